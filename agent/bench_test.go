@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var benchProcs []processInfo
+
+// legacyParsePS is the original split-based parser, kept as a reference for
+// correctness and allocation comparisons.
+func legacyParsePS(out string) []processInfo {
+	var procs []processInfo
+	for i, line := range strings.Split(out, "\n") {
+		if i == 0 || strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 11 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		cpu, _ := strconv.ParseFloat(fields[2], 64)
+		mem, _ := strconv.ParseFloat(fields[3], 64)
+		procs = append(procs, processInfo{
+			PID:     pid,
+			CPU:     cpu,
+			Mem:     mem,
+			Command: fields[10],
+			CmdFull: strings.Join(fields[10:], " "),
+		})
+	}
+	return procs
+}
+
+// syntheticPSOutput returns `ps aux` output with n processes.
+func syntheticPSOutput(n int) string {
+	var b strings.Builder
+	b.WriteString("USER               PID  %CPU %MEM      VSZ    RSS   TT  STAT STARTED      TIME COMMAND\n")
+	for i := 0; i < n; i++ {
+		switch i % 4 {
+		case 0:
+			fmt.Fprintf(&b, "user             %5d   2.5  0.4 412345678  65432   ??  S    10:00AM   0:01.23 /usr/local/bin/node /opt/app/server.js --port %d\n", 1000+i, 3000+i)
+		case 1:
+			fmt.Fprintf(&b, "root             %5d   0.0  0.0 408123456   1234   ??  Ss   9:00AM   0:00.01 /usr/sbin/daemon\n", 1000+i)
+		case 2:
+			fmt.Fprintf(&b, "user             %5d  35.1  2.2 423456789 345678 s001  S+   11:30AM   3:12.45 claude  --resume   abc\n", 1000+i)
+		default:
+			fmt.Fprintf(&b, "user             %5d   1.0  0.1 409876543  12345   ??  S    10:15AM   0:02.00 /Applications/Cursor.app/Contents/MacOS/Cursor Helper (Renderer) --type=renderer\n", 1000+i)
+		}
+	}
+	return b.String()
+}
+
+func BenchmarkParsePSOutput(b *testing.B) {
+	out := syntheticPSOutput(3000)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(out)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchProcs, _ = parsePSOutput(strings.NewReader(out))
+	}
+}
+
+func BenchmarkParsePSOutputLegacySplit(b *testing.B) {
+	out := syntheticPSOutput(3000)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(out)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchProcs = legacyParsePS(out)
+	}
+}
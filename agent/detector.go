@@ -1,8 +1,13 @@
 package agent
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -14,11 +19,32 @@ import (
 type Detector struct {
 	Registry *Registry
 	Config   *config.Config
+	// TokenProbe, if set, reports how token usage for an agent is being
+	// collected (see monitor.TokenMonitor.Probe). Diagnose uses it to flag
+	// running agents whose token collection is not working.
+	TokenProbe func(agentID string) (TokenSource, error)
+
+	listProcs func() ([]processInfo, error)
+	// procRoot, if set, is where processes are listed from instead of ps.
+	procRoot string
+	// listPS, if set, replaces the ps fallback used when procRoot is unset
+	// or unreadable.
+	listPS func() ([]processInfo, error)
 }
 
-// NewDetector creates a new agent detector.
+// NewDetector creates a new agent detector. It modifies registry: the
+// custom agents declared in cfg.Agents are registered in it, replacing
+// definitions with the same ID, so a registry shared between detectors
+// carries the agents of every config it was given.
 func NewDetector(registry *Registry, cfg *config.Config) *Detector {
-	return &Detector{Registry: registry, Config: cfg}
+	if registry != nil && cfg != nil {
+		registry.RegisterFromConfig(cfg.Agents)
+	}
+	d := &Detector{Registry: registry, Config: cfg}
+	if runtime.GOOS == "linux" {
+		d.procRoot = "/proc"
+	}
+	return d
 }
 
 type processInfo struct {
@@ -29,11 +55,12 @@ type processInfo struct {
 	CmdFull string
 }
 
-// Scan lists running processes via "ps aux", matches them against the
+// Scan lists running processes (from /proc on Linux, via "ps aux"
+// elsewhere or if /proc cannot be read), matches them against the
 // registry, and returns one Instance per detected agent. Multiple processes
 // for the same agent are merged (highest CPU, summed memory).
 func (d *Detector) Scan() ([]Instance, error) {
-	procs, err := d.listProcesses()
+	procs, err := d.processes()
 	if err != nil {
 		return nil, fmt.Errorf("listing processes: %w", err)
 	}
@@ -92,44 +119,168 @@ func (d *Detector) Scan() ([]Instance, error) {
 	return result, nil
 }
 
+// Diagnose reports, for every registry entry, whether a matching process is
+// running, which of its log paths exist, and (if TokenProbe is set) whether
+// token collection works. If the process list cannot be read, every agent is
+// reported as not running.
+func (d *Detector) Diagnose() []AgentStatus {
+	running := make(map[string][]int)
+	if procs, err := d.processes(); err == nil {
+		for _, proc := range procs {
+			if d.Config.ShouldIgnoreProcess(proc.CmdFull) {
+				continue
+			}
+			if d.Config.Detection.SkipSystemProcesses && d.Config.IsSystemProcess(proc.CmdFull) {
+				continue
+			}
+			if info := d.matchProcess(proc); info != nil {
+				running[info.ID] = append(running[info.ID], proc.PID)
+			}
+		}
+	}
+
+	agents := d.Registry.all()
+	result := make([]AgentStatus, 0, len(agents))
+	for _, info := range agents {
+		st := AgentStatus{
+			Info:    info,
+			PIDs:    running[info.ID],
+			Running: len(running[info.ID]) > 0,
+		}
+		for _, p := range info.LogPaths {
+			if _, err := os.Stat(p); err == nil {
+				st.LogPathsOK = append(st.LogPathsOK, p)
+			} else {
+				st.LogPathsBad = append(st.LogPathsBad, p)
+			}
+		}
+		if d.TokenProbe != nil {
+			src, err := d.TokenProbe(info.ID)
+			st.TokenSource = src
+			if err != nil {
+				st.TokenError = err.Error()
+			}
+		}
+
+		switch {
+		case d.Config.IsAgentDisabled(info.ID):
+			st.State = DetectionDisabled
+		case !st.Running:
+			st.State = DetectionNotRunning
+		case st.TokenError != "" || (len(info.LogPaths) > 0 && len(st.LogPathsOK) == 0):
+			st.State = DetectionMisconfigured
+		default:
+			st.State = DetectionDetected
+		}
+		result = append(result, st)
+	}
+	return result
+}
+
+func (d *Detector) processes() ([]processInfo, error) {
+	if d.listProcs != nil {
+		return d.listProcs()
+	}
+	if d.procRoot != "" {
+		if procs, err := procListProcesses(d.procRoot); err == nil {
+			return procs, nil
+		}
+	}
+	if d.listPS != nil {
+		return d.listPS()
+	}
+	return d.listProcesses()
+}
+
 func (d *Detector) listProcesses() ([]processInfo, error) {
 	cmd := exec.Command("ps", "aux")
-	out, err := cmd.Output()
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return nil, err
 	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	procs, parseErr := parsePSOutput(stdout)
+	if parseErr != nil {
+		// Drain so ps is not blocked writing to a full pipe.
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+	return procs, parseErr
+}
 
-	lines := strings.Split(string(out), "\n")
-	var procs []processInfo
+// parsePSOutput streams `ps aux` output line by line, skipping the header and
+// lines that do not parse. Only one string per process is allocated.
+func parsePSOutput(r io.Reader) ([]processInfo, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
 
-	for i, line := range lines {
-		if i == 0 || strings.TrimSpace(line) == "" {
+	var procs []processInfo
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
 			continue
 		}
-		proc, err := parsePSLine(line)
+		proc, err := parsePSLine(string(line))
 		if err != nil {
 			continue
 		}
 		procs = append(procs, proc)
 	}
-	return procs, nil
+	return procs, scanner.Err()
 }
 
+// psCmdField is the index of the COMMAND column in `ps aux` output.
+const psCmdField = 10
+
+var errPSFields = errors.New("not enough fields")
+
+// parsePSLine splits a `ps aux` line in place, without building a []string
+// of all fields. CmdFull is the command and its arguments separated by single
+// spaces.
 func parsePSLine(line string) (processInfo, error) {
-	fields := strings.Fields(line)
-	if len(fields) < 11 {
-		return processInfo{}, fmt.Errorf("not enough fields")
+	var start, end [psCmdField + 1]int
+	n, i := 0, 0
+	for n <= psCmdField {
+		for i < len(line) && isPSSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			break
+		}
+		start[n] = i
+		for i < len(line) && !isPSSpace(line[i]) {
+			i++
+		}
+		end[n] = i
+		n++
+	}
+	if n <= psCmdField {
+		return processInfo{}, errPSFields
 	}
 
-	pid, err := strconv.Atoi(fields[1])
+	pid, err := strconv.Atoi(line[start[1]:end[1]])
 	if err != nil {
 		return processInfo{}, err
 	}
 
-	cpu, _ := strconv.ParseFloat(fields[2], 64)
-	mem, _ := strconv.ParseFloat(fields[3], 64)
-	command := fields[10]
-	cmdFull := strings.Join(fields[10:], " ")
+	cpu, _ := strconv.ParseFloat(line[start[2]:end[2]], 64)
+	mem, _ := strconv.ParseFloat(line[start[3]:end[3]], 64)
+	command := line[start[psCmdField]:end[psCmdField]]
+	cmdFull := strings.TrimRightFunc(line[start[psCmdField]:], func(r rune) bool {
+		return r < 0x80 && isPSSpace(byte(r))
+	})
+	if !singleSpaced(cmdFull) {
+		cmdFull = collapseSpaces(cmdFull)
+	}
 
 	return processInfo{
 		PID:     pid,
@@ -140,6 +291,46 @@ func parsePSLine(line string) (processInfo, error) {
 	}, nil
 }
 
+// collapseSpaces is strings.Join(strings.Fields(s), " ") for ASCII
+// whitespace, in a single allocation.
+func collapseSpaces(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for i := 0; i < len(s); i++ {
+		if isPSSpace(s[i]) {
+			space = b.Len() > 0
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func isPSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// singleSpaced reports whether s separates words by exactly one ' '.
+func singleSpaced(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' {
+			if i+1 < len(s) && s[i+1] == ' ' {
+				return false
+			}
+			continue
+		}
+		if isPSSpace(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (d *Detector) matchProcess(proc processInfo) *Info {
 	cmdBase := extractBaseName(proc.Command)
 	if agentInfo := d.Registry.FindByProcess(cmdBase); agentInfo != nil {
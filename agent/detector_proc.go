@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Rafiki81/libagentmetrics/internal/procfs"
+)
+
+// procListProcesses lists the processes in the /proc tree under root with
+// the same values `ps aux` reports: CPU is the average over the process
+// lifetime and Mem the share of total memory, both in percent. Command is
+// the first argument and CmdFull all of them; kernel threads, which have no
+// arguments, show as "[name]" like ps shows them.
+func procListProcesses(root string) ([]processInfo, error) {
+	pids, err := procfs.PIDs(root)
+	if err != nil {
+		return nil, err
+	}
+	uptime, err := procfs.Uptime(root)
+	if err != nil {
+		return nil, err
+	}
+	memTotalKB, err := procfs.MemTotalKB(root)
+	if err != nil {
+		return nil, err
+	}
+	pageKB := float64(os.Getpagesize()) / 1024
+
+	var procs []processInfo
+	for _, pid := range pids {
+		st, err := procfs.ReadStat(root, pid)
+		if err != nil {
+			continue // exited while scanning
+		}
+		cmdline, err := procfs.ReadCmdline(root, pid)
+		if err != nil {
+			continue
+		}
+
+		// Collapse runs of spaces as parsePSLine does for ps output.
+		proc := processInfo{PID: pid, CmdFull: collapseSpaces(cmdline)}
+		if proc.CmdFull == "" {
+			proc.CmdFull = "[" + st.Comm + "]"
+		}
+		proc.Command, _, _ = strings.Cut(proc.CmdFull, " ")
+		if elapsed := uptime - float64(st.StartTicks)/procfs.ClockTicks; elapsed > 0 {
+			proc.CPU = float64(st.CPUTicks) / procfs.ClockTicks / elapsed * 100
+		}
+		if memTotalKB > 0 {
+			proc.Mem = float64(st.RSSPages) * pageKB / memTotalKB * 100
+		}
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
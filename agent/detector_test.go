@@ -1,6 +1,14 @@
 package agent
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/Rafiki81/libagentmetrics/config"
@@ -101,6 +109,44 @@ func TestParsePSLine_CmdFull(t *testing.T) {
 	}
 }
 
+func TestParsePSOutput_MatchesLegacySplit(t *testing.T) {
+	out := syntheticPSOutput(200) +
+		"user 1 0.0\n" + // too few fields
+		"user   abc  5.3  1.2  123456  78900   ??  S    10:00AM   0:01.23 /usr/bin/test\n" +
+		"\n" +
+		"user   77  0.5  0.1  1  2  ??  S  10:00AM  0:00.01 /bin/sh\t-c  'echo  hi'   \r\n"
+
+	got, err := parsePSOutput(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("parsePSOutput: %v", err)
+	}
+	want := legacyParsePS(out)
+	if len(got) != 201 {
+		t.Errorf("parsed %d processes, want 201", len(got))
+	}
+	if !reflect.DeepEqual(got, want) {
+		for i := range want {
+			if i >= len(got) || got[i] != want[i] {
+				t.Fatalf("process %d differs:\n got  %+v\n want %+v", i, got[min(i, len(got)-1)], want[i])
+			}
+		}
+		t.Fatalf("got %d processes, want %d", len(got), len(want))
+	}
+}
+
+func TestParsePSOutput_AllocatesLess(t *testing.T) {
+	out := syntheticPSOutput(1000)
+	streamed := testing.AllocsPerRun(5, func() {
+		benchProcs, _ = parsePSOutput(strings.NewReader(out))
+	})
+	legacy := testing.AllocsPerRun(5, func() {
+		benchProcs = legacyParsePS(out)
+	})
+	if streamed >= legacy {
+		t.Errorf("streaming parse allocs = %.0f, want fewer than split-based %.0f", streamed, legacy)
+	}
+}
+
 func TestExtractBaseName(t *testing.T) {
 	tests := []struct {
 		cmd  string
@@ -202,6 +248,27 @@ func TestMatchProcess_OnlyExactMatch(t *testing.T) {
 	}
 }
 
+func TestNewDetector_RegistersConfigAgents(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents = []config.AgentDef{{Name: "Acme Bot", ID: "acme-bot", ProcessNames: []string{"acme-bot"}}}
+	d := NewDetector(NewRegistry(), cfg)
+	d.listProcs = func() ([]processInfo, error) {
+		return []processInfo{
+			{PID: 10, CPU: 2, Mem: 40, Command: "/opt/acme/bin/acme-bot", CmdFull: "/opt/acme/bin/acme-bot --watch"},
+			{PID: 11, Command: "vim", CmdFull: "vim main.go"},
+		}, nil
+	}
+	cfg.Detection.SkipLsofForDetection = true
+
+	agents, err := d.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Info.ID != "acme-bot" || agents[0].PID != 10 {
+		t.Errorf("Scan() = %+v, want the custom agent", agents)
+	}
+}
+
 func TestScan_ReturnsResult(t *testing.T) {
 	// Scan talks to real processes — verify it doesn't error
 	r := NewRegistry()
@@ -216,3 +283,177 @@ func TestScan_ReturnsResult(t *testing.T) {
 	// We can't guarantee any agents are running, but the slice should not be nil on success
 	_ = agents
 }
+
+func TestDiagnose(t *testing.T) {
+	home := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(home, ".claude", "logs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".aider.logs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Detection.DisabledAgents = []string{"cursor"}
+	d := NewDetector(NewRegistryForHome(home), cfg)
+	d.listProcs = func() ([]processInfo, error) {
+		return []processInfo{
+			{PID: 100, Command: "/usr/local/bin/claude", CmdFull: "/usr/local/bin/claude"},
+			{PID: 101, Command: "/usr/local/bin/claude", CmdFull: "/usr/local/bin/claude --resume"},
+			{PID: 200, Command: "copilot-agent", CmdFull: "copilot-agent --stdio"},
+			{PID: 300, Command: "aider", CmdFull: "aider --model gpt-4o"},
+			{PID: 400, Command: "Cursor", CmdFull: "Cursor"},
+		}, nil
+	}
+	d.TokenProbe = func(id string) (TokenSource, error) {
+		if id == "aider" {
+			return TokenSourceNone, errors.New("no token data")
+		}
+		return TokenSourceLog, nil
+	}
+
+	got := make(map[string]AgentStatus)
+	for _, st := range d.Diagnose() {
+		got[st.Info.ID] = st
+	}
+	if len(got) != len(d.Registry.Agents) {
+		t.Fatalf("Diagnose returned %d statuses, want one per registry entry (%d)", len(got), len(d.Registry.Agents))
+	}
+
+	tests := []struct {
+		id    string
+		state DetectionState
+	}{
+		{"claude-code", DetectionDetected},
+		{"copilot", DetectionMisconfigured}, // log path missing
+		{"aider", DetectionMisconfigured},   // token probe fails
+		{"cursor", DetectionDisabled},
+		{"gemini-cli", DetectionNotRunning},
+	}
+	for _, tt := range tests {
+		if st := got[tt.id]; st.State != tt.state {
+			t.Errorf("%s state = %q, want %q (%+v)", tt.id, st.State, tt.state, st)
+		}
+	}
+
+	claude := got["claude-code"]
+	if !claude.Running || len(claude.PIDs) != 2 {
+		t.Errorf("claude-code running=%v pids=%v, want both PIDs", claude.Running, claude.PIDs)
+	}
+	if len(claude.LogPathsOK) != 1 || len(claude.LogPathsBad) != 1 {
+		t.Errorf("claude-code log paths ok=%v missing=%v", claude.LogPathsOK, claude.LogPathsBad)
+	}
+	if claude.TokenSource != TokenSourceLog {
+		t.Errorf("claude-code token source = %q", claude.TokenSource)
+	}
+	if got["aider"].TokenError == "" {
+		t.Error("aider should report the token probe error")
+	}
+}
+
+func TestDiagnose_ProcessListError(t *testing.T) {
+	d := NewDetector(NewRegistryForHome(t.TempDir()), config.DefaultConfig())
+	d.listProcs = func() ([]processInfo, error) { return nil, errors.New("ps failed") }
+	for _, st := range d.Diagnose() {
+		if st.Running || st.State != DetectionNotRunning {
+			t.Errorf("%s = %+v, want not running when ps fails", st.Info.ID, st)
+		}
+	}
+}
+
+// writeProcTree writes a fake /proc with uptime 1000s, 1000000 kB of memory
+// and the given processes, each started at 500s with rss pages of memory
+// and cpuTicks of CPU time.
+func writeProcTree(t *testing.T, procs []struct {
+	pid                int
+	comm, cmdline      string
+	cpuTicks, rssPages int64
+}) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"uptime":  "1000.00 3500.00\n",
+		"meminfo": "MemTotal:        1000000 kB\nMemFree:          500000 kB\n",
+	}
+	for _, p := range procs {
+		dir := strconv.Itoa(p.pid)
+		files[filepath.Join(dir, "stat")] = fmt.Sprintf(
+			"%d (%s) S 1 %d 0 0 -1 4194304 0 0 0 0 %d 0 0 0 20 0 1 0 50000 0 %d 18446744073709551615\n",
+			p.pid, p.comm, p.pid, p.cpuTicks, p.rssPages)
+		files[filepath.Join(dir, "cmdline")] = p.cmdline
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestProcListProcesses(t *testing.T) {
+	// 100000 kB resident is 10% of memory.
+	pages := int64(100000 * 1024 / os.Getpagesize())
+	root := writeProcTree(t, []struct {
+		pid                int
+		comm, cmdline      string
+		cpuTicks, rssPages int64
+	}{
+		{4242, "claude", "/usr/local/bin/claude\x00--resume\x00  \x00", 2500, pages},
+		{77, "node (main)", "node\x00/opt/copilot-agent/dist/agent.js\x00", 0, 0},
+		{2, "kthreadd", "", 0, 0},
+	})
+
+	procs, err := procListProcesses(root)
+	if err != nil {
+		t.Fatalf("procListProcesses error: %v", err)
+	}
+	byPID := make(map[int]processInfo)
+	for _, p := range procs {
+		byPID[p.PID] = p
+	}
+	if len(byPID) != 3 {
+		t.Fatalf("got %d processes, want 3: %+v", len(procs), procs)
+	}
+
+	// 25s of CPU over the 500s since it started is 5%.
+	claude := byPID[4242]
+	if claude.Command != "/usr/local/bin/claude" || claude.CmdFull != "/usr/local/bin/claude --resume" {
+		t.Errorf("claude = %+v", claude)
+	}
+	if math.Abs(claude.CPU-5) > 1e-9 || math.Abs(claude.Mem-10) > 0.01 {
+		t.Errorf("claude CPU = %v, Mem = %v, want 5 and 10", claude.CPU, claude.Mem)
+	}
+	if k := byPID[2]; k.Command != "[kthreadd]" || k.CmdFull != "[kthreadd]" {
+		t.Errorf("kernel thread = %+v", k)
+	}
+
+	// The listed processes match as they do from ps.
+	d := NewDetector(NewRegistry(), config.DefaultConfig())
+	d.procRoot = root
+	cases := map[int]string{4242: "claude-code", 77: "copilot", 2: ""}
+	for pid, want := range cases {
+		got := d.matchProcess(byPID[pid])
+		if (got == nil) != (want == "") || (got != nil && got.ID != want) {
+			t.Errorf("matchProcess(pid %d) = %v, want %q", pid, got, want)
+		}
+	}
+}
+
+func TestDetector_ProcessesFallsBackToPS(t *testing.T) {
+	d := NewDetector(NewRegistry(), config.DefaultConfig())
+	d.procRoot = filepath.Join(t.TempDir(), "missing")
+	d.listPS = func() ([]processInfo, error) {
+		return []processInfo{{PID: 7, Command: "ps-listed"}}, nil
+	}
+	procs, err := d.processes()
+	if err != nil {
+		t.Fatalf("processes() with an unreadable proc root: %v", err)
+	}
+	if len(procs) != 1 || procs[0].Command != "ps-listed" {
+		t.Errorf("processes() = %+v, want the ps fallback's list", procs)
+	}
+}
@@ -3,17 +3,41 @@ package agent
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Rafiki81/libagentmetrics/config"
 )
 
 // Registry holds all known agent definitions.
+//
+// Its methods are safe for concurrent use, so agents can be registered
+// while a Detector scans. Register never modifies Agents in place but
+// replaces the slice, which keeps Info pointers from FindByProcess and
+// FindByCmdLine valid. Writing to Agents directly is not synchronized and
+// must not overlap with other use of the registry.
 type Registry struct {
 	Agents []Info
+
+	mu sync.RWMutex
+	// custom is the number of registered agents at the front of Agents.
+	custom int
+	// home is where "~/" in registered log paths points; empty means
+	// os.UserHomeDir.
+	home string
 }
 
 // NewRegistry creates a registry populated with known AI coding agents.
 func NewRegistry() *Registry {
 	home, _ := os.UserHomeDir()
+	return NewRegistryForHome(home)
+}
+
+// NewRegistryForHome is like NewRegistry but resolves agent log paths
+// relative to home instead of the current user's home directory.
+func NewRegistryForHome(home string) *Registry {
 	return &Registry{
+		home: home,
 		Agents: []Info{
 			{
 				Name:           "Claude Code",
@@ -127,13 +151,80 @@ func NewRegistry() *Registry {
 	}
 }
 
+// Register adds an agent definition, or replaces the agent with the same ID
+// in place.
+// Registered agents are matched before the built-in ones, in registration
+// order, so an in-house agent whose command line mentions a known agent is
+// still reported as itself.
+func (r *Registry) Register(info Info) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agents := make([]Info, 0, len(r.Agents)+1)
+	for i := range r.Agents {
+		if r.Agents[i].ID == info.ID {
+			agents = append(agents, r.Agents...)
+			agents[i] = info
+			r.Agents = agents
+			return
+		}
+	}
+	agents = append(agents, r.Agents[:r.custom]...)
+	agents = append(agents, info)
+	r.Agents = append(agents, r.Agents[r.custom:]...)
+	r.custom++
+}
+
+// all returns the current agent definitions. The slice is never modified
+// by Register, so it can be read without holding r.mu.
+func (r *Registry) all() []Info {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.Agents
+}
+
+// RegisterFromConfig registers the custom agents declared in the config.
+// Definitions without an ID are skipped, Name defaults to the ID, and a
+// leading "~/" in LogPaths is expanded to the registry's home directory.
+func (r *Registry) RegisterFromConfig(defs []config.AgentDef) {
+	home := r.home
+	if home == "" {
+		home, _ = os.UserHomeDir()
+	}
+	for _, def := range defs {
+		if def.ID == "" {
+			continue
+		}
+		info := Info{
+			Name:           def.Name,
+			ID:             def.ID,
+			ProcessNames:   def.ProcessNames,
+			LogPaths:       make([]string, 0, len(def.LogPaths)),
+			Ports:          def.Ports,
+			Description:    def.Description,
+			DetectPatterns: def.DetectPatterns,
+		}
+		if info.Name == "" {
+			info.Name = def.ID
+		}
+		for _, p := range def.LogPaths {
+			if rest, ok := strings.CutPrefix(p, "~/"); ok && home != "" {
+				p = filepath.Join(home, rest)
+			}
+			info.LogPaths = append(info.LogPaths, p)
+		}
+		r.Register(info)
+	}
+}
+
 // FindByProcess returns the Info for the agent whose ProcessNames list contains
 // processName, or nil if no match is found.
 func (r *Registry) FindByProcess(processName string) *Info {
-	for i, a := range r.Agents {
+	agents := r.all()
+	for i, a := range agents {
 		for _, pname := range a.ProcessNames {
 			if pname == processName {
-				return &r.Agents[i]
+				return &agents[i]
 			}
 		}
 	}
@@ -143,10 +234,11 @@ func (r *Registry) FindByProcess(processName string) *Info {
 // FindByCmdLine returns the Info for the first agent whose DetectPatterns
 // appear as a word in cmdline, or nil if no match is found.
 func (r *Registry) FindByCmdLine(cmdline string) *Info {
-	for i, a := range r.Agents {
+	agents := r.all()
+	for i, a := range agents {
 		for _, pattern := range a.DetectPatterns {
 			if containsWord(cmdline, pattern) {
-				return &r.Agents[i]
+				return &agents[i]
 			}
 		}
 	}
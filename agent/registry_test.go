@@ -1,6 +1,13 @@
 package agent
 
-import "testing"
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Rafiki81/libagentmetrics/config"
+)
 
 func TestNewRegistry(t *testing.T) {
 	r := NewRegistry()
@@ -232,3 +239,104 @@ func TestRegistryWithCustomAgents(t *testing.T) {
 		t.Errorf("found.ID = %q, want 'test-agent'", found.ID)
 	}
 }
+
+func TestNewRegistryForHome(t *testing.T) {
+	home := filepath.Join("home", "other")
+	r := NewRegistryForHome(home)
+	if len(r.Agents) != len(NewRegistry().Agents) {
+		t.Fatalf("NewRegistryForHome has %d agents, want %d", len(r.Agents), len(NewRegistry().Agents))
+	}
+	for _, a := range r.Agents {
+		if a.ID != "claude-code" {
+			continue
+		}
+		want := filepath.Join(home, ".claude", "logs")
+		if len(a.LogPaths) == 0 || a.LogPaths[0] != want {
+			t.Errorf("claude-code LogPaths = %v, want first %q", a.LogPaths, want)
+		}
+		return
+	}
+	t.Fatal("claude-code missing from registry")
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry()
+	r.Register(Info{Name: "Acme Bot", ID: "acme-bot", ProcessNames: []string{"acme-bot"}, DetectPatterns: []string{"acme-bot"}})
+	r.Register(Info{Name: "Second", ID: "second", ProcessNames: []string{"second"}})
+
+	if len(r.Agents) != 14 || r.Agents[0].ID != "acme-bot" || r.Agents[1].ID != "second" {
+		t.Fatalf("custom agents not first in registration order: %d agents, first %q, %q", len(r.Agents), r.Agents[0].ID, r.Agents[1].ID)
+	}
+	if got := r.FindByProcess("acme-bot"); got == nil || got.ID != "acme-bot" {
+		t.Errorf("FindByProcess(acme-bot) = %v", got)
+	}
+	// The custom agent wins over the built-in claude pattern.
+	if got := r.FindByCmdLine("python -m acme-bot --backend claude"); got == nil || got.ID != "acme-bot" {
+		t.Errorf("FindByCmdLine = %v, want acme-bot", got)
+	}
+
+	// Same ID replaces in place.
+	r.Register(Info{Name: "Aider (fork)", ID: "aider", ProcessNames: []string{"aider-fork"}})
+	if len(r.Agents) != 14 {
+		t.Errorf("re-registering aider added an agent: %d agents", len(r.Agents))
+	}
+	if got := r.FindByProcess("aider-fork"); got == nil || got.Name != "Aider (fork)" {
+		t.Errorf("FindByProcess(aider-fork) = %v", got)
+	}
+	if got := r.FindByProcess("aider"); got != nil {
+		t.Errorf("replaced aider definition still matches: %v", got)
+	}
+}
+
+func TestRegistry_RegisterFromConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", t.TempDir()) // the registry's home wins over $HOME
+
+	r := NewRegistryForHome(home)
+	r.RegisterFromConfig([]config.AgentDef{
+		{ID: "acme-bot", DetectPatterns: []string{"acme_agent.py"}, LogPaths: []string{"~/.acme/logs", "/var/log/acme"}},
+		{Name: "no id", ProcessNames: []string{"ghost"}},
+	})
+
+	got := r.FindByCmdLine("python3 /opt/acme/acme_agent.py --serve")
+	if got == nil || got.ID != "acme-bot" {
+		t.Fatalf("FindByCmdLine = %v, want acme-bot", got)
+	}
+	if got.Name != "acme-bot" {
+		t.Errorf("Name = %q, want the ID", got.Name)
+	}
+	want := []string{filepath.Join(home, ".acme", "logs"), "/var/log/acme"}
+	if len(got.LogPaths) != 2 || got.LogPaths[0] != want[0] || got.LogPaths[1] != want[1] {
+		t.Errorf("LogPaths = %v, want %v", got.LogPaths, want)
+	}
+	if r.FindByProcess("ghost") != nil {
+		t.Error("definition without an ID was registered")
+	}
+}
+
+func TestRegistry_RegisterDuringLookups(t *testing.T) {
+	r := NewRegistry()
+	claude := r.FindByProcess("claude")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			r.Register(Info{ID: fmt.Sprintf("bot-%d", i), ProcessNames: []string{fmt.Sprintf("bot-%d", i)}})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		r.FindByCmdLine("python agent.py")
+		r.FindByProcess("bot-50")
+	}
+	wg.Wait()
+
+	if got := r.FindByProcess("bot-99"); got == nil || got.ID != "bot-99" {
+		t.Errorf("FindByProcess(bot-99) = %v", got)
+	}
+	// Earlier lookups keep pointing at the agent they found.
+	if claude.ID != "claude-code" {
+		t.Errorf("pointer from before Register now has ID %q", claude.ID)
+	}
+}
@@ -26,6 +26,20 @@ func (s Status) String() string {
 	}
 }
 
+// ActivityState classifies what a running agent is doing, beyond its
+// process being alive.
+type ActivityState string
+
+const (
+	// ActivityWorking means the agent is making observable progress:
+	// model requests, terminal commands or file changes.
+	ActivityWorking ActivityState = "WORKING"
+	// ActivityIdle means the agent is quiet and not using CPU.
+	ActivityIdle ActivityState = "IDLE"
+	// ActivityStalled means the agent is burning CPU without progress.
+	ActivityStalled ActivityState = "STALLED"
+)
+
 // Info holds metadata about a known agent type.
 type Info struct {
 	Name           string
@@ -49,29 +63,82 @@ const (
 	TokenSourceLocalAPI  TokenSource = "local_api"
 )
 
-// TokenMetrics holds token usage data for an agent.
+// TokenMetrics holds token usage data for an agent. Prompt-cache tokens
+// (CacheReadTokens, CacheCreateTokens) are reported separately from
+// InputTokens and are not included in TotalTokens. TokensPerSec is the
+// growth of TotalTokens per second over the last minute.
 type TokenMetrics struct {
-	InputTokens   int64       `json:"input_tokens"`
-	OutputTokens  int64       `json:"output_tokens"`
-	TotalTokens   int64       `json:"total_tokens"`
-	TokensPerSec  float64     `json:"tokens_per_sec"`
-	RequestCount  int         `json:"request_count"`
-	LastModel     string      `json:"last_model"`
-	Source        TokenSource `json:"source"`
-	Confidence    float64     `json:"confidence"`
-	LastRequestAt time.Time   `json:"last_request_at"`
-	EstCost       float64     `json:"est_cost"`
-	AvgLatencyMs  int64       `json:"avg_latency_ms"`
+	InputTokens       int64       `json:"input_tokens"`
+	OutputTokens      int64       `json:"output_tokens"`
+	TotalTokens       int64       `json:"total_tokens"`
+	CacheReadTokens   int64       `json:"cache_read_tokens,omitempty"`
+	CacheCreateTokens int64       `json:"cache_create_tokens,omitempty"`
+	TokensPerSec      float64     `json:"tokens_per_sec"`
+	RequestCount      int         `json:"request_count"`
+	SuccessCount      int         `json:"success_count"`
+	ErrorCount        int         `json:"error_count"`
+	LastModel         string      `json:"last_model"`
+	Source            TokenSource `json:"source"`
+	Confidence        float64     `json:"confidence"`
+	LastRequestAt     time.Time   `json:"last_request_at"`
+	EstCost           float64     `json:"est_cost"`
+	CostToday         float64     `json:"cost_today"`
+	AvgLatencyMs      int64       `json:"avg_latency_ms"`
+}
+
+// ErrorRate returns the fraction (0-1) of requests with a known outcome that
+// failed, or 0 when no outcomes have been seen.
+func (m TokenMetrics) ErrorRate() float64 {
+	total := m.SuccessCount + m.ErrorCount
+	if total == 0 {
+		return 0
+	}
+	return float64(m.ErrorCount) / float64(total)
+}
+
+// DetectionState summarizes an agent's state in a Detector.Diagnose report.
+type DetectionState string
+
+const (
+	DetectionDetected      DetectionState = "detected"
+	DetectionNotRunning    DetectionState = "not_running"
+	DetectionMisconfigured DetectionState = "misconfigured"
+	DetectionDisabled      DetectionState = "disabled"
+)
+
+// AgentStatus is the diagnostic status of one registry entry.
+type AgentStatus struct {
+	Info        Info           `json:"info"`
+	State       DetectionState `json:"state"`
+	Running     bool           `json:"running"`
+	PIDs        []int          `json:"pids,omitempty"`
+	LogPathsOK  []string       `json:"log_paths_ok,omitempty"`
+	LogPathsBad []string       `json:"log_paths_missing,omitempty"`
+	TokenSource TokenSource    `json:"token_source,omitempty"`
+	TokenError  string         `json:"token_error,omitempty"`
 }
 
 // GitActivity holds git-related metrics for an agent's working directory.
+// SessionCommits counts commits made on top of the HEAD first seen by the
+// GitMonitor for that directory; NewCommits counts those made since the
+// previous collection. Uncommitted counts every changed or untracked file;
+// Staged and Untracked break out those with index changes and those not
+// tracked at all. Ahead and Behind compare HEAD with its upstream
+// branch and are zero when there is none.
 type GitActivity struct {
-	Branch        string      `json:"branch"`
-	RecentCommits []GitCommit `json:"recent_commits"`
-	Uncommitted   int         `json:"uncommitted"`
-	LinesAdded    int         `json:"lines_added"`
-	LinesRemoved  int         `json:"lines_removed"`
-	FilesChanged  int         `json:"files_changed"`
+	Branch         string      `json:"branch"`
+	RecentCommits  []GitCommit `json:"recent_commits"`
+	Uncommitted    int         `json:"uncommitted"`
+	LinesAdded     int         `json:"lines_added"`
+	LinesRemoved   int         `json:"lines_removed"`
+	FilesChanged   int         `json:"files_changed"`
+	DiffTruncated  bool        `json:"diff_truncated"`
+	SessionCommits int         `json:"session_commits"`
+	NewCommits     int         `json:"new_commits"`
+	Untracked      int         `json:"untracked"`
+	Staged         int         `json:"staged"`
+	Ahead          int         `json:"ahead"`
+	Behind         int         `json:"behind"`
 }
 
 // GitCommit represents a single git commit.
@@ -88,11 +155,14 @@ type TerminalActivity struct {
 	TotalCommands  int               `json:"total_commands"`
 }
 
-// TerminalCommand represents a detected terminal command.
+// TerminalCommand represents a detected terminal command. Count is how many
+// consecutive identical runs the entry stands for when the terminal monitor
+// deduplicates; Timestamp is then the start of the latest run.
 type TerminalCommand struct {
 	Command   string    `json:"command"`
 	Timestamp time.Time `json:"timestamp"`
 	Category  string    `json:"category"`
+	Count     int       `json:"count,omitempty"`
 }
 
 // SessionMetrics holds session timing data.
@@ -112,21 +182,38 @@ type LOCMetrics struct {
 	Files   int `json:"files_modified"`
 }
 
-// FileOperation represents a file change detected.
+// FileOperation represents a file change detected. Op is CREATE, MODIFY,
+// DELETE or RENAME; for a RENAME, OldPath holds the previous path.
 type FileOperation struct {
 	Timestamp time.Time `json:"timestamp"`
 	Path      string    `json:"path"`
 	Op        string    `json:"op"`
+	OldPath   string    `json:"old_path,omitempty"`
 }
 
-// NetConnection represents a network connection.
+// NetConnection represents a network connection. RemoteHost is the reverse
+// DNS name of the remote address, set only when the network monitor has a
+// resolver configured.
 type NetConnection struct {
 	LocalAddr  string `json:"local_addr"`
 	RemoteAddr string `json:"remote_addr"`
+	RemoteHost string `json:"remote_host,omitempty"`
 	State      string `json:"state"`
 	Protocol   string `json:"protocol"`
 }
 
+// ChildProcess is a descendant of an agent process. Detached is set when the
+// child left the agent's process tree (reparented after its parent exited)
+// or started its own session without a terminal, as nohup, setsid and
+// disown do.
+type ChildProcess struct {
+	PID      int           `json:"pid"`
+	PPID     int           `json:"ppid"`
+	Command  string        `json:"command"`
+	Elapsed  time.Duration `json:"elapsed"`
+	Detached bool          `json:"detached"`
+}
+
 // AlertLevel represents severity of an alert.
 type AlertLevel string
 
@@ -137,13 +224,24 @@ const (
 	AlertSecurity AlertLevel = "SECURITY"
 )
 
-// Alert represents a triggered alert.
+// Alert represents a triggered alert. ID is unique within the AlertMonitor
+// that raised it.
 type Alert struct {
-	Timestamp time.Time  `json:"timestamp"`
-	Level     AlertLevel `json:"level"`
-	AgentID   string     `json:"agent_id"`
-	AgentName string     `json:"agent_name"`
-	Message   string     `json:"message"`
+	ID        uint64            `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Level     AlertLevel        `json:"level"`
+	Type      string            `json:"type,omitempty"`
+	AgentID   string            `json:"agent_id"`
+	AgentName string            `json:"agent_name"`
+	Message   string            `json:"message"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	// Resolved is set once the condition that raised the alert has cleared,
+	// at ResolvedAt.
+	Resolved   bool      `json:"resolved,omitempty"`
+	ResolvedAt time.Time `json:"resolved_at,omitzero"`
+	// Acknowledged is set by AlertMonitor.AcknowledgeByID once a user has
+	// seen the alert.
+	Acknowledged bool `json:"acknowledged,omitempty"`
 }
 
 // SecurityCategory categorizes the type of security event.
@@ -168,6 +266,12 @@ const (
 	SecCatLogTampering     SecurityCategory = "log_tampering"
 	SecCatRemoteAccess     SecurityCategory = "remote_access"
 	SecCatShellPersistence SecurityCategory = "shell_persistence"
+	SecCatReverseTunnel    SecurityCategory = "reverse_tunnel"
+	SecCatRansomware       SecurityCategory = "ransomware"
+	SecCatBackgroundDaemon SecurityCategory = "background_daemon"
+	// SecCatCustom is used for events from caller-registered rules that do
+	// not set a category.
+	SecCatCustom SecurityCategory = "custom"
 )
 
 // SecuritySeverity indicates how dangerous the event is.
@@ -182,15 +286,16 @@ const (
 
 // SecurityEvent represents a detected security-relevant action by an agent.
 type SecurityEvent struct {
-	Timestamp   time.Time        `json:"timestamp"`
-	AgentID     string           `json:"agent_id"`
-	AgentName   string           `json:"agent_name"`
-	Category    SecurityCategory `json:"category"`
-	Severity    SecuritySeverity `json:"severity"`
-	Description string           `json:"description"`
-	Detail      string           `json:"detail"`
-	Blocked     bool             `json:"blocked"`
-	Rule        string           `json:"rule"`
+	Timestamp   time.Time         `json:"timestamp"`
+	AgentID     string            `json:"agent_id"`
+	AgentName   string            `json:"agent_name"`
+	Category    SecurityCategory  `json:"category"`
+	Severity    SecuritySeverity  `json:"severity"`
+	Description string            `json:"description"`
+	Detail      string            `json:"detail"`
+	Blocked     bool              `json:"blocked"`
+	Rule        string            `json:"rule"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
 }
 
 // LocalModelStatus represents the status of a locally running model.
@@ -218,12 +323,16 @@ type LocalModelInfo struct {
 	VRAM_MB     float64          `json:"vram_mb"`
 	UptimeStr   string           `json:"uptime"`
 	LastSeen    time.Time        `json:"last_seen"`
+	// ExpiresAt is when ActiveModel will be unloaded, if known.
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 
 	TotalRequests     int64   `json:"total_requests"`
+	PromptTokens      int64   `json:"prompt_tokens,omitempty"`
 	TokensGenerated   int64   `json:"tokens_generated"`
 	TokensPerSec      float64 `json:"tokens_per_sec"`
 	AvgLatencyMs      int64   `json:"avg_latency_ms"`
 	ActiveConnections int     `json:"active_connections"`
+	GPUUtilPercent    float64 `json:"gpu_util_percent,omitempty"` // busiest GPU the server runs on
 }
 
 // LocalModel represents a single model available on a local server.
@@ -236,6 +345,9 @@ type LocalModel struct {
 	Parameters string  `json:"parameters"`
 	Running    bool    `json:"running"`
 	VRAM_MB    float64 `json:"vram_mb"`
+	// ExpiresAt is when a running model will be unloaded, if the server
+	// reports it (Ollama's keep-alive).
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
 }
 
 // Instance represents a running or detected agent instance.
@@ -243,15 +355,20 @@ type Instance struct {
 	Info           Info
 	PID            int
 	Status         Status
+	Activity       ActivityState
 	StartTime      time.Time
 	LastSeen       time.Time
 	CPU            float64
 	Memory         float64
+	OpenFiles      int
 	CmdLine        string
 	WorkDir        string
+	ProjectName    string
 	LogLines       []string
 	FileOps        []FileOperation
 	NetConns       []NetConnection
+	Children       []ChildProcess
+	ForkRate       float64
 	Tokens         TokenMetrics
 	Git            GitActivity
 	Terminal       TerminalActivity
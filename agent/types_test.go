@@ -1,6 +1,11 @@
 package agent
 
-import "testing"
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
 
 func TestStatus_String(t *testing.T) {
 	tests := []struct {
@@ -142,6 +147,28 @@ func TestLocalModelStatusConstants(t *testing.T) {
 	}
 }
 
+func TestLocalModelInfo_ExpiresAtOmittedWhenUnknown(t *testing.T) {
+	info := LocalModelInfo{ServerID: "vllm", Models: []LocalModel{{Name: "m"}}}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "expires_at") {
+		t.Errorf("JSON = %s, want no expires_at for an unknown expiry", data)
+	}
+
+	expires := time.Date(2026, 3, 10, 9, 5, 0, 0, time.UTC)
+	info.ExpiresAt = expires
+	info.Models[0].ExpiresAt = expires
+	data, err = json.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"expires_at":"2026-03-10T09:05:00Z"`); n != 2 {
+		t.Errorf("JSON = %s, want expires_at on the server and the model", data)
+	}
+}
+
 func TestInstanceZeroValue(t *testing.T) {
 	var inst Instance
 	if inst.PID != 0 {
@@ -182,3 +209,21 @@ func TestSnapshotZeroValue(t *testing.T) {
 		t.Errorf("zero Snapshot.Timestamp should be zero")
 	}
 }
+
+func TestTokenMetrics_ErrorRate(t *testing.T) {
+	tests := []struct {
+		success, errors int
+		want            float64
+	}{
+		{0, 0, 0},
+		{10, 0, 0},
+		{3, 1, 0.25},
+		{0, 4, 1},
+	}
+	for _, tt := range tests {
+		m := TokenMetrics{SuccessCount: tt.success, ErrorCount: tt.errors}
+		if got := m.ErrorRate(); got != tt.want {
+			t.Errorf("ErrorRate(%d ok, %d err) = %v, want %v", tt.success, tt.errors, got, tt.want)
+		}
+	}
+}
@@ -4,8 +4,12 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -44,6 +48,66 @@ func (d Duration) Duration() time.Duration {
 	return time.Duration(d)
 }
 
+// MemorySize is an amount of memory stored in megabytes. In JSON it accepts
+// a plain number of MB or a string with a unit (e.g. "512MB", "1.5GB",
+// "2GiB"); units are binary, so 1GB is 1024MB.
+type MemorySize float64
+
+// ParseMemorySize parses a size such as "800", "800MB", "1.5 GB" or "2g".
+// A bare number is taken as megabytes.
+func ParseMemorySize(s string) (MemorySize, error) {
+	str := strings.TrimSpace(s)
+	i := len(str)
+	for i > 0 && (str[i-1] < '0' || str[i-1] > '9') && str[i-1] != '.' {
+		i--
+	}
+	num, unit := strings.TrimSpace(str[:i]), strings.ToLower(strings.TrimSpace(str[i:]))
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid memory size: %q", s)
+	}
+	scale, ok := memoryUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid memory unit in %q", s)
+	}
+	return MemorySize(v * scale), nil
+}
+
+// memoryUnits maps a unit suffix to its size in MB.
+var memoryUnits = map[string]float64{
+	"b": 1.0 / (1024 * 1024),
+	"k": 1.0 / 1024, "kb": 1.0 / 1024, "kib": 1.0 / 1024,
+	"": 1, "m": 1, "mb": 1, "mib": 1,
+	"g": 1024, "gb": 1024, "gib": 1024,
+	"t": 1024 * 1024, "tb": 1024 * 1024, "tib": 1024 * 1024,
+}
+
+// UnmarshalJSON decodes a size from a number of MB or a string with a unit.
+func (m *MemorySize) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch val := v.(type) {
+	case string:
+		size, err := ParseMemorySize(val)
+		if err != nil {
+			return err
+		}
+		*m = size
+	case float64:
+		*m = MemorySize(val)
+	default:
+		return fmt.Errorf("invalid memory size: %v", v)
+	}
+	return nil
+}
+
+// MB returns the size in megabytes.
+func (m MemorySize) MB() float64 {
+	return float64(m)
+}
+
 // Config holds the full application configuration.
 type Config struct {
 	RefreshInterval Duration          `json:"refresh_interval"`
@@ -56,6 +120,34 @@ type Config struct {
 	Display         DisplayConfig     `json:"display"`
 	Keybindings     KeyConfig         `json:"keybindings"`
 	Monitor         MonitorConfig     `json:"monitor"`
+	// Pricing overrides the built-in model prices, keyed by model name or
+	// a substring of it (e.g. "gpt-4o", "claude-sonnet").
+	Pricing map[string]ModelPriceConfig `json:"pricing,omitempty"`
+	// Agents declares custom agents to detect alongside the built-in ones.
+	Agents []AgentDef `json:"agents,omitempty"`
+}
+
+// AgentDef declares a custom agent, e.g.
+// {"id": "acme-bot", "process_names": ["acme-bot"], "detect_patterns": ["acme-bot"]}.
+// ProcessNames match the executable name exactly; DetectPatterns match
+// anywhere in the command line. LogPaths may start with "~/".
+type AgentDef struct {
+	Name           string   `json:"name,omitempty"`
+	ID             string   `json:"id"`
+	ProcessNames   []string `json:"process_names,omitempty"`
+	DetectPatterns []string `json:"detect_patterns,omitempty"`
+	LogPaths       []string `json:"log_paths,omitempty"`
+	Ports          []int    `json:"ports,omitempty"`
+	Description    string   `json:"description,omitempty"`
+}
+
+// ModelPriceConfig is the price of a model in USD per 1M tokens.
+// CachedInputPer1M is the price of prompt-cache reads; zero derives it
+// from InputPer1M.
+type ModelPriceConfig struct {
+	InputPer1M       float64 `json:"input_per_1m"`
+	OutputPer1M      float64 `json:"output_per_1m"`
+	CachedInputPer1M float64 `json:"cached_input_per_1m,omitempty"`
 }
 
 // DetectionConfig controls how agents are detected.
@@ -69,24 +161,75 @@ type DetectionConfig struct {
 }
 
 // AlertConfig controls alert thresholds and behavior.
+// SecurityCategories maps security categories (e.g. "reverse_shell") to
+// whether their events raise SECURITY alerts, overriding SecurityMinSeverity.
 type AlertConfig struct {
-	Enabled           bool    `json:"enabled"`
-	CPUWarning        float64 `json:"cpu_warning"`
-	CPUCritical       float64 `json:"cpu_critical"`
-	MemoryWarning     float64 `json:"memory_warning_mb"`
-	MemoryCritical    float64 `json:"memory_critical_mb"`
-	TokenWarning      int64   `json:"token_warning"`
-	TokenCritical     int64   `json:"token_critical"`
-	CostWarning       float64 `json:"cost_warning_usd"`
-	CostCritical      float64 `json:"cost_critical_usd"`
-	DailyBudgetUSD    float64 `json:"daily_budget_usd"`
-	MonthlyBudgetUSD  float64 `json:"monthly_budget_usd"`
-	BudgetWarnPercent float64 `json:"budget_warn_percent"`
-	BurnRateWarning   float64 `json:"burn_rate_warning"`
-	BurnRateCritical  float64 `json:"burn_rate_critical"`
-	IdleMinutes       int     `json:"idle_minutes"`
-	CooldownMinutes   int     `json:"cooldown_minutes"`
-	MaxAlerts         int     `json:"max_alerts"`
+	Enabled               bool              `json:"enabled"`
+	CPUWarning            float64           `json:"cpu_warning"`
+	CPUCritical           float64           `json:"cpu_critical"`
+	MemoryWarning         float64           `json:"memory_warning_mb"`
+	MemoryCritical        float64           `json:"memory_critical_mb"`
+	MemoryWarningPercent  float64           `json:"memory_warning_percent"`
+	MemoryCriticalPercent float64           `json:"memory_critical_percent"`
+	TokenWarning          int64             `json:"token_warning"`
+	TokenCritical         int64             `json:"token_critical"`
+	CostWarning           float64           `json:"cost_warning_usd"`
+	CostCritical          float64           `json:"cost_critical_usd"`
+	DailyBudgetUSD        float64           `json:"daily_budget_usd"`
+	MonthlyBudgetUSD      float64           `json:"monthly_budget_usd"`
+	BudgetWarnPercent     float64           `json:"budget_warn_percent"`
+	BurnRateWarning       float64           `json:"burn_rate_warning"`
+	BurnRateCritical      float64           `json:"burn_rate_critical"`
+	TokensPerMin          int               `json:"tokens_per_min"`
+	CostPerHour           float64           `json:"cost_per_hour_usd"`
+	ErrorRate             float64           `json:"error_rate"`
+	CostPerCommit         float64           `json:"cost_per_commit_usd"`
+	NoCommitSpendUSD      float64           `json:"no_commit_spend_usd"`
+	NoCommitWindowMinutes int               `json:"no_commit_window_minutes"`
+	SecurityMinSeverity   string            `json:"security_min_severity"`
+	SecurityCategories    map[string]bool   `json:"security_alert_categories,omitempty"`
+	ForkRateWarning       float64           `json:"fork_rate_warning"`
+	ForkRateCritical      float64           `json:"fork_rate_critical"`
+	TokensPerSecWarning   float64           `json:"tokens_per_sec_warning"`
+	TokensPerSecCritical  float64           `json:"tokens_per_sec_critical"`
+	IdleMinutes           int               `json:"idle_minutes"`
+	CooldownMinutes       int               `json:"cooldown_minutes"`
+	MaxAlerts             int               `json:"max_alerts"`
+	Rules                 []AlertRuleConfig `json:"rules,omitempty"`
+}
+
+// UnmarshalJSON decodes an AlertConfig, also accepting memory_warning_mb
+// and memory_critical_mb as strings with a unit (see MemorySize). The
+// fields still hold megabytes.
+func (a *AlertConfig) UnmarshalJSON(b []byte) error {
+	type plain AlertConfig
+	aux := struct {
+		*plain
+		MemoryWarning  MemorySize `json:"memory_warning_mb"`
+		MemoryCritical MemorySize `json:"memory_critical_mb"`
+	}{
+		plain:          (*plain)(a),
+		MemoryWarning:  MemorySize(a.MemoryWarning),
+		MemoryCritical: MemorySize(a.MemoryCritical),
+	}
+	if err := json.Unmarshal(b, &aux); err != nil {
+		return err
+	}
+	a.MemoryWarning, a.MemoryCritical = aux.MemoryWarning.MB(), aux.MemoryCritical.MB()
+	return nil
+}
+
+// AlertRuleConfig is a user-defined metric rule, e.g.
+// {"metric": "open_files", "operator": ">", "threshold": 1000, "level": "WARNING", "duration": "1m"}.
+type AlertRuleConfig struct {
+	Name      string   `json:"name,omitempty"`
+	Metric    string   `json:"metric"`
+	Operator  string   `json:"operator"`
+	Threshold float64  `json:"threshold"`
+	Level     string   `json:"level,omitempty"`
+	Duration  Duration `json:"duration,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Group     string   `json:"group,omitempty"`
 }
 
 // ThemeConfig controls UI colors (hex values).
@@ -104,10 +247,45 @@ type ThemeConfig struct {
 }
 
 // ExportConfig controls history export settings.
+// Formats, when non-empty, takes precedence over the single Format field.
 type ExportConfig struct {
-	Format     string `json:"format"`
-	Directory  string `json:"directory"`
-	MaxHistory int    `json:"max_history"`
+	Format     string     `json:"format"`
+	Formats    []string   `json:"formats,omitempty"`
+	Directory  string     `json:"directory"`
+	MaxHistory int        `json:"max_history"`
+	Push       PushConfig `json:"push"`
+}
+
+// PushConfig controls pushing snapshots to a team collector. Token is sent
+// as a bearer token. MachineID defaults to the hostname and User to $USER.
+type PushConfig struct {
+	Enabled   bool     `json:"enabled"`
+	URL       string   `json:"url"`
+	Token     string   `json:"token,omitempty"`
+	MachineID string   `json:"machine_id,omitempty"`
+	User      string   `json:"user,omitempty"`
+	Interval  Duration `json:"interval"`
+}
+
+// ExportFormats returns the list of export formats to produce on each
+// export. It prefers Formats and falls back to the legacy Format field.
+// Entries are lower-cased, trimmed and deduplicated.
+func (e ExportConfig) ExportFormats() []string {
+	src := e.Formats
+	if len(src) == 0 && e.Format != "" {
+		src = []string{e.Format}
+	}
+	seen := make(map[string]bool, len(src))
+	var formats []string
+	for _, f := range src {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		formats = append(formats, f)
+	}
+	return formats
 }
 
 // DisplayConfig controls which sections appear in the dashboard.
@@ -136,18 +314,29 @@ type KeyConfig struct {
 	Toggle  string `json:"toggle"`
 }
 
-// MonitorConfig controls monitor subsystem parameters.
+// MonitorConfig controls monitor subsystem parameters. BuildTools, when
+// set, replaces the commands whose child processes are ignored by the fork
+// rate check.
 type MonitorConfig struct {
 	MaxLogLines     int      `json:"max_log_lines"`
 	MaxFileOps      int      `json:"max_file_ops"`
 	MaxTermCommands int      `json:"max_terminal_commands"`
 	WatchDirs       []string `json:"watch_dirs"`
+	BuildTools      []string `json:"build_tools,omitempty"`
 }
 
-// LocalModelsConfig controls local model server monitoring.
+// LocalModelsConfig controls local model server monitoring. Timeout bounds
+// each HTTP request to a server (2s if unset); servers are probed
+// concurrently, so one slow server does not delay the others. GPUMetrics
+// reads each server's GPU utilization from nvidia-smi when it is installed.
+// A server that does not respond is not probed again until RetryInterval
+// has passed (30s if unset, every cycle if negative).
 type LocalModelsConfig struct {
-	Enabled   bool                 `json:"enabled"`
-	Endpoints []LocalModelEndpoint `json:"endpoints"`
+	Enabled       bool                 `json:"enabled"`
+	Endpoints     []LocalModelEndpoint `json:"endpoints"`
+	Timeout       Duration             `json:"timeout,omitempty"`
+	GPUMetrics    bool                 `json:"gpu_metrics,omitempty"`
+	RetryInterval Duration             `json:"retry_interval,omitempty"`
 }
 
 // LocalModelEndpoint defines a custom local model server.
@@ -158,9 +347,47 @@ type LocalModelEndpoint struct {
 }
 
 // SecurityConfig controls security monitoring and alerting.
+//
+// Command and path patterns match as case-insensitive substrings, except
+// those containing a ".*" or ".+" wildcard, which are regular expressions
+// (so a literal "|" must be escaped as "\|").
+//
+// The MassRewrite* settings drive the ransomware heuristic: it fires when at
+// least MassRewriteThreshold files written within MassRewriteWindow look
+// encrypted, either by content entropy (RewriteEntropyBits, in bits per byte)
+// or by gaining one of RansomwareExtensions or a new extension in place of
+// the original file. A threshold of 0 disables it.
+//
+// DaemonMinAge is how long a detached child of an agent may keep running
+// before it is reported as a background daemon; 0 disables the check.
+//
+// EscalationWindow correlates privilege escalation with persistence: a
+// later command matching PersistenceCommands, or a shell persistence file
+// write, within this long after an escalation command raises a critical
+// event; 0 disables it.
+//
+// ScanFileContents opts in to reading small text files the agent creates or
+// modifies under its WorkDir, up to SecretScanMaxBytes, and flagging tokens
+// that look like credentials: known key formats, or strings whose Shannon
+// entropy reaches SecretEntropyBits per character.
+//
+// DedupWindow suppresses repeats of an event (same agent, rule and detail)
+// within this long of the previous one; 0 disables deduplication, so every
+// check re-reports what it still sees.
+//
+// Commands matching AllowedCommands raise no command-based events at all.
+// A chained command is allowed only if each of its ";", "&&", "||" or "|"
+// segments matches on its own; literal entries must start the segment and
+// regexp entries follow the same rules as the other patterns.
+//
+// SeverityOverrides replaces the built-in severity of matching events. Keys
+// are a full rule ("system_modify:crontab") or a category
+// ("system_modify"); a rule key wins over its category. Values are LOW,
+// MEDIUM, HIGH or CRITICAL.
 type SecurityConfig struct {
 	Enabled                  bool     `json:"enabled"`
 	BlockDangerousCommands   bool     `json:"block_dangerous_commands"`
+	AllowedCommands          []string `json:"allowed_commands,omitempty"`
 	DangerousCommands        []string `json:"dangerous_commands"`
 	SensitiveFiles           []string `json:"sensitive_files"`
 	SuspiciousHosts          []string `json:"suspicious_hosts"`
@@ -173,11 +400,54 @@ type SecurityConfig struct {
 	ContainerEscapePatterns  []string `json:"container_escape_patterns"`
 	EnvManipulationPatterns  []string `json:"env_manipulation_patterns"`
 	CredentialAccessPatterns []string `json:"credential_access_patterns"`
+	BrowserProfilePaths      []string `json:"browser_profile_paths"`
 	LogTamperingPatterns     []string `json:"log_tampering_patterns"`
 	RemoteAccessPatterns     []string `json:"remote_access_patterns"`
+	ReverseTunnelPatterns    []string `json:"reverse_tunnel_patterns"`
 	ShellPersistenceFiles    []string `json:"shell_persistence_files"`
+	PersistenceCommands      []string `json:"persistence_commands"`
 	MassDeletionThreshold    int      `json:"mass_deletion_threshold"`
+	MassRewriteThreshold     int      `json:"mass_rewrite_threshold"`
+	MassRewriteWindow        Duration `json:"mass_rewrite_window"`
+	RewriteEntropyBits       float64  `json:"rewrite_entropy_bits"`
+	ScanFileContents         bool     `json:"scan_file_contents"`
+	SecretScanMaxBytes       int      `json:"secret_scan_max_bytes"`
+	SecretEntropyBits        float64  `json:"secret_entropy_bits"`
+	RansomwareExtensions     []string `json:"ransomware_extensions"`
+	DaemonMinAge             Duration `json:"daemon_min_age"`
+	EscalationWindow         Duration `json:"escalation_window"`
+	DedupWindow              Duration `json:"dedup_window"`
 	MaxEvents                int      `json:"max_events"`
+
+	SeverityOverrides map[string]string `json:"severity_overrides,omitempty"`
+}
+
+// securitySeverities are the values accepted in SeverityOverrides.
+var securitySeverities = map[string]bool{"LOW": true, "MEDIUM": true, "HIGH": true, "CRITICAL": true}
+
+// ValidSecuritySeverity reports whether s names a security severity, in any
+// case.
+func ValidSecuritySeverity(s string) bool {
+	return securitySeverities[strings.ToUpper(s)]
+}
+
+// Validate reports the first SeverityOverrides entry with an empty key or
+// an unknown severity.
+func (s SecurityConfig) Validate() error {
+	keys := make([]string, 0, len(s.SeverityOverrides))
+	for k := range s.SeverityOverrides {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("severity_overrides: empty rule or category")
+		}
+		if v := s.SeverityOverrides[k]; !ValidSecuritySeverity(v) {
+			return fmt.Errorf("severity_overrides[%q]: unknown severity %q", k, v)
+		}
+	}
+	return nil
 }
 
 // DefaultConfig returns the default configuration.
@@ -202,7 +472,8 @@ func DefaultConfig() *Config {
 			TokenWarning: 500000, TokenCritical: 2000000,
 			CostWarning: 1.0, CostCritical: 5.0,
 			DailyBudgetUSD: 0, MonthlyBudgetUSD: 0, BudgetWarnPercent: 80,
-			BurnRateWarning: 2.0, BurnRateCritical: 3.0,
+			BurnRateWarning: 2.0, BurnRateCritical: 3.0, ErrorRate: 0.25,
+			ForkRateWarning: 120, ForkRateCritical: 600,
 			IdleMinutes: 10, CooldownMinutes: 5, MaxAlerts: 100,
 		},
 		Security: SecurityConfig{
@@ -210,7 +481,7 @@ func DefaultConfig() *Config {
 			DangerousCommands: []string{
 				"rm -rf /", "rm -rf ~", "rm -rf *", "rm -rf .", "mkfs.", "dd if=",
 				":(){:|:&};:", "> /dev/sda", "chmod -R 777", "chmod 777",
-				"wget.*|.*sh", "curl.*|.*sh", "curl.*|.*bash", "wget.*|.*bash",
+				pipeToShellPattern,
 			},
 			SensitiveFiles: []string{
 				".env", ".ssh/", "id_rsa", "id_ed25519", ".aws/credentials", ".aws/config",
@@ -221,6 +492,7 @@ func DefaultConfig() *Config {
 			SuspiciousHosts: []string{
 				"pastebin.com", "requestbin.com", "ngrok.io", "localtunnel.me",
 				"hookbin.com", "burpcollaborator.net", "interact.sh", "oast.fun",
+				"trycloudflare.com", "bore.pub", "serveo.net", "loca.lt",
 			},
 			AllowedRegistries: []string{},
 			EscalationCommands: []string{
@@ -237,6 +509,9 @@ func DefaultConfig() *Config {
 				"chkconfig", "update-rc.d", "/etc/init.d/", "visudo",
 				"usermod", "useradd", "groupadd", "iptables", "pfctl",
 				"networksetup", "defaults write",
+				"systemctl --user enable", "systemctl --user start", "systemd-run --user",
+				"systemd-run --on-calendar", "schtasks /create", "schtasks.exe /create",
+				"register-scheduledtask", "new-scheduledtask", `currentversion\run`,
 			},
 			ReverseShellPatterns: []string{
 				"bash -i >& /dev/tcp/", "bash -i >&/dev/tcp/", "sh -i >& /dev/tcp/",
@@ -248,7 +523,7 @@ func DefaultConfig() *Config {
 			},
 			ObfuscationPatterns: []string{
 				"base64 --decode", "base64 -d", "base64 -D", "| base64",
-				"echo.*|.*base64", "xxd -r", "xxd -p",
+				`echo.*\|.*base64`, "xxd -r", "xxd -p",
 			},
 			ContainerEscapePatterns: []string{
 				"docker run --privileged", "docker run -v /:/", "docker.sock",
@@ -270,6 +545,7 @@ func DefaultConfig() *Config {
 				"pass show", "gopass show", "Login Data", "cookies.sqlite",
 				"logins.json", "chrome/Default", "firefox/Profiles",
 			},
+			BrowserProfilePaths: defaultBrowserProfilePaths(runtime.GOOS),
 			LogTamperingPatterns: []string{
 				"history -c", "history -w", "history -d",
 				"> ~/.bash_history", "> ~/.zsh_history",
@@ -281,13 +557,43 @@ func DefaultConfig() *Config {
 				"ssh ", "ssh -L", "ssh -R", "ssh -D", "scp ",
 				"rsync ", "sftp ", "autossh", "mosh ",
 			},
+			ReverseTunnelPatterns: []string{
+				"cloudflared tunnel", "cloudflared access tcp", "tailscale funnel",
+				"tailscale serve", "bore local", "frpc ", "frpc -c", "ngrok ",
+				"lt --port", "localtunnel", "zrok share", "chisel client",
+				"chisel server", "ssh -R 80:serveo.net", "localhost.run",
+				"pinggy.io", "telebit ", "expose share",
+			},
 			ShellPersistenceFiles: []string{
 				".bashrc", ".bash_profile", ".profile", ".zshrc", ".zprofile",
 				".zshenv", ".config/fish/config.fish", "Library/LaunchAgents/",
 				".config/autostart/", "cron.d/", "cron.daily/",
+				".config/systemd/user/", "/etc/systemd/system/",
+				"start menu/programs/startup/", `start menu\programs\startup\`,
+				`system32\tasks\`,
+			},
+			PersistenceCommands: []string{
+				"crontab -e", `crontab\s+[^-\s].*`, "| crontab", "systemctl enable",
+				"systemctl --user enable", "launchctl load", "launchctl bootstrap",
+				"update-rc.d", "chkconfig", "systemd-run --on-calendar",
+				"schtasks /create", "schtasks.exe /create", "register-scheduledtask",
+				`currentversion\run`, ">> ~/.bashrc", ">> ~/.zshrc", ">> ~/.profile",
+				">> ~/.bash_profile",
 			},
 			MassDeletionThreshold: 10,
-			MaxEvents:             500,
+			MassRewriteThreshold:  20,
+			MassRewriteWindow:     Duration(time.Minute),
+			RewriteEntropyBits:    7.5,
+			SecretScanMaxBytes:    64 * 1024,
+			SecretEntropyBits:     4.3,
+			DaemonMinAge:          Duration(2 * time.Minute),
+			EscalationWindow:      Duration(10 * time.Minute),
+			DedupWindow:           Duration(5 * time.Minute),
+			RansomwareExtensions: []string{
+				".encrypted", ".enc", ".locked", ".crypt", ".crypted",
+				".cry", ".locky", ".ransom", ".pay", ".wncry",
+			},
+			MaxEvents: 500,
 		},
 		Theme: ThemeConfig{
 			Primary: "#7C3AED", Secondary: "#06B6D4", Success: "#10B981",
@@ -295,7 +601,10 @@ func DefaultConfig() *Config {
 			Background: "#1A1B26", BackgroundAlt: "#24283B",
 			Foreground: "#C0CAF5", Border: "#3B4261",
 		},
-		Export: ExportConfig{Format: "json", Directory: "", MaxHistory: 10000},
+		Export: ExportConfig{
+			Format: "json", Directory: "", MaxHistory: 10000,
+			Push: PushConfig{Interval: Duration(30 * time.Second)},
+		},
 		Display: DisplayConfig{
 			ShowTokens: true, ShowCost: true, ShowGit: true, ShowTerminal: true,
 			ShowNetwork: true, ShowFiles: true, ShowSession: true, ShowAlerts: true,
@@ -308,10 +617,76 @@ func DefaultConfig() *Config {
 		Monitor: MonitorConfig{
 			MaxLogLines: 50, MaxFileOps: 200, MaxTermCommands: 50, WatchDirs: []string{},
 		},
-		LocalModels: LocalModelsConfig{Enabled: true, Endpoints: []LocalModelEndpoint{}},
+		LocalModels: LocalModelsConfig{Enabled: true, Endpoints: []LocalModelEndpoint{}, Timeout: Duration(2 * time.Second), RetryInterval: Duration(30 * time.Second)},
+	}
+}
+
+// defaultBrowserProfilePaths returns home-relative browser profile directories
+// (Chrome, Chromium, Edge, Brave, Firefox) for the given GOOS. Patterns are
+// matched as case-insensitive substrings of file paths and commands.
+func defaultBrowserProfilePaths(goos string) []string {
+	switch goos {
+	case "darwin":
+		return []string{
+			"Library/Application Support/Google/Chrome/",
+			"Library/Application Support/Chromium/",
+			"Library/Application Support/Microsoft Edge/",
+			"Library/Application Support/BraveSoftware/Brave-Browser/",
+			"Library/Application Support/Firefox/Profiles/",
+			"Library/Cookies/",
+		}
+	case "windows":
+		return []string{
+			`AppData\Local\Google\Chrome\User Data\`,
+			`AppData\Local\Chromium\User Data\`,
+			`AppData\Local\Microsoft\Edge\User Data\`,
+			`AppData\Local\BraveSoftware\Brave-Browser\User Data\`,
+			`AppData\Roaming\Mozilla\Firefox\Profiles\`,
+		}
+	default:
+		return []string{
+			".config/google-chrome/",
+			".config/chromium/",
+			".config/microsoft-edge/",
+			".config/BraveSoftware/Brave-Browser/",
+			".mozilla/firefox/",
+			"snap/firefox/common/.mozilla/firefox/",
+		}
 	}
 }
 
+// pipeToShellPattern flags downloads piped into a shell.
+const pipeToShellPattern = `(curl|wget).*\|\s*(sudo\s+)?(ba|z)?sh\b`
+
+// legacyPatterns maps default patterns saved by earlier versions, which
+// were literal substrings, to their regular expression replacements. Read
+// as regular expressions the originals are alternations ("wget.*" or ".*sh")
+// that match almost any command.
+var legacyPatterns = map[string]string{
+	"wget.*|.*sh":     pipeToShellPattern,
+	"curl.*|.*sh":     pipeToShellPattern,
+	"curl.*|.*bash":   pipeToShellPattern,
+	"wget.*|.*bash":   pipeToShellPattern,
+	"echo.*|.*base64": `echo.*\|.*base64`,
+}
+
+// migrateLegacyPatterns replaces legacyPatterns in patterns, dropping the
+// duplicates this creates.
+func migrateLegacyPatterns(patterns []string) []string {
+	seen := make(map[string]bool, len(patterns))
+	out := patterns[:0]
+	for _, p := range patterns {
+		if repl, ok := legacyPatterns[p]; ok {
+			p = repl
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 // ConfigPath returns the default config file path.
 func ConfigPath() string {
 	home, _ := os.UserHomeDir()
@@ -326,7 +701,22 @@ func Load() *Config {
 		_ = cfg.Save()
 		return cfg
 	}
-	_ = json.Unmarshal(data, cfg)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		log.Printf("config: %s: %v", ConfigPath(), err)
+	}
+	for _, err := range cfg.Validate() {
+		log.Printf("config: %v", err)
+	}
+	// Severities are upper case everywhere else; accept "high" as well.
+	cfg.Alerts.SecurityMinSeverity = strings.ToUpper(cfg.Alerts.SecurityMinSeverity)
+	cfg.Security.DangerousCommands = migrateLegacyPatterns(cfg.Security.DangerousCommands)
+	cfg.Security.ObfuscationPatterns = migrateLegacyPatterns(cfg.Security.ObfuscationPatterns)
+	// Drop overrides that would otherwise give events a bogus severity.
+	for k, v := range cfg.Security.SeverityOverrides {
+		if k == "" || !ValidSecuritySeverity(v) {
+			delete(cfg.Security.SeverityOverrides, k)
+		}
+	}
 	return cfg
 }
 
@@ -344,6 +734,109 @@ func (c *Config) Save() error {
 	return os.WriteFile(path, data, 0644)
 }
 
+// Validate checks the configuration for values that cannot work as
+// intended, such as negative thresholds, a warning threshold above its
+// critical one, non-positive intervals, empty keybindings or unknown export
+// formats. It returns every problem found, or nil if there are none.
+// Thresholds of 0 are left alone, as they disable their check.
+func (c *Config) Validate() []error {
+	var errs []error
+	addf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.RefreshInterval <= 0 {
+		addf("refresh_interval: must be positive, got %v", c.RefreshInterval.Duration())
+	}
+
+	a := c.Alerts
+	for _, t := range []struct {
+		name              string
+		warning, critical float64
+	}{
+		{"cpu", a.CPUWarning, a.CPUCritical},
+		{"memory", a.MemoryWarning, a.MemoryCritical},
+		{"memory_percent", a.MemoryWarningPercent, a.MemoryCriticalPercent},
+		{"token", float64(a.TokenWarning), float64(a.TokenCritical)},
+		{"cost", a.CostWarning, a.CostCritical},
+		{"burn_rate", a.BurnRateWarning, a.BurnRateCritical},
+		{"fork_rate", a.ForkRateWarning, a.ForkRateCritical},
+		{"tokens_per_sec", a.TokensPerSecWarning, a.TokensPerSecCritical},
+	} {
+		if t.warning < 0 || t.critical < 0 {
+			addf("alerts: %s thresholds must not be negative (warning %v, critical %v)", t.name, t.warning, t.critical)
+		} else if t.warning > 0 && t.critical > 0 && t.warning >= t.critical {
+			addf("alerts: %s warning threshold %v must be below critical %v", t.name, t.warning, t.critical)
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value float64
+	}{
+		{"daily_budget_usd", a.DailyBudgetUSD},
+		{"monthly_budget_usd", a.MonthlyBudgetUSD},
+		{"budget_warn_percent", a.BudgetWarnPercent},
+		{"tokens_per_min", float64(a.TokensPerMin)},
+		{"cost_per_hour_usd", a.CostPerHour},
+		{"idle_minutes", float64(a.IdleMinutes)},
+		{"cooldown_minutes", float64(a.CooldownMinutes)},
+		{"max_alerts", float64(a.MaxAlerts)},
+	} {
+		if v.value < 0 {
+			addf("alerts: %s must not be negative, got %v", v.name, v.value)
+		}
+	}
+	if a.SecurityMinSeverity != "" && !ValidSecuritySeverity(a.SecurityMinSeverity) {
+		addf("alerts: security_min_severity: unknown severity %q", a.SecurityMinSeverity)
+	}
+
+	if err := c.Security.Validate(); err != nil {
+		addf("security: %v", err)
+	}
+
+	for _, f := range c.Export.ExportFormats() {
+		if f != "json" && f != "csv" {
+			addf("export: unsupported format %q", f)
+		}
+	}
+	if c.Export.MaxHistory < 0 {
+		addf("export: max_history must not be negative, got %d", c.Export.MaxHistory)
+	}
+	if p := c.Export.Push; p.Enabled {
+		if p.URL == "" {
+			addf("export: push is enabled without a url")
+		}
+		if p.Interval <= 0 {
+			addf("export: push interval must be positive, got %v", p.Interval.Duration())
+		}
+	}
+
+	k := c.Keybindings
+	for _, b := range []struct{ name, key string }{
+		{"quit", k.Quit}, {"refresh", k.Refresh}, {"export", k.Export}, {"detail", k.Detail},
+		{"back", k.Back}, {"up", k.Up}, {"down", k.Down}, {"toggle", k.Toggle},
+	} {
+		if strings.TrimSpace(b.key) == "" {
+			addf("keybindings: %s is empty", b.name)
+		}
+	}
+
+	for i, def := range c.Agents {
+		if def.ID == "" {
+			addf("agents[%d] (%q) has no id", i, def.Name)
+		} else if len(def.ProcessNames) == 0 && len(def.DetectPatterns) == 0 {
+			addf("agents[%d] (%q) has no process_names or detect_patterns", i, def.ID)
+		}
+	}
+
+	for i, ep := range c.LocalModels.Endpoints {
+		if ep.URL == "" {
+			addf("local_models: endpoints[%d] (%q) has no url", i, ep.Name)
+		}
+	}
+	return errs
+}
+
 // ShouldIgnoreProcess reports whether cmdline matches any of the
 // configured IgnoreProcessPatterns. Returns false if SkipSystemProcesses is disabled.
 func (c *Config) ShouldIgnoreProcess(cmdline string) bool {
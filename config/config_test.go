@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -88,6 +89,12 @@ func TestDefaultConfig(t *testing.T) {
 	if !cfg.LocalModels.Enabled {
 		t.Error("LocalModels should be enabled by default")
 	}
+	if cfg.LocalModels.Timeout.Duration() != 2*time.Second {
+		t.Errorf("LocalModels.Timeout = %v, want 2s", cfg.LocalModels.Timeout.Duration())
+	}
+	if cfg.LocalModels.RetryInterval.Duration() != 30*time.Second {
+		t.Errorf("LocalModels.RetryInterval = %v, want 30s", cfg.LocalModels.RetryInterval.Duration())
+	}
 }
 
 func TestDuration_MarshalJSON(t *testing.T) {
@@ -165,6 +172,86 @@ func TestDuration_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestParseMemorySize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want MemorySize
+	}{
+		{"800", 800},
+		{"800MB", 800},
+		{"512 mb", 512},
+		{"1.5GB", 1536},
+		{"2GiB", 2048},
+		{"2g", 2048},
+		{"1TB", 1024 * 1024},
+		{"512KB", 0.5},
+		{"1048576B", 1},
+	}
+	for _, tt := range tests {
+		got, err := ParseMemorySize(tt.in)
+		if err != nil {
+			t.Errorf("ParseMemorySize(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMemorySize(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "GB", "1.5XB", "-1GB", "abc"} {
+		if _, err := ParseMemorySize(bad); err == nil {
+			t.Errorf("ParseMemorySize(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestAlertConfig_RateThresholdsJSON(t *testing.T) {
+	var a AlertConfig
+	if err := json.Unmarshal([]byte(`{"tokens_per_min": 20000, "cost_per_hour_usd": 2.5, "tokens_per_sec_warning": 200, "tokens_per_sec_critical": 500}`), &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.TokensPerMin != 20000 || a.CostPerHour != 2.5 {
+		t.Errorf("TokensPerMin = %d, CostPerHour = %v; want 20000, 2.5", a.TokensPerMin, a.CostPerHour)
+	}
+	if a.TokensPerSecWarning != 200 || a.TokensPerSecCritical != 500 {
+		t.Errorf("TokensPerSec = %v/%v, want 200/500", a.TokensPerSecWarning, a.TokensPerSecCritical)
+	}
+}
+
+func TestMemorySize_UnmarshalJSON(t *testing.T) {
+	var a AlertConfig
+	err := json.Unmarshal([]byte(`{"memory_warning_mb": "2GB", "memory_critical_mb": 4096}`), &a)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if a.MemoryWarning != 2048 {
+		t.Errorf("MemoryWarning = %v MB, want 2048", a.MemoryWarning)
+	}
+	if a.MemoryCritical != 4096 {
+		t.Errorf("MemoryCritical = %v MB, want 4096", a.MemoryCritical)
+	}
+
+	// Fields missing from the JSON keep their value, other fields decode
+	// as usual, and a bad size is an error.
+	cfg := DefaultConfig()
+	if err := json.Unmarshal([]byte(`{"alerts": {"cpu_warning": 55, "memory_critical_mb": "3g"}}`), cfg); err != nil {
+		t.Fatalf("Unmarshal config error: %v", err)
+	}
+	if cfg.Alerts.CPUWarning != 55 || cfg.Alerts.MemoryWarning != 500 || cfg.Alerts.MemoryCritical != 3072 {
+		t.Errorf("alerts = cpu %v, memory %v/%v; want 55, 500/3072", cfg.Alerts.CPUWarning, cfg.Alerts.MemoryWarning, cfg.Alerts.MemoryCritical)
+	}
+	if err := json.Unmarshal([]byte(`{"memory_warning_mb": "lots"}`), &a); err == nil {
+		t.Error("expected error for invalid memory_warning_mb")
+	}
+
+	var m MemorySize
+	if err := json.Unmarshal([]byte(`true`), &m); err == nil {
+		t.Error("expected error for bool value")
+	}
+	if err := json.Unmarshal([]byte(`"lots"`), &m); err == nil {
+		t.Error("expected error for invalid size string")
+	}
+}
+
 func TestConfigSaveAndLoad(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "config.json")
@@ -361,3 +448,183 @@ func TestConfigJSON_RoundTrip(t *testing.T) {
 		t.Errorf("Display.ShowTokens mismatch")
 	}
 }
+
+func TestExportFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ExportConfig
+		want []string
+	}{
+		{"legacy single format", ExportConfig{Format: "json"}, []string{"json"}},
+		{"formats list wins", ExportConfig{Format: "json", Formats: []string{"csv", "json"}}, []string{"csv", "json"}},
+		{"normalized and deduplicated", ExportConfig{Formats: []string{" JSON", "json", "", "Csv"}}, []string{"json", "csv"}},
+		{"empty", ExportConfig{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cfg.ExportFormats()
+			if len(got) != len(tt.want) {
+				t.Fatalf("ExportFormats() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ExportFormats() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExportFormats_JSONBackwardCompat(t *testing.T) {
+	cfg := DefaultConfig()
+	if err := json.Unmarshal([]byte(`{"export":{"format":"csv"}}`), cfg); err != nil {
+		t.Fatalf("unmarshal legacy export config: %v", err)
+	}
+	got := cfg.Export.ExportFormats()
+	if len(got) != 1 || got[0] != "csv" {
+		t.Fatalf("ExportFormats() = %v, want [csv]", got)
+	}
+
+	cfg = DefaultConfig()
+	if err := json.Unmarshal([]byte(`{"export":{"formats":["json","csv"]}}`), cfg); err != nil {
+		t.Fatalf("unmarshal export formats: %v", err)
+	}
+	got = cfg.Export.ExportFormats()
+	if len(got) != 2 || got[0] != "json" || got[1] != "csv" {
+		t.Fatalf("ExportFormats() = %v, want [json csv]", got)
+	}
+}
+
+func TestPricing_JSON(t *testing.T) {
+	cfg := DefaultConfig()
+	in := `{"pricing":{"gpt-4o":{"input_per_1m":2,"output_per_1m":8,"cached_input_per_1m":1}}}`
+	if err := json.Unmarshal([]byte(in), cfg); err != nil {
+		t.Fatalf("unmarshal pricing: %v", err)
+	}
+	want := ModelPriceConfig{InputPer1M: 2, OutputPer1M: 8, CachedInputPer1M: 1}
+	if got := cfg.Pricing["gpt-4o"]; got != want {
+		t.Errorf("Pricing[gpt-4o] = %+v, want %+v", got, want)
+	}
+}
+
+func TestDefaultBrowserProfilePaths(t *testing.T) {
+	for _, goos := range []string{"darwin", "linux", "windows"} {
+		paths := defaultBrowserProfilePaths(goos)
+		var chrome, firefox bool
+		for _, p := range paths {
+			lower := strings.ToLower(p)
+			chrome = chrome || strings.Contains(lower, "chrome")
+			firefox = firefox || strings.Contains(lower, "firefox")
+		}
+		if !chrome || !firefox {
+			t.Errorf("%s: expected Chrome and Firefox profile paths, got %v", goos, paths)
+		}
+	}
+
+	if len(DefaultConfig().Security.BrowserProfilePaths) == 0 {
+		t.Error("Security.BrowserProfilePaths should not be empty")
+	}
+}
+
+func TestSecurityConfig_Validate(t *testing.T) {
+	if err := DefaultConfig().Security.Validate(); err != nil {
+		t.Errorf("default config: %v", err)
+	}
+	s := SecurityConfig{SeverityOverrides: map[string]string{"system_modify": "high", "reverse_shell:telnet ": "LOW"}}
+	if err := s.Validate(); err != nil {
+		t.Errorf("valid overrides: %v", err)
+	}
+	for _, bad := range []map[string]string{{"system_modify": "SEVERE"}, {"": "HIGH"}} {
+		if err := (SecurityConfig{SeverityOverrides: bad}).Validate(); err == nil {
+			t.Errorf("Validate(%v) = nil, want error", bad)
+		}
+	}
+}
+
+func TestLoad_DropsInvalidSeverityOverrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := ConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"security": {"enabled": true, "severity_overrides": {"system_modify": "HIGH", "obfuscation": "extreme"}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got := Load().Security.SeverityOverrides
+	if len(got) != 1 || got["system_modify"] != "HIGH" {
+		t.Errorf("SeverityOverrides = %v, want only system_modify", got)
+	}
+}
+
+func TestLoad_NormalizesSecurityMinSeverity(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path := ConfigPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(`{"alerts": {"security_min_severity": "high"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Load().Alerts.SecurityMinSeverity; got != "HIGH" {
+		t.Errorf("SecurityMinSeverity = %q, want HIGH", got)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	if errs := DefaultConfig().Validate(); len(errs) != 0 {
+		t.Errorf("default config: %v", errs)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{"cpu warning above critical", func(c *Config) { c.Alerts.CPUWarning, c.Alerts.CPUCritical = 95, 80 }, []string{"cpu warning"}},
+		{"negative memory", func(c *Config) { c.Alerts.MemoryWarning = -1 }, []string{"memory thresholds must not be negative"}},
+		{"token and cost inverted", func(c *Config) {
+			c.Alerts.TokenWarning, c.Alerts.TokenCritical = 10, 5
+			c.Alerts.CostWarning, c.Alerts.CostCritical = 5, 5
+		}, []string{"token warning", "cost warning"}},
+		{"negative cooldown", func(c *Config) { c.Alerts.CooldownMinutes = -5 }, []string{"cooldown_minutes"}},
+		{"tokens per sec inverted", func(c *Config) {
+			c.Alerts.TokensPerSecWarning, c.Alerts.TokensPerSecCritical = 500, 200
+		}, []string{"tokens_per_sec warning"}},
+		{"negative rates", func(c *Config) { c.Alerts.TokensPerMin, c.Alerts.CostPerHour = -1, -0.5 }, []string{"tokens_per_min", "cost_per_hour_usd"}},
+		{"zero refresh", func(c *Config) { c.RefreshInterval = 0 }, []string{"refresh_interval"}},
+		{"push without url", func(c *Config) { c.Export.Push.Enabled = true }, []string{"push is enabled without a url"}},
+		{"export format", func(c *Config) { c.Export.Formats = []string{"json", "xml"} }, []string{`unsupported format "xml"`}},
+		{"empty keybindings", func(c *Config) { c.Keybindings.Quit, c.Keybindings.Up = "", " " }, []string{"quit is empty", "up is empty"}},
+		{"custom agents", func(c *Config) {
+			c.Agents = []AgentDef{{Name: "nameless"}, {ID: "acme"}, {ID: "ok", ProcessNames: []string{"ok"}}}
+		}, []string{`agents[0] ("nameless") has no id`, `agents[1] ("acme") has no process_names`}},
+		{"security override", func(c *Config) {
+			c.Security.SeverityOverrides = map[string]string{"system_modify": "SEVERE"}
+		}, []string{"security: severity_overrides"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(cfg)
+			errs := cfg.Validate()
+			if len(errs) != len(tt.want) {
+				t.Fatalf("Validate() = %v, want %d errors", errs, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("error %d = %q, want it to mention %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+
+	// A zero threshold disables its check rather than being invalid.
+	cfg := DefaultConfig()
+	cfg.Alerts.CPUWarning, cfg.Alerts.ForkRateCritical = 0, 0
+	if errs := cfg.Validate(); len(errs) != 0 {
+		t.Errorf("disabled thresholds: %v", errs)
+	}
+}
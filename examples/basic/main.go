@@ -10,6 +10,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -29,27 +30,51 @@ func main() {
 	sessMon := monitor.NewSessionMonitor()
 	termMon := monitor.NewTerminalMonitor(50)
 	tokenMon := monitor.NewTokenMonitor()
+	tokenMon.SetPricing(monitor.PricingFromConfig(cfg.Pricing))
 	gitMon := monitor.NewGitMonitor()
 	netMon := monitor.NewNetworkMonitor()
+	treeMon := monitor.NewProcessTreeMonitor()
+	if len(cfg.Monitor.BuildTools) > 0 {
+		treeMon.SetBuildTools(cfg.Monitor.BuildTools)
+	}
 	secMon := monitor.NewSecurityMonitor(cfg.Security)
 	alertMon := monitor.NewAlertMonitor(monitor.AlertThresholds{
-		CPUWarning:        cfg.Alerts.CPUWarning,
-		CPUCritical:       cfg.Alerts.CPUCritical,
-		MemoryWarning:     cfg.Alerts.MemoryWarning,
-		MemoryCritical:    cfg.Alerts.MemoryCritical,
-		TokenWarning:      cfg.Alerts.TokenWarning,
-		TokenCritical:     cfg.Alerts.TokenCritical,
-		CostWarning:       cfg.Alerts.CostWarning,
-		CostCritical:      cfg.Alerts.CostCritical,
-		DailyBudgetUSD:    cfg.Alerts.DailyBudgetUSD,
-		MonthlyBudgetUSD:  cfg.Alerts.MonthlyBudgetUSD,
-		BudgetWarnPercent: cfg.Alerts.BudgetWarnPercent,
-		BurnRateWarning:   cfg.Alerts.BurnRateWarning,
-		BurnRateCritical:  cfg.Alerts.BurnRateCritical,
-		IdleMinutes:       cfg.Alerts.IdleMinutes,
-		CooldownMinutes:   cfg.Alerts.CooldownMinutes,
-		MaxAlerts:         cfg.Alerts.MaxAlerts,
+		CPUWarning:            cfg.Alerts.CPUWarning,
+		CPUCritical:           cfg.Alerts.CPUCritical,
+		MemoryWarning:         cfg.Alerts.MemoryWarning,
+		MemoryCritical:        cfg.Alerts.MemoryCritical,
+		MemoryWarningPercent:  cfg.Alerts.MemoryWarningPercent,
+		MemoryCriticalPercent: cfg.Alerts.MemoryCriticalPercent,
+		TokenWarning:          cfg.Alerts.TokenWarning,
+		TokenCritical:         cfg.Alerts.TokenCritical,
+		CostWarning:           cfg.Alerts.CostWarning,
+		CostCritical:          cfg.Alerts.CostCritical,
+		DailyBudgetUSD:        cfg.Alerts.DailyBudgetUSD,
+		MonthlyBudgetUSD:      cfg.Alerts.MonthlyBudgetUSD,
+		BudgetWarnPercent:     cfg.Alerts.BudgetWarnPercent,
+		BurnRateWarning:       cfg.Alerts.BurnRateWarning,
+		BurnRateCritical:      cfg.Alerts.BurnRateCritical,
+		TokensPerMin:          cfg.Alerts.TokensPerMin,
+		CostPerHour:           cfg.Alerts.CostPerHour,
+		ErrorRate:             cfg.Alerts.ErrorRate,
+		CostPerCommit:         cfg.Alerts.CostPerCommit,
+		NoCommitSpendUSD:      cfg.Alerts.NoCommitSpendUSD,
+		NoCommitWindowMinutes: cfg.Alerts.NoCommitWindowMinutes,
+		SecurityMinSeverity:   agent.SecuritySeverity(cfg.Alerts.SecurityMinSeverity),
+		SecurityCategories:    securityCategories(cfg.Alerts.SecurityCategories),
+		ForkRateWarning:       cfg.Alerts.ForkRateWarning,
+		ForkRateCritical:      cfg.Alerts.ForkRateCritical,
+		TokensPerSecWarning:   cfg.Alerts.TokensPerSecWarning,
+		TokensPerSecCritical:  cfg.Alerts.TokensPerSecCritical,
+		IdleMinutes:           cfg.Alerts.IdleMinutes,
+		CooldownMinutes:       cfg.Alerts.CooldownMinutes,
+		MaxAlerts:             cfg.Alerts.MaxAlerts,
 	})
+	for _, rc := range cfg.Alerts.Rules {
+		if err := alertMon.AddMetricRule(monitor.MetricRuleFromConfig(rc)); err != nil {
+			fmt.Printf("Skipping alert rule %q: %v\n", rc.Name, err)
+		}
+	}
 	localMon := monitor.NewLocalModelMonitor(cfg.LocalModels)
 
 	fmt.Println("=== libagentmetrics - scan example ===")
@@ -85,17 +110,22 @@ func main() {
 			if pm.PID == a.PID {
 				a.CPU = pm.CPU
 				a.Memory = pm.MemoryMB
+				a.OpenFiles = pm.OpenFiles
 			}
 		}
 		sessMon.Collect(a)
 		termMon.Collect(a)
 		gitMon.Collect(a)
 		a.NetConns = netMon.GetConnections(a.PID)
+		treeMon.Collect(a)
 		secMon.CheckAgent(a)
 		alertMon.Check(a)
 	}
 
 	tokenMon.Collect(agents)
+	for i := range agents {
+		sessMon.ApplyActivity(&agents[i], time.Now())
+	}
 	alertMon.CheckFleet(agents)
 
 	localModels := localMon.GetModels()
@@ -144,19 +174,38 @@ func main() {
 		}
 		fmt.Println()
 	}
+
+	if cfg.Export.Push.Enabled {
+		snap := agent.Snapshot{Timestamp: time.Now(), Agents: agents, Alerts: alerts}
+		pusher := monitor.NewPushExporter(cfg.Export.Push)
+		if err := pusher.Push(context.Background(), snap); err != nil {
+			fmt.Printf("Push to %s failed: %v\n", cfg.Export.Push.URL, err)
+		}
+	}
+}
+
+func securityCategories(m map[string]bool) map[agent.SecurityCategory]bool {
+	out := make(map[agent.SecurityCategory]bool, len(m))
+	for cat, page := range m {
+		out[agent.SecurityCategory(cat)] = page
+	}
+	return out
 }
 
 func printAgent(a agent.Instance) {
-	fmt.Printf("-- %s (%s) --\n", a.Info.Name, a.Status)
+	fmt.Printf("-- %s (%s, %s) --\n", a.Info.Name, a.Status, a.Activity)
 	fmt.Printf("  PID:    %d\n", a.PID)
 
 	if a.CPU > 0 || a.Memory > 0 {
-		fmt.Printf("  CPU:    %.1f%%    Memory: %.1f MB\n", a.CPU, a.Memory)
+		fmt.Printf("  CPU:    %.1f%%    Memory: %s\n", a.CPU, monitor.FormatMemory(a.Memory))
 	}
 
 	if a.WorkDir != "" {
 		fmt.Printf("  Dir:    %s\n", a.WorkDir)
 	}
+	if a.ProjectName != "" {
+		fmt.Printf("  Proj:   %s\n", a.ProjectName)
+	}
 
 	if a.Tokens.TotalTokens > 0 {
 		fmt.Printf("  Tokens: %s in / %s out  (cost ~ $%.4f)\n",
@@ -0,0 +1,196 @@
+// Package procfs reads the Linux /proc files that the agent detector and
+// the monitors use instead of spawning ps. Every function takes the proc
+// root (normally "/proc") so tests can point it at a fixture tree.
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClockTicks is USER_HZ, the unit of the time fields in /proc/<pid>/stat.
+// It is 100 on every mainstream Linux architecture.
+const ClockTicks = 100
+
+// Stat holds the fields of /proc/<pid>/stat used by this module.
+type Stat struct {
+	Comm       string
+	PPID       int
+	CPUTicks   int64 // utime + stime
+	StartTicks int64 // clock ticks after boot
+	RSSPages   int64
+}
+
+// PIDs lists the process IDs under root.
+func PIDs(root string) ([]int, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// ReadStat reads and parses <root>/<pid>/stat.
+func ReadStat(root string, pid int) (Stat, error) {
+	data, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return Stat{}, err
+	}
+	return ParseStat(string(data))
+}
+
+// ParseStat parses the contents of /proc/<pid>/stat. The command name is
+// in parentheses and may itself contain spaces and parentheses, so fields
+// are counted from the last ')'.
+func ParseStat(content string) (Stat, error) {
+	open := strings.IndexByte(content, '(')
+	end := strings.LastIndexByte(content, ')')
+	if open < 0 || end < open {
+		return Stat{}, fmt.Errorf("malformed proc stat")
+	}
+	// Fields after the name start at state (field 3); ppid is field 4,
+	// utime and stime 14 and 15, starttime 22 and rss 24.
+	fields := strings.Fields(content[end+1:])
+	if len(fields) < 22 {
+		return Stat{}, fmt.Errorf("proc stat has %d fields after comm", len(fields))
+	}
+	var nums [5]int64
+	for i, idx := range [5]int{1, 11, 12, 19, 21} {
+		n, err := strconv.ParseInt(fields[idx], 10, 64)
+		if err != nil {
+			return Stat{}, fmt.Errorf("parse proc stat field %d: %w", idx+3, err)
+		}
+		nums[i] = n
+	}
+	return Stat{
+		Comm:       content[open+1 : end],
+		PPID:       int(nums[0]),
+		CPUTicks:   nums[1] + nums[2],
+		StartTicks: nums[3],
+		RSSPages:   nums[4],
+	}, nil
+}
+
+// ReadCmdline reads <root>/<pid>/cmdline and joins its arguments with
+// spaces, as ParseCmdline does.
+func ReadCmdline(root string, pid int) (string, error) {
+	data, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return "", err
+	}
+	return ParseCmdline(data), nil
+}
+
+// ParseCmdline joins the NUL-separated arguments of /proc/<pid>/cmdline
+// with spaces. Kernel threads and zombies have an empty cmdline.
+func ParseCmdline(data []byte) string {
+	data = bytes.TrimRight(data, "\x00")
+	return strings.TrimSpace(string(bytes.ReplaceAll(data, []byte{0}, []byte{' '})))
+}
+
+// IO holds the character counters of /proc/<pid>/io: bytes read and
+// written through any file descriptor, so disk, pipes and sockets alike.
+type IO struct {
+	ReadChars  int64 // rchar
+	WriteChars int64 // wchar
+}
+
+// ReadIO reads and parses <root>/<pid>/io.
+func ReadIO(root string, pid int) (IO, error) {
+	data, err := os.ReadFile(filepath.Join(root, strconv.Itoa(pid), "io"))
+	if err != nil {
+		return IO{}, err
+	}
+	return ParseIO(string(data))
+}
+
+// ParseIO parses the contents of /proc/<pid>/io.
+func ParseIO(content string) (IO, error) {
+	var io IO
+	found := 0
+	for _, line := range strings.Split(content, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || (key != "rchar" && key != "wchar") {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return IO{}, fmt.Errorf("parse %s: %w", key, err)
+		}
+		if key == "rchar" {
+			io.ReadChars = n
+		} else {
+			io.WriteChars = n
+		}
+		found++
+	}
+	if found == 0 {
+		return IO{}, fmt.Errorf("rchar/wchar not found in proc io")
+	}
+	return io, nil
+}
+
+// Uptime reads the system uptime in seconds from <root>/uptime.
+func Uptime(root string) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(root, "uptime"))
+	if err != nil {
+		return 0, err
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(string(data)), " ")
+	up, err := strconv.ParseFloat(first, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse uptime: %w", err)
+	}
+	return up, nil
+}
+
+// MemTotalKB reads MemTotal from <root>/meminfo.
+func MemTotalKB(root string) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(root, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "MemTotal:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse MemTotal: %w", err)
+		}
+		return kb, nil
+	}
+	return 0, fmt.Errorf("MemTotal not found in meminfo")
+}
+
+// BootTime reads the system boot time from the btime line of <root>/stat.
+func BootTime(root string) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(root, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(line, "btime ")
+		if !ok {
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parse btime: %w", err)
+		}
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("btime not found in proc stat")
+}
@@ -0,0 +1,104 @@
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseStat(t *testing.T) {
+	st, err := ParseStat("9 (a) b) (c) R 7 9 0 0 -1 0 0 0 0 0 7 3 0 0 20 0 1 0 1234 0 55 0\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stat{Comm: "a) b) (c", PPID: 7, CPUTicks: 10, StartTicks: 1234, RSSPages: 55}
+	if st != want {
+		t.Errorf("ParseStat = %+v, want %+v", st, want)
+	}
+	for _, bad := range []string{
+		"",
+		"42 (short) R 7",
+		"1 x) S 1 1 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 0 1 0",
+		"1 (x) S 1 1 0 0 -1 0 0 0 0 0 u 0 0 0 20 0 1 0 1 0 1 0",
+	} {
+		if _, err := ParseStat(bad); err == nil {
+			t.Errorf("ParseStat(%q) = nil error", bad)
+		}
+	}
+}
+
+func TestParseCmdline(t *testing.T) {
+	tests := map[string]string{
+		"node\x00claude\x00":        "node claude",
+		"/bin/sh\x00-c\x00a  b\x00": "/bin/sh -c a  b",
+		"":                          "",
+		"\x00\x00":                  "",
+	}
+	for in, want := range tests {
+		if got := ParseCmdline([]byte(in)); got != want {
+			t.Errorf("ParseCmdline(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseIO(t *testing.T) {
+	io, err := ParseIO("rchar: 323934931\nwchar: 323929600\nsyscr: 632687\nread_bytes: 0\n")
+	if err != nil || io != (IO{ReadChars: 323934931, WriteChars: 323929600}) {
+		t.Errorf("ParseIO = %+v, %v", io, err)
+	}
+	if _, err := ParseIO("syscr: 1\n"); err == nil {
+		t.Error("expected error without rchar/wchar")
+	}
+	if _, err := ParseIO("rchar: x\n"); err == nil {
+		t.Error("expected error for a malformed rchar")
+	}
+}
+
+func TestReadTree(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"uptime":     "1000.50 3500.00\n",
+		"meminfo":    "MemTotal:        1000000 kB\nMemFree:          500000 kB\n",
+		"stat":       "cpu  1 2 3 4\nbtime 1000000000\nprocesses 42\n",
+		"12/stat":    "12 (sh) S 1 12 0 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 500 0 0 0\n",
+		"12/cmdline": "sh\x00",
+		"self/stat":  "not a pid",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if pids, err := PIDs(root); err != nil || len(pids) != 1 || pids[0] != 12 {
+		t.Errorf("PIDs = %v, %v; want [12]", pids, err)
+	}
+	if st, err := ReadStat(root, 12); err != nil || st.Comm != "sh" || st.StartTicks != 500 {
+		t.Errorf("ReadStat = %+v, %v", st, err)
+	}
+	if cmd, err := ReadCmdline(root, 12); err != nil || cmd != "sh" {
+		t.Errorf("ReadCmdline = %q, %v", cmd, err)
+	}
+	if up, err := Uptime(root); err != nil || up != 1000.5 {
+		t.Errorf("Uptime = %v, %v", up, err)
+	}
+	if kb, err := MemTotalKB(root); err != nil || kb != 1000000 {
+		t.Errorf("MemTotalKB = %v, %v", kb, err)
+	}
+	if bt, err := BootTime(root); err != nil || !bt.Equal(time.Unix(1000000000, 0)) {
+		t.Errorf("BootTime = %v, %v", bt, err)
+	}
+
+	missing := filepath.Join(root, "missing")
+	if _, err := Uptime(missing); err == nil {
+		t.Error("Uptime of a missing root = nil error")
+	}
+	if _, err := BootTime(filepath.Join(root, "12")); err == nil {
+		t.Error("BootTime without a btime line = nil error")
+	}
+}
@@ -1,36 +1,80 @@
 package monitor
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Rafiki81/libagentmetrics/agent"
 )
 
-// AlertThresholds defines configurable alert thresholds.
+// AlertThresholds defines configurable alert thresholds. The MemoryXxxPercent
+// thresholds are a share of host memory, checked alongside the absolute MB
+// ones; zero disables them. ErrorRate is the fraction (0-1) of failed model
+// requests that raises a warning; zero disables it.
+//
+// CostPerCommit warns when an agent's session cost divided by its session
+// commits reaches the given USD amount. NoCommitSpendUSD warns when an agent
+// spends that much within NoCommitWindowMinutes (default 30) without
+// committing. Both are opt-in and rely on GitActivity.SessionCommits.
+//
+// ForkRateWarning and ForkRateCritical apply to Instance.ForkRate, the new
+// child processes per minute measured by ProcessTreeMonitor; both must be
+// set to enable the check.
+//
+// TokensPerSecWarning and TokensPerSecCritical apply to
+// TokenMetrics.TokensPerSec and flag runaway generation; both must be set to
+// enable the check.
+//
+// TokensPerMin and CostPerHour warn when an agent's token usage or estimated
+// cost grows faster than the given rate, measured between consecutive Check
+// calls for that agent; zero disables them.
+//
+// SecurityMinSeverity opts in to mirroring security events into the alert
+// stream: events in Instance.SecurityEvents at or above this severity raise
+// an AlertSecurity alert; case does not matter. Leave it empty to keep the
+// two streams separate.
+// SecurityCategories overrides that per category: true always raises an
+// alert for the category and false never does, whatever the severity;
+// categories not in the map follow SecurityMinSeverity.
 type AlertThresholds struct {
-	CPUWarning        float64
-	CPUCritical       float64
-	MemoryWarning     float64
-	MemoryCritical    float64
-	TokenWarning      int64
-	TokenCritical     int64
-	CostWarning       float64
-	CostCritical      float64
-	DailyBudgetUSD    float64
-	MonthlyBudgetUSD  float64
-	BudgetWarnPercent float64
-	BurnRateWarning   float64
-	BurnRateCritical  float64
-	IdleMinutes       int
-	CooldownMinutes   int
-	MaxAlerts         int
-	CPUPercent        float64
-	MemoryMB          float64
-	TokensPerMin      int
-	CostPerHour       float64
-	ErrorRate         float64
+	CPUWarning            float64
+	CPUCritical           float64
+	MemoryWarning         float64
+	MemoryCritical        float64
+	MemoryWarningPercent  float64
+	MemoryCriticalPercent float64
+	TokenWarning          int64
+	TokenCritical         int64
+	CostWarning           float64
+	CostCritical          float64
+	DailyBudgetUSD        float64
+	MonthlyBudgetUSD      float64
+	BudgetWarnPercent     float64
+	BurnRateWarning       float64
+	BurnRateCritical      float64
+	IdleMinutes           int
+	CooldownMinutes       int
+	MaxAlerts             int
+	CPUPercent            float64
+	MemoryMB              float64
+	TokensPerMin          int
+	CostPerHour           float64
+	ErrorRate             float64
+	CostPerCommit         float64
+	NoCommitSpendUSD      float64
+	NoCommitWindowMinutes int
+	SecurityMinSeverity   agent.SecuritySeverity
+	SecurityCategories    map[agent.SecurityCategory]bool
+	ForkRateWarning       float64
+	ForkRateCritical      float64
+	TokensPerSecWarning   float64
+	TokensPerSecCritical  float64
 }
 
 // DefaultThresholds returns default alert thresholds.
@@ -49,6 +93,9 @@ func DefaultThresholds() AlertThresholds {
 		BudgetWarnPercent: 80,
 		BurnRateWarning:   2.0,
 		BurnRateCritical:  3.0,
+		ErrorRate:         0.25,
+		ForkRateWarning:   120,
+		ForkRateCritical:  600,
 		IdleMinutes:       10,
 		CooldownMinutes:   5,
 		MaxAlerts:         100,
@@ -61,7 +108,59 @@ type AlertMonitor struct {
 	thresholds AlertThresholds
 	alerts     []agent.Alert
 	maxAlerts  int
+	lastID     uint64
 	alerted    map[string]time.Time
+	spend      map[string]*commitSpend
+	rates      map[string]rateSample
+	firing     map[string]bool                 // alert types whose condition held this Check
+	secSeen    map[string]map[string]time.Time // agent -> security event key -> its timestamp
+	rules      []compiledRule
+	ruleSince  map[string]time.Time
+	hostMemMB  float64
+	now        func() time.Time
+	homeDir    string // for ExportJSON's default path; empty means os.UserHomeDir
+	metadata   map[string]string
+	injector   MetadataFunc
+	subs       subscribers[agent.Alert]
+	handlers   []func(agent.Alert)
+	pending    []agent.Alert // raised this Check or CheckFleet, for handlers
+}
+
+// minErrorRateRequests avoids flagging an error rate from a handful of requests.
+const minErrorRateRequests = 5
+
+// MetadataFunc returns per-call metadata (e.g. a trace ID) to stamp on an
+// alert or security event raised for agent a. Returned keys override static
+// metadata with the same name.
+type MetadataFunc func(a *agent.Instance) map[string]string
+
+func buildMetadata(static map[string]string, inject MetadataFunc, a *agent.Instance) map[string]string {
+	var dynamic map[string]string
+	if inject != nil {
+		dynamic = inject(a)
+	}
+	if len(static) == 0 && len(dynamic) == 0 {
+		return nil
+	}
+	md := make(map[string]string, len(static)+len(dynamic))
+	for k, v := range static {
+		md[k] = v
+	}
+	for k, v := range dynamic {
+		md[k] = v
+	}
+	return md
+}
+
+func copyMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return nil
+	}
+	out := make(map[string]string, len(md))
+	for k, v := range md {
+		out[k] = v
+	}
+	return out
 }
 
 // NewAlertMonitor creates a new alert monitor.
@@ -70,51 +169,130 @@ func NewAlertMonitor(thresholds AlertThresholds) *AlertMonitor {
 	if maxAlerts <= 0 {
 		maxAlerts = 100
 	}
-	return &AlertMonitor{
+	thresholds.SecurityMinSeverity = agent.SecuritySeverity(strings.ToUpper(string(thresholds.SecurityMinSeverity)))
+	am := &AlertMonitor{
 		thresholds: thresholds,
 		alerts:     make([]agent.Alert, 0),
 		maxAlerts:  maxAlerts,
 		alerted:    make(map[string]time.Time),
+		spend:      make(map[string]*commitSpend),
+		rates:      make(map[string]rateSample),
+		secSeen:    make(map[string]map[string]time.Time),
+		ruleSince:  make(map[string]time.Time),
+		now:        time.Now,
 	}
+	for _, r := range DefaultRules(thresholds) {
+		cr, _ := compileRule(r)
+		am.rules = append(am.rules, cr)
+	}
+	if thresholds.MemoryWarningPercent > 0 || thresholds.MemoryCriticalPercent > 0 {
+		am.hostMemMB, _ = HostMemoryMB()
+	}
+	return am
 }
 
-// Check evaluates an agent's CPU, memory, token count, cost, and idle time
-// against the configured thresholds. Alerts are deduplicated using a
-// per-agent cooldown window.
-func (am *AlertMonitor) Check(a *agent.Instance) {
+// SetHostMemoryMB overrides the host memory total used by the percentage
+// memory thresholds. NewAlertMonitor detects it automatically when those
+// thresholds are set; a value <= 0 disables them.
+func (am *AlertMonitor) SetHostMemoryMB(totalMB float64) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.hostMemMB = totalMB
+}
+
+// SetMetadata sets static key/value pairs (environment, hostname, ...) that
+// are attached to every alert generated from now on.
+func (am *AlertMonitor) SetMetadata(md map[string]string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.metadata = copyMetadata(md)
+}
+
+// SetMetadataInjector registers fn to supply per-alert metadata. It is called
+// with the monitor's lock held and must not call back into the AlertMonitor.
+func (am *AlertMonitor) SetMetadataInjector(fn MetadataFunc) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
+	am.injector = fn
+}
 
-	if a.CPU >= am.thresholds.CPUCritical {
-		am.addAlert(a, agent.AlertCritical, fmt.Sprintf("Critical CPU: %.1f%%", a.CPU), "cpu")
-	} else if a.CPU >= am.thresholds.CPUWarning {
-		am.addAlert(a, agent.AlertWarning, fmt.Sprintf("High CPU: %.1f%%", a.CPU), "cpu")
+// OnAlert registers fn to be called once for every new alert, from both
+// Check and CheckFleet; alerts suppressed by the cooldown are not passed on.
+// Handlers run on the goroutine calling Check or CheckFleet, in registration
+// order, once the monitor's lock has been released, so they may call back
+// into the AlertMonitor. A slow handler delays the check.
+func (am *AlertMonitor) OnAlert(fn func(agent.Alert)) {
+	if fn == nil {
+		return
 	}
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.handlers = append(am.handlers, fn)
+}
 
-	if a.Memory >= am.thresholds.MemoryCritical {
-		am.addAlert(a, agent.AlertCritical, fmt.Sprintf("Critical memory: %.1f MB", a.Memory), "mem")
-	} else if a.Memory >= am.thresholds.MemoryWarning {
-		am.addAlert(a, agent.AlertWarning, fmt.Sprintf("High memory: %.1f MB", a.Memory), "mem")
+// notify takes the alerts raised since the last call and passes them to the
+// handlers after releasing the lock, which the caller must hold.
+func (am *AlertMonitor) notify() {
+	handlers, raised := am.handlers, am.pending
+	am.pending = nil
+	am.mu.Unlock()
+	for _, al := range raised {
+		for _, fn := range handlers {
+			fn(al)
+		}
 	}
+}
 
-	if a.Tokens.TotalTokens >= am.thresholds.TokenCritical {
-		am.addAlert(a, agent.AlertCritical,
-			fmt.Sprintf("Critical tokens: %s", FormatTokenCount(a.Tokens.TotalTokens)), "tokens")
-	} else if a.Tokens.TotalTokens >= am.thresholds.TokenWarning {
-		am.addAlert(a, agent.AlertWarning,
-			fmt.Sprintf("High tokens: %s", FormatTokenCount(a.Tokens.TotalTokens)), "tokens")
+// Check evaluates an agent against the metric rules (the CPU, memory, token
+// and cost thresholds plus any added with AddMetricRule), then checks share
+// of host memory, request error rate, token and cost rates, spend per commit,
+// and idle time, and
+// optionally mirrors its security events. Alerts are deduplicated using a
+// per-agent cooldown window.
+//
+// Once a condition no longer holds, the agent's alerts of that type are
+// marked Resolved. The cooldown still applies: a recurrence within it
+// reopens the resolved alert rather than raising a new one, so a metric
+// flapping around its threshold alerts at most once per cooldown. Mirrored
+// security alerts record events rather than conditions and are never
+// resolved.
+func (am *AlertMonitor) Check(a *agent.Instance) {
+	am.mu.Lock()
+	am.check(a)
+	am.notify()
+}
+
+func (am *AlertMonitor) check(a *agent.Instance) {
+	am.firing = make(map[string]bool)
+	defer am.resolveCleared(a)
+
+	am.checkRules(a)
+
+	if am.hostMemMB > 0 {
+		pct := a.Memory / am.hostMemMB * 100
+		if am.thresholds.MemoryCriticalPercent > 0 && pct >= am.thresholds.MemoryCriticalPercent {
+			am.addAlert(a, agent.AlertCritical,
+				fmt.Sprintf("Critical memory: %.1f%% of host (%s)", pct, FormatMemory(a.Memory)), "mem_pct")
+		} else if am.thresholds.MemoryWarningPercent > 0 && pct >= am.thresholds.MemoryWarningPercent {
+			am.addAlert(a, agent.AlertWarning,
+				fmt.Sprintf("High memory: %.1f%% of host (%s)", pct, FormatMemory(a.Memory)), "mem_pct")
+		}
 	}
 
-	if a.Tokens.EstCost >= am.thresholds.CostCritical {
-		am.addAlert(a, agent.AlertCritical,
-			fmt.Sprintf("Critical cost: %s", FormatCost(a.Tokens.EstCost)), "cost")
-	} else if a.Tokens.EstCost >= am.thresholds.CostWarning {
-		am.addAlert(a, agent.AlertWarning,
-			fmt.Sprintf("High cost: %s", FormatCost(a.Tokens.EstCost)), "cost")
+	if am.thresholds.ErrorRate > 0 && a.Tokens.SuccessCount+a.Tokens.ErrorCount >= minErrorRateRequests {
+		if rate := a.Tokens.ErrorRate(); rate >= am.thresholds.ErrorRate {
+			am.addAlert(a, agent.AlertWarning,
+				fmt.Sprintf("High request error rate: %.0f%% (%d of %d failed)",
+					rate*100, a.Tokens.ErrorCount, a.Tokens.SuccessCount+a.Tokens.ErrorCount), "error_rate")
+		}
 	}
 
+	am.checkRates(a)
+	am.checkCommitSpend(a)
+	am.checkSecurityEvents(a)
+
 	if am.thresholds.IdleMinutes > 0 && !a.Session.LastActiveAt.IsZero() {
-		idleDur := time.Since(a.Session.LastActiveAt).Minutes()
+		idleDur := am.now().Sub(a.Session.LastActiveAt).Minutes()
 		if idleDur >= float64(am.thresholds.IdleMinutes) {
 			am.addAlert(a, agent.AlertInfo,
 				fmt.Sprintf("Agent idle for %.0f min", idleDur), "idle")
@@ -122,12 +300,173 @@ func (am *AlertMonitor) Check(a *agent.Instance) {
 	}
 }
 
+// rateSample is an agent's token and cost totals at its previous Check.
+type rateSample struct {
+	at     time.Time
+	tokens int64
+	cost   float64
+}
+
+// checkRates compares the agent's totals with its previous sample and warns
+// when tokens per minute or cost per hour exceed their thresholds. A drop in
+// either total (a counter reset) only resets the baseline.
+func (am *AlertMonitor) checkRates(a *agent.Instance) {
+	if am.thresholds.TokensPerMin <= 0 && am.thresholds.CostPerHour <= 0 {
+		return
+	}
+	now := am.now()
+	cur := rateSample{at: now, tokens: a.Tokens.TotalTokens, cost: a.Tokens.EstCost}
+	prev, ok := am.rates[a.Info.ID]
+	am.rates[a.Info.ID] = cur
+	if !ok || !now.After(prev.at) || cur.tokens < prev.tokens || cur.cost < prev.cost {
+		return
+	}
+	elapsed := now.Sub(prev.at)
+
+	if am.thresholds.TokensPerMin > 0 {
+		perMin := float64(cur.tokens-prev.tokens) / elapsed.Minutes()
+		if perMin >= float64(am.thresholds.TokensPerMin) {
+			am.addAlert(a, agent.AlertWarning,
+				fmt.Sprintf("High token rate: %s tokens/min", FormatTokenCount(int64(perMin))), "tokens_per_min")
+		}
+	}
+	if am.thresholds.CostPerHour > 0 {
+		perHour := (cur.cost - prev.cost) / elapsed.Hours()
+		if perHour >= am.thresholds.CostPerHour {
+			am.addAlert(a, agent.AlertWarning,
+				fmt.Sprintf("High spend rate: %s/hour", FormatCost(perHour)), "cost_per_hour")
+		}
+	}
+}
+
+// commitSpend holds cost samples taken since an agent's last commit.
+type commitSpend struct {
+	commits int
+	samples []costSample
+}
+
+type costSample struct {
+	at   time.Time
+	cost float64
+}
+
+const defaultNoCommitWindow = 30 * time.Minute
+
+func (am *AlertMonitor) checkCommitSpend(a *agent.Instance) {
+	commits := a.Git.SessionCommits
+	cost := a.Tokens.EstCost
+
+	if am.thresholds.CostPerCommit > 0 && commits > 0 {
+		if perCommit := cost / float64(commits); perCommit >= am.thresholds.CostPerCommit {
+			am.addAlert(a, agent.AlertWarning,
+				fmt.Sprintf("High cost per commit: %s (%s over %d commits)",
+					FormatCost(perCommit), FormatCost(cost), commits), "cost_per_commit")
+		}
+	}
+
+	if am.thresholds.NoCommitSpendUSD <= 0 {
+		return
+	}
+	window := time.Duration(am.thresholds.NoCommitWindowMinutes) * time.Minute
+	if window <= 0 {
+		window = defaultNoCommitWindow
+	}
+	now := am.now()
+
+	st := am.spend[a.Info.ID]
+	if st == nil {
+		st = &commitSpend{commits: commits}
+		am.spend[a.Info.ID] = st
+	}
+	// A new commit, or a counter reset, starts a fresh window.
+	if commits != st.commits || (len(st.samples) > 0 && cost < st.samples[len(st.samples)-1].cost) {
+		st.commits = commits
+		st.samples = st.samples[:0]
+	}
+	st.samples = append(st.samples, costSample{at: now, cost: cost})
+
+	// Keep the newest sample at or before the window start as the baseline.
+	cut := 0
+	for cut+1 < len(st.samples) && !st.samples[cut+1].at.After(now.Add(-window)) {
+		cut++
+	}
+	st.samples = st.samples[cut:]
+
+	base := st.samples[0]
+	if now.Sub(base.at) < window {
+		return
+	}
+	if spent := cost - base.cost; spent >= am.thresholds.NoCommitSpendUSD {
+		am.addAlert(a, agent.AlertWarning,
+			fmt.Sprintf("Spent %s in %.0f min without a commit", FormatCost(spent), window.Minutes()),
+			"no_commit_spend")
+	}
+}
+
+// checkSecurityEvents raises an AlertSecurity alert for each security event
+// selected by SecurityCategories or SecurityMinSeverity that was not seen by
+// an earlier Check. Events are told apart by timestamp, rule and detail, so
+// two recorded in the same instant are both considered. Alerts share the
+// usual cooldown, keyed by rule.
+func (am *AlertMonitor) checkSecurityEvents(a *agent.Instance) {
+	minRank := severityRank(am.thresholds.SecurityMinSeverity)
+	categories := am.thresholds.SecurityCategories
+	if minRank == 0 && len(categories) == 0 {
+		return
+	}
+	seen := am.secSeen[a.Info.ID]
+	if seen == nil {
+		seen = make(map[string]time.Time)
+		am.secSeen[a.Info.ID] = seen
+	}
+	var oldest time.Time
+	for _, evt := range a.SecurityEvents {
+		if oldest.IsZero() || evt.Timestamp.Before(oldest) {
+			oldest = evt.Timestamp
+		}
+		key := securityEventKey(evt)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = evt.Timestamp
+		page, mapped := categories[evt.Category]
+		if !mapped {
+			page = minRank > 0 && severityRank(evt.Severity) >= minRank
+		}
+		if !page {
+			continue
+		}
+		am.addAlert(a, agent.AlertSecurity,
+			fmt.Sprintf("Security %s: %s", evt.Severity, evt.Description), "security:"+evt.Rule)
+	}
+	// Forget events older than anything the agent still carries; they can
+	// no longer come back.
+	for key, ts := range seen {
+		if ts.Before(oldest) {
+			delete(seen, key)
+		}
+	}
+}
+
+// securityEventKey identifies a security event across Checks.
+func securityEventKey(evt agent.SecurityEvent) string {
+	return fmt.Sprintf("%d|%s|%s", evt.Timestamp.UnixNano(), evt.Rule, evt.Detail)
+}
+
 // CheckFleet evaluates aggregated token/cost usage for all agents against
 // optional budget thresholds. This is O(n) over agent slice and intended to be
-// called at the same cadence as other monitor checks.
+// called at the same cadence as other monitor checks. Fleet alerts are
+// resolved like Check resolves an agent's.
 func (am *AlertMonitor) CheckFleet(agents []agent.Instance) {
 	am.mu.Lock()
-	defer am.mu.Unlock()
+	am.checkFleet(agents)
+	am.notify()
+}
+
+func (am *AlertMonitor) checkFleet(agents []agent.Instance) {
+	fleet := &agent.Instance{Info: agent.Info{ID: "fleet", Name: "Fleet"}}
+	am.firing = make(map[string]bool)
+	defer am.resolveCleared(fleet)
 
 	if len(agents) == 0 {
 		return
@@ -149,8 +488,7 @@ func (am *AlertMonitor) CheckFleet(agents []agent.Instance) {
 		totalTokens += a.Tokens.TotalTokens
 	}
 
-	fleet := &agent.Instance{Info: agent.Info{ID: "fleet", Name: "Fleet"}}
-	now := time.Now()
+	now := am.now()
 	burnWarn := am.thresholds.BurnRateWarning
 	burnCritical := am.thresholds.BurnRateCritical
 	if burnWarn <= 0 {
@@ -230,6 +568,41 @@ func dailyBurnRate(totalCost, budget float64, now time.Time) float64 {
 	return totalCost / expected
 }
 
+// NoBudgetExhaustion is returned by [BudgetRunway] when the budget is not
+// projected to be exhausted within the current day.
+const NoBudgetExhaustion time.Duration = -1
+
+// BudgetRunway projects how long it will take, at the current daily burn
+// rate, for spendSoFar to reach budget. The rate is derived from the spend
+// accumulated since local midnight of now. It returns 0 when the budget is
+// already exhausted and [NoBudgetExhaustion] when there is not enough data
+// to project or the current pace will not exhaust the budget before the day
+// ends.
+func BudgetRunway(spendSoFar, budget float64, now time.Time) time.Duration {
+	if budget <= 0 {
+		return NoBudgetExhaustion
+	}
+	if spendSoFar >= budget {
+		return 0
+	}
+
+	burn := dailyBurnRate(spendSoFar, budget, now)
+	if burn <= 0 {
+		return NoBudgetExhaustion
+	}
+
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	elapsed := now.Sub(startOfDay)
+	perSecond := spendSoFar / elapsed.Seconds()
+	runway := time.Duration((budget - spendSoFar) / perSecond * float64(time.Second))
+
+	endOfDay := startOfDay.AddDate(0, 0, 1)
+	if now.Add(runway).After(endOfDay) {
+		return NoBudgetExhaustion
+	}
+	return runway
+}
+
 func monthlyBurnRate(totalCost, budget float64, now time.Time) float64 {
 	if budget <= 0 {
 		return 0
@@ -254,28 +627,73 @@ func (am *AlertMonitor) addAlert(a *agent.Instance, level agent.AlertLevel, msg,
 		cooldown = 5 * time.Minute
 	}
 
+	now := am.now()
 	key := a.Info.ID + ":" + alertType
+	if am.firing != nil {
+		am.firing[alertType] = true
+	}
 	if last, ok := am.alerted[key]; ok {
-		if time.Since(last) < cooldown {
+		if now.Sub(last) < cooldown {
+			am.reopen(a.Info.ID, alertType)
 			return
 		}
 	}
 
+	am.lastID++
 	alert := agent.Alert{
-		Timestamp: time.Now(),
+		ID:        am.lastID,
+		Timestamp: now,
 		Level:     level,
+		Type:      alertType,
 		AgentID:   a.Info.ID,
 		AgentName: a.Info.Name,
 		Message:   msg,
+		Metadata:  buildMetadata(am.metadata, am.injector, a),
 	}
 	am.alerts = append(am.alerts, alert)
-	am.alerted[key] = time.Now()
+	am.alerted[key] = now
+	am.subs.publish(alert)
+	if len(am.handlers) > 0 {
+		am.pending = append(am.pending, alert)
+	}
 
 	if len(am.alerts) > am.maxAlerts {
 		am.alerts = am.alerts[len(am.alerts)-am.maxAlerts:]
 	}
 }
 
+// resolveCleared marks the agent's unresolved alerts whose condition did not
+// fire during this Check as resolved.
+func (am *AlertMonitor) resolveCleared(a *agent.Instance) {
+	firing := am.firing
+	am.firing = nil
+	now := am.now()
+	for i := range am.alerts {
+		al := &am.alerts[i]
+		if al.Resolved || al.AgentID != a.Info.ID || firing[al.Type] || strings.HasPrefix(al.Type, "security:") {
+			continue
+		}
+		al.Resolved = true
+		al.ResolvedAt = now
+	}
+}
+
+// reopen marks the latest alert of alertType for agentID unresolved again,
+// if it was resolved.
+func (am *AlertMonitor) reopen(agentID, alertType string) {
+	for i := len(am.alerts) - 1; i >= 0; i-- {
+		al := &am.alerts[i]
+		if al.AgentID != agentID || al.Type != alertType {
+			continue
+		}
+		if al.Resolved {
+			al.Resolved = false
+			al.ResolvedAt = time.Time{}
+		}
+		return
+	}
+}
+
 // GetAlerts returns all alerts.
 func (am *AlertMonitor) GetAlerts() []agent.Alert {
 	am.mu.Lock()
@@ -285,6 +703,90 @@ func (am *AlertMonitor) GetAlerts() []agent.Alert {
 	return result
 }
 
+// ActiveAlerts returns the alerts that have not been resolved.
+func (am *AlertMonitor) ActiveAlerts() []agent.Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	var result []agent.Alert
+	for _, a := range am.alerts {
+		if !a.Resolved {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// AcknowledgeByID marks the retained alert with the given ID acknowledged
+// and reports whether it was found. Acknowledged alerts are still returned by
+// GetAlerts and counted by AlertCount.
+func (am *AlertMonitor) AcknowledgeByID(id uint64) bool {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	for i := range am.alerts {
+		if am.alerts[i].ID == id {
+			am.alerts[i].Acknowledged = true
+			return true
+		}
+	}
+	return false
+}
+
+// UnacknowledgedAlerts returns the alerts that have not been acknowledged.
+func (am *AlertMonitor) UnacknowledgedAlerts() []agent.Alert {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	var result []agent.Alert
+	for _, a := range am.alerts {
+		if !a.Acknowledged {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// SetHomeDir sets the home directory ExportJSON writes under when given no
+// path, as TokenMonitor.SetHomeDir does for logs. An empty dir restores the
+// default of os.UserHomeDir.
+func (am *AlertMonitor) SetHomeDir(dir string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.homeDir = dir
+}
+
+// ExportJSON writes all retained alerts, including their resolution and
+// acknowledgement state, to a JSON file. If path is empty, a timestamped file
+// is created in ~/.agentmetrics/alerts, under the SetHomeDir home if set.
+func (am *AlertMonitor) ExportJSON(path string) error {
+	am.mu.Lock()
+	alerts := make([]agent.Alert, len(am.alerts))
+	copy(alerts, am.alerts)
+	now := am.now()
+	home := am.homeDir
+	am.mu.Unlock()
+
+	if path == "" {
+		if home == "" {
+			var err error
+			if home, err = os.UserHomeDir(); err != nil {
+				return err
+			}
+		}
+		path = filepath.Join(home, ".agentmetrics", "alerts", fmt.Sprintf("alerts_%s.json",
+			now.Format("20060102_150405")))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(alerts, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
 // GetRecentAlerts returns alerts from the last N minutes.
 func (am *AlertMonitor) GetRecentAlerts(minutes int) []agent.Alert {
 	am.mu.Lock()
@@ -300,7 +802,57 @@ func (am *AlertMonitor) GetRecentAlerts(minutes int) []agent.Alert {
 	return result
 }
 
-// AlertCount returns counts by level.
+// AlertSummary groups the retained alerts that share an agent, type and
+// level.
+type AlertSummary struct {
+	AgentID     string           `json:"agent_id"`
+	AgentName   string           `json:"agent_name"`
+	Type        string           `json:"type"`
+	Level       agent.AlertLevel `json:"level"`
+	Count       int              `json:"count"`
+	FirstSeen   time.Time        `json:"first_seen"`
+	LastSeen    time.Time        `json:"last_seen"`
+	LastMessage string           `json:"last_message"`
+}
+
+// GetAlertSummaries collapses the retained alerts into one summary per
+// agent ID, type and level, most recently seen first.
+func (am *AlertMonitor) GetAlertSummaries() []AlertSummary {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	index := make(map[string]int)
+	var out []AlertSummary
+	for _, al := range am.alerts {
+		key := al.AgentID + "\x00" + al.Type + "\x00" + string(al.Level)
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, AlertSummary{
+				AgentID:   al.AgentID,
+				AgentName: al.AgentName,
+				Type:      al.Type,
+				Level:     al.Level,
+				FirstSeen: al.Timestamp,
+			})
+			i = len(out) - 1
+		}
+		s := &out[i]
+		s.Count++
+		if al.Timestamp.Before(s.FirstSeen) {
+			s.FirstSeen = al.Timestamp
+		}
+		if !al.Timestamp.Before(s.LastSeen) {
+			s.LastSeen = al.Timestamp
+			s.LastMessage = al.Message
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].LastSeen.After(out[j].LastSeen) })
+	return out
+}
+
+// AlertCount returns counts by level. Alerts at the AlertSecurity level are
+// not included; SecurityAlertCount returns them.
 func (am *AlertMonitor) AlertCount() (info, warning, critical int) {
 	am.mu.Lock()
 	defer am.mu.Unlock()
@@ -316,3 +868,17 @@ func (am *AlertMonitor) AlertCount() (info, warning, critical int) {
 	}
 	return
 }
+
+// SecurityAlertCount returns the number of alerts at the AlertSecurity
+// level, raised from security events or by rules.
+func (am *AlertMonitor) SecurityAlertCount() int {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	n := 0
+	for _, a := range am.alerts {
+		if a.Level == agent.AlertSecurity {
+			n++
+		}
+	}
+	return n
+}
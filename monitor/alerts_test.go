@@ -1,10 +1,16 @@
 package monitor
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
 )
 
 func TestDefaultThresholds(t *testing.T) {
@@ -139,6 +145,379 @@ func TestCheck_MemoryCritical(t *testing.T) {
 	}
 }
 
+func TestCheck_MemoryPercentOfHost(t *testing.T) {
+	th := DefaultThresholds()
+	th.MemoryWarning = 1e9 // keep absolute thresholds out of the way
+	th.MemoryCritical = 1e9
+	th.MemoryWarningPercent = 20
+	th.MemoryCriticalPercent = 50
+
+	tests := []struct {
+		name   string
+		memory float64
+		want   agent.AlertLevel
+	}{
+		{"below", 1600, ""},
+		{"warning at 20%", 1638.4, agent.AlertWarning},
+		{"warning below critical", 4000, agent.AlertWarning},
+		{"critical at 50%", 4096, agent.AlertCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			am := NewAlertMonitor(th)
+			am.SetHostMemoryMB(8192)
+			am.Check(&agent.Instance{Info: agent.Info{ID: "test"}, Memory: tt.memory})
+			alerts := am.GetAlerts()
+			if tt.want == "" {
+				if len(alerts) != 0 {
+					t.Fatalf("got %d alerts, want 0: %+v", len(alerts), alerts)
+				}
+				return
+			}
+			if len(alerts) != 1 {
+				t.Fatalf("got %d alerts, want 1: %+v", len(alerts), alerts)
+			}
+			if alerts[0].Level != tt.want {
+				t.Errorf("alert level = %q, want %q", alerts[0].Level, tt.want)
+			}
+			if !strings.Contains(alerts[0].Message, "of host") {
+				t.Errorf("message = %q, want host share", alerts[0].Message)
+			}
+		})
+	}
+}
+
+func TestCheck_MemoryPercentAlongsideAbsolute(t *testing.T) {
+	th := DefaultThresholds()
+	th.MemoryWarningPercent = 20
+	am := NewAlertMonitor(th)
+	am.SetHostMemoryMB(2048)
+	am.Check(&agent.Instance{Info: agent.Info{ID: "test"}, Memory: 600})
+	if got := len(am.GetAlerts()); got != 2 {
+		t.Fatalf("got %d alerts, want absolute and percent alerts", got)
+	}
+
+	am = NewAlertMonitor(th)
+	am.SetHostMemoryMB(0)
+	am.Check(&agent.Instance{Info: agent.Info{ID: "test"}, Memory: 600})
+	if got := len(am.GetAlerts()); got != 1 {
+		t.Fatalf("got %d alerts, want only absolute alert without host total", got)
+	}
+}
+
+func TestCheck_ErrorRate(t *testing.T) {
+	tests := []struct {
+		name            string
+		success, errors int
+		wantAlert       bool
+	}{
+		{"too few requests", 1, 3, false},
+		{"below threshold", 8, 2, false},
+		{"at threshold", 6, 2, true},
+		{"all failing", 0, 5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			am := NewAlertMonitor(DefaultThresholds())
+			am.Check(&agent.Instance{
+				Info:   agent.Info{ID: "test"},
+				Tokens: agent.TokenMetrics{SuccessCount: tt.success, ErrorCount: tt.errors},
+			})
+			alerts := am.GetAlerts()
+			if got := len(alerts) == 1; got != tt.wantAlert {
+				t.Fatalf("alerts = %+v, want alert %v", alerts, tt.wantAlert)
+			}
+			if tt.wantAlert && !strings.Contains(alerts[0].Message, "error rate") {
+				t.Errorf("message = %q", alerts[0].Message)
+			}
+		})
+	}
+}
+
+func TestCheck_CostPerCommit(t *testing.T) {
+	th := DefaultThresholds()
+	th.CostWarning = 1000
+	th.CostCritical = 1000
+	th.CostPerCommit = 2.0
+
+	tests := []struct {
+		name      string
+		cost      float64
+		commits   int
+		wantAlert bool
+	}{
+		{"no commits yet", 10, 0, false},
+		{"cheap commits", 3, 4, false},
+		{"expensive commits", 9, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			am := NewAlertMonitor(th)
+			am.Check(&agent.Instance{
+				Info:   agent.Info{ID: "test"},
+				Tokens: agent.TokenMetrics{EstCost: tt.cost},
+				Git:    agent.GitActivity{SessionCommits: tt.commits},
+			})
+			alerts := am.GetAlerts()
+			if got := len(alerts) == 1; got != tt.wantAlert {
+				t.Fatalf("alerts = %+v, want alert %v", alerts, tt.wantAlert)
+			}
+			if tt.wantAlert && !strings.Contains(alerts[0].Message, "per commit") {
+				t.Errorf("message = %q", alerts[0].Message)
+			}
+		})
+	}
+}
+
+func TestCheck_NoCommitSpend(t *testing.T) {
+	th := DefaultThresholds()
+	th.CostWarning = 1000
+	th.CostCritical = 1000
+	th.NoCommitSpendUSD = 5
+	th.NoCommitWindowMinutes = 30
+
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	run := func(commitsAt func(min int) int) []agent.Alert {
+		am := NewAlertMonitor(th)
+		for min := 0; min <= 60; min += 5 {
+			now := start.Add(time.Duration(min) * time.Minute)
+			am.now = func() time.Time { return now }
+			am.Check(&agent.Instance{
+				Info:   agent.Info{ID: "test"},
+				Tokens: agent.TokenMetrics{EstCost: float64(min) * 0.25}, // $15/hour
+				Git:    agent.GitActivity{SessionCommits: commitsAt(min)},
+			})
+		}
+		return am.GetAlerts()
+	}
+
+	thrashing := run(func(int) int { return 0 })
+	if len(thrashing) == 0 {
+		t.Fatal("expected no_commit_spend alert for high spend without commits")
+	}
+	if want := start.Add(30 * time.Minute); !thrashing[0].Timestamp.Equal(want) {
+		t.Errorf("first alert at %v, want once the window is full at %v", thrashing[0].Timestamp, want)
+	}
+	if !strings.Contains(thrashing[0].Message, "without a commit") {
+		t.Errorf("message = %q", thrashing[0].Message)
+	}
+
+	// Committing every 15 minutes keeps spend between commits under $5.
+	productive := run(func(min int) int { return min / 15 })
+	if len(productive) != 0 {
+		t.Errorf("got %d alerts for regular commits, want 0: %+v", len(productive), productive)
+	}
+}
+
+func TestCheck_Rates(t *testing.T) {
+	th := DefaultThresholds()
+	th.TokenWarning, th.TokenCritical = 1e9, 1e9
+	th.CostWarning, th.CostCritical = 1000, 1000
+	th.TokensPerMin = 10000
+	th.CostPerHour = 5
+
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	sample := func(am *AlertMonitor, at time.Duration, tokens int64, cost float64) {
+		am.now = func() time.Time { return start.Add(at) }
+		am.Check(&agent.Instance{
+			Info:   agent.Info{ID: "test"},
+			Tokens: agent.TokenMetrics{TotalTokens: tokens, EstCost: cost},
+		})
+	}
+	types := func(am *AlertMonitor) map[string]bool {
+		out := map[string]bool{}
+		for _, al := range am.GetAlerts() {
+			out[al.Type] = true
+		}
+		return out
+	}
+
+	// 60k tokens and $1 in two minutes: 30k/min and $30/hour.
+	am := NewAlertMonitor(th)
+	sample(am, 0, 100000, 2)
+	if got := am.GetAlerts(); len(got) != 0 {
+		t.Fatalf("first sample raised %d alerts, want 0 (no baseline)", len(got))
+	}
+	sample(am, 2*time.Minute, 160000, 3)
+	if got := types(am); !got["tokens_per_min"] || !got["cost_per_hour"] {
+		t.Errorf("alert types = %v, want tokens_per_min and cost_per_hour", got)
+	}
+
+	// 5k tokens and $0.10 in ten minutes stays under both thresholds.
+	am = NewAlertMonitor(th)
+	sample(am, 0, 100000, 2)
+	sample(am, 10*time.Minute, 105000, 2.1)
+	if got := am.GetAlerts(); len(got) != 0 {
+		t.Errorf("slow usage raised %d alerts, want 0: %+v", len(got), got)
+	}
+
+	// A counter reset only moves the baseline.
+	am = NewAlertMonitor(th)
+	sample(am, 0, 500000, 10)
+	sample(am, time.Minute, 1000, 0.01)
+	if got := am.GetAlerts(); len(got) != 0 {
+		t.Errorf("counter reset raised %d alerts, want 0: %+v", len(got), got)
+	}
+}
+
+func TestCheck_SecurityEventsMirrored(t *testing.T) {
+	th := DefaultThresholds()
+	th.SecurityMinSeverity = agent.SecSevHigh
+	am := NewAlertMonitor(th)
+
+	t0 := time.Now()
+	inst := &agent.Instance{
+		Info: agent.Info{ID: "test", Name: "Test Agent"},
+		SecurityEvents: []agent.SecurityEvent{
+			{Timestamp: t0, Severity: agent.SecSevCritical, Description: "Reverse shell", Rule: "reverse_shell:nc -e"},
+			{Timestamp: t0, Severity: agent.SecSevMedium, Description: "Package install", Rule: "package_install:npm"},
+		},
+	}
+	am.Check(inst)
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1 for the critical event: %+v", len(alerts), alerts)
+	}
+	if alerts[0].Level != agent.AlertSecurity {
+		t.Errorf("level = %q, want SECURITY", alerts[0].Level)
+	}
+	if !strings.Contains(alerts[0].Message, "Reverse shell") {
+		t.Errorf("message = %q", alerts[0].Message)
+	}
+
+	// Events already seen are not raised again, even after the cooldown.
+	am.now = func() time.Time { return t0.Add(time.Hour) }
+	am.Check(inst)
+	if got := len(am.GetAlerts()); got != 1 {
+		t.Errorf("got %d alerts after re-check, want 1", got)
+	}
+
+	inst.SecurityEvents = append(inst.SecurityEvents, agent.SecurityEvent{
+		Timestamp: t0.Add(time.Hour), Severity: agent.SecSevHigh, Description: "Credential access", Rule: "credential_access:.aws",
+	})
+	am.Check(inst)
+	if got := len(am.GetAlerts()); got != 2 {
+		t.Errorf("got %d alerts after a new high event, want 2", got)
+	}
+}
+
+func TestCheck_SecurityEventsOptIn(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	am.Check(&agent.Instance{
+		Info: agent.Info{ID: "test"},
+		SecurityEvents: []agent.SecurityEvent{
+			{Timestamp: time.Now(), Severity: agent.SecSevCritical, Rule: "dangerous:rm -rf"},
+		},
+	})
+	if got := len(am.GetAlerts()); got != 0 {
+		t.Errorf("got %d alerts with SecurityMinSeverity unset, want 0", got)
+	}
+}
+
+func TestCheck_SecurityCategories(t *testing.T) {
+	th := DefaultThresholds()
+	th.SecurityCategories = map[agent.SecurityCategory]bool{
+		agent.SecCatReverseShell:     true,
+		agent.SecCatCredentialAccess: true,
+		agent.SecCatDangerousCommand: false,
+	}
+	am := NewAlertMonitor(th)
+
+	t0 := time.Now()
+	am.Check(&agent.Instance{
+		Info: agent.Info{ID: "test"},
+		SecurityEvents: []agent.SecurityEvent{
+			{Timestamp: t0, Category: agent.SecCatReverseShell, Severity: agent.SecSevCritical, Description: "Reverse shell", Rule: "reverse_shell:nc -e"},
+			{Timestamp: t0, Category: agent.SecCatCredentialAccess, Severity: agent.SecSevLow, Description: "Credential access", Rule: "credential_file:.aws"},
+			{Timestamp: t0, Category: agent.SecCatDangerousCommand, Severity: agent.SecSevCritical, Description: "Dangerous command", Rule: "dangerous_command:rm -rf"},
+			{Timestamp: t0, Category: agent.SecCatPackageInstall, Severity: agent.SecSevCritical, Description: "Package install", Rule: "package_install:npm"},
+		},
+	})
+
+	got := map[string]bool{}
+	for _, al := range am.GetAlerts() {
+		if al.Level != agent.AlertSecurity {
+			t.Errorf("unexpected %s alert %q", al.Level, al.Message)
+		}
+		got[al.Message] = true
+	}
+	if len(got) != 2 || !got["Security LOW: Credential access"] || !got["Security CRITICAL: Reverse shell"] {
+		t.Errorf("alerts = %v, want only the mapped categories", got)
+	}
+}
+
+func TestCheck_SecurityCategoriesWithMinSeverity(t *testing.T) {
+	th := DefaultThresholds()
+	th.SecurityMinSeverity = agent.SecSevHigh
+	th.SecurityCategories = map[agent.SecurityCategory]bool{agent.SecCatPackageInstall: false}
+	am := NewAlertMonitor(th)
+
+	t0 := time.Now()
+	am.Check(&agent.Instance{
+		Info: agent.Info{ID: "test"},
+		SecurityEvents: []agent.SecurityEvent{
+			{Timestamp: t0, Category: agent.SecCatPackageInstall, Severity: agent.SecSevCritical, Rule: "package_install:npm"},
+			{Timestamp: t0, Category: agent.SecCatObfuscation, Severity: agent.SecSevHigh, Rule: "obfuscation:base64 -d"},
+			{Timestamp: t0, Category: agent.SecCatObfuscation, Severity: agent.SecSevMedium, Rule: "obfuscation:xxd"},
+		},
+	})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Message, "HIGH") {
+		t.Errorf("alerts = %+v, want only the unmapped high event", alerts)
+	}
+}
+
+func TestCheck_SecurityEventsSameTimestampAcrossChecks(t *testing.T) {
+	th := DefaultThresholds()
+	th.SecurityMinSeverity = "high" // lower case, as written in a config file
+	am := NewAlertMonitor(th)
+
+	t0 := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	first := agent.SecurityEvent{Timestamp: t0, Category: agent.SecCatObfuscation, Severity: agent.SecSevHigh, Rule: "obfuscation:base64 -d", Description: "Obfuscation"}
+	inst := &agent.Instance{Info: agent.Info{ID: "test"}, SecurityEvents: []agent.SecurityEvent{first}}
+	am.Check(inst)
+
+	// A second event recorded in the same instant shows up on the next Check.
+	second := agent.SecurityEvent{Timestamp: t0, Category: agent.SecCatReverseShell, Severity: agent.SecSevCritical, Rule: "reverse_shell:nc -e", Description: "Reverse shell"}
+	inst.SecurityEvents = append(inst.SecurityEvents, second)
+	am.Check(inst)
+	am.Check(inst)
+
+	got := map[string]int{}
+	for _, al := range am.GetAlerts() {
+		got[al.Message]++
+	}
+	if len(got) != 2 || got["Security HIGH: Obfuscation"] != 1 || got["Security CRITICAL: Reverse shell"] != 1 {
+		t.Errorf("alerts = %v, want one per event", got)
+	}
+}
+
+func TestSecurityMonitorToAlertMonitor(t *testing.T) {
+	sm := NewSecurityMonitor(config.DefaultConfig().Security)
+	th := DefaultThresholds()
+	th.SecurityMinSeverity = agent.SecSevCritical
+	am := NewAlertMonitor(th)
+
+	inst := &agent.Instance{
+		Info: agent.Info{ID: "test"},
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{
+			{Command: "rm -rf /"},
+		}},
+	}
+	sm.CheckAgent(inst)
+	am.Check(inst)
+
+	var found bool
+	for _, a := range am.GetAlerts() {
+		if a.Level == agent.AlertSecurity {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a SECURITY alert from a critical event; events=%+v", inst.SecurityEvents)
+	}
+}
+
 func TestCheck_TokenWarning(t *testing.T) {
 	th := DefaultThresholds()
 	th.CooldownMinutes = 0
@@ -232,6 +611,197 @@ func TestCheck_IdleAlert(t *testing.T) {
 	}
 }
 
+func TestCheck_ResolvesClearedAlerts(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	am.now = func() time.Time { return now }
+	check := func(cpu float64) {
+		am.Check(&agent.Instance{Info: agent.Info{ID: "test", Name: "Test Agent"}, CPU: cpu})
+	}
+
+	check(97) // spike
+	if active := am.ActiveAlerts(); len(active) != 1 || active[0].Type != "cpu" {
+		t.Fatalf("ActiveAlerts after spike = %+v, want one cpu alert", active)
+	}
+
+	now = now.Add(time.Minute)
+	check(90) // still above the warning threshold
+	if active := am.ActiveAlerts(); len(active) != 1 {
+		t.Fatalf("ActiveAlerts while still high = %d, want 1", len(active))
+	}
+
+	now = now.Add(time.Minute)
+	check(20) // recovered
+	if active := am.ActiveAlerts(); len(active) != 0 {
+		t.Errorf("ActiveAlerts after recovery = %+v, want none", active)
+	}
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 || !alerts[0].Resolved || !alerts[0].ResolvedAt.Equal(now) {
+		t.Fatalf("GetAlerts after recovery = %+v, want the spike resolved at %v", alerts, now)
+	}
+
+	// A new spike inside the cooldown reopens the alert; flapping does not
+	// raise one alert per spike.
+	for i := 0; i < 2; i++ {
+		now = now.Add(time.Minute)
+		check(97)
+		if active := am.ActiveAlerts(); len(active) != 1 || active[0].ID != alerts[0].ID || !active[0].ResolvedAt.IsZero() {
+			t.Fatalf("ActiveAlerts after spike inside cooldown = %+v, want the first alert reopened", active)
+		}
+		now = now.Add(30 * time.Second)
+		check(20)
+	}
+	if got := len(am.GetAlerts()); got != 1 {
+		t.Errorf("GetAlerts after flapping = %d, want 1", got)
+	}
+
+	// Once the cooldown has passed, a spike raises a new alert.
+	now = now.Add(5 * time.Minute)
+	check(97)
+	if active := am.ActiveAlerts(); len(active) != 1 || !active[0].Timestamp.Equal(now) {
+		t.Errorf("ActiveAlerts after the cooldown = %+v, want a new alert", active)
+	}
+	if got := len(am.GetAlerts()); got != 2 {
+		t.Errorf("GetAlerts = %d, want 2", got)
+	}
+}
+
+func TestCheckFleet_ResolvesClearedAlerts(t *testing.T) {
+	th := DefaultThresholds()
+	th.DailyBudgetUSD = 10
+	am := NewAlertMonitor(th)
+	now := time.Date(2026, 3, 10, 23, 0, 0, 0, time.Local)
+	am.now = func() time.Time { return now }
+
+	am.CheckFleet([]agent.Instance{{Info: agent.Info{ID: "a"}, Tokens: agent.TokenMetrics{EstCost: 12}}})
+	if active := am.ActiveAlerts(); len(active) != 1 || active[0].Type != "budget_daily" {
+		t.Fatalf("ActiveAlerts = %+v, want a daily budget alert", active)
+	}
+
+	// A new day: the spend counters reset and the budget is back in range.
+	now = now.Add(2 * time.Hour)
+	am.CheckFleet([]agent.Instance{{Info: agent.Info{ID: "a"}, Tokens: agent.TokenMetrics{EstCost: 0.1}}})
+	if active := am.ActiveAlerts(); len(active) != 0 {
+		t.Errorf("ActiveAlerts after the spend dropped = %+v, want none", active)
+	}
+	if alerts := am.GetAlerts(); len(alerts) != 1 || !alerts[0].ResolvedAt.Equal(now) {
+		t.Errorf("GetAlerts = %+v, want the budget alert resolved at %v", alerts, now)
+	}
+}
+
+func TestAlert_ResolvedAtOmittedWhileOpen(t *testing.T) {
+	data, err := json.Marshal(agent.Alert{ID: 1, Level: agent.AlertWarning})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "resolved_at") {
+		t.Errorf("open alert JSON = %s, want no resolved_at", data)
+	}
+}
+
+func TestAlertMonitor_OnAlert(t *testing.T) {
+	th := DefaultThresholds()
+	th.DailyBudgetUSD = 1
+	am := NewAlertMonitor(th)
+	am.now = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local) }
+	var got []agent.Alert
+	am.OnAlert(func(al agent.Alert) {
+		got = append(got, al)
+		// Handlers run unlocked, so calling back must not deadlock.
+		am.AlertCount()
+	})
+
+	inst := &agent.Instance{Info: agent.Info{ID: "test", Name: "Test Agent"}, CPU: 97}
+	am.Check(inst)
+	am.Check(inst) // within the cooldown
+	am.CheckFleet([]agent.Instance{{Info: agent.Info{ID: "a1"}, Tokens: agent.TokenMetrics{EstCost: 2}}})
+
+	alerts := am.GetAlerts()
+	if len(alerts) != 2 {
+		t.Fatalf("got %d alerts, want cpu and budget_daily", len(alerts))
+	}
+	if !reflect.DeepEqual(got, alerts) {
+		t.Errorf("callback got %+v, want each alert once: %+v", got, alerts)
+	}
+}
+
+func TestAlertMonitor_AcknowledgeByID(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a"}, CPU: 97})
+	am.Check(&agent.Instance{Info: agent.Info{ID: "b"}, CPU: 85})
+	alerts := am.GetAlerts()
+	if len(alerts) != 2 || alerts[0].ID == alerts[1].ID {
+		t.Fatalf("alerts = %+v, want two with distinct IDs", alerts)
+	}
+
+	if !am.AcknowledgeByID(alerts[0].ID) {
+		t.Fatal("AcknowledgeByID returned false for a retained alert")
+	}
+	if am.AcknowledgeByID(999) {
+		t.Error("AcknowledgeByID returned true for an unknown ID")
+	}
+
+	unacked := am.UnacknowledgedAlerts()
+	if len(unacked) != 1 || unacked[0].ID != alerts[1].ID {
+		t.Errorf("UnacknowledgedAlerts = %+v, want only %d", unacked, alerts[1].ID)
+	}
+	if got := am.GetAlerts(); len(got) != 2 || !got[0].Acknowledged {
+		t.Errorf("GetAlerts = %+v, want both with the first acknowledged", got)
+	}
+	if _, warning, critical := am.AlertCount(); warning != 1 || critical != 1 {
+		t.Errorf("AlertCount = %d warning, %d critical, want 1 and 1", warning, critical)
+	}
+}
+
+func TestAlertMonitor_ExportJSON(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	am.now = func() time.Time { return now }
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a", Name: "A"}, CPU: 97})
+	am.Check(&agent.Instance{Info: agent.Info{ID: "b", Name: "B"}, CPU: 85})
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a", Name: "A"}, CPU: 10}) // resolves a
+	am.AcknowledgeByID(am.GetAlerts()[1].ID)
+
+	path := filepath.Join(t.TempDir(), "out", "alerts.json")
+	if err := am.ExportJSON(path); err != nil {
+		t.Fatalf("ExportJSON error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	var got []agent.Alert
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	if want := am.GetAlerts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %+v, want %+v", got, want)
+	}
+	if len(got) != 2 || !got[0].Resolved || !got[1].Acknowledged {
+		t.Errorf("exported alerts lost their state: %+v", got)
+	}
+
+	// An empty path writes a timestamped file under the home directory.
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := am.ExportJSON(""); err != nil {
+		t.Fatalf("ExportJSON with empty path error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".agentmetrics", "alerts", "alerts_20260310_090000.json")); err != nil {
+		t.Errorf("expected auto-generated alerts file: %v", err)
+	}
+
+	// SetHomeDir takes precedence over the user's home.
+	other := t.TempDir()
+	am.SetHomeDir(other)
+	if err := am.ExportJSON(""); err != nil {
+		t.Fatalf("ExportJSON with SetHomeDir error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(other, ".agentmetrics", "alerts", "alerts_20260310_090000.json")); err != nil {
+		t.Errorf("expected alerts file under the SetHomeDir home: %v", err)
+	}
+}
+
 func TestCheck_NoAlerts(t *testing.T) {
 	th := DefaultThresholds()
 	am := NewAlertMonitor(th)
@@ -299,6 +869,30 @@ func TestGetRecentAlerts(t *testing.T) {
 	}
 }
 
+func TestSecurityAlertCount(t *testing.T) {
+	th := DefaultThresholds()
+	th.CooldownMinutes = 0
+	th.SecurityMinSeverity = agent.SecSevHigh
+	am := NewAlertMonitor(th)
+
+	t0 := time.Now()
+	am.Check(&agent.Instance{
+		Info: agent.Info{ID: "a1", Name: "Agent 1"},
+		CPU:  96.0, // Critical
+		SecurityEvents: []agent.SecurityEvent{
+			{Timestamp: t0, Severity: agent.SecSevCritical, Description: "Reverse shell", Rule: "reverse_shell:nc -e"},
+			{Timestamp: t0, Severity: agent.SecSevHigh, Description: "Crontab edit", Rule: "persistence:crontab -e"},
+		},
+	})
+
+	if got := am.SecurityAlertCount(); got != 2 {
+		t.Errorf("SecurityAlertCount = %d, want 2", got)
+	}
+	if info, warning, critical := am.AlertCount(); info != 0 || warning != 0 || critical != 1 {
+		t.Errorf("AlertCount = %d, %d, %d; want only the CPU alert as critical", info, warning, critical)
+	}
+}
+
 func TestAlertCount(t *testing.T) {
 	th := DefaultThresholds()
 	th.CooldownMinutes = 0
@@ -341,6 +935,8 @@ func TestCheckFleet_DailyBudgetWarning(t *testing.T) {
 	th.DailyBudgetUSD = 10
 	th.BudgetWarnPercent = 80
 	am := NewAlertMonitor(th)
+	// Late in the day the spend is on pace, so only the usage warning fires.
+	am.now = func() time.Time { return time.Date(2026, 3, 10, 23, 0, 0, 0, time.Local) }
 
 	agents := []agent.Instance{
 		{Info: agent.Info{ID: "a1", Name: "A1"}, Tokens: agent.TokenMetrics{EstCost: 4}},
@@ -447,3 +1043,116 @@ func TestMaxAlerts_Truncation(t *testing.T) {
 		t.Errorf("got %d alerts, want <= 5 (maxAlerts)", len(alerts))
 	}
 }
+
+func TestBudgetRunway(t *testing.T) {
+	day := func(h, m int) time.Time { return time.Date(2026, 3, 10, h, m, 0, 0, time.Local) }
+
+	tests := []struct {
+		name   string
+		spend  float64
+		budget float64
+		now    time.Time
+		want   time.Duration
+	}{
+		{"double pace at 6am", 5, 10, day(6, 0), 6 * time.Hour},
+		{"1.5x pace at noon", 6, 10, day(12, 0), 8 * time.Hour},
+		{"under pace", 2, 10, day(12, 0), NoBudgetExhaustion},
+		{"already exhausted", 12, 10, day(12, 0), 0},
+		{"too early to project", 1, 10, day(0, 3), NoBudgetExhaustion},
+		{"no spend", 0, 10, day(12, 0), NoBudgetExhaustion},
+		{"no budget", 5, 0, day(12, 0), NoBudgetExhaustion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BudgetRunway(tt.spend, tt.budget, tt.now)
+			if diff := got - tt.want; diff > time.Second || diff < -time.Second {
+				t.Errorf("BudgetRunway(%.2f, %.2f) = %v, want %v", tt.spend, tt.budget, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertMetadata(t *testing.T) {
+	th := DefaultThresholds()
+	th.CooldownMinutes = 0
+	am := NewAlertMonitor(th)
+	am.SetMetadata(map[string]string{"env": "ci", "host": "builder-1"})
+	am.SetMetadataInjector(func(a *agent.Instance) map[string]string {
+		return map[string]string{"trace_id": "trace-" + a.Info.ID, "host": "override"}
+	})
+
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a1", Name: "A1"}, CPU: 99})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	md := alerts[0].Metadata
+	if md["env"] != "ci" {
+		t.Errorf("env = %q, want ci", md["env"])
+	}
+	if md["trace_id"] != "trace-a1" {
+		t.Errorf("trace_id = %q, want trace-a1", md["trace_id"])
+	}
+	if md["host"] != "override" {
+		t.Errorf("host = %q, want injector to override static value", md["host"])
+	}
+
+	data, err := json.Marshal(alerts[0])
+	if err != nil {
+		t.Fatalf("marshal alert: %v", err)
+	}
+	if !strings.Contains(string(data), `"trace_id":"trace-a1"`) {
+		t.Errorf("serialized alert missing metadata: %s", data)
+	}
+}
+
+func TestAlertMetadata_NoneConfigured(t *testing.T) {
+	th := DefaultThresholds()
+	am := NewAlertMonitor(th)
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a1", Name: "A1"}, CPU: 99})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if alerts[0].Metadata != nil {
+		t.Errorf("Metadata = %v, want nil", alerts[0].Metadata)
+	}
+}
+
+func TestGetAlertSummaries(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	t0 := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	now := t0
+	am.now = func() time.Time { return now }
+
+	hot := &agent.Instance{Info: agent.Info{ID: "hot", Name: "Hot"}, CPU: 90}
+	for i := 0; i < 4; i++ {
+		now = t0.Add(time.Duration(i) * 10 * time.Minute)
+		hot.CPU = 90 + float64(i)
+		am.Check(hot)
+	}
+	now = t0.Add(45 * time.Minute)
+	am.Check(&agent.Instance{Info: agent.Info{ID: "other"}, CPU: 99})
+
+	if got := len(am.GetAlerts()); got != 5 {
+		t.Fatalf("got %d alerts, want 5", got)
+	}
+	sums := am.GetAlertSummaries()
+	if len(sums) != 2 {
+		t.Fatalf("got %d summaries, want 2: %+v", len(sums), sums)
+	}
+	if sums[0].AgentID != "other" || sums[0].Level != agent.AlertCritical || sums[0].Count != 1 {
+		t.Errorf("most recent summary = %+v", sums[0])
+	}
+	s := sums[1]
+	if s.AgentID != "hot" || s.Type != "cpu" || s.Level != agent.AlertWarning || s.Count != 4 {
+		t.Fatalf("hot summary = %+v", s)
+	}
+	if !s.FirstSeen.Equal(t0) || !s.LastSeen.Equal(t0.Add(30*time.Minute)) {
+		t.Errorf("FirstSeen/LastSeen = %v/%v", s.FirstSeen, s.LastSeen)
+	}
+	if s.LastMessage != "High CPU: 93.0%" {
+		t.Errorf("LastMessage = %q", s.LastMessage)
+	}
+}
@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"os"
+	"os/exec"
 	"testing"
 	"time"
 
@@ -78,3 +80,81 @@ func BenchmarkAlertMonitorCheckFleet(b *testing.B) {
 		am.CheckFleet(agents)
 	}
 }
+
+var benchNetBytes int64
+
+func BenchmarkNetworkBytes_ProcSockets(b *testing.B) {
+	if _, err := procConnections("/proc", os.Getpid()); err != nil {
+		b.Skipf("proc sockets unavailable: %v", err)
+	}
+	b.ReportAllocs()
+	pid := os.Getpid()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conns, _ := procConnections("/proc", pid)
+		benchNetBytes = establishedBytes(conns)
+	}
+}
+
+func BenchmarkNetworkBytes_Nettop(b *testing.B) {
+	_, errNettop := exec.LookPath("nettop")
+	_, errLsof := exec.LookPath("lsof")
+	if errNettop != nil && errLsof != nil {
+		b.Skip("neither nettop nor lsof installed")
+	}
+	b.ReportAllocs()
+	pid := os.Getpid()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		benchNetBytes, _ = nettopBytesForPID(pid)
+	}
+}
+
+func BenchmarkGetAllAgentConnections(b *testing.B) {
+	pids := make([]int, 15)
+	for i := range pids {
+		pids[i] = i + 1
+	}
+	nm := NewNetworkMonitor()
+	nm.connectionsFor = fakeConnections(time.Millisecond)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = nm.GetAllAgentConnections(pids)
+	}
+}
+
+func benchPIDs(b *testing.B) []int {
+	if _, err := exec.LookPath("ps"); err != nil {
+		b.Skip("ps not installed")
+	}
+	pids := make([]int, 10)
+	for i := range pids {
+		pids[i] = os.Getpid()
+	}
+	return pids
+}
+
+func BenchmarkProcessPS_Batched(b *testing.B) {
+	pids := benchPIDs(b)
+	pm := NewProcessMonitor(pids)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = pm.readPSBatch(pids)
+	}
+}
+
+func BenchmarkProcessPS_Serial(b *testing.B) {
+	pids := benchPIDs(b)
+	pm := NewProcessMonitor(pids)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pid := range pids {
+			_, _ = pm.readPSBatch([]int{pid})
+		}
+	}
+}
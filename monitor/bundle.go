@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+// DefaultBundleItems is the number of recent alerts and security events a
+// support bundle keeps when BundleSources.MaxItems is zero.
+const DefaultBundleItems = 100
+
+// BundleSources lists what SupportBundle collects. Every field is optional;
+// missing sources are left out of the bundle.
+type BundleSources struct {
+	Config   *config.Config
+	Snapshot *agent.Snapshot
+	Alerts   *AlertMonitor
+	Security *SecurityMonitor
+	Tokens   *TokenMonitor
+	Process  *ProcessMonitor
+	Network  *NetworkMonitor
+	Git      *GitMonitor
+	MaxItems int
+	// HomeDir is the home directory redacted to "~". Empty means the
+	// Tokens monitor's home (SetHomeDir), else os.UserHomeDir.
+	HomeDir string
+}
+
+type supportBundle struct {
+	GeneratedAt time.Time                               `json:"generated_at"`
+	Platform    string                                  `json:"platform"`
+	GoVersion   string                                  `json:"go_version"`
+	Config      *config.Config                          `json:"config,omitempty"`
+	Snapshot    *agent.Snapshot                         `json:"snapshot,omitempty"`
+	Alerts      []agent.Alert                           `json:"alerts"`
+	Events      []agent.SecurityEvent                   `json:"security_events"`
+	Health      HealthReport                            `json:"health"`
+	ErrorStats  map[string]map[string]MonitorErrorStats `json:"error_stats"`
+}
+
+// SupportBundle gathers configuration, the current snapshot, recent alerts
+// and security events, a health report and per-monitor error stats into one
+// indented JSON document suitable for attaching to a bug report.
+//
+// Every string in the bundle goes through the same redaction: API keys and
+// tokens with well-known prefixes, bearer tokens, KEY=value assignments for
+// secret-looking names, URL credentials, fields such as "token", and the
+// user's home directory (replaced with "~") are masked.
+func SupportBundle(src BundleSources) []byte {
+	limit := src.MaxItems
+	if limit <= 0 {
+		limit = DefaultBundleItems
+	}
+
+	b := supportBundle{
+		GeneratedAt: time.Now(),
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		GoVersion:   runtime.Version(),
+		Config:      src.Config,
+		Snapshot:    src.Snapshot,
+		Alerts:      []agent.Alert{},
+		Events:      []agent.SecurityEvent{},
+		Health:      BuildHealthReport(src.Tokens, src.Process, src.Network, src.Git),
+		ErrorStats:  make(map[string]map[string]MonitorErrorStats),
+	}
+	if src.Alerts != nil {
+		alerts := src.Alerts.GetAlerts()
+		if len(alerts) > limit {
+			alerts = alerts[len(alerts)-limit:]
+		}
+		b.Alerts = alerts
+	}
+	if src.Security != nil {
+		events := src.Security.GetEvents()
+		if len(events) > limit {
+			events = events[len(events)-limit:]
+		}
+		b.Events = events
+	}
+	for name, mh := range b.Health.Monitors {
+		b.ErrorStats[name] = mh.Errors
+	}
+
+	// Round-trip through a generic value so redaction reaches every string,
+	// including map keys and nested agent data.
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return bundleError(err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return bundleError(err)
+	}
+	out, err := json.MarshalIndent(redactValue(doc, src.home()), "", "  ")
+	if err != nil {
+		return bundleError(err)
+	}
+	return out
+}
+
+func (src BundleSources) home() string {
+	if src.HomeDir != "" {
+		return src.HomeDir
+	}
+	if src.Tokens != nil {
+		src.Tokens.mu.Lock()
+		home := src.Tokens.homeDir
+		src.Tokens.mu.Unlock()
+		if home != "" {
+			return home
+		}
+	}
+	home, _ := os.UserHomeDir()
+	return home
+}
+
+func bundleError(err error) []byte {
+	out, _ := json.Marshal(map[string]string{"error": fmt.Sprintf("support bundle: %v", err)})
+	return out
+}
+
+type redactRule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+var redactRules = []redactRule{
+	{regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_\-]{16,}|gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|xox[abprs]-[A-Za-z0-9\-]{10,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_\-]{35}|hf_[A-Za-z0-9]{20,})`), "[REDACTED]"},
+	{regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/\-]+=*`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(\b[A-Z0-9_]*(?:TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|ACCESS_KEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*)(?:"[^"]*"|'[^']*'|\S+)`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)(\b(?:password|passwd|secret|api[_-]?key)["']?\s*[=:]\s*)(?:"[^"]*"|'[^']*'|[^\s"',}]+)`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(?i)(--(?:password|token|api-key|secret)[= ])\S+`), "${1}[REDACTED]"},
+	{regexp.MustCompile(`(://[^/\s:@]+:)[^@\s/]+@`), "${1}[REDACTED]@"},
+}
+
+// secretKeys are JSON field names whose string values are always masked.
+var secretKeys = map[string]bool{
+	"token": true, "password": true, "secret": true, "api_key": true,
+	"apikey": true, "authorization": true,
+}
+
+// redactString masks secrets in s and replaces home with "~".
+func redactString(s, home string) string {
+	for _, r := range redactRules {
+		s = r.re.ReplaceAllString(s, r.repl)
+	}
+	if home != "" && home != "/" {
+		s = strings.ReplaceAll(s, home, "~")
+	}
+	return s
+}
+
+func redactValue(v interface{}, home string) interface{} {
+	switch x := v.(type) {
+	case string:
+		return redactString(x, home)
+	case []interface{}:
+		for i := range x {
+			x[i] = redactValue(x[i], home)
+		}
+		return x
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(x))
+		for k, val := range x {
+			if str, ok := val.(string); ok && str != "" && secretKeys[strings.ToLower(k)] {
+				val = "[REDACTED]"
+			}
+			out[redactString(k, home)] = redactValue(val, home)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -1,11 +1,18 @@
 package monitor
 
-import "fmt"
+import (
+	"fmt"
 
-// ModelPricing holds pricing per 1M tokens for a model.
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+// ModelPricing holds pricing per 1M tokens for a model. CachedInputPer1M is
+// the price of prompt-cache reads; zero means CacheReadMultiplier times
+// InputPer1M.
 type ModelPricing struct {
-	InputPer1M  float64
-	OutputPer1M float64
+	InputPer1M       float64
+	OutputPer1M      float64
+	CachedInputPer1M float64
 }
 
 // ModelPrices maps model name patterns to pricing (USD per 1M tokens).
@@ -41,28 +48,89 @@ var ModelPrices = map[string]ModelPricing{
 	"default": {InputPer1M: 1.00, OutputPer1M: 3.00},
 }
 
+// Prompt-cache prices relative to the model's input price: writing to the
+// cache costs 25% more than plain input, reading from it 90% less.
+const (
+	CacheWriteMultiplier = 1.25
+	CacheReadMultiplier  = 0.10
+)
+
 // EstimateCost calculates estimated cost based on model and token counts.
 func EstimateCost(model string, inputTokens, outputTokens int64) float64 {
-	pricing := FindPricing(model)
+	return EstimateCacheCost(model, inputTokens, outputTokens, 0, 0)
+}
+
+// EstimateCostDetailed is EstimateCost that also returns how the model's
+// price was found; see FindPricingDetailed.
+func EstimateCostDetailed(model string, inputTokens, outputTokens int64) (float64, string) {
+	pricing, kind := FindPricingDetailed(model)
+	return pricedCost(pricing, inputTokens, outputTokens, 0, 0), kind
+}
+
+// EstimateCostWith is EstimateCost with prices consulted before the
+// built-in ModelPrices; see FindPricingWith.
+func EstimateCostWith(prices map[string]ModelPricing, model string, inputTokens, outputTokens int64) float64 {
+	return pricedCost(FindPricingWith(prices, model), inputTokens, outputTokens, 0, 0)
+}
+
+// EstimateCacheCost is EstimateCost for requests that also wrote
+// (cacheCreate) or read (cacheRead) prompt-cache tokens, billed at
+// CacheWriteMultiplier and CacheReadMultiplier times the input price.
+func EstimateCacheCost(model string, inputTokens, outputTokens, cacheCreate, cacheRead int64) float64 {
+	return pricedCost(FindPricing(model), inputTokens, outputTokens, cacheCreate, cacheRead)
+}
+
+func pricedCost(pricing ModelPricing, inputTokens, outputTokens, cacheCreate, cacheRead int64) float64 {
+	cachedPrice := pricing.CachedInputPer1M
+	if cachedPrice == 0 {
+		cachedPrice = pricing.InputPer1M * CacheReadMultiplier
+	}
 	inputCost := float64(inputTokens) / 1_000_000.0 * pricing.InputPer1M
 	outputCost := float64(outputTokens) / 1_000_000.0 * pricing.OutputPer1M
-	return inputCost + outputCost
+	cacheCost := (float64(cacheCreate)*CacheWriteMultiplier*pricing.InputPer1M + float64(cacheRead)*cachedPrice) /
+		1_000_000.0
+	return inputCost + outputCost + cacheCost
 }
 
-// FindPricing returns the best matching pricing for a model name.
-// It tries, in order: exact match, substring match, model-family fallback
-// (claude, gpt-4, gemini), and finally the "default" entry.
-func FindPricing(model string) ModelPricing {
-	if model == "" {
-		return ModelPrices["default"]
+// FindPricingWith returns the pricing for model from prices, matched by
+// exact name and then by substring as in FindPricing, and falls back to
+// FindPricing when prices has no match. A nil map uses the built-ins only.
+func FindPricingWith(prices map[string]ModelPricing, model string) ModelPricing {
+	if model != "" {
+		if p, kind := matchPricing(prices, model); kind != "" {
+			return p
+		}
 	}
+	return FindPricing(model)
+}
 
-	if p, ok := ModelPrices[model]; ok {
-		return p
+// PricingFromConfig converts the pricing section of the config file.
+func PricingFromConfig(c map[string]config.ModelPriceConfig) map[string]ModelPricing {
+	if len(c) == 0 {
+		return nil
+	}
+	prices := make(map[string]ModelPricing, len(c))
+	for pattern, p := range c {
+		prices[pattern] = ModelPricing{
+			InputPer1M:       p.InputPer1M,
+			OutputPer1M:      p.OutputPer1M,
+			CachedInputPer1M: p.CachedInputPer1M,
+		}
+	}
+	return prices
+}
+
+// matchPricing finds model in prices by exact name, then by the longest
+// key that contains or is contained in it, and reports which of the two
+// matched (PricingMatchExact or PricingMatchSubstring), or "" for neither.
+// The "default" key only matches exactly.
+func matchPricing(prices map[string]ModelPricing, model string) (ModelPricing, string) {
+	if p, ok := prices[model]; ok {
+		return p, PricingMatchExact
 	}
 
 	bestMatch := ""
-	for key := range ModelPrices {
+	for key := range prices {
 		if key == "default" {
 			continue
 		}
@@ -72,31 +140,61 @@ func FindPricing(model string) ModelPricing {
 			}
 		}
 	}
+	if bestMatch == "" {
+		return ModelPricing{}, ""
+	}
+	return prices[bestMatch], PricingMatchSubstring
+}
+
+// How FindPricingDetailed matched a model to its price.
+const (
+	PricingMatchExact     = "exact"
+	PricingMatchSubstring = "substring"
+	PricingMatchFamily    = "family"
+	PricingMatchDefault   = "default"
+)
+
+// FindPricing returns the best matching pricing for a model name.
+// It tries, in order: exact match, substring match, model-family fallback
+// (claude, gpt-4, gemini), and finally the "default" entry.
+func FindPricing(model string) ModelPricing {
+	p, _ := FindPricingDetailed(model)
+	return p
+}
+
+// FindPricingDetailed is FindPricing that also reports which step matched:
+// PricingMatchExact, PricingMatchSubstring, PricingMatchFamily or
+// PricingMatchDefault. A default match means the model is unknown and any
+// cost derived from it is a rough guess.
+func FindPricingDetailed(model string) (ModelPricing, string) {
+	if model == "" {
+		return ModelPrices["default"], PricingMatchDefault
+	}
 
-	if bestMatch != "" {
-		return ModelPrices[bestMatch]
+	if p, kind := matchPricing(ModelPrices, model); kind != "" {
+		return p, kind
 	}
 
 	if containsSubstr(model, "claude") {
 		if containsSubstr(model, "opus") {
-			return ModelPrices["claude-opus-4"]
+			return ModelPrices["claude-opus-4"], PricingMatchFamily
 		}
 		if containsSubstr(model, "haiku") {
-			return ModelPrices["claude-3-haiku"]
+			return ModelPrices["claude-3-haiku"], PricingMatchFamily
 		}
-		return ModelPrices["claude-sonnet-4"]
+		return ModelPrices["claude-sonnet-4"], PricingMatchFamily
 	}
 	if containsSubstr(model, "gpt-4") {
 		if containsSubstr(model, "mini") {
-			return ModelPrices["gpt-4o-mini"]
+			return ModelPrices["gpt-4o-mini"], PricingMatchFamily
 		}
-		return ModelPrices["gpt-4o"]
+		return ModelPrices["gpt-4o"], PricingMatchFamily
 	}
 	if containsSubstr(model, "gemini") {
-		return ModelPrices["gemini-2.0-flash"]
+		return ModelPrices["gemini-2.0-flash"], PricingMatchFamily
 	}
 
-	return ModelPrices["default"]
+	return ModelPrices["default"], PricingMatchDefault
 }
 
 func containsSubstr(s, substr string) bool {
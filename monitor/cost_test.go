@@ -1,7 +1,10 @@
 package monitor
 
 import (
+	"math"
 	"testing"
+
+	"github.com/Rafiki81/libagentmetrics/config"
 )
 
 func TestEstimateCost(t *testing.T) {
@@ -65,6 +68,18 @@ func TestEstimateCost(t *testing.T) {
 	}
 }
 
+func TestEstimateCacheCost(t *testing.T) {
+	// claude-sonnet-4: $3/1M input, $15/1M output.
+	// 1M cache writes at 1.25x = $3.75, 2M cache reads at 0.1x = $0.60.
+	got := EstimateCacheCost("claude-sonnet-4", 0, 0, 1_000_000, 2_000_000)
+	if math.Abs(got-4.35) > 1e-9 {
+		t.Errorf("EstimateCacheCost = %f, want 4.35", got)
+	}
+	if a, b := EstimateCacheCost("gpt-4o", 1000, 500, 0, 0), EstimateCost("gpt-4o", 1000, 500); a != b {
+		t.Errorf("without cache tokens EstimateCacheCost = %f, EstimateCost = %f", a, b)
+	}
+}
+
 func TestFindPricing_ExactMatch(t *testing.T) {
 	tests := []struct {
 		model      string
@@ -135,6 +150,58 @@ func TestFindPricing_FamilyFallback(t *testing.T) {
 	}
 }
 
+func TestFindPricingWith_Override(t *testing.T) {
+	prices := map[string]ModelPricing{
+		"gpt-4o":        {InputPer1M: 2.00, OutputPer1M: 8.00},
+		"acme-coder":    {InputPer1M: 0.40, OutputPer1M: 1.60},
+		"claude-sonnet": {InputPer1M: 2.00, OutputPer1M: 10.00, CachedInputPer1M: 0.50},
+	}
+
+	if p := FindPricingWith(prices, "gpt-4o"); p.InputPer1M != 2.00 {
+		t.Errorf("exact override InputPer1M = %f, want 2.00", p.InputPer1M)
+	}
+	if p := FindPricingWith(prices, "acme-coder-large-0925"); p.OutputPer1M != 1.60 {
+		t.Errorf("substring override OutputPer1M = %f, want 1.60", p.OutputPer1M)
+	}
+	if got, want := EstimateCostWith(prices, "acme-coder", 1_000_000, 1_000_000), 2.00; math.Abs(got-want) > 1e-9 {
+		t.Errorf("EstimateCostWith = %f, want %f", got, want)
+	}
+
+	// Cache reads use the explicit cached price instead of the multiplier.
+	m := map[string]ModelPricing{"claude-sonnet": prices["claude-sonnet"]}
+	if got, want := pricedCost(FindPricingWith(m, "claude-sonnet-4"), 0, 0, 0, 1_000_000), 0.50; math.Abs(got-want) > 1e-9 {
+		t.Errorf("cache read cost = %f, want %f", got, want)
+	}
+}
+
+func TestFindPricingWith_Fallback(t *testing.T) {
+	prices := map[string]ModelPricing{"acme-coder": {InputPer1M: 0.40, OutputPer1M: 1.60}}
+
+	for _, model := range []string{"claude-opus-4", "gemini-99-turbo", "unknown-model", ""} {
+		if got, want := FindPricingWith(prices, model), FindPricing(model); got != want {
+			t.Errorf("FindPricingWith(%q) = %+v, want built-in %+v", model, got, want)
+		}
+	}
+	if got, want := FindPricingWith(nil, "gpt-4o"), ModelPrices["gpt-4o"]; got != want {
+		t.Errorf("nil prices = %+v, want %+v", got, want)
+	}
+	if got, want := EstimateCostWith(nil, "gpt-4o", 1000, 500), EstimateCost("gpt-4o", 1000, 500); got != want {
+		t.Errorf("EstimateCostWith(nil) = %f, want %f", got, want)
+	}
+}
+
+func TestPricingFromConfig(t *testing.T) {
+	prices := PricingFromConfig(map[string]config.ModelPriceConfig{
+		"gpt-4o": {InputPer1M: 2.00, OutputPer1M: 8.00, CachedInputPer1M: 1.00},
+	})
+	if want := (ModelPricing{InputPer1M: 2.00, OutputPer1M: 8.00, CachedInputPer1M: 1.00}); prices["gpt-4o"] != want {
+		t.Errorf("PricingFromConfig = %+v, want %+v", prices["gpt-4o"], want)
+	}
+	if PricingFromConfig(nil) != nil {
+		t.Error("PricingFromConfig(nil) should be nil")
+	}
+}
+
 func TestFormatCost(t *testing.T) {
 	tests := []struct {
 		cost float64
@@ -176,3 +243,34 @@ func TestModelPrices_AllPositive(t *testing.T) {
 		}
 	}
 }
+
+func TestFindPricingDetailed(t *testing.T) {
+	tests := []struct {
+		model     string
+		wantKind  string
+		wantInput float64
+	}{
+		{"gpt-4o", PricingMatchExact, 2.50},
+		{"claude-sonnet-4-20250514", PricingMatchSubstring, 3.00},
+		{"claude-future-model", PricingMatchFamily, 3.00},
+		{"gemini-99-turbo", PricingMatchFamily, 0.10},
+		{"llama-3-70b", PricingMatchDefault, 1.00},
+		{"", PricingMatchDefault, 1.00},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			p, kind := FindPricingDetailed(tt.model)
+			if kind != tt.wantKind || p.InputPer1M != tt.wantInput {
+				t.Errorf("FindPricingDetailed(%q) = %v / %q, want %v / %q", tt.model, p.InputPer1M, kind, tt.wantInput, tt.wantKind)
+			}
+			if p != FindPricing(tt.model) {
+				t.Errorf("FindPricingDetailed(%q) disagrees with FindPricing", tt.model)
+			}
+		})
+	}
+
+	cost, kind := EstimateCostDetailed("llama-3-70b", 1000, 500)
+	if kind != PricingMatchDefault || cost != EstimateCost("llama-3-70b", 1000, 500) {
+		t.Errorf("EstimateCostDetailed = %f / %q, want EstimateCost / default", cost, kind)
+	}
+}
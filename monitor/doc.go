@@ -2,6 +2,7 @@
 //
 // It includes monitors for:
 //   - Process CPU/memory metrics ([ProcessMonitor])
+//   - Agent child processes and detached daemons ([ProcessTreeMonitor])
 //   - Token usage and cost estimation ([TokenMonitor], [EstimateCost])
 //   - Git activity in working directories ([GitMonitor])
 //   - File system changes ([FileWatcher])
@@ -9,9 +10,15 @@
 //   - Session timing and idle detection ([SessionMonitor])
 //   - Network connections ([NetworkMonitor])
 //   - Security analysis of agent behavior ([SecurityMonitor])
-//   - Alert generation against configurable thresholds ([AlertMonitor])
+//   - Alert generation against configurable thresholds and rules ([AlertMonitor], [MetricRule])
+//   - Streaming alerts and security events to subscribers ([Subscription])
 //   - Historical metric recording and export ([HistoryStore])
+//   - Replaying recorded history through alert and security rules ([Replay])
+//   - Per-agent activity timelines across all signals ([TimelineSources])
 //   - Local model server discovery ([LocalModelMonitor])
+//   - Redacted support bundles for bug reports ([SupportBundle])
+//   - Pushing snapshots to a team collector ([PushExporter], [CollectorServer])
+//   - Running collection with restarts and a single shutdown ([Supervisor])
 //
 // All monitors are safe for concurrent use. Most monitors follow the pattern
 // of creating an instance with NewXxx, then calling Collect to gather metrics
@@ -1,8 +1,11 @@
 package monitor
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
@@ -11,48 +14,147 @@ import (
 
 // FileWatcher monitors file system changes in directories where agents are working.
 type FileWatcher struct {
-	mu         sync.Mutex
-	dirs       map[string]bool
-	operations []agent.FileOperation
-	maxOps     int
-	stopCh     chan struct{}
-	snapshots  map[string]map[string]time.Time
+	mu          sync.Mutex
+	dirs        map[string]bool
+	operations  []agent.FileOperation
+	maxOps      int
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+	started     bool
+	wg          sync.WaitGroup
+	snapshots   map[string]map[string]fileStamp
+	notifier    *dirNotifier
+	ignoreDirs  []string
+	ignoreFiles []string
+	eventBuffer int
+	events      *Subscription[agent.FileOperation]
 }
 
+// DefaultIgnoreDirs are the directory names a FileWatcher skips unless
+// SetIgnoreDirs replaces them.
+var DefaultIgnoreDirs = []string{".git", "node_modules", ".next", "__pycache__"}
+
+// ErrNotifyUnsupported is returned by [FileWatcher.StartNotify] on platforms
+// without a change notification backend; use [FileWatcher.Start] there.
+var ErrNotifyUnsupported = errors.New("file change notifications are not supported on this platform")
+
 // NewFileWatcher creates a new file system watcher.
 func NewFileWatcher(maxOps int) *FileWatcher {
 	if maxOps <= 0 {
 		maxOps = 100
 	}
 	return &FileWatcher{
-		dirs:      make(map[string]bool),
-		maxOps:    maxOps,
-		stopCh:    make(chan struct{}),
-		snapshots: make(map[string]map[string]time.Time),
+		dirs:       make(map[string]bool),
+		maxOps:     maxOps,
+		stopCh:     make(chan struct{}),
+		snapshots:  make(map[string]map[string]fileStamp),
+		ignoreDirs: append([]string(nil), DefaultIgnoreDirs...),
+	}
+}
+
+// SetIgnoreDirs replaces the directory names that are not watched, e.g.
+// to add "target", ".venv" or "dist". Entries may be glob patterns as in
+// filepath.Match and are matched against the base name. Pass nil to watch
+// every directory.
+func (fw *FileWatcher) SetIgnoreDirs(names []string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.ignoreDirs = append([]string(nil), names...)
+}
+
+// SetIgnoreFiles sets glob patterns (as in filepath.Match, e.g. "*.log")
+// for file base names whose changes are not recorded.
+func (fw *FileWatcher) SetIgnoreFiles(patterns []string) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.ignoreFiles = append([]string(nil), patterns...)
+}
+
+// SetEventBuffer sets the capacity of the channel returned by Events. It
+// must be called before the first Events call; non-positive values mean
+// DefaultSubscriptionBuffer (64).
+func (fw *FileWatcher) SetEventBuffer(n int) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	fw.eventBuffer = n
+}
+
+// Events returns a channel that receives every file operation as it is
+// recorded, for consumers that would otherwise poll GetOperations. The
+// watcher never waits for the reader: when the buffer (see SetEventBuffer)
+// is full, new operations are dropped from the channel, though they are
+// still kept for GetOperations. The channel is closed by Stop, or by a
+// Shutdown that completes in time. Every call
+// returns the same channel.
+func (fw *FileWatcher) Events() <-chan agent.FileOperation {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.events == nil {
+		fw.events = newSubscription[agent.FileOperation](SubscribeOptions{Buffer: fw.eventBuffer, Drop: DropNewest})
+	}
+	return fw.events.C()
+}
+
+// DroppedEvents returns how many operations were not delivered on the
+// Events channel because its buffer was full.
+func (fw *FileWatcher) DroppedEvents() uint64 {
+	fw.mu.Lock()
+	events := fw.events
+	fw.mu.Unlock()
+	if events == nil {
+		return 0
 	}
+	return events.Dropped()
+}
+
+// ignoreRules returns the current ignore lists for a walk done without
+// holding the lock.
+func (fw *FileWatcher) ignoreRules() watchIgnore {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return watchIgnore{dirs: fw.ignoreDirs, files: fw.ignoreFiles}
 }
 
 // AddDir adds a directory to watch.
 func (fw *FileWatcher) AddDir(dir string) {
 	fw.mu.Lock()
-	defer fw.mu.Unlock()
 	fw.dirs[dir] = true
+	n := fw.notifier
+	fw.mu.Unlock()
+	if n != nil {
+		_ = n.addTree(dir, false)
+	}
 }
 
 // RemoveDir removes a directory from watch.
 func (fw *FileWatcher) RemoveDir(dir string) {
 	fw.mu.Lock()
-	defer fw.mu.Unlock()
 	delete(fw.dirs, dir)
+	n := fw.notifier
+	fw.mu.Unlock()
+	if n != nil {
+		n.removeTree(dir)
+	}
 }
 
 // Start begins polling for file changes at the given interval.
 // It takes an initial snapshot and then checks for CREATE, MODIFY, and DELETE
 // operations in a background goroutine. Call [FileWatcher.Stop] to terminate.
+// Only the first call has an effect; a stopped watcher cannot be restarted.
 func (fw *FileWatcher) Start(interval time.Duration) {
+	fw.mu.Lock()
+	if fw.started {
+		fw.mu.Unlock()
+		return
+	}
+	fw.started = true
+	fw.mu.Unlock()
+
 	fw.takeSnapshots()
 
+	fw.wg.Add(1)
 	go func() {
+		defer fw.wg.Done()
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
@@ -67,9 +169,97 @@ func (fw *FileWatcher) Start(interval time.Duration) {
 	}()
 }
 
-// Stop stops the file watcher.
+// StartNotify begins watching for file changes as they happen, using the
+// operating system's change notifications (inotify on Linux) instead of
+// walking every directory on a timer. Subdirectories are watched as they
+// appear, and a file created and deleted in quick succession is still
+// reported, which polling misses. Renames within the watched tree are
+// reported as a single RENAME.
+//
+// It returns ErrNotifyUnsupported on other platforms, or an error if the
+// directories could not be watched (e.g. the inotify watch limit was
+// reached); the watcher is then left unstarted so Start can be used
+// instead. Stop ends it like a polling watcher.
+func (fw *FileWatcher) StartNotify() error {
+	fw.mu.Lock()
+	if fw.started {
+		fw.mu.Unlock()
+		return nil
+	}
+	n, err := newDirNotifier(fw)
+	if err != nil {
+		fw.mu.Unlock()
+		return err
+	}
+	dirs := make([]string, 0, len(fw.dirs))
+	for d := range fw.dirs {
+		dirs = append(dirs, d)
+	}
+	fw.mu.Unlock()
+
+	for _, dir := range dirs {
+		if err := n.addTree(dir, false); err != nil {
+			n.close()
+			return err
+		}
+	}
+
+	fw.mu.Lock()
+	fw.started = true
+	fw.notifier = n
+	fw.mu.Unlock()
+
+	fw.wg.Add(1)
+	go func() {
+		defer fw.wg.Done()
+		n.run(fw.stopCh)
+	}()
+	return nil
+}
+
+// Stop stops the file watcher and waits for its goroutine to exit. A scan in
+// progress is abandoned. Stop is idempotent.
 func (fw *FileWatcher) Stop() {
-	close(fw.stopCh)
+	fw.stopOnce.Do(func() { close(fw.stopCh) })
+	fw.wg.Wait()
+	fw.closeEvents()
+}
+
+func (fw *FileWatcher) closeEvents() {
+	fw.mu.Lock()
+	events := fw.events
+	fw.mu.Unlock()
+	if events != nil {
+		events.Close()
+	}
+}
+
+// Shutdown is like Stop but gives up waiting when ctx is done, returning
+// ctx.Err(). The goroutine still exits once the current scan notices the stop.
+func (fw *FileWatcher) Shutdown(ctx context.Context) error {
+	fw.stopOnce.Do(func() { close(fw.stopCh) })
+
+	done := make(chan struct{})
+	go func() {
+		fw.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		fw.closeEvents()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (fw *FileWatcher) stopping() bool {
+	select {
+	case <-fw.stopCh:
+		return true
+	default:
+		return false
+	}
 }
 
 // GetOperations returns recent file operations.
@@ -95,12 +285,24 @@ func (fw *FileWatcher) GetOperationsForDir(dir string) []agent.FileOperation {
 	return result
 }
 
+// CollectForAgent sets a.FileOps to the recorded operations under the
+// agent's working directory, oldest first. It records nothing for an agent
+// without a WorkDir; add the directory with AddDir for operations to be
+// seen at all. The list is bounded by the watcher's maxOps; pass
+// cfg.Monitor.MaxFileOps to NewFileWatcher to honour the config setting.
+func (fw *FileWatcher) CollectForAgent(a *agent.Instance) {
+	if a.WorkDir == "" {
+		a.FileOps = nil
+		return
+	}
+	a.FileOps = fw.GetOperationsForDir(a.WorkDir)
+}
+
+// isUnder reports whether path is inside dir, not dir itself. Dotfiles and
+// dot directories such as .env and .github are inside.
 func isUnder(path, dir string) bool {
 	rel, err := filepath.Rel(dir, path)
-	if err != nil {
-		return false
-	}
-	return len(rel) > 0 && rel[0] != '.'
+	return err == nil && rel != "." && pathWithin(dir, path)
 }
 
 func (fw *FileWatcher) takeSnapshots() {
@@ -112,19 +314,22 @@ func (fw *FileWatcher) takeSnapshots() {
 	fw.mu.Unlock()
 
 	for _, dir := range dirs {
-		snapshot := make(map[string]time.Time)
+		snapshot := make(map[string]fileStamp)
+		ignore := fw.ignoreRules()
 		_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return nil
 			}
 			if info.IsDir() {
-				base := filepath.Base(path)
-				if base == ".git" || base == "node_modules" || base == ".next" || base == "__pycache__" {
+				if ignore.skipDir(filepath.Base(path)) {
 					return filepath.SkipDir
 				}
 				return nil
 			}
-			snapshot[path] = info.ModTime()
+			if ignore.skipFile(info.Name()) {
+				return nil
+			}
+			snapshot[path] = stampOf(info)
 			return nil
 		})
 
@@ -143,41 +348,78 @@ func (fw *FileWatcher) detectChanges() {
 	fw.mu.Unlock()
 
 	for _, dir := range dirs {
-		current := make(map[string]time.Time)
+		current := make(map[string]fileStamp)
+		ignore := fw.ignoreRules()
 		_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if fw.stopping() {
+				return filepath.SkipAll
+			}
 			if err != nil {
 				return nil
 			}
 			if info.IsDir() {
-				base := filepath.Base(path)
-				if base == ".git" || base == "node_modules" || base == ".next" || base == "__pycache__" {
+				if ignore.skipDir(filepath.Base(path)) {
 					return filepath.SkipDir
 				}
 				return nil
 			}
-			current[path] = info.ModTime()
+			if ignore.skipFile(info.Name()) {
+				return nil
+			}
+			current[path] = stampOf(info)
 			return nil
 		})
+		// A partial walk would report every unvisited file as deleted.
+		if fw.stopping() {
+			return
+		}
 
 		fw.mu.Lock()
 		prevSnapshot := fw.snapshots[dir]
 		if prevSnapshot == nil {
-			prevSnapshot = make(map[string]time.Time)
+			prevSnapshot = make(map[string]fileStamp)
 		}
 
 		now := time.Now()
 
-		for path, modTime := range current {
-			prevMod, existed := prevSnapshot[path]
+		var created, deleted []string
+		for path, stamp := range current {
+			prev, existed := prevSnapshot[path]
 			if !existed {
-				fw.addOp(agent.FileOperation{Timestamp: now, Path: path, Op: "CREATE"})
-			} else if modTime.After(prevMod) {
+				created = append(created, path)
+			} else if stamp.modTime.After(prev.modTime) {
 				fw.addOp(agent.FileOperation{Timestamp: now, Path: path, Op: "MODIFY"})
 			}
 		}
-
 		for path := range prevSnapshot {
 			if _, exists := current[path]; !exists {
+				deleted = append(deleted, path)
+			}
+		}
+		sort.Strings(created)
+		sort.Strings(deleted)
+
+		// A deleted and a created file with the same identity were renamed.
+		renamedFrom := make(map[string]string)
+		for _, oldPath := range deleted {
+			for _, path := range created {
+				if _, taken := renamedFrom[path]; !taken && sameFile(prevSnapshot[oldPath], current[path]) {
+					renamedFrom[path] = oldPath
+					break
+				}
+			}
+		}
+		renamed := make(map[string]bool, len(renamedFrom))
+		for _, path := range created {
+			if oldPath, ok := renamedFrom[path]; ok {
+				renamed[oldPath] = true
+				fw.addOp(agent.FileOperation{Timestamp: now, Path: path, Op: "RENAME", OldPath: oldPath})
+			} else {
+				fw.addOp(agent.FileOperation{Timestamp: now, Path: path, Op: "CREATE"})
+			}
+		}
+		for _, path := range deleted {
+			if !renamed[path] {
 				fw.addOp(agent.FileOperation{Timestamp: now, Path: path, Op: "DELETE"})
 			}
 		}
@@ -187,7 +429,73 @@ func (fw *FileWatcher) detectChanges() {
 	}
 }
 
+// fileStamp identifies a file's content between two polls.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	inode   uint64 // 0 where the platform does not expose one
+}
+
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{modTime: info.ModTime(), size: info.Size(), inode: fileInode(info)}
+}
+
+// sameFile reports whether a and b look like the same file under two
+// names. A rename keeps size and modification time; the inode, where
+// known, rules out an unrelated file that happens to match.
+func sameFile(a, b fileStamp) bool {
+	if a.inode != 0 && b.inode != 0 && a.inode != b.inode {
+		return false
+	}
+	return a.size == b.size && a.modTime.Equal(b.modTime)
+}
+
+// watchIgnore holds the directory and file patterns a walk skips. The
+// slices are replaced, never modified, so a copy is safe to use unlocked.
+type watchIgnore struct {
+	dirs  []string
+	files []string
+}
+
+func (w watchIgnore) skipDir(base string) bool {
+	return matchAnyGlob(w.dirs, base)
+}
+
+func (w watchIgnore) skipFile(base string) bool {
+	return matchAnyGlob(w.files, base)
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// recordNotified adds an operation seen by the notifier. Writes arrive as
+// a burst of modify events, so a MODIFY directly following a CREATE or
+// MODIFY of the same path is folded into it.
+func (fw *FileWatcher) recordNotified(op agent.FileOperation) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if op.Op == "MODIFY" && len(fw.operations) > 0 {
+		last := &fw.operations[len(fw.operations)-1]
+		if last.Path == op.Path && (last.Op == "CREATE" || last.Op == "MODIFY") {
+			if last.Op == "MODIFY" {
+				last.Timestamp = op.Timestamp
+			}
+			return
+		}
+	}
+	fw.addOp(op)
+}
+
 func (fw *FileWatcher) addOp(op agent.FileOperation) {
+	if fw.events != nil {
+		fw.events.publish(op)
+	}
 	fw.operations = append(fw.operations, op)
 	if len(fw.operations) > fw.maxOps {
 		fw.operations = fw.operations[len(fw.operations)-fw.maxOps:]
@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// dirNotifier turns inotify events for a set of directory trees into file
+// operations on a FileWatcher.
+type dirNotifier struct {
+	fw   *FileWatcher
+	file *os.File
+	fd   int
+
+	mu    sync.Mutex
+	paths map[int]string // watch descriptor -> directory
+	wds   map[string]int // directory -> watch descriptor
+}
+
+func newDirNotifier(fw *FileWatcher) (*dirNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &dirNotifier{
+		fw: fw,
+		// A non-blocking descriptor is read through the runtime poller,
+		// so closing the file wakes a pending Read.
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		fd:    fd,
+		paths: make(map[int]string),
+		wds:   make(map[string]int),
+	}, nil
+}
+
+// addTree watches root and every directory below it. With created set,
+// files already inside are reported as created, for a directory that
+// appeared after the watch on its parent was in place.
+func (n *dirNotifier) addTree(root string, created bool) error {
+	ignore := n.fw.ignoreRules()
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if created && !ignore.skipFile(d.Name()) {
+				n.fw.recordNotified(agent.FileOperation{Timestamp: time.Now(), Path: path, Op: "CREATE"})
+			}
+			return nil
+		}
+		if path != root && ignore.skipDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		n.mu.Lock()
+		n.paths[wd] = path
+		n.wds[path] = wd
+		n.mu.Unlock()
+		return nil
+	})
+}
+
+// removeTree stops watching root and the directories below it.
+func (n *dirNotifier) removeTree(root string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for path, wd := range n.wds {
+		if path == root || isUnder(path, root) {
+			_, _ = syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.wds, path)
+			delete(n.paths, wd)
+		}
+	}
+}
+
+// renameTree updates the recorded paths of watches under a moved
+// directory; the watches themselves follow the directory.
+func (n *dirNotifier) renameTree(from, to string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for path, wd := range n.wds {
+		if path != from && !isUnder(path, from) {
+			continue
+		}
+		moved := to + strings.TrimPrefix(path, from)
+		delete(n.wds, path)
+		n.wds[moved] = wd
+		n.paths[wd] = moved
+	}
+}
+
+func (n *dirNotifier) dir(wd int) (string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	path, ok := n.paths[wd]
+	return path, ok
+}
+
+func (n *dirNotifier) forget(wd int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if path, ok := n.paths[wd]; ok {
+		delete(n.paths, wd)
+		if n.wds[path] == wd {
+			delete(n.wds, path)
+		}
+	}
+}
+
+func (n *dirNotifier) close() {
+	n.file.Close()
+}
+
+// run reads events until stop is closed.
+func (n *dirNotifier) run(stop <-chan struct{}) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			n.close()
+		case <-done:
+		}
+	}()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		nr, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+		n.handle(buf[:nr])
+	}
+}
+
+type pendingMove struct {
+	path  string
+	isDir bool
+}
+
+// handle converts one read's worth of events. The two halves of a rename
+// share a cookie and are delivered together; a half without its partner
+// was a move into or out of the watched trees.
+func (n *dirNotifier) handle(buf []byte) {
+	now := time.Now()
+	ignore := n.fw.ignoreRules()
+	moves := make(map[uint32]pendingMove)
+	var order []uint32
+
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		wd := int(int32(binary.NativeEndian.Uint32(buf[0:4])))
+		mask := binary.NativeEndian.Uint32(buf[4:8])
+		cookie := binary.NativeEndian.Uint32(buf[8:12])
+		nameLen := int(binary.NativeEndian.Uint32(buf[12:16]))
+		if len(buf) < syscall.SizeofInotifyEvent+nameLen {
+			break
+		}
+		name := strings.TrimRight(string(buf[syscall.SizeofInotifyEvent:syscall.SizeofInotifyEvent+nameLen]), "\x00")
+		buf = buf[syscall.SizeofInotifyEvent+nameLen:]
+
+		if mask&syscall.IN_IGNORED != 0 {
+			n.forget(wd)
+			continue
+		}
+		dir, ok := n.dir(wd)
+		if !ok || name == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		isDir := mask&syscall.IN_ISDIR != 0
+		if (isDir && ignore.skipDir(name)) || (!isDir && ignore.skipFile(name)) {
+			continue
+		}
+
+		switch {
+		case mask&syscall.IN_CREATE != 0:
+			if isDir {
+				_ = n.addTree(path, true)
+			} else {
+				n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: path, Op: "CREATE"})
+			}
+		case mask&syscall.IN_MODIFY != 0:
+			if !isDir {
+				n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: path, Op: "MODIFY"})
+			}
+		case mask&syscall.IN_DELETE != 0:
+			if !isDir {
+				n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: path, Op: "DELETE"})
+			}
+		case mask&syscall.IN_MOVED_FROM != 0:
+			moves[cookie] = pendingMove{path: path, isDir: isDir}
+			order = append(order, cookie)
+		case mask&syscall.IN_MOVED_TO != 0:
+			from, paired := moves[cookie]
+			delete(moves, cookie)
+			switch {
+			case paired && isDir:
+				n.renameTree(from.path, path)
+				n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: path, Op: "RENAME", OldPath: from.path})
+			case paired:
+				n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: path, Op: "RENAME", OldPath: from.path})
+			case isDir:
+				_ = n.addTree(path, true)
+			default:
+				n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: path, Op: "CREATE"})
+			}
+		}
+	}
+
+	for _, cookie := range order {
+		from, ok := moves[cookie]
+		if !ok {
+			continue
+		}
+		if from.isDir {
+			n.removeTree(from.path)
+		} else {
+			n.fw.recordNotified(agent.FileOperation{Timestamp: now, Path: from.path, Op: "DELETE"})
+		}
+	}
+}
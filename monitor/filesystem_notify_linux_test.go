@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirNotifier_TreesIncludeDotDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"src/.cache", ".github/workflows"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := newDirNotifier(NewFileWatcher(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.close()
+	if err := n.addTree(dir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	n.renameTree(filepath.Join(dir, "src"), filepath.Join(dir, "lib"))
+	if _, ok := n.wds[filepath.Join(dir, "lib", ".cache")]; !ok {
+		t.Errorf("watches after rename = %v, want lib/.cache", n.wds)
+	}
+
+	n.removeTree(filepath.Join(dir, ".github"))
+	n.removeTree(filepath.Join(dir, "lib"))
+	if len(n.wds) != 1 || len(n.paths) != 1 {
+		t.Errorf("watches after removal = %v, want only the root", n.wds)
+	}
+}
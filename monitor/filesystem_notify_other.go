@@ -0,0 +1,16 @@
+//go:build !linux
+
+package monitor
+
+// dirNotifier is only implemented on Linux; elsewhere StartNotify reports
+// ErrNotifyUnsupported and the polling watcher is used.
+type dirNotifier struct{}
+
+func newDirNotifier(*FileWatcher) (*dirNotifier, error) {
+	return nil, ErrNotifyUnsupported
+}
+
+func (*dirNotifier) addTree(string, bool) error { return ErrNotifyUnsupported }
+func (*dirNotifier) removeTree(string)          {}
+func (*dirNotifier) close()                     {}
+func (*dirNotifier) run(<-chan struct{})        {}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package monitor
+
+import "os"
+
+func fileInode(os.FileInfo) uint64 { return 0 }
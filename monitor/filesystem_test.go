@@ -1,8 +1,13 @@
 package monitor
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -208,6 +213,187 @@ func TestFileWatcher_SkipsGitDir(t *testing.T) {
 	}
 }
 
+func TestFileWatcher_IgnoreDirsAndFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, rel := range []string{"target/debug/app", ".venv/lib/site.py", "src/main.rs", "build.log", ".git/HEAD"} {
+		path := filepath.Join(tmpDir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fw := NewFileWatcher(100)
+	fw.SetIgnoreDirs([]string{"target", ".venv"})
+	fw.SetIgnoreFiles([]string{"*.log"})
+	fw.AddDir(tmpDir)
+	fw.takeSnapshots()
+
+	fw.mu.Lock()
+	snapshot := fw.snapshots[tmpDir]
+	fw.mu.Unlock()
+	for path := range snapshot {
+		rel, _ := filepath.Rel(tmpDir, path)
+		if strings.HasPrefix(rel, "target") || strings.HasPrefix(rel, ".venv") || rel == "build.log" {
+			t.Errorf("snapshot includes ignored path %s", rel)
+		}
+	}
+	for _, rel := range []string{"src/main.rs", ".git/HEAD"} {
+		if _, ok := snapshot[filepath.Join(tmpDir, rel)]; !ok {
+			t.Errorf("snapshot missing %s (custom list replaces the defaults)", rel)
+		}
+	}
+
+	// Changes under ignored paths are not reported either.
+	os.WriteFile(filepath.Join(tmpDir, "target", "debug", "app2"), []byte("x"), 0o644)
+	os.WriteFile(filepath.Join(tmpDir, "run.log"), []byte("x"), 0o644)
+	fw.detectChanges()
+	if ops := fw.GetOperations(); len(ops) != 0 {
+		t.Errorf("got ops for ignored paths: %+v", ops)
+	}
+}
+
+func TestFileWatcher_DefaultIgnoreDirs(t *testing.T) {
+	fw := NewFileWatcher(100)
+	ignore := fw.ignoreRules()
+	for _, name := range DefaultIgnoreDirs {
+		if !ignore.skipDir(name) {
+			t.Errorf("%s not ignored by default", name)
+		}
+	}
+	if ignore.skipDir("src") || ignore.skipFile("main.go") {
+		t.Error("default rules skip ordinary paths")
+	}
+}
+
+func TestFileWatcher_DetectRename(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldPath := filepath.Join(tmpDir, "handler.go")
+	if err := os.WriteFile(oldPath, []byte("package api"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(tmpDir, "gone.go")
+	if err := os.WriteFile(other, []byte("package api // old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fw := NewFileWatcher(100)
+	fw.AddDir(tmpDir)
+	fw.takeSnapshots()
+
+	newPath := filepath.Join(tmpDir, "http_handler.go")
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(other)
+	created := filepath.Join(tmpDir, "fresh.go")
+	os.WriteFile(created, []byte("package api // brand new"), 0o644)
+	fw.detectChanges()
+
+	got := make(map[string]agent.FileOperation)
+	for _, op := range fw.GetOperations() {
+		got[op.Op+" "+op.Path] = op
+	}
+	if op, ok := got["RENAME "+newPath]; !ok || op.OldPath != oldPath {
+		t.Errorf("missing RENAME %s -> %s; got %+v", oldPath, newPath, fw.GetOperations())
+	}
+	if _, ok := got["DELETE "+other]; !ok {
+		t.Errorf("missing DELETE %s; got %+v", other, fw.GetOperations())
+	}
+	if _, ok := got["CREATE "+created]; !ok {
+		t.Errorf("missing CREATE %s; got %+v", created, fw.GetOperations())
+	}
+	if len(got) != 3 {
+		t.Errorf("got %d ops, want 3: %+v", len(got), fw.GetOperations())
+	}
+}
+
+func TestSameFile(t *testing.T) {
+	mod := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	a := fileStamp{modTime: mod, size: 10, inode: 42}
+	if !sameFile(a, a) {
+		t.Error("identical stamps should match")
+	}
+	if sameFile(a, fileStamp{modTime: mod, size: 10, inode: 43}) {
+		t.Error("different inodes should not match")
+	}
+	if !sameFile(fileStamp{modTime: mod, size: 10}, fileStamp{modTime: mod, size: 10}) {
+		t.Error("size and modtime should match without inodes")
+	}
+	if sameFile(a, fileStamp{modTime: mod.Add(time.Second), size: 10, inode: 42}) {
+		t.Error("a reused inode with a new modtime should not match")
+	}
+}
+
+func TestFileWatcher_CollectForAgent(t *testing.T) {
+	root := t.TempDir()
+	dirA := filepath.Join(root, "app")
+	dirB := filepath.Join(root, "app-api")
+	for _, d := range []string{dirA, dirB} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fw := NewFileWatcher(100)
+	fw.AddDir(dirA)
+	fw.AddDir(dirB)
+	fw.takeSnapshots()
+	os.WriteFile(filepath.Join(dirA, "main.go"), []byte("package main"), 0o644)
+	os.WriteFile(filepath.Join(dirB, "server.go"), []byte("package api"), 0o644)
+	os.WriteFile(filepath.Join(dirB, "routes.go"), []byte("package api"), 0o644)
+	fw.detectChanges()
+
+	a := &agent.Instance{Info: agent.Info{ID: "claude-code"}, WorkDir: dirA}
+	b := &agent.Instance{Info: agent.Info{ID: "aider"}, WorkDir: dirB}
+	idle := &agent.Instance{Info: agent.Info{ID: "cursor"}, FileOps: []agent.FileOperation{{Path: "stale"}}}
+	fw.CollectForAgent(a)
+	fw.CollectForAgent(b)
+	fw.CollectForAgent(idle)
+
+	if len(a.FileOps) != 1 || a.FileOps[0].Path != filepath.Join(dirA, "main.go") {
+		t.Errorf("agent a FileOps = %+v, want only main.go", a.FileOps)
+	}
+	if len(b.FileOps) != 2 {
+		t.Errorf("agent b FileOps = %+v, want 2 ops", b.FileOps)
+	}
+	for _, op := range b.FileOps {
+		if !isUnder(op.Path, dirB) {
+			t.Errorf("agent b got op outside its dir: %s", op.Path)
+		}
+	}
+	if idle.FileOps != nil {
+		t.Errorf("agent without WorkDir FileOps = %+v, want nil", idle.FileOps)
+	}
+}
+
+func TestFileWatcher_CollectForAgentDotfiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".config"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fw := NewFileWatcher(100)
+	fw.AddDir(dir)
+	fw.takeSnapshots()
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("API_KEY=x"), 0o644)
+	os.WriteFile(filepath.Join(dir, ".config", "x"), []byte("x"), 0o644)
+	fw.detectChanges()
+
+	a := &agent.Instance{Info: agent.Info{ID: "claude-code"}, WorkDir: dir}
+	fw.CollectForAgent(a)
+	got := make(map[string]bool)
+	for _, op := range a.FileOps {
+		got[op.Path] = true
+	}
+	for _, want := range []string{filepath.Join(dir, ".env"), filepath.Join(dir, ".config", "x")} {
+		if !got[want] {
+			t.Errorf("FileOps = %+v, missing %s", a.FileOps, want)
+		}
+	}
+}
+
 func TestIsUnder(t *testing.T) {
 	tests := []struct {
 		path, dir string
@@ -217,6 +403,11 @@ func TestIsUnder(t *testing.T) {
 		{"/home/user/project/sub/file.go", "/home/user/project", true},
 		{"/home/other/file.go", "/home/user/project", false},
 		{"/home/user/project", "/home/user/project", false}, // same dir
+		{"/home/user/project/.env", "/home/user/project", true},
+		{"/home/user/project/.config/x", "/home/user/project", true},
+		{"/home/user/project/..hidden", "/home/user/project", true},
+		{"/home/user/projectx/file.go", "/home/user/project", false},
+		{"/home/user/file.go", "/home/user/project", false},
 	}
 
 	for _, tt := range tests {
@@ -237,3 +428,288 @@ func TestFileWatcher_StartStop(t *testing.T) {
 	fw.Stop()
 	// No panic = success
 }
+
+func TestFileWatcher_StopIdempotent(t *testing.T) {
+	fw := NewFileWatcher(50)
+	fw.AddDir(t.TempDir())
+	fw.Start(10 * time.Millisecond)
+	fw.Start(10 * time.Millisecond) // second Start is a no-op
+	fw.Stop()
+	fw.Stop()
+	if err := fw.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown after Stop = %v, want nil", err)
+	}
+}
+
+func TestFileWatcher_StopNeverStarted(t *testing.T) {
+	fw := NewFileWatcher(50)
+	done := make(chan struct{})
+	go func() {
+		fw.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on a watcher that was never started")
+	}
+}
+
+// waitGoroutines polls until the goroutine count drops to at most want.
+func waitGoroutines(want int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= want || time.Now().After(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileWatcher_StopUnderLoadNoLeak(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 200; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.txt", i)), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := runtime.NumGoroutine()
+	watchers := make([]*FileWatcher, 10)
+	for i := range watchers {
+		watchers[i] = NewFileWatcher(1000)
+		watchers[i].AddDir(dir)
+		watchers[i].Start(time.Millisecond)
+	}
+
+	// Keep the watchers busy with churn while they scan.
+	stopWrites := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		for i := 0; ; i++ {
+			select {
+			case <-stopWrites:
+				return
+			default:
+			}
+			_ = os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.txt", i%200)), []byte{byte(i)}, 0o644)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, fw := range watchers {
+		if err := fw.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	}
+	close(stopWrites)
+	<-writerDone
+
+	if n := waitGoroutines(before, time.Second); n > before {
+		t.Errorf("goroutines after Stop = %d, want <= %d", n, before)
+	}
+}
+
+func TestFileWatcher_ShutdownDeadline(t *testing.T) {
+	fw := NewFileWatcher(50)
+	fw.wg.Add(1) // simulate a scan that does not return
+	defer fw.wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := fw.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+}
+
+// startNotify starts fw in notify mode, skipping where it is unsupported.
+func startNotify(t *testing.T, fw *FileWatcher) {
+	t.Helper()
+	if err := fw.StartNotify(); errors.Is(err, ErrNotifyUnsupported) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatalf("StartNotify: %v", err)
+	}
+	t.Cleanup(fw.Stop)
+}
+
+// waitForOp polls until an operation matching want has been recorded.
+func waitForOp(t *testing.T, fw *FileWatcher, want agent.FileOperation) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, op := range fw.GetOperations() {
+			if op.Op == want.Op && op.Path == want.Path && op.OldPath == want.OldPath {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %s %s; got %+v", want.Op, want.Path, fw.GetOperations())
+}
+
+func TestFileWatcher_NotifyRapidCreateDelete(t *testing.T) {
+	dir := t.TempDir()
+	fw := NewFileWatcher(100)
+	fw.AddDir(dir)
+	startNotify(t, fw)
+
+	path := filepath.Join(dir, "scratch.tmp")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "CREATE", Path: path})
+	waitForOp(t, fw, agent.FileOperation{Op: "DELETE", Path: path})
+}
+
+func TestFileWatcher_NotifySubdirsAndRename(t *testing.T) {
+	dir := t.TempDir()
+	fw := NewFileWatcher(100)
+	fw.AddDir(dir)
+	startNotify(t, fw)
+
+	sub := filepath.Join(dir, "pkg", "internal")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// Give the watcher a moment to register the new directories.
+	time.Sleep(50 * time.Millisecond)
+	path := filepath.Join(sub, "a.go")
+	if err := os.WriteFile(path, []byte("package internal"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "CREATE", Path: path})
+
+	renamed := filepath.Join(sub, "b.go")
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "RENAME", Path: renamed, OldPath: path})
+
+	if err := os.WriteFile(renamed, []byte("package internal // edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "MODIFY", Path: renamed})
+
+	for _, op := range fw.GetOperations() {
+		if op.Op == "DELETE" {
+			t.Errorf("rename reported as delete: %+v", op)
+		}
+	}
+}
+
+func TestFileWatcher_NotifyRenameDotSubdir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", ".cache"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fw := NewFileWatcher(100)
+	fw.AddDir(dir)
+	startNotify(t, fw)
+
+	if err := os.Rename(filepath.Join(dir, "src"), filepath.Join(dir, "lib")); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "RENAME", Path: filepath.Join(dir, "lib"), OldPath: filepath.Join(dir, "src")})
+
+	path := filepath.Join(dir, "lib", ".cache", "entry")
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "CREATE", Path: path})
+}
+
+func TestFileWatcher_NotifySkipsGitDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".git"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	fw := NewFileWatcher(100)
+	fw.AddDir(dir)
+	startNotify(t, fw)
+
+	if err := os.WriteFile(filepath.Join(dir, ".git", "index"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	marker := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(marker, []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitForOp(t, fw, agent.FileOperation{Op: "CREATE", Path: marker})
+	for _, op := range fw.GetOperations() {
+		if strings.Contains(op.Path, ".git") {
+			t.Errorf("unexpected op inside .git: %+v", op)
+		}
+	}
+}
+
+func TestFileWatcher_NotifyStopNoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	fw := NewFileWatcher(100)
+	fw.AddDir(t.TempDir())
+	if err := fw.StartNotify(); errors.Is(err, ErrNotifyUnsupported) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatalf("StartNotify: %v", err)
+	}
+	fw.Stop()
+	if n := waitGoroutines(before, time.Second); n > before {
+		t.Errorf("goroutines = %d after Stop, want <= %d", n, before)
+	}
+}
+
+func TestFileWatcher_Events(t *testing.T) {
+	dir := t.TempDir()
+	fw := NewFileWatcher(100)
+	fw.AddDir(dir)
+	events := fw.Events()
+	fw.Start(10 * time.Millisecond)
+
+	path := filepath.Join(dir, "new.go")
+	if err := os.WriteFile(path, []byte("package main"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case op := <-events:
+		if op.Op != "CREATE" || op.Path != path {
+			t.Errorf("event = %+v, want CREATE %s", op, path)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+	}
+
+	fw.Stop()
+	if _, open := <-events; open {
+		t.Error("Events channel still open after Stop")
+	}
+}
+
+func TestFileWatcher_EventsDropWhenFull(t *testing.T) {
+	dir := t.TempDir()
+	fw := NewFileWatcher(100)
+	fw.SetEventBuffer(2)
+	fw.AddDir(dir)
+	events := fw.Events()
+	fw.takeSnapshots()
+	for i := 0; i < 5; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.go", i)), []byte("x"), 0o644)
+	}
+	fw.detectChanges()
+
+	if len(events) != 2 || cap(events) != 2 {
+		t.Errorf("buffered events = %d (cap %d), want 2 (cap 2)", len(events), cap(events))
+	}
+	if got := fw.DroppedEvents(); got != 3 {
+		t.Errorf("DroppedEvents = %d, want 3", got)
+	}
+	if got := len(fw.GetOperations()); got != 5 {
+		t.Errorf("GetOperations = %d ops, want all 5", got)
+	}
+}
@@ -1,7 +1,13 @@
 package monitor
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -11,24 +17,44 @@ import (
 )
 
 const (
-	gitErrRepo   = "repo"
-	gitErrBranch = "branch"
-	gitErrLog    = "log"
-	gitErrStatus = "status"
-	gitErrDiff   = "diff"
+	gitErrRepo     = "repo"
+	gitErrBranch   = "branch"
+	gitErrLog      = "log"
+	gitErrStatus   = "status"
+	gitErrDiff     = "diff"
+	gitErrUpstream = "upstream"
+)
+
+const (
+	defaultGitDiffTimeout    = 3 * time.Second
+	defaultGitMaxDiffFiles   = 2000
+	defaultGitCommandTimeout = 3 * time.Second
+	defaultGitRecentCommits  = 5
 )
 
 // GitMonitor tracks git activity in agent working directories.
 type GitMonitor struct {
 	lastCommitHash map[string]string
+	sessionBase    map[string]string
+	projectNames   map[string]string
 	mu             sync.Mutex
 	errorStats     map[string]MonitorErrorStats
+	diffTimeout    time.Duration
+	maxDiffFiles   int
+	cmdTimeout     time.Duration
+	recentCommits  int
 }
 
 func (gm *GitMonitor) ensureInit() {
 	if gm.lastCommitHash == nil {
 		gm.lastCommitHash = make(map[string]string)
 	}
+	if gm.sessionBase == nil {
+		gm.sessionBase = make(map[string]string)
+	}
+	if gm.projectNames == nil {
+		gm.projectNames = make(map[string]string)
+	}
 	if gm.errorStats == nil {
 		gm.errorStats = make(map[string]MonitorErrorStats)
 	}
@@ -38,10 +64,75 @@ func (gm *GitMonitor) ensureInit() {
 func NewGitMonitor() *GitMonitor {
 	return &GitMonitor{
 		lastCommitHash: make(map[string]string),
+		sessionBase:    make(map[string]string),
+		projectNames:   make(map[string]string),
 		errorStats:     make(map[string]MonitorErrorStats),
 	}
 }
 
+// SetDiffLimits bounds the cost of diff collection on huge repositories.
+// Each git diff invocation is killed after timeout, and at most maxFiles
+// numstat entries are parsed; when either limit is hit the returned
+// GitActivity has DiffTruncated set. Non-positive values restore the
+// defaults (3s, 2000 files).
+func (gm *GitMonitor) SetDiffLimits(timeout time.Duration, maxFiles int) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.diffTimeout = timeout
+	gm.maxDiffFiles = maxFiles
+}
+
+func (gm *GitMonitor) diffLimits() (time.Duration, int) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	timeout, maxFiles := gm.diffTimeout, gm.maxDiffFiles
+	if timeout <= 0 {
+		timeout = defaultGitDiffTimeout
+	}
+	if maxFiles <= 0 {
+		maxFiles = defaultGitMaxDiffFiles
+	}
+	return timeout, maxFiles
+}
+
+// SetCommandTimeout sets how long any git command other than diff (see
+// SetDiffLimits) may run before it is killed and a timeout error is
+// recorded, so a WorkDir on a stale network mount cannot stall Collect.
+// A non-positive timeout restores the default of 3s.
+func (gm *GitMonitor) SetCommandTimeout(timeout time.Duration) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.cmdTimeout = timeout
+}
+
+// SetRecentCommitLimit sets how many commits Collect lists in
+// GitActivity.RecentCommits. A non-positive n restores the default of 5.
+func (gm *GitMonitor) SetRecentCommitLimit(n int) {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	gm.recentCommits = n
+}
+
+func (gm *GitMonitor) recentCommitLimit() int {
+	gm.mu.Lock()
+	defer gm.mu.Unlock()
+	if gm.recentCommits <= 0 {
+		return defaultGitRecentCommits
+	}
+	return gm.recentCommits
+}
+
+// git runs a git command in dir under the command timeout.
+func (gm *GitMonitor) git(dir string, args ...string) ([]byte, error) {
+	gm.mu.Lock()
+	timeout := gm.cmdTimeout
+	gm.mu.Unlock()
+	if timeout <= 0 {
+		timeout = defaultGitCommandTimeout
+	}
+	return runGitWithTimeout(timeout, append([]string{"-C", dir}, args...)...)
+}
+
 // GetErrorStats returns a snapshot of operational errors per source.
 func (gm *GitMonitor) GetErrorStats() map[string]MonitorErrorStats {
 	gm.mu.Lock()
@@ -68,7 +159,8 @@ func (gm *GitMonitor) recordError(source string, err error) {
 	gm.errorStats[source] = stat
 }
 
-// Collect gathers git metrics for an agent's working directory.
+// Collect gathers git metrics for an agent's working directory and sets
+// its ProjectName (see [ResolveProjectName]).
 func (gm *GitMonitor) Collect(a *agent.Instance) {
 	gm.mu.Lock()
 	gm.ensureInit()
@@ -77,6 +169,7 @@ func (gm *GitMonitor) Collect(a *agent.Instance) {
 	if a.WorkDir == "" {
 		return
 	}
+	a.ProjectName = gm.projectName(a.WorkDir)
 
 	isRepo, err := gm.isGitRepo(a.WorkDir)
 	if err != nil {
@@ -97,7 +190,7 @@ func (gm *GitMonitor) Collect(a *agent.Instance) {
 	}
 	a.Git.Branch = branch
 
-	commits, err := gm.gitRecentCommits(a.WorkDir, 5)
+	commits, err := gm.gitRecentCommits(a.WorkDir, gm.recentCommitLimit())
 	if err != nil {
 		gm.mu.Lock()
 		gm.recordError(gitErrLog, err)
@@ -105,15 +198,42 @@ func (gm *GitMonitor) Collect(a *agent.Instance) {
 	}
 	a.Git.RecentCommits = commits
 
-	uncommitted, err := gm.gitUncommittedCount(a.WorkDir)
+	newCommits, err := gm.gitNewCommits(a.WorkDir, commits)
+	if err != nil {
+		gm.mu.Lock()
+		gm.recordError(gitErrLog, err)
+		gm.mu.Unlock()
+	}
+	a.Git.NewCommits = newCommits
+
+	sessionCommits, err := gm.gitSessionCommits(a.WorkDir)
+	if err != nil {
+		gm.mu.Lock()
+		gm.recordError(gitErrLog, err)
+		gm.mu.Unlock()
+	}
+	a.Git.SessionCommits = sessionCommits
+
+	ahead, behind, err := gm.gitAheadBehind(a.WorkDir)
+	if err != nil {
+		gm.mu.Lock()
+		gm.recordError(gitErrUpstream, err)
+		gm.mu.Unlock()
+	}
+	a.Git.Ahead = ahead
+	a.Git.Behind = behind
+
+	uncommitted, staged, untracked, err := gm.gitStatusCounts(a.WorkDir)
 	if err != nil {
 		gm.mu.Lock()
 		gm.recordError(gitErrStatus, err)
 		gm.mu.Unlock()
 	}
 	a.Git.Uncommitted = uncommitted
+	a.Git.Staged = staged
+	a.Git.Untracked = untracked
 
-	added, removed, files, err := gm.gitDiffStats(a.WorkDir)
+	added, removed, files, truncated, err := gm.gitDiffStats(a.WorkDir)
 	if err != nil {
 		gm.mu.Lock()
 		gm.recordError(gitErrDiff, err)
@@ -122,6 +242,7 @@ func (gm *GitMonitor) Collect(a *agent.Instance) {
 	a.Git.LinesAdded = added
 	a.Git.LinesRemoved = removed
 	a.Git.FilesChanged = files
+	a.Git.DiffTruncated = truncated
 
 	a.LOC.Added = added
 	a.LOC.Removed = removed
@@ -129,9 +250,69 @@ func (gm *GitMonitor) Collect(a *agent.Instance) {
 	a.LOC.Files = files
 }
 
+// projectName resolves dir once and caches the result.
+func (gm *GitMonitor) projectName(dir string) string {
+	gm.mu.Lock()
+	name, ok := gm.projectNames[dir]
+	gm.mu.Unlock()
+	if ok {
+		return name
+	}
+	name = ResolveProjectName(dir)
+	gm.mu.Lock()
+	gm.projectNames[dir] = name
+	gm.mu.Unlock()
+	return name
+}
+
+// ResolveProjectName returns a friendly project name for dir: the
+// repository name from the origin remote, else the "name" in package.json
+// at the repository root (or dir), else the base name of the repository
+// root (or dir).
+func ResolveProjectName(dir string) string {
+	if out, err := runGitWithTimeout(defaultGitCommandTimeout, "-C", dir, "config", "--get", "remote.origin.url"); err == nil {
+		if name := repoNameFromURL(strings.TrimSpace(string(out))); name != "" {
+			return name
+		}
+	}
+	root := dir
+	if out, err := runGitWithTimeout(defaultGitCommandTimeout, "-C", dir, "rev-parse", "--show-toplevel"); err == nil {
+		if top := strings.TrimSpace(string(out)); top != "" {
+			root = top
+		}
+	}
+	if name := packageJSONName(root); name != "" {
+		return name
+	}
+	return filepath.Base(filepath.Clean(root))
+}
+
+// repoNameFromURL extracts the repository name from a git remote URL such
+// as https://github.com/org/repo.git or git@github.com:org/repo.git.
+func repoNameFromURL(url string) string {
+	url = strings.TrimRight(url, "/")
+	if i := strings.LastIndexAny(url, "/:"); i >= 0 {
+		url = url[i+1:]
+	}
+	return strings.TrimSuffix(url, ".git")
+}
+
+func packageJSONName(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(data, &pkg) != nil {
+		return ""
+	}
+	return pkg.Name
+}
+
 func (gm *GitMonitor) isGitRepo(dir string) (bool, error) {
-	cmd := exec.Command("git", "-C", dir, "rev-parse", "--is-inside-work-tree")
-	out, err := cmd.Output()
+	out, err := gm.git(dir, "rev-parse", "--is-inside-work-tree")
 	if err != nil {
 		return false, err
 	}
@@ -139,8 +320,7 @@ func (gm *GitMonitor) isGitRepo(dir string) (bool, error) {
 }
 
 func (gm *GitMonitor) gitCurrentBranch(dir string) (string, error) {
-	cmd := exec.Command("git", "-C", dir, "branch", "--show-current")
-	out, err := cmd.Output()
+	out, err := gm.git(dir, "branch", "--show-current")
 	if err != nil {
 		return "", err
 	}
@@ -149,13 +329,12 @@ func (gm *GitMonitor) gitCurrentBranch(dir string) (string, error) {
 
 func (gm *GitMonitor) gitRecentCommits(dir string, count int) ([]agent.GitCommit, error) {
 	format := "%h|%s|%ct|%an"
-	cmd := exec.Command("git", "-C", dir, "log",
+	out, err := gm.git(dir, "log",
 		"--oneline",
 		"--format="+format,
 		"-n", strconv.Itoa(count),
 		"--no-merges",
 	)
-	out, err := cmd.Output()
 	if err != nil {
 		return nil, err
 	}
@@ -182,24 +361,127 @@ func (gm *GitMonitor) gitRecentCommits(dir string, count int) ([]agent.GitCommit
 	return commits, nil
 }
 
-func (gm *GitMonitor) gitUncommittedCount(dir string) (int, error) {
-	cmd := exec.Command("git", "-C", dir, "status", "--porcelain")
-	out, err := cmd.Output()
+// gitNewCommits counts the commits made since the newest commit seen by the
+// previous Collect for dir, given the recent commits newest first, and
+// remembers the newest one. The first call for dir only records it.
+func (gm *GitMonitor) gitNewCommits(dir string, commits []agent.GitCommit) (int, error) {
+	if len(commits) == 0 {
+		return 0, nil
+	}
+	newest := commits[0].Hash
+
+	gm.mu.Lock()
+	last, ok := gm.lastCommitHash[dir]
+	gm.lastCommitHash[dir] = newest
+	gm.mu.Unlock()
+	if !ok || last == newest {
+		return 0, nil
+	}
+
+	for i, c := range commits {
+		if c.Hash == last {
+			return i, nil
+		}
+	}
+	// More new commits than were listed, or history was rewritten.
+	out, err := gm.git(dir, "rev-list", "--count", "--no-merges", last+".."+newest)
 	if err != nil {
 		return 0, err
 	}
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	if len(lines) == 1 && lines[0] == "" {
+	return strconv.Atoi(strings.TrimSpace(string(out)))
+}
+
+// gitSessionCommits counts commits reachable from HEAD but not from the HEAD
+// recorded the first time dir was seen. If the baseline is no longer an
+// ancestor (history rewritten, branch switched), it is reset to HEAD.
+func (gm *GitMonitor) gitSessionCommits(dir string) (int, error) {
+	out, err := gm.git(dir, "rev-parse", "HEAD")
+	if isGitTimeout(err) {
+		return 0, err
+	}
+	if err != nil {
+		// No commits yet: nothing to count.
 		return 0, nil
 	}
-	return len(lines), nil
+	head := strings.TrimSpace(string(out))
+
+	gm.mu.Lock()
+	base, ok := gm.sessionBase[dir]
+	if !ok {
+		gm.sessionBase[dir] = head
+	}
+	gm.mu.Unlock()
+	if !ok || base == head {
+		return 0, nil
+	}
+
+	if _, err := gm.git(dir, "merge-base", "--is-ancestor", base, head); isGitTimeout(err) {
+		return 0, err
+	} else if err != nil {
+		gm.mu.Lock()
+		gm.sessionBase[dir] = head
+		gm.mu.Unlock()
+		return 0, nil
+	}
+	out, err = gm.git(dir, "rev-list", "--count", base+".."+head)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(out)))
 }
 
-func (gm *GitMonitor) gitDiffStats(dir string) (added, removed, files int, err error) {
-	a1, r1, f1, err1 := gm.parseDiffStat(dir, "diff", "--stat")
-	a2, r2, f2, err2 := gm.parseDiffStat(dir, "diff", "--cached", "--stat")
+// gitAheadBehind counts commits on HEAD not on its upstream (ahead) and the
+// reverse (behind). A branch without an upstream, or a detached HEAD, is
+// 0/0 and not an error.
+func (gm *GitMonitor) gitAheadBehind(dir string) (ahead, behind int, err error) {
+	out, err := gm.git(dir, "rev-list", "--left-right", "--count", "@{upstream}...HEAD")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr := string(exitErr.Stderr)
+			if strings.Contains(stderr, "no upstream") || strings.Contains(stderr, "does not point to a branch") {
+				return 0, 0, nil
+			}
+		}
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("unexpected rev-list output: %q", strings.TrimSpace(string(out)))
+	}
+	behind, _ = strconv.Atoi(fields[0])
+	ahead, _ = strconv.Atoi(fields[1])
+	return ahead, behind, nil
+}
+
+// gitStatusCounts counts the entries of git status --porcelain: all of
+// them, those with changes in the index, and untracked files. A file both
+// staged and modified again in the work tree counts once, as staged.
+func (gm *GitMonitor) gitStatusCounts(dir string) (total, staged, untracked int, err error) {
+	out, err := gm.git(dir, "status", "--porcelain")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		total++
+		switch {
+		case line[:2] == "??":
+			untracked++
+		case strings.ContainsRune("MADRC", rune(line[0])):
+			staged++
+		}
+	}
+	return total, staged, untracked, nil
+}
+
+func (gm *GitMonitor) gitDiffStats(dir string) (added, removed, files int, truncated bool, err error) {
+	a1, r1, f1, t1, err1 := gm.parseDiffStat(dir, "diff", "--stat")
+	a2, r2, f2, t2, err2 := gm.parseDiffStat(dir, "diff", "--cached", "--stat")
 	if err1 != nil && err2 != nil {
-		return 0, 0, 0, err1
+		return 0, 0, 0, t1 || t2, err1
 	}
 	if err1 != nil {
 		err = err1
@@ -207,15 +489,20 @@ func (gm *GitMonitor) gitDiffStats(dir string) (added, removed, files int, err e
 	if err2 != nil {
 		err = err2
 	}
-	return a1 + a2, r1 + r2, f1 + f2, err
+	return a1 + a2, r1 + r2, f1 + f2, t1 || t2, err
 }
 
-func (gm *GitMonitor) parseDiffStat(dir string, args ...string) (added, removed, files int, err error) {
+// parseDiffStat runs the given diff with --numstat (falling back to the
+// --stat line count) under the configured timeout. It stops after the
+// configured file cap and reports truncated when the cap or the timeout was
+// hit.
+func (gm *GitMonitor) parseDiffStat(dir string, args ...string) (added, removed, files int, truncated bool, err error) {
+	timeout, maxFiles := gm.diffLimits()
+
 	fullArgs := append([]string{"-C", dir}, args...)
-	cmd := exec.Command("git", fullArgs...)
-	out, err := cmd.Output()
+	out, err := runGitWithTimeout(timeout, fullArgs...)
 	if err != nil {
-		return 0, 0, 0, err
+		return 0, 0, 0, isGitTimeout(err), err
 	}
 
 	numArgs := make([]string, 0, len(args)+2)
@@ -227,17 +514,25 @@ func (gm *GitMonitor) parseDiffStat(dir string, args ...string) (added, removed,
 	}
 	numArgs = append(numArgs, "--numstat")
 
-	cmd2 := exec.Command("git", numArgs...)
-	out2, err := cmd2.Output()
+	out2, err := runGitWithTimeout(timeout, numArgs...)
 	if err != nil {
 		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-		return 0, 0, len(lines) - 1, err
+		files = len(lines) - 1
+		if files > maxFiles {
+			files = maxFiles
+			truncated = true
+		}
+		return 0, 0, files, truncated || isGitTimeout(err), err
 	}
 
 	for _, line := range strings.Split(strings.TrimSpace(string(out2)), "\n") {
 		if line == "" {
 			continue
 		}
+		if files >= maxFiles {
+			truncated = true
+			break
+		}
 		parts := strings.Fields(line)
 		if len(parts) < 3 {
 			continue
@@ -249,5 +544,26 @@ func (gm *GitMonitor) parseDiffStat(dir string, args ...string) (added, removed,
 		files++
 	}
 
-	return added, removed, files, nil
+	return added, removed, files, truncated, nil
+}
+
+// errGitTimeout is wrapped by errors from git commands killed by their timeout.
+var errGitTimeout = errors.New("git command timed out")
+
+func runGitWithTimeout(timeout time.Duration, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	// Don't let grandchildren holding stdout keep us past the deadline.
+	cmd.WaitDelay = 500 * time.Millisecond
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out, fmt.Errorf("%w after %s: git %s", errGitTimeout, timeout, strings.Join(args, " "))
+	}
+	return out, err
+}
+
+func isGitTimeout(err error) bool {
+	return errors.Is(err, errGitTimeout)
 }
@@ -2,7 +2,14 @@ package monitor
 
 import (
 	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Rafiki81/libagentmetrics/agent"
 )
@@ -47,3 +54,381 @@ func TestGitMonitorZeroValueSafe(t *testing.T) {
 	gm.Collect(a)
 	_ = gm.GetErrorStats()
 }
+
+// installFakeGit puts a shell script named git at the front of PATH for the
+// duration of the test.
+func installFakeGit(t *testing.T, script string) {
+	t.Helper()
+	installFakeCommand(t, "git", script)
+}
+
+// installFakeCommand is installFakeGit for any command name.
+func installFakeCommand(t *testing.T, name, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake " + name + " script requires a POSIX shell")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("writing fake %s: %v", name, err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestGitMonitor_DiffTimeout(t *testing.T) {
+	installFakeGit(t, `case "$3" in
+rev-parse) echo true ;;
+branch) echo main ;;
+diff) exec sleep 5 ;;
+esac
+`)
+	gm := NewGitMonitor()
+	gm.SetDiffLimits(100*time.Millisecond, 0)
+
+	a := &agent.Instance{Info: agent.Info{ID: "slow"}, WorkDir: t.TempDir()}
+	start := time.Now()
+	gm.Collect(a)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("Collect took %s, expected diff timeout to bound it", elapsed)
+	}
+	if !a.Git.DiffTruncated {
+		t.Error("expected DiffTruncated after diff timeout")
+	}
+	if a.Git.Branch != "main" {
+		t.Errorf("Branch = %q, want main", a.Git.Branch)
+	}
+	stat := gm.GetErrorStats()[gitErrDiff]
+	if stat.Count == 0 || !strings.Contains(stat.LastError, "timed out") {
+		t.Errorf("diff error stats = %+v, want timeout error", stat)
+	}
+}
+
+func TestGitMonitor_CommandTimeout(t *testing.T) {
+	installFakeGit(t, `case "$3" in
+rev-parse) [ "$4" = --is-inside-work-tree ] && echo true || exit 128 ;;
+config) exit 1 ;;
+*) exec sleep 5 ;;
+esac
+`)
+	gm := NewGitMonitor()
+	gm.SetCommandTimeout(100 * time.Millisecond)
+	gm.SetDiffLimits(100*time.Millisecond, 0)
+
+	a := &agent.Instance{Info: agent.Info{ID: "nfs"}, WorkDir: t.TempDir()}
+	start := time.Now()
+	gm.Collect(a)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("Collect took %s, expected command timeout to bound it", elapsed)
+	}
+	stats := gm.GetErrorStats()
+	for _, source := range []string{gitErrBranch, gitErrLog, gitErrStatus} {
+		if stat := stats[source]; stat.Count == 0 || !strings.Contains(stat.LastError, "timed out") {
+			t.Errorf("%s error stats = %+v, want timeout error", source, stat)
+		}
+	}
+}
+
+func TestGitMonitor_DiffFileCap(t *testing.T) {
+	installFakeGit(t, `case "$3" in
+rev-parse) echo true ;;
+diff)
+  case "$*" in
+  *--numstat*) i=0; while [ $i -lt 50 ]; do echo "2	1	file$i.go"; i=$((i+1)); done ;;
+  *) echo " file.go | 3 ++-" ;;
+  esac ;;
+esac
+`)
+	gm := NewGitMonitor()
+	gm.SetDiffLimits(0, 10)
+
+	added, removed, files, truncated, err := gm.parseDiffStat(t.TempDir(), "diff", "--stat")
+	if err != nil {
+		t.Fatalf("parseDiffStat error: %v", err)
+	}
+	if !truncated {
+		t.Error("expected truncated when numstat exceeds file cap")
+	}
+	if files != 10 || added != 20 || removed != 10 {
+		t.Errorf("got files=%d added=%d removed=%d, want 10/20/10", files, added, removed)
+	}
+}
+
+func TestGitMonitor_DiffUnderCap(t *testing.T) {
+	installFakeGit(t, `case "$*" in
+*--numstat*) echo "5	2	a.go"; echo "1	0	b.go" ;;
+*) echo " a.go | 7 +++++--" ;;
+esac
+`)
+	gm := NewGitMonitor()
+	added, removed, files, truncated, err := gm.parseDiffStat(t.TempDir(), "diff", "--stat")
+	if err != nil {
+		t.Fatalf("parseDiffStat error: %v", err)
+	}
+	if truncated {
+		t.Error("did not expect truncation for small diff")
+	}
+	if files != 2 || added != 6 || removed != 2 {
+		t.Errorf("got files=%d added=%d removed=%d, want 2/6/2", files, added, removed)
+	}
+}
+
+// initTestRepo creates a git repository with one commit and returns a
+// function that adds further commits.
+func initTestRepo(t *testing.T) (dir string, commit func(msg string)) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir = t.TempDir()
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	commit = func(msg string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, "log.txt"), []byte(msg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		run("add", "log.txt")
+		run("commit", "-q", "-m", msg)
+	}
+	commit("initial")
+	return dir, commit
+}
+
+func TestGitMonitor_SessionCommits(t *testing.T) {
+	dir, commit := initTestRepo(t)
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+
+	gm.Collect(a)
+	if a.Git.SessionCommits != 0 {
+		t.Fatalf("SessionCommits on first sight = %d, want 0", a.Git.SessionCommits)
+	}
+
+	commit("second")
+	commit("third")
+	gm.Collect(a)
+	if a.Git.SessionCommits != 2 {
+		t.Errorf("SessionCommits = %d, want 2", a.Git.SessionCommits)
+	}
+	if len(gm.GetErrorStats()) != 0 {
+		t.Errorf("unexpected errors: %+v", gm.GetErrorStats())
+	}
+}
+
+func TestGitMonitor_SessionCommitsRewrittenHistory(t *testing.T) {
+	dir, commit := initTestRepo(t)
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+
+	commit("second")
+	gm.Collect(a)
+	if out, err := exec.Command("git", "-C", dir, "reset", "-q", "--hard", "HEAD~1").CombinedOutput(); err != nil {
+		t.Fatalf("git reset: %v\n%s", err, out)
+	}
+	commit("replacement")
+	gm.Collect(a)
+	if a.Git.SessionCommits != 0 {
+		t.Errorf("SessionCommits after rewrite = %d, want baseline reset to 0", a.Git.SessionCommits)
+	}
+	commit("after")
+	gm.Collect(a)
+	if a.Git.SessionCommits != 1 {
+		t.Errorf("SessionCommits = %d, want 1 after new baseline", a.Git.SessionCommits)
+	}
+}
+
+func TestGitMonitor_NewCommits(t *testing.T) {
+	dir, commit := initTestRepo(t)
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+
+	commit("second")
+	gm.Collect(a)
+	if a.Git.NewCommits != 0 {
+		t.Fatalf("NewCommits on first pass = %d, want 0", a.Git.NewCommits)
+	}
+
+	commit("third")
+	gm.Collect(a)
+	if a.Git.NewCommits != 1 {
+		t.Errorf("NewCommits = %d, want 1", a.Git.NewCommits)
+	}
+
+	gm.Collect(a)
+	if a.Git.NewCommits != 0 {
+		t.Errorf("NewCommits without new commits = %d, want 0", a.Git.NewCommits)
+	}
+
+	// Beyond the listed recent commits the count comes from rev-list.
+	for i := 0; i < 7; i++ {
+		commit("batch " + strconv.Itoa(i))
+	}
+	gm.Collect(a)
+	if a.Git.NewCommits != 7 {
+		t.Errorf("NewCommits after batch = %d, want 7", a.Git.NewCommits)
+	}
+	if len(gm.GetErrorStats()) != 0 {
+		t.Errorf("unexpected errors: %+v", gm.GetErrorStats())
+	}
+}
+
+func TestGitMonitor_AheadBehind(t *testing.T) {
+	dir, commit := initTestRepo(t)
+	run := func(args ...string) string {
+		t.Helper()
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	remote := filepath.Join(t.TempDir(), "origin.git")
+	run("init", "-q", "--bare", remote)
+	run("remote", "add", "origin", remote)
+	run("push", "-q", "-u", "origin", run("branch", "--show-current"))
+
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+	gm.Collect(a)
+	if a.Git.Ahead != 0 || a.Git.Behind != 0 {
+		t.Fatalf("in sync: ahead=%d behind=%d, want 0/0", a.Git.Ahead, a.Git.Behind)
+	}
+
+	// Upstream gains a commit the local branch then drops, and the local
+	// branch adds two of its own.
+	commit("pushed")
+	run("push", "-q")
+	run("reset", "-q", "--hard", "HEAD~1")
+	commit("local one")
+	commit("local two")
+	gm.Collect(a)
+	if a.Git.Ahead != 2 || a.Git.Behind != 1 {
+		t.Errorf("ahead=%d behind=%d, want 2/1", a.Git.Ahead, a.Git.Behind)
+	}
+	if len(gm.GetErrorStats()) != 0 {
+		t.Errorf("unexpected errors: %+v", gm.GetErrorStats())
+	}
+}
+
+func TestGitMonitor_AheadBehindNoUpstream(t *testing.T) {
+	dir, commit := initTestRepo(t)
+	commit("second")
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+	gm.Collect(a)
+	if a.Git.Ahead != 0 || a.Git.Behind != 0 {
+		t.Errorf("ahead=%d behind=%d, want 0/0 without upstream", a.Git.Ahead, a.Git.Behind)
+	}
+	if stat, ok := gm.GetErrorStats()[gitErrUpstream]; ok {
+		t.Errorf("missing upstream recorded as error: %+v", stat)
+	}
+}
+
+func TestGitMonitor_StatusCounts(t *testing.T) {
+	dir, _ := initTestRepo(t)
+	if err := os.WriteFile(filepath.Join(dir, "new.txt"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "log.txt"), []byte("edited"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "staged.txt"), []byte("staged"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("git", "-C", dir, "add", "staged.txt").CombinedOutput(); err != nil {
+		t.Fatalf("git add: %v\n%s", err, out)
+	}
+
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+	gm.Collect(a)
+	if a.Git.Untracked != 1 || a.Git.Staged != 1 || a.Git.Uncommitted != 3 {
+		t.Errorf("untracked=%d staged=%d uncommitted=%d, want 1/1/3", a.Git.Untracked, a.Git.Staged, a.Git.Uncommitted)
+	}
+}
+
+func TestGitMonitor_RecentCommitLimit(t *testing.T) {
+	dir, commit := initTestRepo(t)
+	for i := 2; i <= 10; i++ {
+		commit("commit " + strconv.Itoa(i))
+	}
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: dir}
+
+	gm := NewGitMonitor()
+	gm.Collect(a)
+	if len(a.Git.RecentCommits) != 5 {
+		t.Errorf("default RecentCommits = %d, want 5", len(a.Git.RecentCommits))
+	}
+
+	gm.SetRecentCommitLimit(8)
+	gm.Collect(a)
+	if len(a.Git.RecentCommits) != 8 {
+		t.Fatalf("RecentCommits = %d, want 8", len(a.Git.RecentCommits))
+	}
+	if a.Git.RecentCommits[0].Message != "commit 10" {
+		t.Errorf("newest commit = %q, want commit 10", a.Git.RecentCommits[0].Message)
+	}
+
+	gm.SetRecentCommitLimit(-1)
+	gm.Collect(a)
+	if len(a.Git.RecentCommits) != 5 {
+		t.Errorf("RecentCommits after non-positive limit = %d, want default 5", len(a.Git.RecentCommits))
+	}
+}
+
+func TestResolveProjectName(t *testing.T) {
+	dir, _ := initTestRepo(t)
+	if got, want := ResolveProjectName(dir), filepath.Base(dir); got != want {
+		t.Errorf("repo without remote = %q, want %q", got, want)
+	}
+
+	if out, err := exec.Command("git", "-C", dir, "remote", "add", "origin", "git@github.com:acme/widget-service.git").CombinedOutput(); err != nil {
+		t.Fatalf("git remote add: %v\n%s", err, out)
+	}
+	sub := filepath.Join(dir, "pkg", "api")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	gm := NewGitMonitor()
+	a := &agent.Instance{Info: agent.Info{ID: "a1"}, WorkDir: sub}
+	gm.Collect(a)
+	if a.ProjectName != "widget-service" {
+		t.Errorf("ProjectName = %q, want widget-service", a.ProjectName)
+	}
+
+	plain := t.TempDir()
+	if got := ResolveProjectName(plain); got != filepath.Base(plain) {
+		t.Errorf("plain dir = %q, want %q", got, filepath.Base(plain))
+	}
+	if err := os.WriteFile(filepath.Join(plain, "package.json"), []byte(`{"name": "@acme/web"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ResolveProjectName(plain); got != "@acme/web" {
+		t.Errorf("package.json dir = %q, want @acme/web", got)
+	}
+}
+
+func TestRepoNameFromURL(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://github.com/org/repo.git":  "repo",
+		"https://github.com/org/repo/":     "repo",
+		"git@github.com:org/repo.git":      "repo",
+		"ssh://git@host:2222/team/app.git": "app",
+		"/srv/git/local":                   "local",
+	} {
+		if got := repoNameFromURL(url); got != want {
+			t.Errorf("repoNameFromURL(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -1,15 +1,20 @@
 package monitor
 
 import (
+	"compress/gzip"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
 )
 
 // HistoryRecord is a flattened snapshot record for storage.
@@ -36,14 +41,38 @@ type HistoryRecord struct {
 	Uptime       string    `json:"uptime"`
 }
 
+// AggregatedRecord rolls up one agent's history records within a time
+// bucket starting at Start.
+type AggregatedRecord struct {
+	Start     time.Time `json:"start"`
+	AgentID   string    `json:"agent_id"`
+	Samples   int       `json:"samples"`
+	AvgCPU    float64   `json:"avg_cpu"`
+	AvgMemory float64   `json:"avg_memory"`
+	MaxTokens int64     `json:"max_tokens"`
+	Cost      float64   `json:"cost"`
+}
+
 // HistoryStore manages historical metric recording.
 type HistoryStore struct {
-	mu      sync.Mutex
-	records []HistoryRecord
-	maxSize int
-	dataDir string
+	mu         sync.Mutex
+	records    []HistoryRecord
+	maxSize    int
+	dataDir    string
+	errorStats map[string]MonitorErrorStats
+	retention  time.Duration
+	autoStop   chan struct{} // nil unless auto-save is running
+	autoDone   chan struct{}
+	formats    []string // extra auto-save formats besides JSON
 }
 
+// AutoSaveFile is the file in the data directory that StartAutoSave keeps
+// up to date.
+const AutoSaveFile = "agentmetrics_autosave.json"
+
+// defaultAutoSaveInterval is used when StartAutoSave is given no interval.
+const defaultAutoSaveInterval = time.Minute
+
 // NewHistoryStore creates a history store. If dataDir is empty, it defaults
 // to ~/.agentmetrics/history. If maxSize is <= 0, it defaults to 10000 records.
 func NewHistoryStore(dataDir string, maxSize int) *HistoryStore {
@@ -52,7 +81,7 @@ func NewHistoryStore(dataDir string, maxSize int) *HistoryStore {
 	}
 	if dataDir == "" {
 		home, _ := os.UserHomeDir()
-		dataDir = filepath.Join(home, ".agentmetrics", "history")
+		return NewHistoryStoreForHome(home, maxSize)
 	}
 	os.MkdirAll(dataDir, 0755)
 
@@ -63,6 +92,36 @@ func NewHistoryStore(dataDir string, maxSize int) *HistoryStore {
 	}
 }
 
+// NewHistoryStoreFromConfig creates a history store in cfg.Directory
+// holding cfg.MaxHistory records, whose auto-save writes every format in
+// cfg.ExportFormats().
+func NewHistoryStoreFromConfig(cfg config.ExportConfig) *HistoryStore {
+	hs := NewHistoryStore(cfg.Directory, cfg.MaxHistory)
+	hs.SetExportFormats(cfg.ExportFormats())
+	return hs
+}
+
+// SetExportFormats sets the formats ("json" or "csv") auto-save writes,
+// each to AutoSaveFile with that format's extension. JSON is always
+// written, since restoring history reads it.
+func (hs *HistoryStore) SetExportFormats(formats []string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.formats = nil
+	for _, f := range formats {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" && f != "json" {
+			hs.formats = append(hs.formats, f)
+		}
+	}
+}
+
+// NewHistoryStoreForHome is like NewHistoryStore with an empty dataDir but
+// keeps history in home/.agentmetrics/history instead of under the current
+// user's home directory.
+func NewHistoryStoreForHome(home string, maxSize int) *HistoryStore {
+	return NewHistoryStore(filepath.Join(home, ".agentmetrics", "history"), maxSize)
+}
+
 // Record takes a snapshot of all agents and adds to history.
 func (hs *HistoryStore) Record(agents []agent.Instance) {
 	hs.mu.Lock()
@@ -95,11 +154,108 @@ func (hs *HistoryStore) Record(agents []agent.Instance) {
 		hs.records = append(hs.records, rec)
 	}
 
+	if hs.retention > 0 {
+		hs.pruneBefore(now.Add(-hs.retention))
+	}
+	if len(hs.records) > hs.maxSize {
+		hs.records = hs.records[len(hs.records)-hs.maxSize:]
+	}
+}
+
+// SetRetention makes Record drop records older than d, in addition to the
+// maxSize bound. A non-positive d keeps records regardless of age.
+func (hs *HistoryStore) SetRetention(d time.Duration) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.retention = d
+}
+
+// PruneOlderThan drops records with a Timestamp more than d before now and
+// returns how many were removed.
+func (hs *HistoryStore) PruneOlderThan(d time.Duration) int {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.pruneBefore(time.Now().Add(-d))
+}
+
+func (hs *HistoryStore) pruneBefore(cutoff time.Time) int {
+	kept := hs.records[:0]
+	for _, r := range hs.records {
+		if !r.Timestamp.Before(cutoff) {
+			kept = append(kept, r)
+		}
+	}
+	n := len(hs.records) - len(kept)
+	clear(hs.records[len(kept):])
+	hs.records = kept
+	return n
+}
+
+// Import adds records to the history, e.g. from a previous run or another
+// tool. The merged history is kept in timestamp order (existing records
+// first on ties) and trimmed to the newest maxSize records.
+func (hs *HistoryStore) Import(records []HistoryRecord) {
+	if len(records) == 0 {
+		return
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	hs.records = append(hs.records, records...)
+	sort.SliceStable(hs.records, func(i, j int) bool {
+		return hs.records[i].Timestamp.Before(hs.records[j].Timestamp)
+	})
 	if len(hs.records) > hs.maxSize {
 		hs.records = hs.records[len(hs.records)-hs.maxSize:]
 	}
 }
 
+// ImportJSON reads a JSON array of records, as written by ExportJSON, and
+// imports them.
+func (hs *HistoryStore) ImportJSON(r io.Reader) error {
+	var records []HistoryRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return fmt.Errorf("import history: %w", err)
+	}
+	hs.Import(records)
+	return nil
+}
+
+// LoadLatest imports the most recently written agentmetrics_*.json file in
+// the data directory, export or AutoSaveFile, so history survives a
+// restart. Files are compared by modification time, with the name breaking
+// ties. It does nothing if there is no export.
+func (hs *HistoryStore) LoadLatest() error {
+	paths, err := filepath.Glob(filepath.Join(hs.dataDir, "agentmetrics_*.json"))
+	if err != nil {
+		return err
+	}
+	var path string
+	var newest time.Time
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if mod := info.ModTime(); path == "" || mod.After(newest) || (mod.Equal(newest) && p > path) {
+			path, newest = p, mod
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := hs.ImportJSON(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
 // GetRecords returns all historical records.
 func (hs *HistoryStore) GetRecords() []HistoryRecord {
 	hs.mu.Lock()
@@ -122,43 +278,141 @@ func (hs *HistoryStore) GetRecordsForAgent(agentID string) []HistoryRecord {
 	return result
 }
 
-// ExportJSON exports all history records to a JSON file.
-// If path is empty, a timestamped file is created in the data directory.
-func (hs *HistoryStore) ExportJSON(path string) error {
+// GetRecordsInRange returns the records for agentID with a timestamp in
+// [from, to).
+func (hs *HistoryStore) GetRecordsInRange(agentID string, from, to time.Time) []HistoryRecord {
 	hs.mu.Lock()
-	records := make([]HistoryRecord, len(hs.records))
-	copy(records, hs.records)
-	hs.mu.Unlock()
+	defer hs.mu.Unlock()
+	var result []HistoryRecord
+	for _, r := range hs.records {
+		if r.AgentID == agentID && !r.Timestamp.Before(from) && r.Timestamp.Before(to) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
 
-	if path == "" {
-		path = filepath.Join(hs.dataDir, fmt.Sprintf("agentmetrics_%s.json",
-			time.Now().Format("20060102_150405")))
+// Aggregate rolls agentID's records up into buckets of the given width,
+// aligned to multiples of bucket since the zero time, in time order. Buckets
+// without records are omitted. CPU and memory are averaged and TotalTokens
+// is the maximum seen; Cost is the spend within the bucket, summed from the
+// increases of the cumulative EstCost as in CostToday.
+func (hs *HistoryStore) Aggregate(agentID string, bucket time.Duration) []AggregatedRecord {
+	if bucket <= 0 {
+		return nil
 	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
 
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+	var out []AggregatedRecord
+	var last float64
+	var hasLast bool
+	for _, r := range hs.records {
+		if r.AgentID != agentID {
+			continue
+		}
+		start := r.Timestamp.Truncate(bucket)
+		if len(out) == 0 || !out[len(out)-1].Start.Equal(start) {
+			out = append(out, AggregatedRecord{Start: start, AgentID: agentID})
+		}
+		agg := &out[len(out)-1]
+		agg.Samples++
+		agg.AvgCPU += r.CPU
+		agg.AvgMemory += r.Memory
+		agg.MaxTokens = max(agg.MaxTokens, r.TotalTokens)
+		agg.Cost += costDelta(last, r.EstCost, hasLast)
+		last, hasLast = r.EstCost, true
+	}
+	for i := range out {
+		out[i].AvgCPU /= float64(out[i].Samples)
+		out[i].AvgMemory /= float64(out[i].Samples)
 	}
+	return out
+}
 
-	data, err := json.MarshalIndent(records, "", "  ")
-	if err != nil {
-		return err
+// CostToday returns the estimated spend of agentID since local midnight of
+// now (in now's location). EstCost in history is cumulative, so the result is
+// the sum of increases between consecutive records, using the last record
+// before midnight as the baseline. A drop in the cumulative value (agent
+// restart or token monitor reset) is treated as a new accumulation from zero.
+func (hs *HistoryStore) CostToday(agentID string, now time.Time) float64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	cost, _, _ := hs.costTodayLocked(agentID, now)
+	return cost
+}
+
+// costTodayWith is like CostToday but also accounts for a live cumulative
+// cost that may not have been recorded yet.
+func (hs *HistoryStore) costTodayWith(agentID string, current float64, now time.Time) float64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	cost, last, ok := hs.costTodayLocked(agentID, now)
+	return cost + costDelta(last, current, ok)
+}
+
+func (hs *HistoryStore) costTodayLocked(agentID string, now time.Time) (cost, last float64, ok bool) {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, r := range hs.records {
+		if r.AgentID != agentID || r.Timestamp.After(now) {
+			continue
+		}
+		if r.Timestamp.Before(midnight) {
+			last, ok = r.EstCost, true
+			continue
+		}
+		cost += costDelta(last, r.EstCost, ok)
+		last, ok = r.EstCost, true
+	}
+	return cost, last, ok
+}
+
+func costDelta(prev, cur float64, hasPrev bool) float64 {
+	if !hasPrev || cur < prev {
+		return cur
 	}
+	return cur - prev
+}
+
+// ExportJSON exports all history records to a JSON file.
+// If path is empty, a timestamped file is created in the data directory.
+func (hs *HistoryStore) ExportJSON(path string) error {
+	return hs.export(path, "json", false, writeRecordsJSON)
+}
 
-	return os.WriteFile(path, data, 0644)
+// ExportJSONGzip is like ExportJSON but gzip-compresses the file, adding a
+// .gz extension to path if it lacks one.
+func (hs *HistoryStore) ExportJSONGzip(path string) error {
+	return hs.export(path, "json", true, writeRecordsJSON)
 }
 
 // ExportCSV exports all history records to a CSV file with a header row.
 // If path is empty, a timestamped file is created in the data directory.
 func (hs *HistoryStore) ExportCSV(path string) error {
+	return hs.export(path, "csv", false, writeRecordsCSV)
+}
+
+// ExportCSVGzip is like ExportCSV but gzip-compresses the file, adding a
+// .gz extension to path if it lacks one.
+func (hs *HistoryStore) ExportCSVGzip(path string) error {
+	return hs.export(path, "csv", true, writeRecordsCSV)
+}
+
+// export snapshots the records and writes them to path with write,
+// defaulting path to a timestamped agentmetrics_*.<ext> file in the data
+// directory and optionally compressing it.
+func (hs *HistoryStore) export(path, ext string, compress bool, write func(io.Writer, []HistoryRecord) error) error {
 	hs.mu.Lock()
 	records := make([]HistoryRecord, len(hs.records))
 	copy(records, hs.records)
 	hs.mu.Unlock()
 
 	if path == "" {
-		path = filepath.Join(hs.dataDir, fmt.Sprintf("agentmetrics_%s.csv",
-			time.Now().Format("20060102_150405")))
+		path = filepath.Join(hs.dataDir, fmt.Sprintf("agentmetrics_%s.%s",
+			time.Now().Format("20060102_150405"), ext))
+	}
+	if compress && !strings.HasSuffix(path, ".gz") {
+		path += ".gz"
 	}
 
 	dir := filepath.Dir(path)
@@ -172,8 +426,33 @@ func (hs *HistoryStore) ExportCSV(path string) error {
 	}
 	defer f.Close()
 
-	w := csv.NewWriter(f)
-	defer w.Flush()
+	if !compress {
+		if err := write(f, records); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+	zw := gzip.NewWriter(f)
+	if err := write(zw, records); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeRecordsJSON(w io.Writer, records []HistoryRecord) error {
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func writeRecordsCSV(out io.Writer, records []HistoryRecord) error {
+	w := csv.NewWriter(out)
 
 	header := []string{
 		"timestamp", "agent_id", "agent_name", "pid", "status",
@@ -214,7 +493,141 @@ func (hs *HistoryStore) ExportCSV(path string) error {
 		}
 	}
 
-	return nil
+	w.Flush()
+	return w.Error()
+}
+
+// ExportAll exports all history records once per requested format ("json"
+// or "csv") into the data directory, using a shared timestamp so the files
+// of one export can be matched up. It returns the paths written. Duplicate
+// formats are exported once; an unsupported format aborts with an error.
+func (hs *HistoryStore) ExportAll(formats []string) ([]string, error) {
+	stamp := time.Now().Format("20060102_150405")
+	seen := make(map[string]bool, len(formats))
+	var paths []string
+
+	for _, format := range formats {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if seen[format] {
+			continue
+		}
+		seen[format] = true
+
+		path := filepath.Join(hs.dataDir, fmt.Sprintf("agentmetrics_%s.%s", stamp, format))
+		if err := hs.exportFormat(path, format); err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+func (hs *HistoryStore) exportFormat(path, format string) error {
+	switch format {
+	case "json":
+		return hs.ExportJSON(path)
+	case "csv":
+		return hs.ExportCSV(path)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// StartAutoSave writes the records to AutoSaveFile in the data directory,
+// and in any other SetExportFormats format alongside it, every interval
+// (one minute if <= 0) until StopAutoSave, so a crash loses at most one
+// interval of history. Each save replaces the files atomically and is
+// safe to run alongside Record. Save errors are recorded in
+// GetErrorStats under "autosave". It does nothing if auto-save is running.
+func (hs *HistoryStore) StartAutoSave(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultAutoSaveInterval
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.autoStop != nil {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	hs.autoStop, hs.autoDone = stop, done
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				hs.autoSave()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopAutoSave stops auto-save, waits for a save in progress, and saves once
+// more so the file holds every record. It does nothing if auto-save is not
+// running.
+func (hs *HistoryStore) StopAutoSave() {
+	hs.mu.Lock()
+	stop, done := hs.autoStop, hs.autoDone
+	hs.autoStop, hs.autoDone = nil, nil
+	hs.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	hs.autoSave()
+}
+
+// autoSave exports to a temporary file and renames it over AutoSaveFile, so
+// readers never see a partial file. Each SetExportFormats format is saved
+// the same way next to it.
+func (hs *HistoryStore) autoSave() {
+	hs.mu.Lock()
+	formats := append([]string{"json"}, hs.formats...)
+	hs.mu.Unlock()
+
+	base := strings.TrimSuffix(AutoSaveFile, filepath.Ext(AutoSaveFile))
+	for _, format := range formats {
+		path := filepath.Join(hs.dataDir, base+"."+format)
+		tmp := path + ".tmp"
+		err := hs.exportFormat(tmp, format)
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			hs.mu.Lock()
+			hs.recordError("autosave", err)
+			hs.mu.Unlock()
+		}
+	}
+}
+
+// GetErrorStats returns a snapshot of operational errors per source.
+func (hs *HistoryStore) GetErrorStats() map[string]MonitorErrorStats {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	stats := make(map[string]MonitorErrorStats, len(hs.errorStats))
+	for k, v := range hs.errorStats {
+		stats[k] = v
+	}
+	return stats
+}
+
+func (hs *HistoryStore) recordError(source string, err error) {
+	if hs.errorStats == nil {
+		hs.errorStats = make(map[string]MonitorErrorStats)
+	}
+	stat := hs.errorStats[source]
+	stat.Count++
+	stat.LastError = err.Error()
+	stat.LastAt = time.Now()
+	hs.errorStats[source] = stat
 }
 
 // DataDir returns the data directory path.
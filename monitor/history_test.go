@@ -1,14 +1,18 @@
 package monitor
 
 import (
+	"compress/gzip"
 	"encoding/csv"
 	"encoding/json"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
 )
 
 func TestNewHistoryStore(t *testing.T) {
@@ -35,6 +39,17 @@ func TestNewHistoryStore_Defaults(t *testing.T) {
 	}
 }
 
+func TestNewHistoryStoreForHome(t *testing.T) {
+	home := t.TempDir()
+	hs := NewHistoryStoreForHome(home, 0)
+	if want := filepath.Join(home, ".agentmetrics", "history"); hs.dataDir != want {
+		t.Errorf("dataDir = %q, want %q", hs.dataDir, want)
+	}
+	if _, err := os.Stat(hs.dataDir); err != nil {
+		t.Errorf("data directory not created: %v", err)
+	}
+}
+
 func TestHistoryStore_Record(t *testing.T) {
 	tmpDir := t.TempDir()
 	hs := NewHistoryStore(tmpDir, 1000)
@@ -106,6 +121,48 @@ func TestHistoryStore_MaxSize(t *testing.T) {
 	}
 }
 
+func TestHistoryStore_PruneOlderThan(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	now := time.Now()
+	hs.records = []HistoryRecord{
+		{Timestamp: now.Add(-3 * time.Hour), AgentID: "a"},
+		{Timestamp: now.Add(-90 * time.Minute), AgentID: "b"},
+		{Timestamp: now.Add(-30 * time.Minute), AgentID: "c"},
+		{Timestamp: now.Add(-time.Minute), AgentID: "d"},
+	}
+
+	if n := hs.PruneOlderThan(time.Hour); n != 2 {
+		t.Errorf("PruneOlderThan removed %d, want 2", n)
+	}
+	got := hs.GetRecords()
+	if len(got) != 2 || got[0].AgentID != "c" || got[1].AgentID != "d" {
+		t.Errorf("records after prune = %+v, want c and d", got)
+	}
+	if n := hs.PruneOlderThan(time.Hour); n != 0 {
+		t.Errorf("second PruneOlderThan removed %d, want 0", n)
+	}
+}
+
+func TestHistoryStore_RetentionOnRecord(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	hs.records = []HistoryRecord{
+		{Timestamp: time.Now().Add(-2 * time.Hour), AgentID: "old"},
+		{Timestamp: time.Now().Add(-10 * time.Minute), AgentID: "recent"},
+	}
+
+	hs.Record([]agent.Instance{{Info: agent.Info{ID: "new"}}})
+	if got := len(hs.GetRecords()); got != 3 {
+		t.Fatalf("without retention: %d records, want 3", got)
+	}
+
+	hs.SetRetention(time.Hour)
+	hs.Record([]agent.Instance{{Info: agent.Info{ID: "new"}}})
+	got := hs.GetRecords()
+	if len(got) != 3 || got[0].AgentID != "recent" {
+		t.Errorf("with retention: records = %+v, want old pruned", got)
+	}
+}
+
 func TestHistoryStore_GetRecordsForAgent(t *testing.T) {
 	tmpDir := t.TempDir()
 	hs := NewHistoryStore(tmpDir, 1000)
@@ -191,6 +248,245 @@ func TestHistoryStore_ExportJSON_AutoPath(t *testing.T) {
 	}
 }
 
+func TestHistoryStore_ExportGzip(t *testing.T) {
+	tmpDir := t.TempDir()
+	hs := NewHistoryStore(tmpDir, 1000)
+	hs.Record([]agent.Instance{
+		{Info: agent.Info{ID: "test", Name: "Test"}, PID: 1, CPU: 5.0},
+		{Info: agent.Info{ID: "other", Name: "Other"}, PID: 2},
+	})
+
+	open := func(path string) *gzip.Reader {
+		t.Helper()
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Open error: %v", err)
+		}
+		t.Cleanup(func() { f.Close() })
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("gzip.NewReader error: %v", err)
+		}
+		return zr
+	}
+
+	jsonPath := filepath.Join(tmpDir, "export.json")
+	if err := hs.ExportJSONGzip(jsonPath); err != nil {
+		t.Fatalf("ExportJSONGzip error: %v", err)
+	}
+	var records []HistoryRecord
+	if err := json.NewDecoder(open(jsonPath + ".gz")).Decode(&records); err != nil {
+		t.Fatalf("decode error: %v", err)
+	}
+	if len(records) != 2 || records[0].AgentID != "test" || records[0].CPU != 5.0 {
+		t.Errorf("decoded records = %+v", records)
+	}
+
+	csvPath := filepath.Join(tmpDir, "export.csv.gz")
+	if err := hs.ExportCSVGzip(csvPath); err != nil {
+		t.Fatalf("ExportCSVGzip error: %v", err)
+	}
+	rows, err := csv.NewReader(open(csvPath)).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV error: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "timestamp" || rows[1][1] != "test" {
+		t.Errorf("CSV rows = %v", rows)
+	}
+
+	if err := hs.ExportJSONGzip(""); err != nil {
+		t.Fatalf("ExportJSONGzip with empty path error: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(tmpDir, "agentmetrics_*.json.gz")); len(files) == 0 {
+		t.Error("expected auto-generated .json.gz file in dataDir")
+	}
+}
+
+func TestHistoryStore_ImportJSONFromExport(t *testing.T) {
+	src := NewHistoryStore(t.TempDir(), 100)
+	src.Record([]agent.Instance{
+		{Info: agent.Info{ID: "claude-code", Name: "Claude Code"}, Tokens: agent.TokenMetrics{TotalTokens: 1000, EstCost: 0.5}},
+		{Info: agent.Info{ID: "cursor", Name: "Cursor"}, CPU: 12.5},
+	})
+	path := filepath.Join(t.TempDir(), "export.json")
+	if err := src.ExportJSON(path); err != nil {
+		t.Fatalf("ExportJSON: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dst := NewHistoryStore(t.TempDir(), 100)
+	if err := dst.ImportJSON(f); err != nil {
+		t.Fatalf("ImportJSON: %v", err)
+	}
+
+	want, got := src.GetRecords(), dst.GetRecords()
+	if len(got) != len(want) {
+		t.Fatalf("imported %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].AgentID != want[i].AgentID || got[i].TotalTokens != want[i].TotalTokens ||
+			got[i].CPU != want[i].CPU || !got[i].Timestamp.Equal(want[i].Timestamp) {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if recs := dst.GetRecordsForAgent("claude-code"); len(recs) != 1 || recs[0].EstCost != 0.5 {
+		t.Errorf("GetRecordsForAgent after import = %+v", recs)
+	}
+}
+
+func TestHistoryStore_ImportOrderAndMaxSize(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	hs := NewHistoryStore(t.TempDir(), 4)
+	hs.Import([]HistoryRecord{
+		{Timestamp: base.Add(2 * time.Minute), AgentID: "b"},
+		{Timestamp: base.Add(4 * time.Minute), AgentID: "d"},
+	})
+	hs.Import([]HistoryRecord{
+		{Timestamp: base.Add(3 * time.Minute), AgentID: "c"},
+		{Timestamp: base, AgentID: "old"},
+		{Timestamp: base.Add(time.Minute), AgentID: "a"},
+	})
+
+	recs := hs.GetRecords()
+	var ids []string
+	for _, r := range recs {
+		ids = append(ids, r.AgentID)
+	}
+	if want := "a,b,c,d"; strings.Join(ids, ",") != want {
+		t.Errorf("records = %v, want %s (oldest dropped by maxSize)", ids, want)
+	}
+}
+
+func TestHistoryStore_LoadLatest(t *testing.T) {
+	dir := t.TempDir()
+	src := NewHistoryStore(dir, 100)
+	src.Record([]agent.Instance{{Info: agent.Info{ID: "old"}}})
+	if err := src.ExportJSON(filepath.Join(dir, "agentmetrics_20260101_000000.json")); err != nil {
+		t.Fatal(err)
+	}
+	src.Record([]agent.Instance{
+		{Info: agent.Info{ID: "claude-code"}, CPU: 12.5},
+		{Info: agent.Info{ID: "aider"}, Memory: 300},
+	})
+	if err := src.ExportJSON(filepath.Join(dir, "agentmetrics_20260310_090000.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewHistoryStore(dir, 2)
+	if err := dst.LoadLatest(); err != nil {
+		t.Fatalf("LoadLatest error: %v", err)
+	}
+	got := dst.GetRecords()
+	if len(got) != 2 {
+		t.Fatalf("got %d records, want the newest 2 of the latest export", len(got))
+	}
+	if got[0].AgentID != "claude-code" || got[0].CPU != 12.5 || got[1].AgentID != "aider" {
+		t.Errorf("loaded records = %+v", got)
+	}
+
+	if err := NewHistoryStore(t.TempDir(), 10).LoadLatest(); err != nil {
+		t.Errorf("LoadLatest with no exports = %v, want nil", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "agentmetrics_20260311_000000.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewHistoryStore(dir, 10).LoadLatest(); err == nil {
+		t.Error("LoadLatest of a corrupt export returned nil error")
+	}
+}
+
+func TestHistoryStore_LoadLatestPrefersNewerExportOverAutoSave(t *testing.T) {
+	dir := t.TempDir()
+	src := NewHistoryStore(dir, 100)
+	src.Record([]agent.Instance{{Info: agent.Info{ID: "autosaved"}}})
+	autosave := filepath.Join(dir, AutoSaveFile)
+	if err := src.ExportJSON(autosave); err != nil {
+		t.Fatal(err)
+	}
+	src.Record([]agent.Instance{{Info: agent.Info{ID: "exported"}}})
+	export := filepath.Join(dir, "agentmetrics_20260310_090000.json")
+	if err := src.ExportJSON(export); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err := os.Chtimes(autosave, now.Add(-time.Hour), now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(export, now, now); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewHistoryStore(dir, 100)
+	if err := dst.LoadLatest(); err != nil {
+		t.Fatalf("LoadLatest error: %v", err)
+	}
+	if got := dst.GetRecords(); len(got) != 2 || got[1].AgentID != "exported" {
+		t.Errorf("loaded records = %+v, want the newer export", got)
+	}
+
+	// Once the auto-save is rewritten it is the latest again.
+	if err := os.Chtimes(autosave, now.Add(time.Minute), now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	dst = NewHistoryStore(dir, 100)
+	if err := dst.LoadLatest(); err != nil {
+		t.Fatalf("LoadLatest error: %v", err)
+	}
+	if got := dst.GetRecords(); len(got) != 1 || got[0].AgentID != "autosaved" {
+		t.Errorf("loaded records = %+v, want the auto-save", got)
+	}
+}
+
+func TestHistoryStore_AutoSave(t *testing.T) {
+	dir := t.TempDir()
+	hs := NewHistoryStore(dir, 1000)
+	hs.StartAutoSave(10 * time.Millisecond)
+	hs.StartAutoSave(time.Hour) // already running; no effect
+
+	path := filepath.Join(dir, AutoSaveFile)
+	deadline := time.Now().Add(2 * time.Second)
+	for i := 0; ; i++ {
+		hs.Record([]agent.Instance{{Info: agent.Info{ID: "test"}, PID: i}})
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("auto-save file did not appear")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	hs.Record([]agent.Instance{{Info: agent.Info{ID: "last"}}})
+	hs.StopAutoSave()
+	hs.StopAutoSave() // idempotent
+
+	// The final save on stop includes the last record.
+	loaded := NewHistoryStore(dir, 1000)
+	if err := loaded.LoadLatest(); err != nil {
+		t.Fatalf("LoadLatest error: %v", err)
+	}
+	got := loaded.GetRecords()
+	if len(got) != len(hs.GetRecords()) || got[len(got)-1].AgentID != "last" {
+		t.Errorf("auto-saved %d records ending %+v, want all %d", len(got), got[len(got)-1], len(hs.GetRecords()))
+	}
+	if stats := hs.GetErrorStats(); len(stats) != 0 {
+		t.Errorf("GetErrorStats = %+v, want none", stats)
+	}
+}
+
+func TestHistoryStore_ImportJSONInvalid(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 10)
+	if err := hs.ImportJSON(strings.NewReader(`{"not": "an array"}`)); err == nil {
+		t.Error("expected error for non-array JSON")
+	}
+	if n := len(hs.GetRecords()); n != 0 {
+		t.Errorf("got %d records after failed import", n)
+	}
+}
+
 func TestHistoryStore_ExportCSV(t *testing.T) {
 	tmpDir := t.TempDir()
 	hs := NewHistoryStore(tmpDir, 1000)
@@ -284,3 +580,196 @@ func TestHistoryStore_Empty(t *testing.T) {
 		t.Fatalf("ExportCSV of empty store error: %v", err)
 	}
 }
+
+func TestHistoryStore_ExportAll(t *testing.T) {
+	tmpDir := t.TempDir()
+	hs := NewHistoryStore(tmpDir, 1000)
+	hs.Record([]agent.Instance{
+		{Info: agent.Info{ID: "aider", Name: "Aider"}, PID: 7, Status: agent.StatusRunning},
+	})
+
+	paths, err := hs.ExportAll([]string{"json", "CSV", "json"})
+	if err != nil {
+		t.Fatalf("ExportAll error: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths, want 2: %v", len(paths), paths)
+	}
+	if filepath.Ext(paths[0]) != ".json" || filepath.Ext(paths[1]) != ".csv" {
+		t.Fatalf("unexpected export paths: %v", paths)
+	}
+
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("reading JSON export: %v", err)
+	}
+	var records []HistoryRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("unmarshal JSON export: %v", err)
+	}
+	if len(records) != 1 || records[0].AgentID != "aider" {
+		t.Fatalf("unexpected JSON records: %+v", records)
+	}
+
+	f, err := os.Open(paths[1])
+	if err != nil {
+		t.Fatalf("opening CSV export: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("reading CSV export: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d CSV rows, want 2 (header + record)", len(rows))
+	}
+}
+
+func TestHistoryStore_ExportAll_UnsupportedFormat(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	paths, err := hs.ExportAll([]string{"json", "xml"})
+	if err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+	if len(paths) != 1 {
+		t.Fatalf("got %d paths before failure, want 1", len(paths))
+	}
+}
+
+func TestHistoryStore_AutoSaveFormatsFromConfig(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig().Export
+	cfg.Directory, cfg.MaxHistory, cfg.Formats = dir, 5, []string{"CSV", "json"}
+	hs := NewHistoryStoreFromConfig(cfg)
+	if hs.dataDir != dir || hs.maxSize != 5 {
+		t.Fatalf("dataDir/maxSize = %q/%d, want %q/5", hs.dataDir, hs.maxSize, dir)
+	}
+
+	hs.StartAutoSave(time.Hour)
+	hs.Record([]agent.Instance{{Info: agent.Info{ID: "test"}}})
+	hs.StopAutoSave()
+
+	for _, name := range []string{"agentmetrics_autosave.json", "agentmetrics_autosave.csv"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("auto-save did not write %s: %v", name, err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "agentmetrics_autosave.csv"))
+	if err != nil || !strings.Contains(string(data), "test") {
+		t.Errorf("CSV auto-save = %q, %v", data, err)
+	}
+	if stats := hs.GetErrorStats(); len(stats) != 0 {
+		t.Errorf("GetErrorStats = %+v, want none", stats)
+	}
+}
+
+func TestHistoryStore_CostToday(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	at := func(day, hour int) time.Time { return time.Date(2026, 3, day, hour, 0, 0, 0, loc) }
+
+	hs.records = []HistoryRecord{
+		{Timestamp: at(9, 23), AgentID: "claude-code", EstCost: 2.0},
+		{Timestamp: at(10, 1), AgentID: "claude-code", EstCost: 3.0},
+		{Timestamp: at(10, 1), AgentID: "aider", EstCost: 9.0},
+		{Timestamp: at(10, 5), AgentID: "claude-code", EstCost: 4.5},
+		{Timestamp: at(10, 8), AgentID: "claude-code", EstCost: 0.5}, // restarted
+		{Timestamp: at(10, 10), AgentID: "claude-code", EstCost: 1.5},
+		{Timestamp: at(10, 13), AgentID: "claude-code", EstCost: 7.0}, // after now
+	}
+
+	now := at(10, 12)
+	if got := hs.CostToday("claude-code", now); math.Abs(got-4.0) > 1e-9 {
+		t.Errorf("CostToday local = %.2f, want 4.00", got)
+	}
+
+	// In UTC, midnight falls at 19:00 the previous local day, so the 23:00
+	// record is already "today" and there is no baseline.
+	if got := hs.CostToday("claude-code", now.UTC()); math.Abs(got-6.0) > 1e-9 {
+		t.Errorf("CostToday UTC = %.2f, want 6.00", got)
+	}
+
+	if got := hs.CostToday("missing", now); got != 0 {
+		t.Errorf("CostToday for unknown agent = %.2f, want 0", got)
+	}
+}
+
+func TestHistoryStore_GetRecordsInRange(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+	hs.records = []HistoryRecord{
+		{Timestamp: at(0), AgentID: "a"},
+		{Timestamp: at(5), AgentID: "a"},
+		{Timestamp: at(5), AgentID: "b"},
+		{Timestamp: at(10), AgentID: "a"},
+		{Timestamp: at(15), AgentID: "a"},
+	}
+
+	got := hs.GetRecordsInRange("a", at(5), at(15))
+	if len(got) != 2 || !got[0].Timestamp.Equal(at(5)) || !got[1].Timestamp.Equal(at(10)) {
+		t.Errorf("GetRecordsInRange = %+v, want a's records at 5 and 10 min", got)
+	}
+	if got := hs.GetRecordsInRange("a", at(20), at(30)); len(got) != 0 {
+		t.Errorf("GetRecordsInRange after history = %d records, want 0", len(got))
+	}
+}
+
+func TestHistoryStore_Aggregate(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+	hs.records = []HistoryRecord{
+		{Timestamp: at(0), AgentID: "a", CPU: 10, Memory: 100, TotalTokens: 1000, EstCost: 1.0},
+		{Timestamp: at(4), AgentID: "a", CPU: 30, Memory: 300, TotalTokens: 3000, EstCost: 1.5},
+		{Timestamp: at(4), AgentID: "b", CPU: 99, Memory: 999, TotalTokens: 9999, EstCost: 9.0},
+		{Timestamp: at(6), AgentID: "a", CPU: 50, Memory: 200, TotalTokens: 5000, EstCost: 2.5},
+		{Timestamp: at(8), AgentID: "a", CPU: 70, Memory: 400, TotalTokens: 500, EstCost: 0.25}, // restarted
+		// Nothing in [10, 15).
+		{Timestamp: at(16), AgentID: "a", CPU: 5, Memory: 50, TotalTokens: 1500, EstCost: 0.75},
+	}
+
+	got := hs.Aggregate("a", 5*time.Minute)
+	want := []AggregatedRecord{
+		{Start: at(0), AgentID: "a", Samples: 2, AvgCPU: 20, AvgMemory: 200, MaxTokens: 3000, Cost: 1.5},
+		{Start: at(5), AgentID: "a", Samples: 2, AvgCPU: 60, AvgMemory: 300, MaxTokens: 5000, Cost: 1.25},
+		{Start: at(15), AgentID: "a", Samples: 1, AvgCPU: 5, AvgMemory: 50, MaxTokens: 1500, Cost: 0.5},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Aggregate = %+v, want %d buckets", got, len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Start.Equal(w.Start) || g.AgentID != w.AgentID || g.Samples != w.Samples ||
+			g.MaxTokens != w.MaxTokens || math.Abs(g.AvgCPU-w.AvgCPU) > 1e-9 ||
+			math.Abs(g.AvgMemory-w.AvgMemory) > 1e-9 || math.Abs(g.Cost-w.Cost) > 1e-9 {
+			t.Errorf("bucket %d = %+v, want %+v", i, g, w)
+		}
+	}
+
+	if got := hs.Aggregate("a", 0); got != nil {
+		t.Errorf("Aggregate with zero bucket = %+v, want nil", got)
+	}
+}
+
+func TestTokenMonitor_CostTodayFromHistory(t *testing.T) {
+	hs := NewHistoryStore(t.TempDir(), 1000)
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	hs.records = []HistoryRecord{
+		{Timestamp: midnight.Add(-time.Hour), AgentID: "custom", EstCost: 0.2},
+		{Timestamp: midnight, AgentID: "custom", EstCost: 0.5},
+	}
+
+	tm := NewTokenMonitor()
+	tm.SetHistoryStore(hs)
+	tm.data["custom"] = &agent.TokenMetrics{InputTokens: 1_000_000, LastModel: "default"}
+
+	agents := []agent.Instance{{Info: agent.Info{ID: "custom"}, PID: -1}}
+	tm.Collect(agents)
+
+	// 0.3 recorded today plus 0.5 not yet recorded (live cost is $1.00).
+	if got := agents[0].Tokens.CostToday; math.Abs(got-0.8) > 1e-9 {
+		t.Errorf("CostToday = %.2f, want 0.80", got)
+	}
+}
@@ -1,6 +1,8 @@
 package monitor
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -21,26 +23,71 @@ type LocalModelMonitor struct {
 	config config.LocalModelsConfig
 	client *http.Client
 	models []agent.LocalModelInfo
+	// servers are the well-known servers probed on their default ports.
+	servers []serverDef
+	// listeningPorts maps listening TCP ports to the owning PID.
+	listeningPorts func() map[int]int
+	// processStats reports a process's CPU, memory and start time; the
+	// start time is empty if the process is not running.
+	processStats func(pid int) (cpu, memMB float64, started string)
+	now          func() time.Time
+
+	// retry is how long an unreachable endpoint is skipped.
+	retry       time.Duration
+	unreachable map[string]time.Time
+	// discovered remembers the process serving each known server found,
+	// so it is not looked up again while that process lives.
+	discovered map[string]discoveredProc
 
 	prevRequests map[string]int64
 	prevTokens   map[string]int64
 	prevTime     map[string]time.Time
 }
 
+// defaultLocalModelTimeout bounds each probe request unless
+// LocalModelsConfig.Timeout is set.
+const defaultLocalModelTimeout = 2 * time.Second
+
+// defaultLocalModelRetry is how long an unreachable server is skipped
+// unless LocalModelsConfig.RetryInterval is set.
+const defaultLocalModelRetry = 30 * time.Second
+
 // NewLocalModelMonitor creates a new local model monitor.
 func NewLocalModelMonitor(cfg config.LocalModelsConfig) *LocalModelMonitor {
+	timeout := cfg.Timeout.Duration()
+	if timeout <= 0 {
+		timeout = defaultLocalModelTimeout
+	}
+	retry := cfg.RetryInterval.Duration()
+	if retry == 0 {
+		retry = defaultLocalModelRetry
+	}
 	return &LocalModelMonitor{
 		config: cfg,
 		client: &http.Client{
-			Timeout: 2 * time.Second,
+			Timeout: timeout,
 		},
-		models:       make([]agent.LocalModelInfo, 0),
-		prevRequests: make(map[string]int64),
-		prevTokens:   make(map[string]int64),
-		prevTime:     make(map[string]time.Time),
+		servers:        knownServers(),
+		listeningPorts: NewNetworkMonitor().GetListeningPorts,
+		processStats:   psProcessStats,
+		now:            time.Now,
+		retry:          retry,
+		unreachable:    make(map[string]time.Time),
+		discovered:     make(map[string]discoveredProc),
+		models:         make([]agent.LocalModelInfo, 0),
+		prevRequests:   make(map[string]int64),
+		prevTokens:     make(map[string]int64),
+		prevTime:       make(map[string]time.Time),
 	}
 }
 
+// discoveredProc identifies the process serving an endpoint. The start
+// time tells a live process from a new one that reused its PID.
+type discoveredProc struct {
+	PID     int
+	Started string
+}
+
 type serverDef struct {
 	Name         string
 	ID           string
@@ -52,6 +99,9 @@ func knownServers() []serverDef {
 	return []serverDef{
 		{Name: "Ollama", ID: "ollama", DefaultPort: 11434, ProcessNames: []string{"ollama"}},
 		{Name: "LM Studio", ID: "lm-studio", DefaultPort: 1234, ProcessNames: []string{"lms", "LM Studio", "lmstudio"}},
+		// Servers sharing a port are tried in this order, so those with a
+		// distinctive endpoint (TGI's /info) come before generic ones.
+		{Name: "text-generation-inference", ID: "tgi", DefaultPort: 8080, ProcessNames: []string{"text-generation-launcher", "text-generation-router"}},
 		{Name: "llama.cpp", ID: "llama-cpp", DefaultPort: 8080, ProcessNames: []string{"llama-server", "llama-cli", "server"}},
 		{Name: "vLLM", ID: "vllm", DefaultPort: 8000, ProcessNames: []string{"vllm"}},
 		{Name: "LocalAI", ID: "localai", DefaultPort: 8080, ProcessNames: []string{"local-ai"}},
@@ -61,28 +111,51 @@ func knownServers() []serverDef {
 }
 
 // Collect scans for local model servers (Ollama, LM Studio, llama.cpp, vLLM,
-// LocalAI, text-generation-webui, GPT4All) plus any custom endpoints, and
-// returns their current status and loaded models.
+// text-generation-inference, LocalAI, text-generation-webui, GPT4All) plus
+// any custom endpoints, and returns their current status and loaded models.
+// Custom endpoints are probed first, all at once, then the well-known
+// servers not already found among them, all ports at once. Endpoints that
+// did not respond are skipped until the retry interval has passed; use
+// ForceRefresh to probe everything again.
 func (lm *LocalModelMonitor) Collect() []agent.LocalModelInfo {
 	if !lm.config.Enabled {
 		return nil
 	}
 
+	// Decide what to probe under the lock, then probe without it so
+	// GetModels does not wait on slow servers.
 	lm.mu.Lock()
-	defer lm.mu.Unlock()
-
-	var results []agent.LocalModelInfo
-
+	now := lm.now()
+	var probed []string
+	var endpoints []config.LocalModelEndpoint
 	for _, ep := range lm.config.Endpoints {
+		if !lm.skipProbe(ep.URL, now) {
+			endpoints = append(endpoints, ep)
+			probed = append(probed, ep.URL)
+		}
+	}
+	servers := lm.servers
+	discovered := make(map[string]discoveredProc, len(lm.discovered))
+	for endpoint, proc := range lm.discovered {
+		discovered[endpoint] = proc
+	}
+	lm.mu.Unlock()
+
+	results := probeAll(endpoints, func(ep config.LocalModelEndpoint) *agent.LocalModelInfo {
 		info := lm.probeOpenAICompatible(ep.Name, ep.ID, ep.URL)
 		if info != nil {
 			info.PID = lm.findProcessPID([]string{ep.ID, ep.Name})
-			lm.calculateRates(info)
-			results = append(results, *info)
+			lm.probeServerMetrics(info)
 		}
-	}
+		return info
+	})
 
-	for _, srv := range knownServers() {
+	// Servers sharing a default port are one group, probed in list order
+	// until one responds, so a single process is not reported twice.
+	var ports []int
+	groups := make(map[int][]serverDef)
+	lm.mu.Lock()
+	for _, srv := range servers {
 		alreadyFound := false
 		for _, r := range results {
 			if r.ServerID == srv.ID {
@@ -90,30 +163,153 @@ func (lm *LocalModelMonitor) Collect() []agent.LocalModelInfo {
 				break
 			}
 		}
-		if alreadyFound {
+		if alreadyFound || lm.skipProbe(knownEndpoint(srv), now) {
 			continue
 		}
+		if _, ok := groups[srv.DefaultPort]; !ok {
+			ports = append(ports, srv.DefaultPort)
+			probed = append(probed, knownEndpoint(srv))
+		}
+		groups[srv.DefaultPort] = append(groups[srv.DefaultPort], srv)
+	}
+	lm.mu.Unlock()
+	pending := make([][]serverDef, len(ports))
+	for i, port := range ports {
+		pending[i] = groups[port]
+	}
+	listening := sync.OnceValue(lm.listeningPorts) // only run if a server responds
+	var foundMu sync.Mutex
+	found := make(map[string]discoveredProc)
+	results = append(results, probeAll(pending, func(group []serverDef) *agent.LocalModelInfo {
+		for _, srv := range group {
+			info, proc := lm.probeKnownServer(srv, discovered[knownEndpoint(srv)], listening)
+			if info != nil {
+				foundMu.Lock()
+				found[info.Endpoint] = proc
+				foundMu.Unlock()
+				return info
+			}
+		}
+		return nil
+	})...)
 
-		endpoint := fmt.Sprintf("http://localhost:%d", srv.DefaultPort)
+	var gpuUtil map[int]float64
+	if lm.config.GPUMetrics {
+		gpuUtil = lm.gpuUtilByPID()
+	}
 
-		var info *agent.LocalModelInfo
-		if srv.ID == "ollama" {
-			info = lm.probeOllama(endpoint)
-		} else {
-			info = lm.probeOpenAICompatible(srv.Name, srv.ID, endpoint)
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.recordProbes(probed, results, found, now)
+	for i := range results {
+		if results[i].PID > 0 {
+			results[i].GPUUtilPercent = gpuUtil[results[i].PID]
 		}
+		lm.calculateRates(&results[i])
+	}
+	lm.models = results
+	return results
+}
 
-		if info != nil {
+// ForceRefresh forgets which endpoints were unreachable and which PIDs
+// served them, then collects as Collect does, probing every server.
+func (lm *LocalModelMonitor) ForceRefresh() []agent.LocalModelInfo {
+	lm.mu.Lock()
+	lm.unreachable = make(map[string]time.Time)
+	lm.discovered = make(map[string]discoveredProc)
+	lm.mu.Unlock()
+	return lm.Collect()
+}
+
+// skipProbe reports whether endpoint failed to respond within the retry
+// interval before now.
+func (lm *LocalModelMonitor) skipProbe(endpoint string, now time.Time) bool {
+	failed, ok := lm.unreachable[endpoint]
+	return ok && now.Sub(failed) < lm.retry
+}
+
+// recordProbes remembers which of the probed endpoints responded, and the
+// processes found serving them, for the next Collect.
+func (lm *LocalModelMonitor) recordProbes(probed []string, results []agent.LocalModelInfo, found map[string]discoveredProc, now time.Time) {
+	for _, endpoint := range probed {
+		lm.unreachable[endpoint] = now
+		delete(lm.discovered, endpoint)
+	}
+	for _, r := range results {
+		delete(lm.unreachable, r.Endpoint)
+		if proc := found[r.Endpoint]; proc.PID > 0 && proc.Started != "" {
+			lm.discovered[r.Endpoint] = proc
+		}
+	}
+}
+
+func knownEndpoint(srv serverDef) string {
+	return fmt.Sprintf("http://localhost:%d", srv.DefaultPort)
+}
+
+// probeKnownServer probes srv on its default port and, if it responds,
+// fills in its process and server metrics and returns the process found.
+// The process is prev, found by an earlier Collect, if it is still running
+// with the same start time, else the one listening on the port, which
+// finds servers started under wrappers such as "python -m", falling back
+// to matching srv.ProcessNames.
+func (lm *LocalModelMonitor) probeKnownServer(srv serverDef, prev discoveredProc, listening func() map[int]int) (*agent.LocalModelInfo, discoveredProc) {
+	endpoint := knownEndpoint(srv)
+
+	var info *agent.LocalModelInfo
+	switch srv.ID {
+	case "ollama":
+		info = lm.probeOllama(endpoint)
+	case "tgi":
+		info = lm.probeTGI(srv.Name, endpoint)
+	default:
+		info = lm.probeOpenAICompatible(srv.Name, srv.ID, endpoint)
+	}
+
+	if info == nil {
+		return nil, discoveredProc{}
+	}
+	var proc discoveredProc
+	if prev.PID > 0 {
+		if cpu, mem, started := lm.processStats(prev.PID); started == prev.Started {
+			info.PID, info.CPU, info.MemoryMB = prev.PID, cpu, mem
+			proc = prev
+		}
+	}
+	if info.PID == 0 {
+		info.PID = listening()[srv.DefaultPort]
+		if info.PID == 0 {
 			info.PID = lm.findProcessPID(srv.ProcessNames)
-			if info.PID > 0 {
-				info.CPU, info.MemoryMB = lm.getProcessStats(info.PID)
-			}
-			lm.calculateRates(info)
-			results = append(results, *info)
+		}
+		if info.PID > 0 {
+			proc.PID = info.PID
+			info.CPU, info.MemoryMB, proc.Started = lm.processStats(info.PID)
 		}
 	}
+	lm.probeServerMetrics(info)
+	return info, proc
+}
 
-	lm.models = results
+// probeAll runs probe for every target concurrently and returns the servers
+// found, in target order.
+func probeAll[T any](targets []T, probe func(T) *agent.LocalModelInfo) []agent.LocalModelInfo {
+	found := make([]*agent.LocalModelInfo, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found[i] = probe(t)
+		}()
+	}
+	wg.Wait()
+
+	var results []agent.LocalModelInfo
+	for _, info := range found {
+		if info != nil {
+			results = append(results, *info)
+		}
+	}
 	return results
 }
 
@@ -210,14 +406,17 @@ func (lm *LocalModelMonitor) probeOllama(endpoint string) *agent.LocalModelInfo
 			var ps ollamaPSResponse
 			if json.Unmarshal(psBody, &ps) == nil {
 				for _, running := range ps.Models {
+					expires, _ := time.Parse(time.RFC3339Nano, running.ExpiresAt)
 					info.Status = agent.LocalModelLoaded
 					info.ActiveModel = running.Name
 					info.VRAM_MB = float64(running.SizeVRAM) / (1024 * 1024)
+					info.ExpiresAt = expires
 
 					for i := range info.Models {
 						if info.Models[i].Name == running.Name {
 							info.Models[i].Running = true
 							info.Models[i].VRAM_MB = float64(running.SizeVRAM) / (1024 * 1024)
+							info.Models[i].ExpiresAt = expires
 						}
 					}
 				}
@@ -287,6 +486,189 @@ func (lm *LocalModelMonitor) probeOpenAICompatible(name, id, endpoint string) *a
 	return info
 }
 
+// --- text-generation-inference probing ---
+
+type tgiInfoResponse struct {
+	ModelID    string `json:"model_id"`
+	ModelDtype string `json:"model_dtype"`
+	Version    string `json:"version"`
+}
+
+// probeTGI identifies a HuggingFace text-generation-inference server by its
+// /info endpoint. TGI serves a single model; it is reported as running once
+// /health succeeds and as idle while the model is still loading.
+func (lm *LocalModelMonitor) probeTGI(name, endpoint string) *agent.LocalModelInfo {
+	resp, err := lm.client.Get(endpoint + "/info")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var tgi tgiInfoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tgi); err != nil || tgi.ModelID == "" {
+		return nil
+	}
+
+	info := &agent.LocalModelInfo{
+		ServerName:  name,
+		ServerID:    "tgi",
+		Endpoint:    endpoint,
+		Status:      agent.LocalModelIdle,
+		ActiveModel: tgi.ModelID,
+		LastSeen:    time.Now(),
+		Models: []agent.LocalModel{{
+			Name:       tgi.ModelID,
+			QuantLevel: tgi.ModelDtype,
+		}},
+	}
+
+	health, err := lm.client.Get(endpoint + "/health")
+	if err == nil {
+		health.Body.Close()
+		if health.StatusCode == http.StatusOK {
+			info.Status = agent.LocalModelRunning
+			info.Models[0].Running = true
+		}
+	}
+	return info
+}
+
+// --- Prometheus metrics probing ---
+
+// probeServerMetrics fills request and token counters from the server's
+// Prometheus /metrics endpoint, for servers known to expose one (vLLM).
+func (lm *LocalModelMonitor) probeServerMetrics(info *agent.LocalModelInfo) {
+	if info.ServerID != "vllm" {
+		return
+	}
+	resp, err := lm.client.Get(info.Endpoint + "/metrics")
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+	metrics, err := parsePrometheusText(resp.Body)
+	if err != nil {
+		return
+	}
+	applyVLLMMetrics(info, metrics)
+}
+
+// applyVLLMMetrics maps vLLM's counters onto info: completed requests,
+// prompt and generated tokens, and the requests currently running.
+func applyVLLMMetrics(info *agent.LocalModelInfo, metrics map[string]float64) {
+	info.TotalRequests = int64(metrics["vllm:request_success_total"])
+	info.PromptTokens = int64(metrics["vllm:prompt_tokens_total"])
+	info.TokensGenerated = int64(metrics["vllm:generation_tokens_total"])
+	info.ActiveConnections = int(metrics["vllm:num_requests_running"])
+}
+
+// parsePrometheusText reads the Prometheus text exposition format and returns
+// each metric's value summed over all of its label sets (e.g. one series per
+// model or finish reason). Comments and unparsable samples are skipped.
+func parsePrometheusText(r io.Reader) (map[string]float64, error) {
+	metrics := make(map[string]float64)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		name, rest := line, ""
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			end := strings.LastIndexByte(line, '}')
+			if end < i {
+				continue
+			}
+			name, rest = line[:i], line[end+1:]
+		} else if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, rest = line[:i], line[i:]
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		metrics[name] += v
+	}
+	return metrics, sc.Err()
+}
+
+// --- GPU utilization ---
+
+// gpuUtilByPID maps each process using an NVIDIA GPU to the utilization of
+// the busiest GPU it runs on. It returns nil if nvidia-smi is not installed
+// or fails.
+func (lm *LocalModelMonitor) gpuUtilByPID() map[int]float64 {
+	if _, err := exec.LookPath("nvidia-smi"); err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lm.client.Timeout)
+	defer cancel()
+
+	gpus, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-gpu=uuid,utilization.gpu", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil
+	}
+	apps, err := exec.CommandContext(ctx, "nvidia-smi",
+		"--query-compute-apps=pid,gpu_uuid", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return nil
+	}
+	return gpuUtilForApps(parseNvidiaGPUUtil(string(gpus)), string(apps))
+}
+
+// parseNvidiaGPUUtil parses "uuid, utilization" lines from nvidia-smi.
+// GPUs reporting "[N/A]" or "[Not Supported]" are skipped.
+func parseNvidiaGPUUtil(out string) map[string]float64 {
+	util := make(map[string]float64)
+	for _, line := range strings.Split(out, "\n") {
+		uuid, value, ok := strings.Cut(line, ",")
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			continue
+		}
+		util[strings.TrimSpace(uuid)] = v
+	}
+	return util
+}
+
+// gpuUtilForApps parses "pid, gpu_uuid" lines from nvidia-smi and returns the
+// highest utilization among the GPUs each PID uses.
+func gpuUtilForApps(util map[string]float64, apps string) map[int]float64 {
+	byPID := make(map[int]float64)
+	for _, line := range strings.Split(apps, "\n") {
+		pidStr, uuid, ok := strings.Cut(line, ",")
+		if !ok {
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(pidStr))
+		if err != nil {
+			continue
+		}
+		v, ok := util[strings.TrimSpace(uuid)]
+		if !ok {
+			continue
+		}
+		byPID[pid] = max(byPID[pid], v)
+	}
+	return byPID
+}
+
 // --- Helper functions ---
 
 func (lm *LocalModelMonitor) findProcessPID(processNames []string) int {
@@ -312,17 +694,19 @@ func (lm *LocalModelMonitor) findProcessPID(processNames []string) int {
 	return 0
 }
 
-func (lm *LocalModelMonitor) getProcessStats(pid int) (cpu float64, memMB float64) {
-	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "%cpu=,%mem=,rss=").Output()
+// psProcessStats reads a process's CPU, memory and start time from ps.
+func psProcessStats(pid int) (cpu float64, memMB float64, started string) {
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "%cpu=,%mem=,rss=,lstart=").Output()
 	if err != nil {
-		return 0, 0
+		return 0, 0, ""
 	}
 
 	fields := strings.Fields(strings.TrimSpace(string(out)))
-	if len(fields) >= 3 {
+	if len(fields) >= 4 {
 		cpu, _ = strconv.ParseFloat(fields[0], 64)
 		rssKB, _ := strconv.ParseFloat(fields[2], 64)
 		memMB = rssKB / 1024
+		started = strings.Join(fields[3:], " ")
 	}
 	return
 }
@@ -0,0 +1,440 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+const vllmMetricsBody = `# HELP vllm:num_requests_running Number of requests currently running on GPU.
+# TYPE vllm:num_requests_running gauge
+vllm:num_requests_running{model_name="meta-llama/Llama-3.1-8B"} 3.0
+# HELP vllm:prompt_tokens_total Number of prefill tokens processed.
+# TYPE vllm:prompt_tokens_total counter
+vllm:prompt_tokens_total{model_name="meta-llama/Llama-3.1-8B"} 12345.0
+# HELP vllm:generation_tokens_total Number of generation tokens processed.
+# TYPE vllm:generation_tokens_total counter
+vllm:generation_tokens_total{model_name="meta-llama/Llama-3.1-8B"} 6789.0
+# TYPE vllm:request_success_total counter
+vllm:request_success_total{finished_reason="stop",model_name="meta-llama/Llama-3.1-8B"} 40.0
+vllm:request_success_total{finished_reason="length",model_name="meta-llama/Llama-3.1-8B"} 2.0
+vllm:e2e_request_latency_seconds_bucket{le="+Inf",model_name="a {b}"} 42 1712345678000
+process_open_fds 17
+`
+
+func TestParsePrometheusText(t *testing.T) {
+	metrics, err := parsePrometheusText(strings.NewReader(vllmMetricsBody))
+	if err != nil {
+		t.Fatalf("parsePrometheusText error: %v", err)
+	}
+	want := map[string]float64{
+		"vllm:num_requests_running":               3,
+		"vllm:prompt_tokens_total":                12345,
+		"vllm:generation_tokens_total":            6789,
+		"vllm:request_success_total":              42,
+		"vllm:e2e_request_latency_seconds_bucket": 42,
+		"process_open_fds":                        17,
+	}
+	for name, v := range want {
+		if metrics[name] != v {
+			t.Errorf("%s = %v, want %v", name, metrics[name], v)
+		}
+	}
+	if len(metrics) != len(want) {
+		t.Errorf("parsed %d metrics, want %d: %v", len(metrics), len(want), metrics)
+	}
+}
+
+func TestLocalModelMonitor_ProbeVLLMMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(vllmMetricsBody))
+	}))
+	defer srv.Close()
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{})
+	info := &agent.LocalModelInfo{ServerID: "vllm", Endpoint: srv.URL}
+	lm.probeServerMetrics(info)
+	if info.TotalRequests != 42 || info.PromptTokens != 12345 || info.TokensGenerated != 6789 || info.ActiveConnections != 3 {
+		t.Errorf("info = %+v", info)
+	}
+
+	// Other servers are not probed.
+	other := &agent.LocalModelInfo{ServerID: "lm-studio", Endpoint: srv.URL}
+	lm.probeServerMetrics(other)
+	if other.TokensGenerated != 0 {
+		t.Errorf("non-vLLM server got TokensGenerated = %d", other.TokensGenerated)
+	}
+}
+
+// slowModelServer serves an OpenAI-compatible /v1/models after delay.
+func slowModelServer(t *testing.T, model string, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(`{"data":[{"id":"` + model + `"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLocalModelMonitor_CollectConcurrent(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	a := slowModelServer(t, "model-a", delay)
+	b := slowModelServer(t, "model-b", delay)
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{
+		Enabled: true,
+		Endpoints: []config.LocalModelEndpoint{
+			{Name: "A", ID: "stub-a", URL: a.URL},
+			{Name: "B", ID: "stub-b", URL: b.URL},
+		},
+	})
+	lm.servers = nil
+
+	start := time.Now()
+	got := lm.Collect()
+	elapsed := time.Since(start)
+
+	if len(got) != 2 || got[0].ActiveModel != "model-a" || got[1].ActiveModel != "model-b" {
+		t.Fatalf("Collect = %+v, want both servers in endpoint order", got)
+	}
+	if elapsed >= 2*delay {
+		t.Errorf("Collect took %v, want the slow servers probed concurrently (< %v)", elapsed, 2*delay)
+	}
+}
+
+func TestLocalModelMonitor_Timeout(t *testing.T) {
+	slow := slowModelServer(t, "model", 500*time.Millisecond)
+	cfg := config.LocalModelsConfig{
+		Enabled:   true,
+		Endpoints: []config.LocalModelEndpoint{{Name: "Slow", ID: "stub-slow", URL: slow.URL}},
+	}
+
+	if lm := NewLocalModelMonitor(cfg); lm.client.Timeout != defaultLocalModelTimeout {
+		t.Errorf("default timeout = %v, want %v", lm.client.Timeout, defaultLocalModelTimeout)
+	}
+
+	cfg.Timeout = config.Duration(100 * time.Millisecond)
+	lm := NewLocalModelMonitor(cfg)
+	lm.servers = nil
+	if got := lm.Collect(); len(got) != 0 {
+		t.Errorf("Collect with 100ms timeout = %+v, want the slow server skipped", got)
+	}
+
+	cfg.Timeout = config.Duration(2 * time.Second)
+	lm = NewLocalModelMonitor(cfg)
+	lm.servers = nil
+	if got := lm.Collect(); len(got) != 1 {
+		t.Errorf("Collect with 2s timeout found %d servers, want 1", len(got))
+	}
+}
+
+func TestLocalModelMonitor_ProbeOllamaExpiry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[
+				{"name":"llama3.2:3b","size":2019393189,"details":{"family":"llama","parameter_size":"3.2B","quantization_level":"Q4_K_M"}},
+				{"name":"qwen2.5:7b","size":4683087332}]}`))
+		case "/api/ps":
+			w.Write([]byte(`{"models":[
+				{"name":"llama3.2:3b","size":3155165184,"size_vram":3155165184,"expires_at":"2026-03-10T09:04:31.83753-07:00"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{})
+	info := lm.probeOllama(srv.URL)
+	if info == nil {
+		t.Fatal("probeOllama returned nil")
+	}
+
+	want := time.Date(2026, 3, 10, 9, 4, 31, 837530000, time.FixedZone("", -7*60*60))
+	if !info.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", info.ExpiresAt, want)
+	}
+	if info.Status != agent.LocalModelLoaded || info.ActiveModel != "llama3.2:3b" {
+		t.Errorf("info = %+v, want llama3.2:3b loaded", info)
+	}
+	if len(info.Models) != 2 || !info.Models[0].ExpiresAt.Equal(want) || !info.Models[1].ExpiresAt.IsZero() {
+		t.Errorf("models = %+v, want expiry only on the running model", info.Models)
+	}
+}
+
+func TestLocalModelMonitor_GPUUtilByPID(t *testing.T) {
+	installFakeCommand(t, "nvidia-smi", `case "$1" in
+--query-gpu=*)
+	echo "GPU-aaaa, 87"
+	echo "GPU-bbbb, 12"
+	echo "GPU-cccc, [Not Supported]"
+	;;
+--query-compute-apps=*)
+	echo "4242, GPU-aaaa"
+	echo "4242, GPU-bbbb"
+	echo "5151, GPU-bbbb"
+	echo "6161, GPU-cccc"
+	;;
+esac
+`)
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{GPUMetrics: true})
+	got := lm.gpuUtilByPID()
+	want := map[int]float64{4242: 87, 5151: 12}
+	if len(got) != len(want) {
+		t.Fatalf("gpuUtilByPID = %v, want %v", got, want)
+	}
+	for pid, v := range want {
+		if got[pid] != v {
+			t.Errorf("pid %d = %v, want %v", pid, got[pid], v)
+		}
+	}
+}
+
+func TestLocalModelMonitor_GPUUtilWithoutNvidiaSMI(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{GPUMetrics: true})
+	if got := lm.gpuUtilByPID(); got != nil {
+		t.Errorf("gpuUtilByPID without nvidia-smi = %v, want nil", got)
+	}
+}
+
+// tgiServer stubs text-generation-inference, which also serves the
+// OpenAI-compatible /v1/models like llama.cpp does.
+func tgiServer(t *testing.T, healthy bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/info":
+			w.Write([]byte(`{"model_id":"bigcode/starcoder2-15b","model_dtype":"torch.float16","version":"2.4.0"}`))
+		case "/health":
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/v1/models":
+			w.Write([]byte(`{"data":[{"id":"tgi"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLocalModelMonitor_ProbeTGI(t *testing.T) {
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{})
+
+	info := lm.probeTGI("text-generation-inference", tgiServer(t, true).URL)
+	if info == nil {
+		t.Fatal("probeTGI returned nil")
+	}
+	if info.ServerID != "tgi" || info.ActiveModel != "bigcode/starcoder2-15b" || info.Status != agent.LocalModelRunning {
+		t.Errorf("info = %+v", info)
+	}
+	if len(info.Models) != 1 || info.Models[0].QuantLevel != "torch.float16" || !info.Models[0].Running {
+		t.Errorf("models = %+v", info.Models)
+	}
+
+	if info := lm.probeTGI("text-generation-inference", tgiServer(t, false).URL); info == nil || info.Status != agent.LocalModelIdle {
+		t.Errorf("loading server = %+v, want idle", info)
+	}
+
+	// An OpenAI-compatible server without /info is not TGI.
+	other := slowModelServer(t, "model", 0)
+	if info := lm.probeTGI("text-generation-inference", other.URL); info != nil {
+		t.Errorf("probeTGI on a non-TGI server = %+v, want nil", info)
+	}
+}
+
+func TestLocalModelMonitor_SharedPortReportedOnce(t *testing.T) {
+	srv := tgiServer(t, true)
+	port, err := strconv.Atoi(srv.URL[strings.LastIndexByte(srv.URL, ':')+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{Enabled: true})
+	lm.servers = []serverDef{
+		{Name: "text-generation-inference", ID: "tgi", DefaultPort: port},
+		{Name: "llama.cpp", ID: "llama-cpp", DefaultPort: port},
+		{Name: "LocalAI", ID: "localai", DefaultPort: port},
+	}
+	got := lm.Collect()
+	if len(got) != 1 || got[0].ServerID != "tgi" {
+		t.Errorf("Collect = %+v, want only tgi on the shared port", got)
+	}
+}
+
+func TestLocalModelMonitor_PIDFromListeningPort(t *testing.T) {
+	srv := tgiServer(t, true)
+	port, err := strconv.Atoi(srv.URL[strings.LastIndexByte(srv.URL, ':')+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{Enabled: true})
+	// No process name matches, so only the port owner can identify it.
+	lm.servers = []serverDef{{Name: "text-generation-inference", ID: "tgi", DefaultPort: port,
+		ProcessNames: []string{"no-such-process-name"}}}
+	lm.listeningPorts = func() map[int]int { return map[int]int{port: os.Getpid(), 1: 1} }
+
+	got := lm.Collect()
+	if len(got) != 1 {
+		t.Fatalf("Collect = %+v, want one server", got)
+	}
+	if got[0].PID != os.Getpid() {
+		t.Errorf("PID = %d, want the port owner %d", got[0].PID, os.Getpid())
+	}
+	if got[0].MemoryMB <= 0 {
+		t.Errorf("MemoryMB = %v, want stats for the port owner", got[0].MemoryMB)
+	}
+}
+
+func TestLocalModelMonitor_SkipsUnreachableWithinRetry(t *testing.T) {
+	var hits atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{
+		Enabled:       true,
+		Endpoints:     []config.LocalModelEndpoint{{Name: "Down", ID: "stub-down", URL: down.URL}},
+		RetryInterval: config.Duration(30 * time.Second),
+	})
+	lm.servers = nil
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	lm.now = func() time.Time { return start }
+
+	lm.Collect()
+	perProbe := hits.Load()
+	if perProbe == 0 {
+		t.Fatal("first Collect did not probe the endpoint")
+	}
+
+	lm.now = func() time.Time { return start.Add(29 * time.Second) }
+	lm.Collect()
+	if got := hits.Load(); got != perProbe {
+		t.Errorf("Collect within the retry interval made %d requests, want none", got-perProbe)
+	}
+
+	lm.now = func() time.Time { return start.Add(30 * time.Second) }
+	lm.Collect()
+	if got := hits.Load(); got != 2*perProbe {
+		t.Errorf("Collect after the retry interval made %d requests, want %d", got-perProbe, perProbe)
+	}
+
+	lm.ForceRefresh()
+	if got := hits.Load(); got != 3*perProbe {
+		t.Errorf("ForceRefresh made %d requests, want %d", got-2*perProbe, perProbe)
+	}
+}
+
+func TestLocalModelMonitor_RemembersDiscoveredPID(t *testing.T) {
+	srv := tgiServer(t, true)
+	port, err := strconv.Atoi(srv.URL[strings.LastIndexByte(srv.URL, ':')+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{Enabled: true})
+	lm.servers = []serverDef{{Name: "text-generation-inference", ID: "tgi", DefaultPort: port}}
+	lookups := 0
+	lm.listeningPorts = func() map[int]int {
+		lookups++
+		return map[int]int{port: os.Getpid()}
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := lm.Collect(); len(got) != 1 || got[0].PID != os.Getpid() {
+			t.Fatalf("Collect #%d = %+v, want the server with this PID", i+1, got)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("listening ports listed %d times, want once while the process lives", lookups)
+	}
+
+	lm.ForceRefresh()
+	if lookups != 2 {
+		t.Errorf("ForceRefresh did not look the PID up again (%d lookups)", lookups)
+	}
+}
+
+func TestLocalModelMonitor_DiscoveredPIDReused(t *testing.T) {
+	srv := tgiServer(t, true)
+	port, err := strconv.Atoi(srv.URL[strings.LastIndexByte(srv.URL, ':')+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{Enabled: true})
+	lm.servers = []serverDef{{Name: "text-generation-inference", ID: "tgi", DefaultPort: port}}
+	owner := 100
+	lm.listeningPorts = func() map[int]int { return map[int]int{port: owner} }
+	started := map[int]string{100: "Thu Oct 15 09:00:00 2026"}
+	lm.processStats = func(pid int) (float64, float64, string) { return 1, 64, started[pid] }
+
+	if got := lm.Collect(); len(got) != 1 || got[0].PID != 100 {
+		t.Fatalf("first Collect = %+v, want PID 100", got)
+	}
+
+	// The server restarted as PID 200 and an unrelated process reused 100.
+	owner = 200
+	started[100] = "Fri Oct 16 10:00:00 2026"
+	started[200] = "Fri Oct 16 09:59:00 2026"
+	if got := lm.Collect(); len(got) != 1 || got[0].PID != 200 {
+		t.Errorf("Collect after PID reuse = %+v, want the port owner 200", got)
+	}
+}
+
+func TestLocalModelMonitor_GetModelsDuringCollect(t *testing.T) {
+	release := make(chan struct{})
+	probing := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case probing <- struct{}{}:
+		default:
+		}
+		<-release
+		w.Write([]byte(`{"data":[{"id":"slow"}]}`))
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	lm := NewLocalModelMonitor(config.LocalModelsConfig{
+		Enabled:   true,
+		Endpoints: []config.LocalModelEndpoint{{Name: "Slow", ID: "stub-slow", URL: slow.URL}},
+		Timeout:   config.Duration(10 * time.Second),
+	})
+	lm.servers = nil
+	go lm.Collect()
+	<-probing
+
+	done := make(chan struct{})
+	go func() {
+		lm.GetModels()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetModels blocked while Collect was probing")
+	}
+}
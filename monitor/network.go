@@ -1,8 +1,11 @@
 package monitor
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,10 +19,41 @@ const (
 	networkErrLsofListening   = "lsof_listening"
 )
 
+const (
+	defaultResolveTimeout = 500 * time.Millisecond
+	defaultHostCacheSize  = 1024
+	hostCacheTTL          = 10 * time.Minute
+
+	// connectionWorkers bounds the concurrent lookups in
+	// GetAllAgentConnections.
+	connectionWorkers = 8
+)
+
+// HostResolver reverse-resolves IP addresses. *net.Resolver implements it.
+type HostResolver interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
 // NetworkMonitor tracks network connections for agent processes.
 type NetworkMonitor struct {
 	mu         sync.Mutex
 	errorStats map[string]MonitorErrorStats
+
+	// Reverse DNS for remote addresses; nil disables it
+	resolver       HostResolver
+	resolveTimeout time.Duration
+	hostCacheSize  int
+	hosts          map[string]hostEntry // IP -> name, "" if it has none
+
+	// Root of the proc filesystem on Linux; empty means /proc
+	procRoot string
+	// Per-PID lookup used by GetAllAgentConnections; nil means GetConnections
+	connectionsFor func(pid int) []agent.NetConnection
+}
+
+type hostEntry struct {
+	name    string
+	expires time.Time
 }
 
 func (nm *NetworkMonitor) ensureInit() {
@@ -33,6 +67,34 @@ func NewNetworkMonitor() *NetworkMonitor {
 	return &NetworkMonitor{errorStats: make(map[string]MonitorErrorStats)}
 }
 
+// SetResolver enables reverse DNS for remote addresses: GetConnections then
+// fills NetConnection.RemoteHost using r, for example net.DefaultResolver.
+// Lookups are bounded by a timeout and cached, failures included, for ten
+// minutes. Pass nil to disable it again; it is off by default since lookups
+// add latency.
+func (nm *NetworkMonitor) SetResolver(r HostResolver) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.resolver = r
+	nm.hosts = nil
+}
+
+// SetResolveTimeout bounds each reverse lookup. Non-positive values restore
+// the default of 500ms.
+func (nm *NetworkMonitor) SetResolveTimeout(d time.Duration) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.resolveTimeout = d
+}
+
+// SetHostCacheSize limits how many resolved addresses are cached.
+// Non-positive values restore the default of 1024.
+func (nm *NetworkMonitor) SetHostCacheSize(n int) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	nm.hostCacheSize = n
+}
+
 // GetErrorStats returns a snapshot of operational errors per source.
 func (nm *NetworkMonitor) GetErrorStats() map[string]MonitorErrorStats {
 	nm.mu.Lock()
@@ -59,8 +121,23 @@ func (nm *NetworkMonitor) recordError(source string, err error) {
 	nm.errorStats[source] = stat
 }
 
-// GetConnections returns active network connections for a PID.
+// GetConnections returns active network connections for a PID. On Linux
+// they are read from /proc, falling back to lsof when that fails; elsewhere
+// lsof is used.
 func (nm *NetworkMonitor) GetConnections(pid int) []agent.NetConnection {
+	if runtime.GOOS == "linux" {
+		nm.mu.Lock()
+		root := nm.procRoot
+		nm.mu.Unlock()
+		if root == "" {
+			root = "/proc"
+		}
+		if conns, err := procConnections(root, pid); err == nil {
+			nm.resolveHosts(conns)
+			return conns
+		}
+	}
+
 	cmd := exec.Command("lsof", "-i", "-n", "-P", "-p", strconv.Itoa(pid))
 	out, err := cmd.Output()
 	if err != nil {
@@ -84,18 +161,111 @@ func (nm *NetworkMonitor) GetConnections(pid int) []agent.NetConnection {
 		}
 	}
 
+	nm.resolveHosts(conns)
 	return conns
 }
 
-// GetAllAgentConnections returns connections for all given PIDs.
+// resolveHosts sets RemoteHost on conns when a resolver is configured.
+func (nm *NetworkMonitor) resolveHosts(conns []agent.NetConnection) {
+	nm.mu.Lock()
+	r := nm.resolver
+	nm.mu.Unlock()
+	if r == nil {
+		return
+	}
+	for i := range conns {
+		ip, _, err := net.SplitHostPort(conns[i].RemoteAddr)
+		if err != nil || net.ParseIP(ip) == nil {
+			continue
+		}
+		conns[i].RemoteHost = nm.lookupHost(r, ip)
+	}
+}
+
+// lookupHost returns the cached or freshly resolved name of ip. The lookup
+// runs without holding the lock.
+func (nm *NetworkMonitor) lookupHost(r HostResolver, ip string) string {
+	now := time.Now()
+	nm.mu.Lock()
+	if e, ok := nm.hosts[ip]; ok && now.Before(e.expires) {
+		nm.mu.Unlock()
+		return e.name
+	}
+	timeout := nm.resolveTimeout
+	nm.mu.Unlock()
+	if timeout <= 0 {
+		timeout = defaultResolveTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	names, err := r.LookupAddr(ctx, ip)
+	cancel()
+	name := ""
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if nm.hosts == nil {
+		nm.hosts = make(map[string]hostEntry)
+	}
+	limit := nm.hostCacheSize
+	if limit <= 0 {
+		limit = defaultHostCacheSize
+	}
+	if len(nm.hosts) >= limit {
+		for k, e := range nm.hosts {
+			if !now.Before(e.expires) {
+				delete(nm.hosts, k)
+			}
+		}
+		// Still full: drop arbitrary entries, they are cheap to refetch.
+		for k := range nm.hosts {
+			if len(nm.hosts) < limit {
+				break
+			}
+			delete(nm.hosts, k)
+		}
+	}
+	nm.hosts[ip] = hostEntry{name: name, expires: now.Add(hostCacheTTL)}
+	return name
+}
+
+// GetAllAgentConnections returns connections for all given PIDs. Up to
+// eight PIDs are looked up concurrently.
 func (nm *NetworkMonitor) GetAllAgentConnections(pids []int) map[int][]agent.NetConnection {
+	lookup := nm.connectionsFor
+	if lookup == nil {
+		lookup = nm.GetConnections
+	}
+
+	var (
+		resultMu sync.Mutex
+		wg       sync.WaitGroup
+	)
 	result := make(map[int][]agent.NetConnection)
+	work := make(chan int)
+	for i := 0; i < min(connectionWorkers, len(pids)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pid := range work {
+				conns := lookup(pid)
+				if len(conns) == 0 {
+					continue
+				}
+				resultMu.Lock()
+				result[pid] = conns
+				resultMu.Unlock()
+			}
+		}()
+	}
 	for _, pid := range pids {
-		conns := nm.GetConnections(pid)
-		if len(conns) > 0 {
-			result[pid] = conns
-		}
+		work <- pid
 	}
+	close(work)
+	wg.Wait()
 	return result
 }
 
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// tcpStates maps the st column of /proc/net/tcp to the names lsof prints.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSED",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// procConnections returns the TCP and UDP sockets pid holds, read from the
+// /proc tree under root: socket inodes come from the PID's fd links and are
+// matched against its network namespace's tcp, tcp6, udp and udp6 tables.
+func procConnections(root string, pid int) ([]agent.NetConnection, error) {
+	pidDir := filepath.Join(root, strconv.Itoa(pid))
+	inodes, err := socketInodes(filepath.Join(pidDir, "fd"))
+	if err != nil {
+		return nil, err
+	}
+	if len(inodes) == 0 {
+		return nil, nil
+	}
+
+	var conns []agent.NetConnection
+	for _, table := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join(pidDir, "net", table))
+		if err != nil {
+			continue // IPv6 disabled, or no UDP table
+		}
+		found, err := parseProcNet(f, strings.TrimSuffix(table, "6"), inodes)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", table, err)
+		}
+		conns = append(conns, found...)
+	}
+	return conns, nil
+}
+
+// socketInodes returns the inodes of the sockets linked from an fd directory.
+func socketInodes(fdDir string) (map[string]bool, error) {
+	entries, err := os.ReadDir(fdDir)
+	if err != nil {
+		return nil, err
+	}
+	inodes := make(map[string]bool)
+	for _, e := range entries {
+		target, err := os.Readlink(filepath.Join(fdDir, e.Name()))
+		if err != nil {
+			continue // closed while scanning
+		}
+		if inode, ok := strings.CutPrefix(target, "socket:["); ok {
+			inodes[strings.TrimSuffix(inode, "]")] = true
+		}
+	}
+	return inodes, nil
+}
+
+// parseProcNet reads a /proc/net/{tcp,udp}[6] table and returns the rows
+// whose inode is in inodes. protocol is "tcp" or "udp"; UDP sockets have no
+// state, matching lsof.
+func parseProcNet(r io.Reader, protocol string, inodes map[string]bool) ([]agent.NetConnection, error) {
+	var conns []agent.NetConnection
+	sc := bufio.NewScanner(r)
+	first := true
+	for sc.Scan() {
+		if first { // header
+			first = false
+			continue
+		}
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 10 || !inodes[fields[9]] {
+			continue
+		}
+		local, err := decodeProcAddr(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		remote, err := decodeProcAddr(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		conn := agent.NetConnection{LocalAddr: local, Protocol: protocol}
+		if !strings.HasPrefix(remote, "*:") {
+			conn.RemoteAddr = remote
+		}
+		if protocol == "tcp" {
+			conn.State = tcpStates[strings.ToUpper(fields[3])]
+		}
+		conns = append(conns, conn)
+	}
+	return conns, sc.Err()
+}
+
+// decodeProcAddr turns a hex "ADDR:PORT" from /proc/net into lsof's form:
+// "127.0.0.1:8080", "[::1]:443", or "*:3000" for the unspecified address.
+// Addresses are stored as 32-bit words in host (little-endian) order.
+func decodeProcAddr(s string) (string, error) {
+	addrHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", fmt.Errorf("malformed address %q", s)
+	}
+	raw, err := hex.DecodeString(addrHex)
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", fmt.Errorf("malformed address %q", s)
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("malformed port %q", s)
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	p := strconv.FormatUint(port, 10)
+	if ip.IsUnspecified() {
+		return "*:" + p, nil
+	}
+	return net.JoinHostPort(ip.String(), p), nil
+}
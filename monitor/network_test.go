@@ -1,8 +1,17 @@
 package monitor
 
 import (
+	"context"
 	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Rafiki81/libagentmetrics/agent"
 )
@@ -167,6 +176,60 @@ func TestGetAllAgentConnections_EmptyPIDs(t *testing.T) {
 	}
 }
 
+// fakeConnections returns a deterministic, PID-dependent connection list,
+// sleeping like a slow lsof would. Every third PID has none.
+func fakeConnections(delay time.Duration) func(int) []agent.NetConnection {
+	return func(pid int) []agent.NetConnection {
+		time.Sleep(delay)
+		if pid%3 == 0 {
+			return nil
+		}
+		return []agent.NetConnection{{
+			LocalAddr:  "10.0.0.2:" + strconv.Itoa(40000+pid),
+			RemoteAddr: "142.250.80.46:443",
+			State:      "ESTABLISHED",
+			Protocol:   "tcp",
+		}}
+	}
+}
+
+func TestGetAllAgentConnections_MatchesSerial(t *testing.T) {
+	var active, peak atomic.Int32
+	slow := fakeConnections(20 * time.Millisecond)
+	nm := NewNetworkMonitor()
+	nm.connectionsFor = func(pid int) []agent.NetConnection {
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		return slow(pid)
+	}
+
+	var pids []int
+	for pid := 1; pid <= 20; pid++ {
+		pids = append(pids, pid)
+	}
+	got := nm.GetAllAgentConnections(pids)
+
+	serial := make(map[int][]agent.NetConnection)
+	lookup := fakeConnections(0)
+	for _, pid := range pids {
+		if conns := lookup(pid); len(conns) > 0 {
+			serial[pid] = conns
+		}
+	}
+	if !reflect.DeepEqual(got, serial) {
+		t.Errorf("concurrent result differs from serial:\n%v\n%v", got, serial)
+	}
+	if p := peak.Load(); p < 2 || p > connectionWorkers {
+		t.Errorf("peak concurrency = %d, want between 2 and %d", p, connectionWorkers)
+	}
+}
+
 func TestNetworkMonitorErrorStats(t *testing.T) {
 	nm := NewNetworkMonitor()
 	nm.recordError(networkErrLsofConnections, errors.New("lsof failed"))
@@ -198,3 +261,155 @@ func TestNetworkMonitorZeroValueSafe(t *testing.T) {
 	_ = nm.GetListeningPorts()
 	_ = nm.GetErrorStats()
 }
+
+type stubResolver struct {
+	names map[string]string
+	calls map[string]int
+}
+
+func (r *stubResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	r.calls[addr]++
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("lookup without deadline")
+	}
+	if name, ok := r.names[addr]; ok {
+		return []string{name}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func TestNetworkMonitor_ResolveHosts(t *testing.T) {
+	r := &stubResolver{
+		names: map[string]string{"142.250.80.46": "lga34s34-in-f14.1e100.net."},
+		calls: map[string]int{},
+	}
+	conns := []agent.NetConnection{
+		{LocalAddr: "10.0.0.2:5000", RemoteAddr: "142.250.80.46:443"},
+		{LocalAddr: "10.0.0.2:5001", RemoteAddr: "203.0.113.9:443"},
+		{LocalAddr: "*:3000"},
+	}
+
+	nm := NewNetworkMonitor()
+	nm.resolveHosts(conns)
+	if conns[0].RemoteHost != "" {
+		t.Fatal("RemoteHost set without a resolver")
+	}
+
+	nm.SetResolver(r)
+	nm.resolveHosts(conns)
+	if conns[0].RemoteHost != "lga34s34-in-f14.1e100.net" {
+		t.Errorf("RemoteHost = %q, want trailing dot trimmed", conns[0].RemoteHost)
+	}
+	if conns[1].RemoteHost != "" || conns[2].RemoteHost != "" {
+		t.Errorf("unexpected hosts: %+v", conns)
+	}
+
+	// Hits and misses are both cached.
+	nm.resolveHosts(conns)
+	if r.calls["142.250.80.46"] != 1 || r.calls["203.0.113.9"] != 1 {
+		t.Errorf("calls = %v, want one lookup per address", r.calls)
+	}
+}
+
+func TestNetworkMonitor_HostCacheBounded(t *testing.T) {
+	r := &stubResolver{names: map[string]string{}, calls: map[string]int{}}
+	nm := NewNetworkMonitor()
+	nm.SetResolver(r)
+	nm.SetHostCacheSize(2)
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+		nm.lookupHost(r, ip)
+	}
+	if n := len(nm.hosts); n != 2 {
+		t.Errorf("cache holds %d entries, want 2", n)
+	}
+}
+
+const sampleProcNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 1111 1 0000000000000000 100 0 0 10 0
+   1: 0200000A:D431 2E50FA8E:01BB 01 00000000:00000000 02:000A7D5B 00000000  1000        0 2222 1 0000000000000000 20 4 30 10 -1
+   2: 00000000:0BB8 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 3333 1 0000000000000000 100 0 0 10 0
+   3: 0200000A:D432 2E50FA8E:01BB 06 00000000:00000000 03:00000A2E 00000000     0        0 0 3 0000000000000000
+`
+
+func TestParseProcNet(t *testing.T) {
+	inodes := map[string]bool{"1111": true, "2222": true, "3333": true}
+	got, err := parseProcNet(strings.NewReader(sampleProcNetTCP), "tcp", inodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []agent.NetConnection{
+		{LocalAddr: "127.0.0.1:8080", State: "LISTEN", Protocol: "tcp"},
+		{LocalAddr: "10.0.0.2:54321", RemoteAddr: "142.250.80.46:443", State: "ESTABLISHED", Protocol: "tcp"},
+		{LocalAddr: "*:3000", State: "LISTEN", Protocol: "tcp"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseProcNet =\n%+v\nwant\n%+v", got, want)
+	}
+	if got[0].RemoteAddr != "" || DescribeConnection(got[0]) != "tcp 127.0.0.1:8080 (LISTEN)" {
+		t.Errorf("listening socket described as %q", DescribeConnection(got[0]))
+	}
+}
+
+func TestDecodeProcAddr(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0100007F:1F90", "127.0.0.1:8080"},
+		{"00000000:0035", "*:53"},
+		{"00000000000000000000000001000000:01BB", "[::1]:443"},
+		{"0000000000000000FFFF00000100007F:0050", "127.0.0.1:80"},
+		{"B80D0120000000000000000001000000:0016", "[2001:db8::1]:22"},
+	}
+	for _, tt := range tests {
+		got, err := decodeProcAddr(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("decodeProcAddr(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "0100007F", "XYZ:0050", "0100:0050", "0100007F:GGGG"} {
+		if _, err := decodeProcAddr(bad); err == nil {
+			t.Errorf("decodeProcAddr(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestProcConnections(t *testing.T) {
+	root := t.TempDir()
+	pidDir := filepath.Join(root, "4242")
+	for _, dir := range []string{"fd", "net"} {
+		if err := os.MkdirAll(filepath.Join(pidDir, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{"0": "/dev/null", "3": "socket:[2222]", "4": "pipe:[9]", "5": "socket:[7777]"}
+	for fd, target := range links {
+		if err := os.Symlink(target, filepath.Join(pidDir, "fd", fd)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	udp6 := `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  9: 00000000000000000000000001000000:14E9 00000000000000000000000000000000:0000 07 00000000:00000000 00:00000000 00000000  1000        0 7777 2 0000000000000000 0
+`
+	files := map[string]string{"tcp": sampleProcNetTCP, "udp6": udp6}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(pidDir, "net", name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := procConnections(root, 4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []agent.NetConnection{
+		{LocalAddr: "10.0.0.2:54321", RemoteAddr: "142.250.80.46:443", State: "ESTABLISHED", Protocol: "tcp"},
+		{LocalAddr: "[::1]:5353", Protocol: "udp"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("procConnections =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if _, err := procConnections(root, 1); err == nil {
+		t.Error("expected error for a missing PID")
+	}
+}
@@ -1,12 +1,17 @@
 package monitor
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/Rafiki81/libagentmetrics/internal/procfs"
 )
 
 const (
@@ -14,14 +19,25 @@ const (
 	processErrLsof = "lsof"
 )
 
-// ProcessMetrics holds CPU/memory metrics for a process.
+// ProcessMetrics holds CPU/memory metrics for a process. Threads is zero
+// when the thread count is unavailable.
+//
+// ReadBytes and WriteBytes are the cumulative bytes the process has read and
+// written through any descriptor (files, pipes and sockets), and the
+// PerSec fields their rate since the previous Collect. They are read from
+// /proc/<pid>/io and stay zero on other platforms; the rates are zero on
+// the first Collect for a PID.
 type ProcessMetrics struct {
-	PID       int
-	CPU       float64
-	MemoryMB  float64
-	Threads   int
-	OpenFiles int
-	Timestamp time.Time
+	PID              int
+	CPU              float64
+	MemoryMB         float64
+	Threads          int
+	OpenFiles        int
+	ReadBytes        int64
+	WriteBytes       int64
+	ReadBytesPerSec  float64
+	WriteBytesPerSec float64
+	Timestamp        time.Time
 }
 
 // ProcessMonitor monitors metrics of specific PIDs.
@@ -29,6 +45,20 @@ type ProcessMonitor struct {
 	mu         sync.Mutex
 	pids       []int
 	errorStats map[string]MonitorErrorStats
+
+	// Platform whose ps flavour is used; empty means runtime.GOOS
+	goos string
+	// Root of the proc filesystem the I/O counters are read from; empty
+	// means /proc
+	procRoot string
+	// Cumulative I/O byte counters per PID; nil means procIOCounters
+	ioCounters func(pid int) (read, write int64, err error)
+	prevIO     map[int]ioSample
+}
+
+type ioSample struct {
+	read, write int64
+	at          time.Time
 }
 
 func (pm *ProcessMonitor) ensureInit() {
@@ -76,7 +106,9 @@ func (pm *ProcessMonitor) recordError(source string, err error) {
 	pm.errorStats[source] = stat
 }
 
-// Collect gathers metrics for all tracked PIDs.
+// Collect gathers metrics for all tracked PIDs. CPU and memory for every PID
+// come from a single ps call; if its output cannot be parsed, each PID is
+// queried on its own instead.
 func (pm *ProcessMonitor) Collect() ([]ProcessMetrics, error) {
 	pm.mu.Lock()
 	pm.ensureInit()
@@ -86,6 +118,94 @@ func (pm *ProcessMonitor) Collect() ([]ProcessMetrics, error) {
 	if len(pids) == 0 {
 		return nil, nil
 	}
+
+	samples, err := pm.readPSBatch(pids)
+	if err != nil {
+		metrics := pm.collectSerial(pids)
+		pm.applyIO(metrics)
+		return metrics, nil
+	}
+	var metrics []ProcessMetrics
+	for _, pid := range pids {
+		sample, ok := samples[pid]
+		if !ok {
+			continue // exited
+		}
+		metrics = append(metrics, ProcessMetrics{
+			PID:       pid,
+			CPU:       sample.cpu,
+			MemoryMB:  sample.rssKB / 1024.0,
+			Threads:   sample.threads,
+			OpenFiles: pm.countOpenFiles(pid),
+			Timestamp: time.Now(),
+		})
+	}
+	pm.applyIO(metrics)
+	return metrics, nil
+}
+
+// applyIO fills the I/O counters of metrics and their rates against the
+// previous Collect. Counters that went backwards mean the PID was reused,
+// so the rate restarts from zero.
+func (pm *ProcessMonitor) applyIO(metrics []ProcessMetrics) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	read := pm.ioCounters
+	if read == nil {
+		root := pm.procRoot
+		if root == "" {
+			root = "/proc"
+		}
+		read = func(pid int) (int64, int64, error) { return procIOCounters(root, pid) }
+	}
+	seen := make(map[int]ioSample, len(metrics))
+	for i := range metrics {
+		m := &metrics[i]
+		r, w, err := read(m.PID)
+		if err != nil {
+			continue
+		}
+		m.ReadBytes, m.WriteBytes = r, w
+		cur := ioSample{read: r, write: w, at: m.Timestamp}
+		seen[m.PID] = cur
+		prev, ok := pm.prevIO[m.PID]
+		if !ok || r < prev.read || w < prev.write {
+			continue
+		}
+		if secs := cur.at.Sub(prev.at).Seconds(); secs > 0 {
+			m.ReadBytesPerSec = float64(r-prev.read) / secs
+			m.WriteBytesPerSec = float64(w-prev.write) / secs
+		}
+	}
+	pm.prevIO = seen
+}
+
+// procIOCounters reads rchar and wchar from <root>/<pid>/io. It fails on
+// platforms without /proc.
+func procIOCounters(root string, pid int) (read, write int64, err error) {
+	io, err := procfs.ReadIO(root, pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return io.ReadChars, io.WriteChars, nil
+}
+
+func (pm *ProcessMonitor) platform() string {
+	if pm.goos != "" {
+		return pm.goos
+	}
+	return runtime.GOOS
+}
+
+// psHasNLWP reports whether ps on goos supports the nlwp (thread count)
+// column. BSD-style ps, as on macOS, does not; threads are counted from
+// `ps -M` there instead.
+func psHasNLWP(goos string) bool {
+	return goos != "darwin"
+}
+
+// collectSerial gathers metrics with one ps call per PID.
+func (pm *ProcessMonitor) collectSerial(pids []int) []ProcessMetrics {
 	var metrics []ProcessMetrics
 	for _, pid := range pids {
 		m, err := pm.collectOne(pid)
@@ -94,12 +214,123 @@ func (pm *ProcessMonitor) Collect() ([]ProcessMetrics, error) {
 		}
 		metrics = append(metrics, m)
 	}
-	return metrics, nil
+	return metrics
+}
+
+// psSample is one row of batched ps output.
+type psSample struct {
+	cpu     float64
+	rssKB   float64
+	threads int
+}
+
+// readPSBatch reads CPU and RSS for all pids with a single ps call. PIDs
+// that have exited are absent from the result. An error means the output
+// could not be parsed and the caller should fall back to per-PID calls.
+func (pm *ProcessMonitor) readPSBatch(pids []int) (map[int]psSample, error) {
+	list := make([]string, len(pids))
+	for i, pid := range pids {
+		list[i] = strconv.Itoa(pid)
+	}
+	columns := "pid=,%cpu=,%mem=,rss="
+	nlwp := psHasNLWP(pm.platform())
+	if nlwp {
+		columns += ",nlwp="
+	}
+	cmd := exec.Command("ps", "-p", strings.Join(list, ","), "-o", columns)
+	out, err := cmd.Output()
+	if err != nil && len(strings.TrimSpace(string(out))) == 0 {
+		// ps exits non-zero when none of the PIDs exist; only a failure
+		// to run it at all is worth recording.
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			pm.mu.Lock()
+			pm.recordError(processErrPS, err)
+			pm.mu.Unlock()
+			return nil, err
+		}
+		return map[int]psSample{}, nil
+	}
+	samples, err := parsePSBatch(string(out), nlwp)
+	if err != nil || nlwp {
+		return samples, err
+	}
+	if threads, err := exec.Command("ps", "-M", "-p", strings.Join(list, ",")).Output(); err == nil {
+		for pid, n := range parsePSThreads(string(threads)) {
+			if sample, ok := samples[pid]; ok {
+				sample.threads = n
+				samples[pid] = sample
+			}
+		}
+	}
+	return samples, nil
+}
+
+// parsePSBatch parses `ps -o pid=,%cpu=,%mem=,rss=` output keyed by PID,
+// with a trailing nlwp= column when nlwp is set.
+func parsePSBatch(out string, nlwp bool) (map[int]psSample, error) {
+	want := 4
+	if nlwp {
+		want = 5
+	}
+	samples := make(map[int]psSample)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != want {
+			return nil, fmt.Errorf("unexpected ps row %q", line)
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parse pid in %q: %w", line, err)
+		}
+		cpu, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse cpu in %q: %w", line, err)
+		}
+		rss, err := strconv.ParseFloat(fields[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse rss in %q: %w", line, err)
+		}
+		sample := psSample{cpu: cpu, rssKB: rss}
+		if nlwp {
+			if sample.threads, err = strconv.Atoi(fields[4]); err != nil {
+				return nil, fmt.Errorf("parse nlwp in %q: %w", line, err)
+			}
+		}
+		samples[pid] = sample
+	}
+	return samples, nil
+}
+
+// parsePSThreads counts the rows per PID in macOS `ps -M` output, which
+// prints one row per thread. The user column is left blank on every row but
+// a process's first, so the PID is the first or second field.
+func parsePSThreads(out string) map[int]int {
+	counts := make(map[int]int)
+	lines := strings.Split(out, "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		for _, f := range fields[:min(2, len(fields))] {
+			if pid, err := strconv.Atoi(f); err == nil {
+				counts[pid]++
+				break
+			}
+		}
+	}
+	return counts
 }
 
 func (pm *ProcessMonitor) collectOne(pid int) (ProcessMetrics, error) {
 	pidStr := strconv.Itoa(pid)
-	cmd := exec.Command("ps", "-p", pidStr, "-o", "%cpu,%mem,rss")
+	columns := "%cpu,%mem,rss"
+	nlwp := psHasNLWP(pm.platform())
+	if nlwp {
+		columns += ",nlwp"
+	}
+	cmd := exec.Command("ps", "-p", pidStr, "-o", columns)
 	out, err := cmd.Output()
 	if err != nil {
 		pm.mu.Lock()
@@ -121,12 +352,17 @@ func (pm *ProcessMonitor) collectOne(pid int) (ProcessMetrics, error) {
 	cpu, _ := strconv.ParseFloat(fields[0], 64)
 	rssKB, _ := strconv.ParseFloat(fields[2], 64)
 	memMB := rssKB / 1024.0
+	threads := 0
+	if nlwp && len(fields) > 3 {
+		threads, _ = strconv.Atoi(fields[3])
+	}
 	openFiles := pm.countOpenFiles(pid)
 
 	return ProcessMetrics{
 		PID:       pid,
 		CPU:       cpu,
 		MemoryMB:  memMB,
+		Threads:   threads,
 		OpenFiles: openFiles,
 		Timestamp: time.Now(),
 	}, nil
@@ -149,6 +385,15 @@ func (pm *ProcessMonitor) countOpenFiles(pid int) int {
 	return count
 }
 
+// FormatMemory formats a size in MB for display, switching to GB from
+// 1024 MB (e.g. "512.0 MB", "1.5 GB").
+func FormatMemory(mb float64) string {
+	if mb >= 1024 {
+		return fmt.Sprintf("%.1f GB", mb/1024)
+	}
+	return fmt.Sprintf("%.1f MB", mb)
+}
+
 // IsRunning checks if a PID is still active.
 func IsRunning(pid int) bool {
 	cmd := exec.Command("kill", "-0", strconv.Itoa(pid))
@@ -174,3 +419,47 @@ func GetChildPIDs(pid int) []int {
 	}
 	return children
 }
+
+// HostMemoryMB returns the total physical memory of the host in MB. It reads
+// /proc/meminfo on Linux and sysctl hw.memsize on macOS.
+func HostMemoryMB() (float64, error) {
+	switch runtime.GOOS {
+	case "linux":
+		data, err := os.ReadFile("/proc/meminfo")
+		if err != nil {
+			return 0, err
+		}
+		return parseMemTotal(string(data))
+	case "darwin":
+		out, err := exec.Command("sysctl", "-n", "hw.memsize").Output()
+		if err != nil {
+			return 0, err
+		}
+		bytes, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+		if err != nil {
+			return 0, err
+		}
+		return bytes / (1024 * 1024), nil
+	default:
+		return 0, fmt.Errorf("host memory not supported on %s", runtime.GOOS)
+	}
+}
+
+// parseMemTotal extracts MemTotal (reported in kB) from /proc/meminfo.
+func parseMemTotal(meminfo string) (float64, error) {
+	for _, line := range strings.Split(meminfo, "\n") {
+		if !strings.HasPrefix(line, "MemTotal:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			break
+		}
+		kb, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb / 1024, nil
+	}
+	return 0, fmt.Errorf("MemTotal not found in meminfo")
+}
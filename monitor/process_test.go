@@ -2,7 +2,12 @@ package monitor
 
 import (
 	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestNewProcessMonitor(t *testing.T) {
@@ -123,3 +128,242 @@ func TestProcessMonitorZeroValueSafe(t *testing.T) {
 	}
 	_ = pm.GetErrorStats()
 }
+
+func TestParseMemTotal(t *testing.T) {
+	meminfo := "MemTotal:       16318480 kB\nMemFree:         1234567 kB\n"
+	got, err := parseMemTotal(meminfo)
+	if err != nil {
+		t.Fatalf("parseMemTotal: %v", err)
+	}
+	if want := 16318480.0 / 1024; got != want {
+		t.Errorf("parseMemTotal = %v, want %v", got, want)
+	}
+	if _, err := parseMemTotal("MemFree: 1 kB\n"); err == nil {
+		t.Error("expected error when MemTotal is missing")
+	}
+}
+
+func TestHostMemoryMB(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("host memory not supported on " + runtime.GOOS)
+	}
+	mb, err := HostMemoryMB()
+	if err != nil {
+		t.Fatalf("HostMemoryMB: %v", err)
+	}
+	if mb <= 0 {
+		t.Errorf("HostMemoryMB = %v, want > 0", mb)
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	tests := []struct {
+		mb   float64
+		want string
+	}{
+		{0, "0.0 MB"},
+		{512, "512.0 MB"},
+		{1023.9, "1023.9 MB"},
+		{1024, "1.0 GB"},
+		{1536, "1.5 GB"},
+		{20480, "20.0 GB"},
+	}
+	for _, tt := range tests {
+		if got := FormatMemory(tt.mb); got != tt.want {
+			t.Errorf("FormatMemory(%v) = %q, want %q", tt.mb, got, tt.want)
+		}
+	}
+}
+
+func TestParsePSBatch(t *testing.T) {
+	out := "    1  0.2  0.1  9240\n 4242 12.5  1.3 204800\n\n"
+	got, err := parsePSBatch(out, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]psSample{1: {cpu: 0.2, rssKB: 9240}, 4242: {cpu: 12.5, rssKB: 204800}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePSBatch = %+v, want %+v", got, want)
+	}
+
+	got, err = parsePSBatch("    1  0.2  0.1  9240    1\n 4242 12.5  1.3 204800   17\n", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[1].threads != 1 || got[4242].threads != 17 {
+		t.Errorf("threads = %d, %d; want 1, 17", got[1].threads, got[4242].threads)
+	}
+
+	for _, bad := range []string{"  1 0.2 0.1\n", "abc 0.2 0.1 9240\n", "1 n/a 0.1 9240\n", "1 0.2 0.1 lots\n"} {
+		if _, err := parsePSBatch(bad, false); err == nil {
+			t.Errorf("parsePSBatch(%q) succeeded, want error", bad)
+		}
+	}
+	if _, err := parsePSBatch("1 0.2 0.1 9240 many\n", true); err == nil {
+		t.Error("parsePSBatch accepted a non-numeric nlwp")
+	}
+}
+
+func TestParsePSThreads(t *testing.T) {
+	out := `USER   PID   TT  %CPU STAT PRI     STIME     UTIME COMMAND
+alice 4242 s000  0.0 S    31T   0:00.01   0:00.02 claude
+      4242         0.0 S    31T   0:00.00   0:00.00
+      4242         0.1 S    31T   0:00.00   0:00.00
+alice  501 s001  0.0 S    31T   0:00.00   0:00.01 node
+`
+	got := parsePSThreads(out)
+	if got[4242] != 3 || got[501] != 1 || len(got) != 2 {
+		t.Errorf("parsePSThreads = %v, want 4242:3 501:1", got)
+	}
+}
+
+func TestCollect_ThreadsCurrentProcess(t *testing.T) {
+	metrics, err := NewProcessMonitor([]int{os.Getpid()}).Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) == 0 {
+		t.Skip("current process not visible to ps")
+	}
+	if runtime.GOOS != "darwin" && metrics[0].Threads <= 0 {
+		// The Go runtime always runs several threads.
+		t.Errorf("Threads = %d, want > 0", metrics[0].Threads)
+	}
+}
+
+func TestCollect_Batched(t *testing.T) {
+	installFakeCommand(t, "ps", `[ "$2" = "100,200,300" ] || exit 2
+printf '  100  5.0  0.3  2048    9\n  300  0.5  0.1  1024    1\n'
+exit 1
+`)
+	installFakeCommand(t, "lsof", `printf 'HEADER\na\nb\n'`)
+
+	pm := NewProcessMonitor([]int{100, 200, 300})
+	pm.goos = "linux"
+	metrics, err := pm.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 || metrics[0].PID != 100 || metrics[1].PID != 300 {
+		t.Fatalf("metrics = %+v, want PIDs 100 and 300", metrics)
+	}
+	if metrics[0].CPU != 5 || metrics[0].MemoryMB != 2 || metrics[0].Threads != 9 || metrics[0].OpenFiles != 2 {
+		t.Errorf("metrics[0] = %+v", metrics[0])
+	}
+}
+
+func TestCollect_BatchedThreadsDarwin(t *testing.T) {
+	installFakeCommand(t, "ps", `if [ "$1" = -M ]; then
+printf 'USER PID TT %%CPU STAT PRI STIME UTIME COMMAND\n'
+printf 'alice 100 s000 0.0 S 31T 0:00.01 0:00.02 claude\n'
+printf '      100      0.0 S 31T 0:00.00 0:00.00\n'
+exit 0
+fi
+case "$4" in *nlwp*) exit 2 ;; esac
+printf '  100  5.0  0.3  2048\n'
+`)
+	installFakeCommand(t, "lsof", `exit 0`)
+
+	pm := NewProcessMonitor([]int{100})
+	pm.goos = "darwin"
+	metrics, err := pm.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].Threads != 2 {
+		t.Errorf("metrics = %+v, want 2 threads from ps -M", metrics)
+	}
+}
+
+func TestCollect_BatchFallsBackToSerial(t *testing.T) {
+	installFakeCommand(t, "ps", `case "$2" in
+*,*) echo "garbage" ;;
+*) printf '%%CPU %%MEM RSS\n 1.5 0.1 4096\n' ;;
+esac
+`)
+	installFakeCommand(t, "lsof", `exit 0`)
+
+	pm := NewProcessMonitor([]int{100, 200})
+	pm.goos = "darwin"
+	metrics, err := pm.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 2 || metrics[1].PID != 200 || metrics[1].CPU != 1.5 || metrics[1].MemoryMB != 4 {
+		t.Errorf("metrics = %+v, want per-PID results", metrics)
+	}
+}
+
+func TestProcessMonitor_IORates(t *testing.T) {
+	counters := map[int][2]int64{100: {1000, 500}, 200: {10, 10}}
+	pm := NewProcessMonitor(nil)
+	pm.ioCounters = func(pid int) (int64, int64, error) {
+		c, ok := counters[pid]
+		if !ok {
+			return 0, 0, errors.New("no such process")
+		}
+		return c[0], c[1], nil
+	}
+
+	t0 := time.Unix(1000, 0)
+	first := []ProcessMetrics{{PID: 100, Timestamp: t0}, {PID: 200, Timestamp: t0}, {PID: 300, Timestamp: t0}}
+	pm.applyIO(first)
+	if first[0].ReadBytes != 1000 || first[0].WriteBytes != 500 || first[0].ReadBytesPerSec != 0 {
+		t.Errorf("first sample = %+v, want counters without a rate", first[0])
+	}
+	if first[2].ReadBytes != 0 {
+		t.Errorf("PID without counters got %+v", first[2])
+	}
+
+	counters[100] = [2]int64{5000, 1500}
+	counters[200] = [2]int64{5, 5} // PID reused: counters restarted
+	second := []ProcessMetrics{{PID: 100, Timestamp: t0.Add(2 * time.Second)}, {PID: 200, Timestamp: t0.Add(2 * time.Second)}}
+	pm.applyIO(second)
+	if second[0].ReadBytesPerSec != 2000 || second[0].WriteBytesPerSec != 500 {
+		t.Errorf("rates = %v/%v, want 2000/500", second[0].ReadBytesPerSec, second[0].WriteBytesPerSec)
+	}
+	if second[1].ReadBytesPerSec != 0 || second[1].WriteBytes != 5 {
+		t.Errorf("reused PID = %+v, want counters with zero rate", second[1])
+	}
+	if _, ok := pm.prevIO[300]; ok {
+		t.Error("state kept for a PID that was not collected")
+	}
+}
+
+func TestCollect_IOCounters(t *testing.T) {
+	installFakeCommand(t, "ps", `printf '  100  5.0  0.3  2048    9\n'`)
+	installFakeCommand(t, "lsof", `exit 0`)
+	pm := NewProcessMonitor([]int{100})
+	pm.goos = "linux"
+	pm.ioCounters = func(int) (int64, int64, error) { return 4096, 128, nil }
+
+	metrics, err := pm.Collect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 1 || metrics[0].ReadBytes != 4096 || metrics[0].WriteBytes != 128 {
+		t.Errorf("metrics = %+v", metrics)
+	}
+}
+
+func TestProcessMonitor_IOFromProcRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "100"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	io := "rchar: 4096\nwchar: 128\nsyscr: 7\nread_bytes: 0\n"
+	if err := os.WriteFile(filepath.Join(root, "100", "io"), []byte(io), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pm := NewProcessMonitor(nil)
+	pm.procRoot = root
+
+	metrics := []ProcessMetrics{{PID: 100, Timestamp: time.Now()}, {PID: 200, Timestamp: time.Now()}}
+	pm.applyIO(metrics)
+	if metrics[0].ReadBytes != 4096 || metrics[0].WriteBytes != 128 {
+		t.Errorf("metrics[0] = %+v, want counters from the proc root", metrics[0])
+	}
+	if metrics[1].ReadBytes != 0 || metrics[1].WriteBytes != 0 {
+		t.Errorf("PID missing from the proc root got %+v", metrics[1])
+	}
+}
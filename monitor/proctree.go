@@ -0,0 +1,356 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+const processErrTree = "ps_tree"
+
+// forkRateWindow is the trailing window Instance.ForkRate is measured over.
+const forkRateWindow = time.Minute
+
+// DefaultBuildTools are commands whose descendants are not counted towards
+// an agent's fork rate, since compilers and test runners legitimately spawn
+// many short-lived processes.
+var DefaultBuildTools = []string{
+	"make", "gmake", "ninja", "cmake", "bazel", "bazelisk", "buck2",
+	"cargo", "rustc", "go", "gcc", "g++", "cc", "clang", "clang++", "ld",
+	"mvn", "gradle", "gradlew", "npm", "pnpm", "yarn", "npx", "bun",
+	"tsc", "webpack", "vite", "jest", "vitest", "pytest", "tox",
+	"xcodebuild", "swift", "dotnet", "msbuild",
+}
+
+// ProcessNode is one row of the system process table.
+type ProcessNode struct {
+	PID     int
+	PPID    int
+	PGID    int
+	TTY     string
+	Elapsed time.Duration
+	Command string
+}
+
+// hasTTY reports whether the process has a controlling terminal.
+func (n ProcessNode) hasTTY() bool {
+	return n.TTY != "" && n.TTY != "?" && n.TTY != "??" && n.TTY != "-"
+}
+
+// ListProcessTree returns every process with its parent, process group,
+// terminal and age.
+func ListProcessTree() ([]ProcessNode, error) {
+	cmd := exec.Command("ps", "-A", "-o", "pid=,ppid=,pgid=,tty=,etime=,args=")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	nodes, parseErr := parseProcessTree(stdout)
+	if parseErr != nil {
+		_, _ = io.Copy(io.Discard, stdout)
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+	return nodes, parseErr
+}
+
+func parseProcessTree(r io.Reader) ([]ProcessNode, error) {
+	var nodes []ProcessNode
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		pgid, err3 := strconv.Atoi(fields[2])
+		elapsed, err4 := parseETime(fields[4])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+		nodes = append(nodes, ProcessNode{
+			PID:     pid,
+			PPID:    ppid,
+			PGID:    pgid,
+			TTY:     fields[3],
+			Elapsed: elapsed,
+			Command: strings.Join(fields[5:], " "),
+		})
+	}
+	return nodes, sc.Err()
+}
+
+// parseETime parses the ps etime format, [[dd-]hh:]mm:ss.
+func parseETime(s string) (time.Duration, error) {
+	var days int
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		d, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("bad etime %q", s)
+		}
+		days = d
+		s = s[i+1:]
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("bad etime %q", s)
+	}
+	var secs int
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("bad etime %q", s)
+		}
+		secs = secs*60 + n
+	}
+	return time.Duration(days)*24*time.Hour + time.Duration(secs)*time.Second, nil
+}
+
+// ProcessTreeMonitor tracks the descendants of agent processes and notices
+// children that detach from them. A child is detached when it has moved to a
+// new process group without a terminal (setsid, daemonizing servers) or when
+// it was seen under the agent before and is now running outside its tree
+// because its parent exited (nohup ... &, disown).
+//
+// It also measures Instance.ForkRate, the number of new descendants seen in
+// the last minute. Processes started and reaped between two collections are
+// invisible to it, so the rate is a lower bound. Descendants of build tools
+// (see SetBuildTools) are not counted.
+type ProcessTreeMonitor struct {
+	mu         sync.Mutex
+	listProcs  func() ([]ProcessNode, error)
+	now        func() time.Time
+	known      map[int]map[int]string // agent PID -> descendant PID -> command
+	forks      map[int][]time.Time    // agent PID -> sightings of new descendants
+	buildTools map[string]bool
+	errorStats map[string]MonitorErrorStats
+}
+
+func (tm *ProcessTreeMonitor) ensureInit() {
+	if tm.listProcs == nil {
+		tm.listProcs = ListProcessTree
+	}
+	if tm.now == nil {
+		tm.now = time.Now
+	}
+	if tm.known == nil {
+		tm.known = make(map[int]map[int]string)
+	}
+	if tm.forks == nil {
+		tm.forks = make(map[int][]time.Time)
+	}
+	if tm.buildTools == nil {
+		tm.buildTools = toolSet(DefaultBuildTools)
+	}
+	if tm.errorStats == nil {
+		tm.errorStats = make(map[string]MonitorErrorStats)
+	}
+}
+
+// NewProcessTreeMonitor creates a process tree monitor.
+func NewProcessTreeMonitor() *ProcessTreeMonitor {
+	tm := &ProcessTreeMonitor{}
+	tm.ensureInit()
+	return tm
+}
+
+// SetBuildTools replaces the commands, matched by executable base name,
+// whose descendants do not count towards the fork rate.
+func (tm *ProcessTreeMonitor) SetBuildTools(names []string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.buildTools = toolSet(names)
+}
+
+func toolSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[strings.ToLower(n)] = true
+	}
+	return set
+}
+
+// GetErrorStats returns a snapshot of operational errors per source.
+func (tm *ProcessTreeMonitor) GetErrorStats() map[string]MonitorErrorStats {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.ensureInit()
+
+	stats := make(map[string]MonitorErrorStats, len(tm.errorStats))
+	for k, v := range tm.errorStats {
+		stats[k] = v
+	}
+	return stats
+}
+
+func (tm *ProcessTreeMonitor) recordError(source string, err error) {
+	if err == nil {
+		return
+	}
+	tm.ensureInit()
+
+	stat := tm.errorStats[source]
+	stat.Count++
+	stat.LastError = err.Error()
+	stat.LastAt = time.Now()
+	tm.errorStats[source] = stat
+}
+
+// Collect fills a.Children with the agent's descendants, including detached
+// ones that are still alive, and a.ForkRate.
+func (tm *ProcessTreeMonitor) Collect(a *agent.Instance) {
+	tm.CollectAll([]*agent.Instance{a})
+}
+
+// CollectAll is like Collect for several agents, listing processes once.
+func (tm *ProcessTreeMonitor) CollectAll(agents []*agent.Instance) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.ensureInit()
+
+	nodes, err := tm.listProcs()
+	if err != nil {
+		tm.recordError(processErrTree, err)
+		return
+	}
+	byPID := make(map[int]ProcessNode, len(nodes))
+	children := make(map[int][]int)
+	for _, n := range nodes {
+		byPID[n.PID] = n
+		children[n.PPID] = append(children[n.PPID], n.PID)
+	}
+
+	now := tm.now()
+	live := make(map[int]bool, len(agents))
+	for _, a := range agents {
+		if a.PID <= 0 {
+			continue
+		}
+		live[a.PID] = true
+		_, seenBefore := tm.known[a.PID]
+		var spawned int
+		a.Children, spawned = tm.children(a.PID, byPID, children)
+		a.ForkRate = tm.forkRate(a.PID, spawned, seenBefore, now)
+	}
+	for pid := range tm.known {
+		if !live[pid] {
+			if _, ok := byPID[pid]; !ok {
+				delete(tm.known, pid)
+				delete(tm.forks, pid)
+			}
+		}
+	}
+}
+
+// forkRate records spawned new descendants at now and returns how many were
+// seen within forkRateWindow. The first collection for an agent only sets
+// the baseline.
+func (tm *ProcessTreeMonitor) forkRate(root, spawned int, seenBefore bool, now time.Time) float64 {
+	times := tm.forks[root]
+	cutoff := now.Add(-forkRateWindow)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+	if seenBefore {
+		for j := 0; j < spawned; j++ {
+			times = append(times, now)
+		}
+	}
+	tm.forks[root] = times
+	return float64(len(times))
+}
+
+// children walks the tree under root. It also returns how many descendants
+// were not seen before, leaving out those started under a build tool.
+func (tm *ProcessTreeMonitor) children(root int, byPID map[int]ProcessNode, children map[int][]int) ([]agent.ChildProcess, int) {
+	rootNode := byPID[root]
+	known := tm.known[root]
+	if known == nil {
+		known = make(map[int]string)
+		tm.known[root] = known
+	}
+
+	type item struct {
+		pid     int
+		inBuild bool
+	}
+	var out []agent.ChildProcess
+	var spawned int
+	inTree := make(map[int]bool)
+	var queue []item
+	for _, pid := range children[root] {
+		queue = append(queue, item{pid: pid})
+	}
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		if inTree[it.pid] {
+			continue
+		}
+		inTree[it.pid] = true
+		n := byPID[it.pid]
+		detached := n.PGID != rootNode.PGID && !n.hasTTY() && rootNode.hasTTY()
+		out = append(out, toChildProcess(n, detached))
+		if cmd, ok := known[it.pid]; (!ok || cmd != n.Command) && !it.inBuild {
+			spawned++
+		}
+		known[it.pid] = n.Command
+		inBuild := it.inBuild || tm.buildTools[strings.ToLower(commandBase(n.Command))]
+		for _, pid := range children[it.pid] {
+			queue = append(queue, item{pid: pid, inBuild: inBuild})
+		}
+	}
+
+	// Descendants seen earlier that now live outside the tree were orphaned
+	// and reparented, so they outlived the command that started them. A
+	// changed command line means the PID was reused.
+	for pid, command := range known {
+		if inTree[pid] {
+			continue
+		}
+		n, ok := byPID[pid]
+		if !ok || n.Command != command {
+			delete(known, pid)
+			continue
+		}
+		out = append(out, toChildProcess(n, true))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PID < out[j].PID })
+	return out, spawned
+}
+
+// commandBase returns the executable base name of a command line.
+func commandBase(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return ""
+	}
+	return filepath.Base(fields[0])
+}
+
+func toChildProcess(n ProcessNode, detached bool) agent.ChildProcess {
+	return agent.ChildProcess{
+		PID:      n.PID,
+		PPID:     n.PPID,
+		Command:  n.Command,
+		Elapsed:  n.Elapsed,
+		Detached: detached,
+	}
+}
@@ -0,0 +1,210 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+func TestParseETime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"00:05", 5 * time.Second},
+		{"12:34", 12*time.Minute + 34*time.Second},
+		{"01:00:00", time.Hour},
+		{"2-03:04:05", 51*time.Hour + 4*time.Minute + 5*time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseETime(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseETime(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"", "5", "a:b", "x-01:02"} {
+		if _, err := parseETime(bad); err == nil {
+			t.Errorf("parseETime(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestParseProcessTree(t *testing.T) {
+	out := `    1     0     1 ?        10-00:00:00 /sbin/init
+  100     1   100 pts/0       01:00:00 claude --resume
+  200   100   100 pts/0          00:03 /bin/bash -c npm run dev
+garbage line
+`
+	nodes, err := parseProcessTree(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 3 {
+		t.Fatalf("got %d nodes, want 3", len(nodes))
+	}
+	n := nodes[2]
+	if n.PID != 200 || n.PPID != 100 || n.PGID != 100 || n.TTY != "pts/0" ||
+		n.Elapsed != 3*time.Second || n.Command != "/bin/bash -c npm run dev" {
+		t.Errorf("node = %+v", n)
+	}
+	if nodes[0].hasTTY() || !nodes[1].hasTTY() {
+		t.Error("hasTTY mismatch")
+	}
+}
+
+func TestListProcessTree_IncludesSelf(t *testing.T) {
+	nodes, err := ListProcessTree()
+	if err != nil {
+		t.Skipf("ps unavailable: %v", err)
+	}
+	for _, n := range nodes {
+		if n.PID == os.Getpid() {
+			if n.PPID != os.Getppid() {
+				t.Errorf("PPID = %d, want %d", n.PPID, os.Getppid())
+			}
+			return
+		}
+	}
+	t.Error("current process not listed")
+}
+
+type fakeProcTable struct {
+	nodes []ProcessNode
+	err   error
+}
+
+func (f *fakeProcTable) list() ([]ProcessNode, error) { return f.nodes, f.err }
+
+func TestProcessTreeMonitor_Descendants(t *testing.T) {
+	table := &fakeProcTable{nodes: []ProcessNode{
+		{PID: 100, PPID: 1, PGID: 100, TTY: "pts/0", Command: "claude"},
+		{PID: 200, PPID: 100, PGID: 100, TTY: "pts/0", Command: "bash -c make"},
+		{PID: 201, PPID: 200, PGID: 100, TTY: "pts/0", Command: "make"},
+		{PID: 300, PPID: 100, PGID: 300, TTY: "?", Elapsed: 10 * time.Minute, Command: "setsid python -m http.server 4444"},
+		{PID: 400, PPID: 1, PGID: 400, TTY: "?", Command: "unrelated"},
+	}}
+	tm := &ProcessTreeMonitor{listProcs: table.list}
+	a := &agent.Instance{PID: 100}
+	tm.Collect(a)
+
+	if len(a.Children) != 3 {
+		t.Fatalf("got %d children, want 3: %+v", len(a.Children), a.Children)
+	}
+	for _, c := range a.Children {
+		if want := c.PID == 300; c.Detached != want {
+			t.Errorf("child %d Detached = %v, want %v", c.PID, c.Detached, want)
+		}
+	}
+}
+
+func TestProcessTreeMonitor_Reparented(t *testing.T) {
+	table := &fakeProcTable{nodes: []ProcessNode{
+		{PID: 100, PPID: 1, PGID: 100, TTY: "pts/0", Command: "claude"},
+		{PID: 200, PPID: 100, PGID: 100, TTY: "pts/0", Command: "bash -c nohup ./server &"},
+		{PID: 201, PPID: 200, PGID: 100, TTY: "pts/0", Command: "./server"},
+	}}
+	tm := &ProcessTreeMonitor{listProcs: table.list}
+	a := &agent.Instance{PID: 100}
+	tm.Collect(a)
+	for _, c := range a.Children {
+		if c.Detached {
+			t.Fatalf("child %d detached while still in the tree", c.PID)
+		}
+	}
+
+	// The shell exits and the server is reparented to init.
+	table.nodes = []ProcessNode{
+		{PID: 100, PPID: 1, PGID: 100, TTY: "pts/0", Command: "claude"},
+		{PID: 201, PPID: 1, PGID: 100, TTY: "pts/0", Elapsed: 5 * time.Minute, Command: "./server"},
+	}
+	tm.Collect(a)
+	if len(a.Children) != 1 || a.Children[0].PID != 201 || !a.Children[0].Detached {
+		t.Fatalf("children = %+v, want detached pid 201", a.Children)
+	}
+
+	// A reused PID running something else is not attributed to the agent.
+	table.nodes[1].Command = "sshd"
+	tm.Collect(a)
+	if len(a.Children) != 0 {
+		t.Errorf("children = %+v, want none after PID reuse", a.Children)
+	}
+}
+
+func TestProcessTreeMonitor_ListError(t *testing.T) {
+	tm := &ProcessTreeMonitor{listProcs: (&fakeProcTable{err: errors.New("boom")}).list}
+	tm.Collect(&agent.Instance{PID: 1})
+	if tm.GetErrorStats()[processErrTree].Count != 1 {
+		t.Error("expected ps_tree error to be recorded")
+	}
+}
+
+func TestProcessTreeMonitor_ForkRate(t *testing.T) {
+	base := []ProcessNode{
+		{PID: 100, PPID: 1, PGID: 100, TTY: "pts/0", Command: "claude"},
+		{PID: 200, PPID: 100, PGID: 100, TTY: "pts/0", Command: "bash"},
+	}
+	table := &fakeProcTable{nodes: base}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tm := &ProcessTreeMonitor{listProcs: table.list, now: func() time.Time { return now }}
+	a := &agent.Instance{PID: 100}
+
+	tm.Collect(a)
+	if a.ForkRate != 0 {
+		t.Fatalf("first collect ForkRate = %v, want 0 (baseline)", a.ForkRate)
+	}
+
+	// A burst of short-lived shells, plus a build whose workers are ignored.
+	table.nodes = append([]ProcessNode{}, base...)
+	for pid := 300; pid < 305; pid++ {
+		table.nodes = append(table.nodes, ProcessNode{PID: pid, PPID: 200, PGID: 100, TTY: "pts/0", Command: "sh -c curl"})
+	}
+	table.nodes = append(table.nodes, ProcessNode{PID: 400, PPID: 200, PGID: 100, TTY: "pts/0", Command: "/usr/bin/make -j8"})
+	for pid := 401; pid < 409; pid++ {
+		table.nodes = append(table.nodes, ProcessNode{PID: pid, PPID: 400, PGID: 100, TTY: "pts/0", Command: "cc -c x.c"})
+	}
+	now = now.Add(10 * time.Second)
+	tm.Collect(a)
+	if a.ForkRate != 6 {
+		t.Fatalf("ForkRate = %v, want 6 (5 shells + make)", a.ForkRate)
+	}
+
+	// Already-seen processes do not count again.
+	now = now.Add(10 * time.Second)
+	tm.Collect(a)
+	if a.ForkRate != 6 {
+		t.Fatalf("ForkRate = %v, want 6 within the window", a.ForkRate)
+	}
+
+	// Once the window passes, the burst ages out.
+	now = now.Add(time.Minute)
+	tm.Collect(a)
+	if a.ForkRate != 0 {
+		t.Errorf("ForkRate = %v, want 0 after the window", a.ForkRate)
+	}
+}
+
+func TestProcessTreeMonitor_SetBuildTools(t *testing.T) {
+	table := &fakeProcTable{nodes: []ProcessNode{
+		{PID: 100, PPID: 1, PGID: 100, TTY: "pts/0", Command: "claude"},
+	}}
+	tm := &ProcessTreeMonitor{listProcs: table.list}
+	tm.SetBuildTools([]string{"bazel"})
+	a := &agent.Instance{PID: 100}
+	tm.Collect(a)
+
+	table.nodes = append(table.nodes,
+		ProcessNode{PID: 200, PPID: 100, PGID: 100, TTY: "pts/0", Command: "bazel build //..."},
+		ProcessNode{PID: 201, PPID: 200, PGID: 100, TTY: "pts/0", Command: "javac"},
+		ProcessNode{PID: 300, PPID: 100, PGID: 100, TTY: "pts/0", Command: "make"},
+		ProcessNode{PID: 301, PPID: 300, PGID: 100, TTY: "pts/0", Command: "cc"},
+	)
+	tm.Collect(a)
+	// make is no longer a build tool, so its child counts.
+	if a.ForkRate != 3 {
+		t.Errorf("ForkRate = %v, want 3", a.ForkRate)
+	}
+}
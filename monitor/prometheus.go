@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// promMetric describes one per-agent metric in the Prometheus text format.
+type promMetric struct {
+	name  string
+	kind  string // "gauge" or "counter"
+	help  string
+	value func(a *agent.Instance) float64
+}
+
+var promMetrics = []promMetric{
+	{"agent_cpu_percent", "gauge", "CPU usage of the agent process in percent.",
+		func(a *agent.Instance) float64 { return a.CPU }},
+	{"agent_memory_mb", "gauge", "Resident memory of the agent process in MB.",
+		func(a *agent.Instance) float64 { return a.Memory }},
+	{"agent_tokens_total", "counter", "Tokens used by the agent this session.",
+		func(a *agent.Instance) float64 { return float64(a.Tokens.TotalTokens) }},
+	{"agent_est_cost_usd", "gauge", "Estimated cost of the agent's session in USD.",
+		func(a *agent.Instance) float64 { return a.Tokens.EstCost }},
+}
+
+// PrometheusExporter serves the latest agent metrics in the Prometheus text
+// exposition format. Feed it with Update after each collection cycle and
+// mount it as an http.Handler, e.g. at /metrics. Every series carries
+// agent_id, agent_name and pid labels.
+type PrometheusExporter struct {
+	mu     sync.Mutex
+	agents []agent.Instance
+}
+
+// NewPrometheusExporter creates an exporter with no agents.
+func NewPrometheusExporter() *PrometheusExporter {
+	return &PrometheusExporter{}
+}
+
+// Update replaces the agents reported by the exporter.
+func (pe *PrometheusExporter) Update(agents []agent.Instance) {
+	sorted := make([]agent.Instance, len(agents))
+	copy(sorted, agents)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Info.ID != sorted[j].Info.ID {
+			return sorted[i].Info.ID < sorted[j].Info.ID
+		}
+		return sorted[i].PID < sorted[j].PID
+	})
+
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	pe.agents = sorted
+}
+
+// WriteMetrics writes the current metrics to w in the text format, ordered
+// by metric and then by agent ID and PID.
+func (pe *PrometheusExporter) WriteMetrics(w io.Writer) error {
+	pe.mu.Lock()
+	agents := pe.agents
+	pe.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range promMetrics {
+		bw.WriteString("# HELP " + m.name + " " + m.help + "\n")
+		bw.WriteString("# TYPE " + m.name + " " + m.kind + "\n")
+		for i := range agents {
+			a := &agents[i]
+			bw.WriteString(m.name)
+			bw.WriteString(`{agent_id="` + promEscape(a.Info.ID) +
+				`",agent_name="` + promEscape(a.Info.Name) +
+				`",pid="` + strconv.Itoa(a.PID) + `"} `)
+			bw.WriteString(strconv.FormatFloat(m.value(a), 'g', -1, 64))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP implements http.Handler.
+func (pe *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = pe.WriteMetrics(w)
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promEscape escapes a label value for the text format.
+func promEscape(s string) string {
+	return promEscaper.Replace(s)
+}
@@ -0,0 +1,69 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+func TestPrometheusExporter_WriteMetrics(t *testing.T) {
+	pe := NewPrometheusExporter()
+	pe.Update([]agent.Instance{
+		{
+			Info: agent.Info{ID: "cursor", Name: `Cursor "beta"`}, PID: 200, CPU: 3, Memory: 512,
+		},
+		{
+			Info: agent.Info{ID: "claude-code", Name: "Claude Code"}, PID: 100, CPU: 12.5, Memory: 256.25,
+			Tokens: agent.TokenMetrics{TotalTokens: 15000, EstCost: 0.42},
+		},
+	})
+
+	var sb strings.Builder
+	if err := pe.WriteMetrics(&sb); err != nil {
+		t.Fatalf("WriteMetrics error: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		"# TYPE agent_cpu_percent gauge\n",
+		`agent_cpu_percent{agent_id="claude-code",agent_name="Claude Code",pid="100"} 12.5` + "\n",
+		`agent_memory_mb{agent_id="claude-code",agent_name="Claude Code",pid="100"} 256.25` + "\n",
+		"# TYPE agent_tokens_total counter\n",
+		`agent_tokens_total{agent_id="claude-code",agent_name="Claude Code",pid="100"} 15000` + "\n",
+		`agent_est_cost_usd{agent_id="claude-code",agent_name="Claude Code",pid="100"} 0.42` + "\n",
+		`agent_cpu_percent{agent_id="cursor",agent_name="Cursor \"beta\"",pid="200"} 3` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, `agent_id="claude-code"`) > strings.Index(out, `agent_id="cursor"`) {
+		t.Errorf("agents not sorted by ID:\n%s", out)
+	}
+}
+
+func TestPrometheusExporter_ServeHTTP(t *testing.T) {
+	pe := NewPrometheusExporter()
+	pe.Update([]agent.Instance{{Info: agent.Info{ID: "aider", Name: "Aider"}, PID: 7, CPU: 1}})
+
+	rec := httptest.NewRecorder()
+	pe.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET status = %d, want 200", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), `agent_cpu_percent{agent_id="aider",agent_name="Aider",pid="7"} 1`) {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	pe.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
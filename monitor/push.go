@@ -0,0 +1,317 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+const pushErrPost = "post"
+
+// maxPushBody caps the size of a snapshot accepted by CollectorServer.
+const maxPushBody = 8 << 20
+
+// PushPayload is the body PushExporter sends and CollectorServer accepts.
+type PushPayload struct {
+	MachineID string         `json:"machine_id"`
+	User      string         `json:"user,omitempty"`
+	SentAt    time.Time      `json:"sent_at"`
+	Snapshot  agent.Snapshot `json:"snapshot"`
+}
+
+// PushExporter POSTs snapshots to a team collector.
+type PushExporter struct {
+	mu         sync.Mutex
+	cfg        config.PushConfig
+	client     *http.Client
+	errorStats map[string]MonitorErrorStats
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+	started    bool
+	wg         sync.WaitGroup
+}
+
+func (pe *PushExporter) ensureInit() {
+	if pe.errorStats == nil {
+		pe.errorStats = make(map[string]MonitorErrorStats)
+	}
+	if pe.stopCh == nil {
+		pe.stopCh = make(chan struct{})
+	}
+	if pe.client == nil {
+		pe.client = &http.Client{Timeout: 10 * time.Second}
+	}
+}
+
+// NewPushExporter creates an exporter for cfg, filling in MachineID from the
+// hostname and User from $USER when they are empty.
+func NewPushExporter(cfg config.PushConfig) *PushExporter {
+	if cfg.MachineID == "" {
+		cfg.MachineID, _ = os.Hostname()
+	}
+	if cfg.User == "" {
+		cfg.User = os.Getenv("USER")
+	}
+	pe := &PushExporter{cfg: cfg}
+	pe.ensureInit()
+	return pe
+}
+
+// GetErrorStats returns a snapshot of operational errors per source.
+func (pe *PushExporter) GetErrorStats() map[string]MonitorErrorStats {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	pe.ensureInit()
+
+	stats := make(map[string]MonitorErrorStats, len(pe.errorStats))
+	for k, v := range pe.errorStats {
+		stats[k] = v
+	}
+	return stats
+}
+
+func (pe *PushExporter) recordError(source string, err error) {
+	if err == nil {
+		return
+	}
+	pe.ensureInit()
+
+	stat := pe.errorStats[source]
+	stat.Count++
+	stat.LastError = err.Error()
+	stat.LastAt = time.Now()
+	pe.errorStats[source] = stat
+}
+
+// Push sends one snapshot to the collector.
+func (pe *PushExporter) Push(ctx context.Context, snap agent.Snapshot) error {
+	pe.mu.Lock()
+	pe.ensureInit()
+	cfg, client := pe.cfg, pe.client
+	pe.mu.Unlock()
+
+	err := pushSnapshot(ctx, client, cfg, snap)
+	if err != nil {
+		pe.mu.Lock()
+		pe.recordError(pushErrPost, err)
+		pe.mu.Unlock()
+	}
+	return err
+}
+
+func pushSnapshot(ctx context.Context, client *http.Client, cfg config.PushConfig, snap agent.Snapshot) error {
+	if cfg.URL == "" {
+		return fmt.Errorf("push: no collector URL configured")
+	}
+	body, err := json.Marshal(PushPayload{
+		MachineID: cfg.MachineID,
+		User:      cfg.User,
+		SentAt:    time.Now(),
+		Snapshot:  snap,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("push: collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Start pushes source() every cfg.Interval (30s if unset) until Stop. Push
+// errors are recorded in GetErrorStats. Only the first call has an effect.
+func (pe *PushExporter) Start(source func() agent.Snapshot) {
+	pe.mu.Lock()
+	pe.ensureInit()
+	if pe.started {
+		pe.mu.Unlock()
+		return
+	}
+	pe.started = true
+	interval := pe.cfg.Interval.Duration()
+	pe.mu.Unlock()
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pe.wg.Add(2)
+	go func() {
+		defer pe.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pe.stopCh:
+				return
+			case <-ticker.C:
+				_ = pe.Push(ctx, source())
+			}
+		}
+	}()
+	go func() {
+		defer pe.wg.Done()
+		<-pe.stopCh
+		cancel()
+	}()
+}
+
+// Stop ends the push loop, aborting an in-flight request, and waits for it.
+func (pe *PushExporter) Stop() {
+	pe.mu.Lock()
+	pe.ensureInit()
+	pe.mu.Unlock()
+	pe.stopOnce.Do(func() { close(pe.stopCh) })
+	pe.wg.Wait()
+}
+
+// MachineSnapshot is the latest snapshot received from one machine.
+type MachineSnapshot struct {
+	MachineID  string         `json:"machine_id"`
+	User       string         `json:"user,omitempty"`
+	ReceivedAt time.Time      `json:"received_at"`
+	Snapshot   agent.Snapshot `json:"snapshot"`
+}
+
+// FleetView aggregates the latest snapshot of every machine.
+type FleetView struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Machines    []MachineSnapshot `json:"machines"`
+	TotalAgents int               `json:"total_agents"`
+	TotalTokens int64             `json:"total_tokens"`
+	TotalCost   float64           `json:"total_cost"`
+	CostToday   float64           `json:"cost_today"`
+	Alerts      int               `json:"alerts"`
+	AgentsByID  map[string]int    `json:"agents_by_id"`
+}
+
+// CollectorServer is an http.Handler that receives PushExporter payloads.
+// POST stores the latest snapshot per machine; GET returns the FleetView.
+// When a token is configured, requests must carry it as a bearer token.
+type CollectorServer struct {
+	mu       sync.Mutex
+	token    string
+	machines map[string]MachineSnapshot
+	now      func() time.Time
+}
+
+// NewCollectorServer creates a collector requiring token ("" disables auth).
+func NewCollectorServer(token string) *CollectorServer {
+	return &CollectorServer{
+		token:    token,
+		machines: make(map[string]MachineSnapshot),
+		now:      time.Now,
+	}
+}
+
+func (cs *CollectorServer) authorized(r *http.Request) bool {
+	if cs.token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(cs.token)) == 1
+}
+
+// ServeHTTP implements http.Handler.
+func (cs *CollectorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var p PushPayload
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxPushBody)).Decode(&p); err != nil {
+			http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if p.MachineID == "" {
+			http.Error(w, "missing machine_id", http.StatusBadRequest)
+			return
+		}
+		cs.mu.Lock()
+		cs.machines[p.MachineID] = MachineSnapshot{
+			MachineID:  p.MachineID,
+			User:       p.User,
+			ReceivedAt: cs.now(),
+			Snapshot:   p.Snapshot,
+		}
+		cs.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(cs.Fleet())
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Fleet aggregates the latest snapshot from every machine, sorted by
+// machine ID.
+func (cs *CollectorServer) Fleet() FleetView {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	view := FleetView{
+		GeneratedAt: cs.now(),
+		Machines:    make([]MachineSnapshot, 0, len(cs.machines)),
+		AgentsByID:  make(map[string]int),
+	}
+	for _, m := range cs.machines {
+		view.Machines = append(view.Machines, m)
+		view.Alerts += len(m.Snapshot.Alerts)
+		for _, a := range m.Snapshot.Agents {
+			view.TotalAgents++
+			view.TotalTokens += a.Tokens.TotalTokens
+			view.TotalCost += a.Tokens.EstCost
+			view.CostToday += a.Tokens.CostToday
+			view.AgentsByID[a.Info.ID]++
+		}
+	}
+	sort.Slice(view.Machines, func(i, j int) bool {
+		return view.Machines[i].MachineID < view.Machines[j].MachineID
+	})
+	return view
+}
+
+// Forget drops machines that have not pushed since before cutoff and
+// returns how many were removed.
+func (cs *CollectorServer) Forget(cutoff time.Time) int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	n := 0
+	for id, m := range cs.machines {
+		if m.ReceivedAt.Before(cutoff) {
+			delete(cs.machines, id)
+			n++
+		}
+	}
+	return n
+}
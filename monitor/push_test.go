@@ -0,0 +1,158 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+func fleetSnapshot(ids ...string) agent.Snapshot {
+	snap := agent.Snapshot{Timestamp: time.Now()}
+	for _, id := range ids {
+		snap.Agents = append(snap.Agents, agent.Instance{
+			Info:   agent.Info{ID: id},
+			Tokens: agent.TokenMetrics{TotalTokens: 1000, EstCost: 0.5, CostToday: 0.25},
+		})
+	}
+	return snap
+}
+
+func TestPushExporter_CollectorAggregates(t *testing.T) {
+	cs := NewCollectorServer("s3cret")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	alice := NewPushExporter(config.PushConfig{URL: srv.URL, Token: "s3cret", MachineID: "alice-mbp", User: "alice"})
+	bob := NewPushExporter(config.PushConfig{URL: srv.URL, Token: "s3cret", MachineID: "bob-linux", User: "bob"})
+	ctx := context.Background()
+
+	if err := alice.Push(ctx, fleetSnapshot("claude-code", "cursor")); err != nil {
+		t.Fatalf("alice push: %v", err)
+	}
+	if err := bob.Push(ctx, fleetSnapshot("claude-code")); err != nil {
+		t.Fatalf("bob push: %v", err)
+	}
+	// A newer snapshot replaces the machine's previous one.
+	if err := bob.Push(ctx, fleetSnapshot("claude-code", "aider")); err != nil {
+		t.Fatalf("bob push: %v", err)
+	}
+
+	view := cs.Fleet()
+	if len(view.Machines) != 2 || view.Machines[0].MachineID != "alice-mbp" || view.Machines[1].User != "bob" {
+		t.Fatalf("machines = %+v", view.Machines)
+	}
+	if view.TotalAgents != 4 || view.TotalTokens != 4000 || view.TotalCost != 2 || view.CostToday != 1 {
+		t.Errorf("totals = agents %d tokens %d cost %v today %v", view.TotalAgents, view.TotalTokens, view.TotalCost, view.CostToday)
+	}
+	if view.AgentsByID["claude-code"] != 2 || view.AgentsByID["aider"] != 1 {
+		t.Errorf("AgentsByID = %v", view.AgentsByID)
+	}
+
+	// GET serves the same view.
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got FleetView
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TotalAgents != 4 || len(got.Machines) != 2 {
+		t.Errorf("GET fleet = %+v", got)
+	}
+}
+
+func TestPushExporter_Unauthorized(t *testing.T) {
+	cs := NewCollectorServer("s3cret")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	pe := NewPushExporter(config.PushConfig{URL: srv.URL, Token: "wrong", MachineID: "m1"})
+	err := pe.Push(context.Background(), fleetSnapshot("claude-code"))
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Push error = %v, want 401", err)
+	}
+	if pe.GetErrorStats()[pushErrPost].Count != 1 {
+		t.Error("push error not recorded")
+	}
+	if len(cs.Fleet().Machines) != 0 {
+		t.Error("unauthorized push was stored")
+	}
+}
+
+func TestCollectorServer_RejectsBadRequests(t *testing.T) {
+	cs := NewCollectorServer("")
+	tests := []struct {
+		method, body string
+		want         int
+	}{
+		{http.MethodPost, "not json", http.StatusBadRequest},
+		{http.MethodPost, `{"snapshot":{}}`, http.StatusBadRequest},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		cs.ServeHTTP(rec, httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("%s %q: status %d, want %d", tt.method, tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestCollectorServer_Forget(t *testing.T) {
+	cs := NewCollectorServer("")
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	for i, id := range []string{"old", "new"} {
+		at := base.Add(time.Duration(i) * time.Hour)
+		cs.now = func() time.Time { return at }
+		body := `{"machine_id":"` + id + `","snapshot":{}}`
+		cs.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	}
+	if n := cs.Forget(base.Add(30 * time.Minute)); n != 1 {
+		t.Errorf("Forget removed %d, want 1", n)
+	}
+	if m := cs.Fleet().Machines; len(m) != 1 || m[0].MachineID != "new" {
+		t.Errorf("machines = %+v", m)
+	}
+}
+
+func TestPushExporter_StartStop(t *testing.T) {
+	pushed := make(chan PushPayload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p PushPayload
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		pushed <- p
+	}))
+	defer srv.Close()
+
+	before := runtime.NumGoroutine()
+	pe := NewPushExporter(config.PushConfig{URL: srv.URL, MachineID: "m1", Interval: config.Duration(10 * time.Millisecond)})
+	pe.Start(func() agent.Snapshot { return fleetSnapshot("claude-code") })
+	pe.Start(func() agent.Snapshot { return agent.Snapshot{} }) // no-op
+
+	select {
+	case p := <-pushed:
+		if p.MachineID != "m1" || len(p.Snapshot.Agents) != 1 {
+			t.Errorf("payload = %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no push within 2s")
+	}
+	pe.Stop()
+	pe.Stop()
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	if n := waitGoroutines(before, 2*time.Second); n > before {
+		t.Errorf("goroutines after Stop = %d, want <= %d", n, before)
+	}
+}
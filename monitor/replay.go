@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// ReplayResult summarizes a replay run.
+type ReplayResult struct {
+	Ticks  int                   `json:"ticks"`
+	Alerts []agent.Alert         `json:"alerts,omitempty"`
+	Events []agent.SecurityEvent `json:"events,omitempty"`
+}
+
+// InstanceFromRecord reconstructs the parts of an agent.Instance captured by
+// a HistoryRecord. Fields that history does not store (terminal commands,
+// file operations, connections, ...) are left empty.
+func InstanceFromRecord(r HistoryRecord) agent.Instance {
+	return agent.Instance{
+		Info:   agent.Info{ID: r.AgentID, Name: r.AgentName},
+		PID:    r.PID,
+		Status: parseStatus(r.Status),
+		CPU:    r.CPU,
+		Memory: r.Memory,
+		Tokens: agent.TokenMetrics{
+			TotalTokens:  r.TotalTokens,
+			InputTokens:  r.InputTokens,
+			OutputTokens: r.OutputTokens,
+			TokensPerSec: r.TokensPerSec,
+			EstCost:      r.EstCost,
+			RequestCount: r.RequestCount,
+			LastModel:    r.Model,
+		},
+		Git:      agent.GitActivity{Branch: r.Branch},
+		LOC:      agent.LOCMetrics{Added: r.LOCAdded, Removed: r.LOCRemoved, Files: r.FilesChanged},
+		Terminal: agent.TerminalActivity{TotalCommands: r.TermCmds},
+	}
+}
+
+func parseStatus(s string) agent.Status {
+	for _, st := range []agent.Status{agent.StatusRunning, agent.StatusIdle, agent.StatusStopped} {
+		if st.String() == s {
+			return st
+		}
+	}
+	return agent.StatusUnknown
+}
+
+// Replay feeds recorded history back through the alert and security rules,
+// which is useful for tuning thresholds against past sessions. Records that
+// share a timestamp (one HistoryStore.Record call) are replayed as a single
+// tick: each agent goes through am.Check and sm.CheckAgent, then the tick
+// goes through am.CheckFleet. Either monitor may be nil.
+//
+// The monitors' clocks follow the recorded timestamps during the replay, so
+// cooldowns and burn rates behave as they would have live. Use dedicated
+// monitors: the result holds everything they contain afterwards.
+func Replay(records []HistoryRecord, am *AlertMonitor, sm *SecurityMonitor) ReplayResult {
+	sorted := make([]HistoryRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+	})
+
+	var snaps []agent.Snapshot
+	for _, r := range sorted {
+		if n := len(snaps); n == 0 || !snaps[n-1].Timestamp.Equal(r.Timestamp) {
+			snaps = append(snaps, agent.Snapshot{Timestamp: r.Timestamp})
+		}
+		last := &snaps[len(snaps)-1]
+		last.Agents = append(last.Agents, InstanceFromRecord(r))
+	}
+	return ReplaySnapshots(snaps, am, sm)
+}
+
+// ReplaySnapshots is like Replay but takes full snapshots, so command,
+// file and network rules in the SecurityMonitor are exercised as well.
+// Snapshots are replayed in the order given.
+func ReplaySnapshots(snaps []agent.Snapshot, am *AlertMonitor, sm *SecurityMonitor) ReplayResult {
+	var at time.Time
+	clock := func() time.Time { return at }
+	if am != nil {
+		defer am.swapClock(am.swapClock(clock))
+	}
+	if sm != nil {
+		defer sm.swapClock(sm.swapClock(clock))
+	}
+
+	var res ReplayResult
+	for _, snap := range snaps {
+		at = snap.Timestamp
+		agents := make([]agent.Instance, len(snap.Agents))
+		copy(agents, snap.Agents)
+		for i := range agents {
+			if am != nil {
+				am.Check(&agents[i])
+			}
+			if sm != nil {
+				sm.CheckAgent(&agents[i])
+			}
+		}
+		if am != nil {
+			am.CheckFleet(agents)
+		}
+		res.Ticks++
+	}
+
+	if am != nil {
+		res.Alerts = am.GetAlerts()
+	}
+	if sm != nil {
+		res.Events = sm.GetEvents()
+	}
+	return res
+}
+
+func (am *AlertMonitor) swapClock(fn func() time.Time) func() time.Time {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	prev := am.now
+	am.now = fn
+	return prev
+}
+
+func (sm *SecurityMonitor) swapClock(fn func() time.Time) func() time.Time {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	prev := sm.now
+	sm.now = fn
+	return prev
+}
@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+func TestInstanceFromRecord(t *testing.T) {
+	r := HistoryRecord{
+		AgentID: "claude-code", AgentName: "Claude Code", PID: 42, Status: "RUNNING",
+		CPU: 12.5, Memory: 300, TotalTokens: 1000, EstCost: 0.5, Model: "claude-sonnet-4",
+		Branch: "main", LOCAdded: 10, LOCRemoved: 2, FilesChanged: 3, TermCmds: 7,
+	}
+	a := InstanceFromRecord(r)
+	if a.Info.ID != "claude-code" || a.PID != 42 || a.Status != agent.StatusRunning {
+		t.Errorf("identity not restored: %+v", a.Info)
+	}
+	if a.Tokens.TotalTokens != 1000 || a.Tokens.EstCost != 0.5 || a.Tokens.LastModel != "claude-sonnet-4" {
+		t.Errorf("tokens not restored: %+v", a.Tokens)
+	}
+	if a.LOC.Added != 10 || a.LOC.Files != 3 || a.Git.Branch != "main" || a.Terminal.TotalCommands != 7 {
+		t.Errorf("activity not restored: loc=%+v git=%q term=%d", a.LOC, a.Git.Branch, a.Terminal.TotalCommands)
+	}
+	if got := InstanceFromRecord(HistoryRecord{Status: "bogus"}).Status; got != agent.StatusUnknown {
+		t.Errorf("unknown status = %v, want StatusUnknown", got)
+	}
+}
+
+func TestReplay_AlertsUseRecordedTime(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	var records []HistoryRecord
+	for i, cpu := range []float64{10, 85, 90, 99} {
+		records = append(records, HistoryRecord{
+			Timestamp: base.Add(time.Duration(i) * 2 * time.Minute),
+			AgentID:   "a1", AgentName: "Agent", CPU: cpu,
+		})
+	}
+
+	am := NewAlertMonitor(DefaultThresholds())
+	res := Replay(records, am, nil)
+
+	if res.Ticks != 4 {
+		t.Errorf("Ticks = %d, want 4", res.Ticks)
+	}
+	// 85 at +2m warns; 90 at +4m and 99 at +6m fall inside the 5 minute
+	// cooldown for the shared "cpu" key.
+	if len(res.Alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1: %+v", len(res.Alerts), res.Alerts)
+	}
+	if want := base.Add(2 * time.Minute); !res.Alerts[0].Timestamp.Equal(want) {
+		t.Errorf("alert timestamp = %v, want recorded %v", res.Alerts[0].Timestamp, want)
+	}
+	if res.Events != nil {
+		t.Error("expected no events without a security monitor")
+	}
+
+	// The live clock is restored afterwards.
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a2"}, CPU: 99})
+	alerts := am.GetAlerts()
+	if time.Since(alerts[len(alerts)-1].Timestamp) > time.Minute {
+		t.Error("clock was not restored after replay")
+	}
+}
+
+func TestReplay_UnsortedRecordsGroupedByTick(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	t1 := t0.Add(10 * time.Minute)
+	records := []HistoryRecord{
+		{Timestamp: t1, AgentID: "a1", CPU: 99},
+		{Timestamp: t0, AgentID: "a1", CPU: 1},
+		{Timestamp: t0, AgentID: "a2", CPU: 1},
+		{Timestamp: t1, AgentID: "a2", CPU: 1},
+	}
+	res := Replay(records, NewAlertMonitor(DefaultThresholds()), nil)
+	if res.Ticks != 2 {
+		t.Errorf("Ticks = %d, want 2", res.Ticks)
+	}
+	if len(res.Alerts) != 1 || !res.Alerts[0].Timestamp.Equal(t1) {
+		t.Errorf("alerts = %+v, want one critical CPU alert at %v", res.Alerts, t1)
+	}
+}
+
+func TestReplaySnapshots_SecurityEvents(t *testing.T) {
+	cfg := config.DefaultConfig().Security
+	sm := NewSecurityMonitor(cfg)
+	at := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	a := agent.Instance{
+		Info: agent.Info{ID: "a1", Name: "Agent"},
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{
+			{Command: "rm -rf /"},
+		}},
+	}
+	snaps := []agent.Snapshot{
+		{Timestamp: at, Agents: []agent.Instance{a}},
+		{Timestamp: at.Add(time.Minute), Agents: []agent.Instance{a}},
+		{Timestamp: at.Add(10 * time.Minute), Agents: []agent.Instance{a}},
+	}
+
+	res := ReplaySnapshots(snaps, nil, sm)
+	if res.Ticks != 3 {
+		t.Errorf("Ticks = %d, want 3", res.Ticks)
+	}
+	var first, again int
+	for _, e := range res.Events {
+		if e.Timestamp.Equal(at) {
+			first++
+		}
+		if e.Timestamp.Equal(at.Add(10 * time.Minute)) {
+			again++
+		}
+		if e.Timestamp.Equal(at.Add(time.Minute)) {
+			t.Errorf("event %q not deduplicated within window", e.Rule)
+		}
+	}
+	if first == 0 || again == 0 {
+		t.Errorf("expected events at first tick and after dedup window, got %+v", res.Events)
+	}
+	if len(snaps[0].Agents[0].SecurityEvents) != 0 {
+		t.Error("replay must not mutate the caller's snapshots")
+	}
+}
@@ -0,0 +1,242 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+// RuleOperator compares a metric value against a rule threshold.
+type RuleOperator string
+
+const (
+	OpGreater      RuleOperator = ">"
+	OpGreaterEqual RuleOperator = ">="
+	OpLess         RuleOperator = "<"
+	OpLessEqual    RuleOperator = "<="
+	OpEqual        RuleOperator = "=="
+	OpNotEqual     RuleOperator = "!="
+)
+
+func (op RuleOperator) compare(v, threshold float64) (bool, bool) {
+	switch op {
+	case OpGreater:
+		return v > threshold, true
+	case OpGreaterEqual:
+		return v >= threshold, true
+	case OpLess:
+		return v < threshold, true
+	case OpLessEqual:
+		return v <= threshold, true
+	case OpEqual:
+		return v == threshold, true
+	case OpNotEqual:
+		return v != threshold, true
+	default:
+		return false, false
+	}
+}
+
+// MetricRule raises an alert when Metric compared to Threshold with Operator
+// holds for at least Duration. Rules with the same Group share a cooldown, so
+// a critical and a warning rule on one metric do not both fire; Group
+// defaults to Name, which defaults to "<metric> <op> <threshold>". Message is
+// the alert text before the formatted value (e.g. "High CPU" gives
+// "High CPU: 91.0%").
+type MetricRule struct {
+	Name      string           `json:"name"`
+	Metric    string           `json:"metric"`
+	Operator  RuleOperator     `json:"operator"`
+	Threshold float64          `json:"threshold"`
+	Level     agent.AlertLevel `json:"level"`
+	Duration  time.Duration    `json:"duration"`
+	Message   string           `json:"message,omitempty"`
+	Group     string           `json:"group,omitempty"`
+}
+
+type ruleMetric struct {
+	value  func(a *agent.Instance) float64
+	format func(v float64) string
+}
+
+func formatInt(v float64) string { return strconv.FormatInt(int64(v), 10) }
+
+var ruleMetrics = map[string]ruleMetric{
+	"cpu":               {func(a *agent.Instance) float64 { return a.CPU }, func(v float64) string { return fmt.Sprintf("%.1f%%", v) }},
+	"memory_mb":         {func(a *agent.Instance) float64 { return a.Memory }, FormatMemory},
+	"open_files":        {func(a *agent.Instance) float64 { return float64(a.OpenFiles) }, formatInt},
+	"connections":       {func(a *agent.Instance) float64 { return float64(len(a.NetConns)) }, formatInt},
+	"fork_rate":         {func(a *agent.Instance) float64 { return a.ForkRate }, func(v float64) string { return fmt.Sprintf("%.0f/min", v) }},
+	"file_ops":          {func(a *agent.Instance) float64 { return float64(len(a.FileOps)) }, formatInt},
+	"tokens_total":      {func(a *agent.Instance) float64 { return float64(a.Tokens.TotalTokens) }, func(v float64) string { return FormatTokenCount(int64(v)) }},
+	"tokens_per_sec":    {func(a *agent.Instance) float64 { return a.Tokens.TokensPerSec }, FormatTokensPerSec},
+	"requests":          {func(a *agent.Instance) float64 { return float64(a.Tokens.RequestCount) }, formatInt},
+	"error_rate":        {func(a *agent.Instance) float64 { return a.Tokens.ErrorRate() }, func(v float64) string { return fmt.Sprintf("%.0f%%", v*100) }},
+	"cost_usd":          {func(a *agent.Instance) float64 { return a.Tokens.EstCost }, FormatCost},
+	"cost_today_usd":    {func(a *agent.Instance) float64 { return a.Tokens.CostToday }, FormatCost},
+	"uncommitted":       {func(a *agent.Instance) float64 { return float64(a.Git.Uncommitted) }, formatInt},
+	"session_commits":   {func(a *agent.Instance) float64 { return float64(a.Git.SessionCommits) }, formatInt},
+	"loc_added":         {func(a *agent.Instance) float64 { return float64(a.LOC.Added) }, formatInt},
+	"loc_removed":       {func(a *agent.Instance) float64 { return float64(a.LOC.Removed) }, formatInt},
+	"terminal_commands": {func(a *agent.Instance) float64 { return float64(a.Terminal.TotalCommands) }, formatInt},
+	"security_events":   {func(a *agent.Instance) float64 { return float64(len(a.SecurityEvents)) }, formatInt},
+}
+
+// RuleMetrics returns the metric names a MetricRule can reference.
+func RuleMetrics() []string {
+	names := make([]string, 0, len(ruleMetrics))
+	for name := range ruleMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultRules expresses the CPU, memory, token, cost, fork rate and
+// tokens/sec thresholds as rules.
+// NewAlertMonitor installs these ahead of any rule added with AddMetricRule.
+func DefaultRules(th AlertThresholds) []MetricRule {
+	ladder := func(group, metric, label string, critical, warning float64) []MetricRule {
+		return []MetricRule{
+			{Name: group + "_critical", Group: group, Metric: metric, Operator: OpGreaterEqual,
+				Threshold: critical, Level: agent.AlertCritical, Message: "Critical " + label},
+			{Name: group + "_warning", Group: group, Metric: metric, Operator: OpGreaterEqual,
+				Threshold: warning, Level: agent.AlertWarning, Message: "High " + label},
+		}
+	}
+	var rules []MetricRule
+	rules = append(rules, ladder("cpu", "cpu", "CPU", th.CPUCritical, th.CPUWarning)...)
+	rules = append(rules, ladder("mem", "memory_mb", "memory", th.MemoryCritical, th.MemoryWarning)...)
+	rules = append(rules, ladder("tokens", "tokens_total", "tokens", float64(th.TokenCritical), float64(th.TokenWarning))...)
+	rules = append(rules, ladder("cost", "cost_usd", "cost", th.CostCritical, th.CostWarning)...)
+	if th.ForkRateCritical > 0 && th.ForkRateWarning > 0 {
+		rules = append(rules, ladder("fork_rate", "fork_rate", "process spawn rate", th.ForkRateCritical, th.ForkRateWarning)...)
+	}
+	if th.TokensPerSecCritical > 0 && th.TokensPerSecWarning > 0 {
+		rules = append(rules, ladder("tokens_per_sec", "tokens_per_sec", "token throughput", th.TokensPerSecCritical, th.TokensPerSecWarning)...)
+	}
+	return rules
+}
+
+// MetricRuleFromConfig converts a rule from the config file.
+func MetricRuleFromConfig(c config.AlertRuleConfig) MetricRule {
+	return MetricRule{
+		Name:      c.Name,
+		Metric:    c.Metric,
+		Operator:  RuleOperator(c.Operator),
+		Threshold: c.Threshold,
+		Level:     agent.AlertLevel(c.Level),
+		Duration:  c.Duration.Duration(),
+		Message:   c.Message,
+		Group:     c.Group,
+	}
+}
+
+type compiledRule struct {
+	MetricRule
+	metric ruleMetric
+}
+
+func compileRule(r MetricRule) (compiledRule, error) {
+	m, ok := ruleMetrics[r.Metric]
+	if !ok {
+		return compiledRule{}, fmt.Errorf("unknown rule metric %q", r.Metric)
+	}
+	if _, ok := r.Operator.compare(0, 0); !ok {
+		return compiledRule{}, fmt.Errorf("unknown rule operator %q", r.Operator)
+	}
+	switch r.Level {
+	case "":
+		r.Level = agent.AlertWarning
+	case agent.AlertInfo, agent.AlertWarning, agent.AlertCritical, agent.AlertSecurity:
+	default:
+		return compiledRule{}, fmt.Errorf("unknown alert level %q", r.Level)
+	}
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("%s %s %g", r.Metric, r.Operator, r.Threshold)
+	}
+	if r.Group == "" {
+		r.Group = r.Name
+	}
+	return compiledRule{MetricRule: r, metric: m}, nil
+}
+
+// AddMetricRule validates r and appends it to the rules evaluated by Check.
+func (am *AlertMonitor) AddMetricRule(r MetricRule) error {
+	cr, err := compileRule(r)
+	if err != nil {
+		return err
+	}
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.rules = append(am.rules, cr)
+	return nil
+}
+
+// SetMetricRules replaces every rule evaluated by Check, including the
+// built-in ones from DefaultRules, so CPU, memory, token and cost alerts can
+// be changed or turned off. If any rule is invalid the rules are left as
+// they were.
+func (am *AlertMonitor) SetMetricRules(rules []MetricRule) error {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, r := range rules {
+		cr, err := compileRule(r)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, cr)
+	}
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.rules = compiled
+	am.ruleSince = make(map[string]time.Time)
+	return nil
+}
+
+// MetricRules returns the rules evaluated by Check, built-in ones first.
+func (am *AlertMonitor) MetricRules() []MetricRule {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	rules := make([]MetricRule, len(am.rules))
+	for i, r := range am.rules {
+		rules[i] = r.MetricRule
+	}
+	return rules
+}
+
+func (am *AlertMonitor) checkRules(a *agent.Instance) {
+	now := am.now()
+	for _, r := range am.rules {
+		v := r.metric.value(a)
+		hit, _ := r.Operator.compare(v, r.Threshold)
+		if r.Duration > 0 {
+			key := a.Info.ID + "\x00" + r.Name
+			if !hit {
+				delete(am.ruleSince, key)
+				continue
+			}
+			since, ok := am.ruleSince[key]
+			if !ok {
+				am.ruleSince[key] = now
+				continue
+			}
+			if now.Sub(since) < r.Duration {
+				continue
+			}
+		} else if !hit {
+			continue
+		}
+
+		var msg string
+		if r.Message != "" {
+			msg = r.Message + ": " + r.metric.format(v)
+		} else {
+			msg = fmt.Sprintf("%s: %s %s %s", r.Name, r.metric.format(v), r.Operator, r.metric.format(r.Threshold))
+		}
+		am.addAlert(a, r.Level, msg, r.Group)
+	}
+}
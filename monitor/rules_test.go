@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+func TestMetricRule_OpenFiles(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	err := am.AddMetricRule(MetricRule{
+		Name:      "too_many_files",
+		Metric:    "open_files",
+		Operator:  OpGreater,
+		Threshold: 1000,
+		Level:     agent.AlertCritical,
+		Message:   "Too many open files",
+	})
+	if err != nil {
+		t.Fatalf("AddMetricRule: %v", err)
+	}
+
+	am.Check(&agent.Instance{Info: agent.Info{ID: "ok"}, OpenFiles: 1000})
+	if got := len(am.GetAlerts()); got != 0 {
+		t.Fatalf("got %d alerts at the threshold, want 0", got)
+	}
+
+	am.Check(&agent.Instance{Info: agent.Info{ID: "leaky"}, OpenFiles: 4096})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if alerts[0].Level != agent.AlertCritical || alerts[0].Message != "Too many open files: 4096" {
+		t.Errorf("alert = %+v", alerts[0])
+	}
+}
+
+func TestDefaultRules_ForkRate(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	am.Check(&agent.Instance{Info: agent.Info{ID: "busy"}, ForkRate: 150})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if alerts[0].Level != agent.AlertWarning || !strings.Contains(alerts[0].Message, "150/min") {
+		t.Errorf("alert = %+v", alerts[0])
+	}
+}
+
+func TestDefaultRules_TokensPerSec(t *testing.T) {
+	th := DefaultThresholds()
+	th.TokensPerSecWarning = 200
+	th.TokensPerSecCritical = 1000
+	am := NewAlertMonitor(th)
+	am.Check(&agent.Instance{Info: agent.Info{ID: "runaway"}, Tokens: agent.TokenMetrics{TokensPerSec: 2500}})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	if alerts[0].Level != agent.AlertCritical || alerts[0].Type != "tokens_per_sec" || !strings.Contains(alerts[0].Message, "2.5k/s") {
+		t.Errorf("alert = %+v", alerts[0])
+	}
+
+	// Disabled unless both thresholds are set.
+	am = NewAlertMonitor(DefaultThresholds())
+	am.Check(&agent.Instance{Info: agent.Info{ID: "runaway"}, Tokens: agent.TokenMetrics{TokensPerSec: 2500}})
+	if got := len(am.GetAlerts()); got != 0 {
+		t.Errorf("got %d alerts with thresholds unset, want 0", got)
+	}
+}
+
+func TestMetricRule_Duration(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	if err := am.AddMetricRule(MetricRule{
+		Metric: "connections", Operator: OpGreaterEqual, Threshold: 3, Duration: 2 * time.Minute,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	busy := &agent.Instance{Info: agent.Info{ID: "a1"}, NetConns: make([]agent.NetConnection, 5)}
+	idle := &agent.Instance{Info: agent.Info{ID: "a1"}}
+
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	step := func(min int, a *agent.Instance) int {
+		am.now = func() time.Time { return start.Add(time.Duration(min) * time.Minute) }
+		am.Check(a)
+		return len(am.GetAlerts())
+	}
+
+	if step(0, busy) != 0 || step(1, busy) != 0 {
+		t.Fatal("rule fired before its duration elapsed")
+	}
+	if step(2, idle) != 0 || step(3, busy) != 0 || step(4, busy) != 0 {
+		t.Fatal("a dip below the threshold should restart the duration")
+	}
+	if step(5, busy) != 1 {
+		t.Fatal("expected alert once the condition held for 2 minutes")
+	}
+	msg := am.GetAlerts()[0].Message
+	if !strings.Contains(msg, "connections >= 3") || !strings.Contains(msg, ": 5") {
+		t.Errorf("default message = %q", msg)
+	}
+	if am.GetAlerts()[0].Level != agent.AlertWarning {
+		t.Errorf("default level = %q, want WARNING", am.GetAlerts()[0].Level)
+	}
+}
+
+func TestMetricRule_Validation(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	bad := []MetricRule{
+		{Metric: "nope", Operator: OpGreater},
+		{Metric: "cpu", Operator: "=>"},
+		{Metric: "cpu", Operator: OpGreater, Level: "LOUD"},
+	}
+	for _, r := range bad {
+		if err := am.AddMetricRule(r); err == nil {
+			t.Errorf("AddMetricRule(%+v) = nil, want error", r)
+		}
+	}
+	if got, want := len(am.MetricRules()), len(DefaultRules(DefaultThresholds())); got != want {
+		t.Errorf("invalid rules were added: %d rules, want %d", got, want)
+	}
+}
+
+func TestDefaultRules_MatchBuiltInLadder(t *testing.T) {
+	rules := DefaultRules(DefaultThresholds())
+	if len(rules) != 10 {
+		t.Fatalf("DefaultRules returned %d rules, want 10", len(rules))
+	}
+	for _, r := range rules {
+		if _, ok := ruleMetrics[r.Metric]; !ok {
+			t.Errorf("default rule %q uses unknown metric %q", r.Name, r.Metric)
+		}
+	}
+
+	// Critical takes precedence and the shared group suppresses the warning.
+	am := NewAlertMonitor(DefaultThresholds())
+	am.Check(&agent.Instance{Info: agent.Info{ID: "a"}, CPU: 99})
+	alerts := am.GetAlerts()
+	if len(alerts) != 1 || alerts[0].Level != agent.AlertCritical || alerts[0].Message != "Critical CPU: 99.0%" {
+		t.Errorf("alerts = %+v, want a single critical CPU alert", alerts)
+	}
+}
+
+func TestMetricRuleFromConfig(t *testing.T) {
+	var rc config.AlertRuleConfig
+	data := `{"name":"fd","metric":"open_files","operator":">","threshold":500,"level":"CRITICAL","duration":"30s"}`
+	if err := json.Unmarshal([]byte(data), &rc); err != nil {
+		t.Fatal(err)
+	}
+	r := MetricRuleFromConfig(rc)
+	if r.Metric != "open_files" || r.Operator != OpGreater || r.Threshold != 500 ||
+		r.Level != agent.AlertCritical || r.Duration != 30*time.Second {
+		t.Errorf("MetricRuleFromConfig = %+v", r)
+	}
+	if err := NewAlertMonitor(DefaultThresholds()).AddMetricRule(r); err != nil {
+		t.Errorf("config rule rejected: %v", err)
+	}
+}
+
+func TestRuleMetrics(t *testing.T) {
+	names := RuleMetrics()
+	if len(names) != len(ruleMetrics) {
+		t.Fatalf("RuleMetrics returned %d names, want %d", len(names), len(ruleMetrics))
+	}
+	for i := 1; i < len(names); i++ {
+		if names[i-1] >= names[i] {
+			t.Fatalf("RuleMetrics not sorted: %v", names)
+		}
+	}
+}
+
+func TestSetMetricRules_ReplacesTokenAndCostAlerts(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	var keep []MetricRule
+	for _, r := range DefaultRules(DefaultThresholds()) {
+		if r.Metric != "tokens_total" && r.Metric != "cost_usd" {
+			keep = append(keep, r)
+		}
+	}
+	if err := am.SetMetricRules(keep); err != nil {
+		t.Fatal(err)
+	}
+	am.Check(&agent.Instance{Info: agent.Info{ID: "big"}, Tokens: agent.TokenMetrics{TotalTokens: 5000000, EstCost: 50}})
+	if alerts := am.GetAlerts(); len(alerts) != 0 {
+		t.Errorf("alerts = %+v, want none without token and cost rules", alerts)
+	}
+
+	// With the defaults, each crossing raises exactly one alert.
+	am = NewAlertMonitor(DefaultThresholds())
+	am.Check(&agent.Instance{Info: agent.Info{ID: "big"}, Tokens: agent.TokenMetrics{TotalTokens: 5000000, EstCost: 50}})
+	alerts := am.GetAlerts()
+	if len(alerts) != 2 || alerts[0].Type != "tokens" || alerts[1].Type != "cost" {
+		t.Errorf("alerts = %+v, want one tokens and one cost alert", alerts)
+	}
+
+	if err := am.SetMetricRules([]MetricRule{{Metric: "nope"}}); err == nil {
+		t.Error("SetMetricRules accepted an unknown metric")
+	}
+	if got := len(am.MetricRules()); got != len(DefaultRules(DefaultThresholds())) {
+		t.Errorf("invalid SetMetricRules changed the rules: %d rules", got)
+	}
+}
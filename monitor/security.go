@@ -1,7 +1,14 @@
 package monitor
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -17,8 +24,36 @@ type SecurityMonitor struct {
 	events    []agent.SecurityEvent
 	maxEvents int
 	seen      map[string]time.Time
+	escalated map[string]agent.TerminalCommand // agent ID -> latest escalation
+	now       func() time.Time
+	metadata  map[string]string
+	injector  MetadataFunc
+	subs      subscribers[agent.SecurityEvent]
+	patterns  map[string]*regexp.Regexp         // compiled regexp rules; nil if invalid
+	overrides map[string]agent.SecuritySeverity // rule or category -> severity
+	rules     []SecurityRuleFunc
+	handlers  []func(agent.SecurityEvent)
+	pending   []agent.SecurityEvent // recorded this CheckAgent, for handlers
+	scanned   map[string]string     // path -> size/mtime of its last content scan
+	riskWin   time.Duration
 }
 
+// DefaultRiskWindow is how far back RiskScore looks unless changed with
+// SetRiskWindow.
+const DefaultRiskWindow = time.Hour
+
+// riskWeights are the points each event adds to an agent's risk score.
+var riskWeights = map[agent.SecuritySeverity]int{
+	agent.SecSevLow:      1,
+	agent.SecSevMedium:   2,
+	agent.SecSevHigh:     5,
+	agent.SecSevCritical: 10,
+}
+
+// SecurityRuleFunc is a caller-supplied detection rule. It inspects an agent
+// and returns the events it finds; see SecurityMonitor.AddRule.
+type SecurityRuleFunc func(a *agent.Instance) []agent.SecurityEvent
+
 // NewSecurityMonitor creates a new security monitor.
 func NewSecurityMonitor(cfg config.SecurityConfig) *SecurityMonitor {
 	maxEvents := cfg.MaxEvents
@@ -30,7 +65,66 @@ func NewSecurityMonitor(cfg config.SecurityConfig) *SecurityMonitor {
 		events:    make([]agent.SecurityEvent, 0),
 		maxEvents: maxEvents,
 		seen:      make(map[string]time.Time),
+		escalated: make(map[string]agent.TerminalCommand),
+		now:       time.Now,
+		overrides: severityOverrides(cfg.SeverityOverrides),
+		riskWin:   DefaultRiskWindow,
+	}
+}
+
+// severityOverrides normalizes SecurityConfig.SeverityOverrides, skipping
+// entries that fail validation.
+func severityOverrides(m map[string]string) map[string]agent.SecuritySeverity {
+	out := make(map[string]agent.SecuritySeverity, len(m))
+	for key, sev := range m {
+		if key != "" && config.ValidSecuritySeverity(sev) {
+			out[key] = agent.SecuritySeverity(strings.ToUpper(sev))
+		}
 	}
+	return out
+}
+
+// SetMetadata sets static key/value pairs (environment, hostname, ...) that
+// are attached to every security event recorded from now on.
+func (sm *SecurityMonitor) SetMetadata(md map[string]string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.metadata = copyMetadata(md)
+}
+
+// SetMetadataInjector registers fn to supply per-event metadata. It is called
+// with the monitor's lock held and must not call back into the SecurityMonitor.
+func (sm *SecurityMonitor) SetMetadataInjector(fn MetadataFunc) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.injector = fn
+}
+
+// AddRule registers fn to run on every CheckAgent after the built-in rules.
+// Its events are deduplicated, stamped and trimmed like built-in ones.
+// Events without a Category are filed under custom, without a Severity as
+// MEDIUM, and without a Rule as "custom". fn runs without the monitor's lock
+// held and should not modify a.
+func (sm *SecurityMonitor) AddRule(fn SecurityRuleFunc) {
+	if fn == nil {
+		return
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.rules = append(sm.rules, fn)
+}
+
+// OnEvent registers fn to be called once for every event recorded, after
+// deduplication. Handlers run on the goroutine calling CheckAgent, in
+// registration order, once the monitor's lock has been released, so they may
+// call back into the SecurityMonitor. A slow handler delays CheckAgent.
+func (sm *SecurityMonitor) OnEvent(fn func(agent.SecurityEvent)) {
+	if fn == nil {
+		return
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.handlers = append(sm.handlers, fn)
 }
 
 // CheckAgent analyzes an agent's terminal commands, file operations, and
@@ -42,22 +136,102 @@ func (sm *SecurityMonitor) CheckAgent(a *agent.Instance) {
 	}
 
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	rules := sm.rules
+	sm.mu.Unlock()
+	var custom []agent.SecurityEvent
+	for _, fn := range rules {
+		custom = append(custom, fn(a)...)
+	}
+	// Reading written files is disk I/O; keep it out of the lock so
+	// readers such as GetEvents are not stalled behind a slow filesystem.
+	secrets := sm.scanSecrets(a)
+	rewrite, rewritten := sm.massRewrite(a)
 
+	sm.mu.Lock()
 	sm.checkCommands(a)
-	sm.checkFileOps(a)
+	sm.checkFileOps(a, secrets)
+	if rewritten {
+		sm.addEvent(a, rewrite)
+	}
 	sm.checkNetwork(a)
 	sm.checkFileSecurity(a)
+	sm.checkBrowserData(a)
+	sm.checkBackgroundDaemons(a)
+	sm.checkEscalationPersistence(a)
+	for _, evt := range custom {
+		if evt.Category == "" {
+			evt.Category = agent.SecCatCustom
+		}
+		if evt.Severity == "" {
+			evt.Severity = agent.SecSevMedium
+		}
+		if evt.Rule == "" {
+			evt.Rule = "custom"
+		}
+		sm.addEvent(a, evt)
+	}
 
 	a.SecurityEvents = sm.getEventsForAgent(a.Info.ID)
+	handlers, recorded := sm.handlers, sm.pending
+	sm.pending = nil
+	sm.mu.Unlock()
+
+	for _, evt := range recorded {
+		for _, fn := range handlers {
+			fn(evt)
+		}
+	}
+}
+
+// commandAllowed reports whether cmdLower is exempt from every command
+// rule. Each segment of a command chained with ";", "&&", "||", "|" or "&"
+// must match AllowedCommands on its own, so an allowed command cannot carry
+// another one along; a literal pattern must start the segment.
+func (sm *SecurityMonitor) commandAllowed(cmdLower string) bool {
+	if len(sm.config.AllowedCommands) == 0 {
+		return false
+	}
+	segments := strings.FieldsFunc(cmdLower, func(r rune) bool {
+		return r == ';' || r == '&' || r == '|' || r == '\n'
+	})
+	allowed := false
+	for _, seg := range segments {
+		seg = strings.TrimSpace(seg)
+		if seg == "" {
+			continue
+		}
+		if !sm.segmentAllowed(seg) {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func (sm *SecurityMonitor) segmentAllowed(seg string) bool {
+	for _, p := range sm.config.AllowedCommands {
+		switch {
+		case p == "":
+		case isRegexPattern(p):
+			if sm.patternMatches(seg, p) {
+				return true
+			}
+		case strings.HasPrefix(seg, strings.ToLower(p)):
+			return true
+		}
+	}
+	return false
 }
 
 func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 	for _, cmd := range a.Terminal.RecentCommands {
 		cmdLower := strings.ToLower(cmd.Command)
+		if sm.commandAllowed(cmdLower) {
+			continue
+		}
 
 		for _, pattern := range sm.config.DangerousCommands {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatDangerousCommand,
 					Severity:    agent.SecSevCritical,
@@ -70,7 +244,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.EscalationCommands {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatPermEscalation,
 					Severity:    agent.SecSevHigh,
@@ -83,7 +257,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.CodeInjectionPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatCodeInjection,
 					Severity:    agent.SecSevHigh,
@@ -96,7 +270,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.SystemModifyCommands {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatSystemModify,
 					Severity:    agent.SecSevMedium,
@@ -121,7 +295,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.ReverseShellPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatReverseShell,
 					Severity:    agent.SecSevCritical,
@@ -134,7 +308,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.ObfuscationPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatObfuscation,
 					Severity:    agent.SecSevHigh,
@@ -147,7 +321,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.ContainerEscapePatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatContainerEscape,
 					Severity:    agent.SecSevCritical,
@@ -160,7 +334,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.EnvManipulationPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatEnvManipulation,
 					Severity:    agent.SecSevHigh,
@@ -172,8 +346,10 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 			}
 		}
 
-		for _, pattern := range sm.config.CredentialAccessPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+		// Commands touching a browser profile are reported once, by
+		// checkBrowserData.
+		for _, pattern := range sm.credentialPatterns(cmdLower) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatCredentialAccess,
 					Severity:    agent.SecSevCritical,
@@ -186,7 +362,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.LogTamperingPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatLogTampering,
 					Severity:    agent.SecSevHigh,
@@ -199,7 +375,7 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 		}
 
 		for _, pattern := range sm.config.RemoteAccessPatterns {
-			if strings.Contains(cmdLower, strings.ToLower(pattern)) {
+			if sm.patternMatches(cmdLower, pattern) {
 				if strings.Contains(cmdLower, "ssh-agent") || strings.Contains(cmdLower, "ssh-add") {
 					continue
 				}
@@ -213,10 +389,23 @@ func (sm *SecurityMonitor) checkCommands(a *agent.Instance) {
 				break
 			}
 		}
+
+		for _, pattern := range sm.config.ReverseTunnelPatterns {
+			if sm.patternMatches(cmdLower, pattern) {
+				sm.addEvent(a, agent.SecurityEvent{
+					Category:    agent.SecCatReverseTunnel,
+					Severity:    agent.SecSevHigh,
+					Description: "Reverse tunnel exposing local services",
+					Detail:      cmd.Command,
+					Rule:        fmt.Sprintf("reverse_tunnel:%s", pattern),
+				})
+				break
+			}
+		}
 	}
 }
 
-func (sm *SecurityMonitor) checkFileOps(a *agent.Instance) {
+func (sm *SecurityMonitor) checkFileOps(a *agent.Instance, secrets map[string]agent.SecurityEvent) {
 	deleteCount := 0
 	for _, op := range a.FileOps {
 		if op.Op == "DELETE" {
@@ -252,10 +441,342 @@ func (sm *SecurityMonitor) checkFileOps(a *agent.Instance) {
 			}
 		}
 
-		if op.Op == "CREATE" || op.Op == "MODIFY" {
+		if writesFile(op) {
 			sm.checkSecretsInFilename(a, op.Path)
+			if evt, ok := secrets[op.Path]; ok {
+				sm.addEvent(a, evt)
+				delete(secrets, op.Path)
+			}
+		}
+	}
+}
+
+// entropySampleBytes is how much of each rewritten file is read to estimate
+// its entropy; minEntropySample skips files too small to judge.
+const (
+	entropySampleBytes = 4096
+	minEntropySample   = 256
+)
+
+// compressedExts are formats whose content is legitimately high-entropy.
+var compressedExts = map[string]bool{
+	".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true,
+	".7z": true, ".rar": true, ".jar": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".webp": true, ".mp3": true, ".mp4": true, ".mov": true, ".pdf": true,
+	".woff": true, ".woff2": true, ".pack": true, ".idx": true,
+}
+
+// massRewrite flags a burst of writes whose results look encrypted, the
+// typical footprint of ransomware encrypting a tree in place. It reads the
+// written files, so CheckAgent calls it without holding sm.mu; ok is false
+// when there is nothing to report.
+func (sm *SecurityMonitor) massRewrite(a *agent.Instance) (evt agent.SecurityEvent, ok bool) {
+	threshold := sm.config.MassRewriteThreshold
+	if threshold <= 0 || len(a.FileOps) < threshold {
+		return evt, false
+	}
+
+	var latest time.Time
+	for _, op := range a.FileOps {
+		if op.Timestamp.After(latest) {
+			latest = op.Timestamp
+		}
+	}
+	window := sm.config.MassRewriteWindow.Duration()
+
+	deleted := make(map[string]bool)
+	written := make(map[string]bool)
+	var paths []string
+	for _, op := range a.FileOps {
+		if window > 0 && latest.Sub(op.Timestamp) > window {
+			continue
+		}
+		switch op.Op {
+		case "DELETE":
+			deleted[op.Path] = true
+		case "RENAME":
+			deleted[op.OldPath] = true
+			fallthrough
+		case "CREATE", "MODIFY":
+			if !written[op.Path] {
+				written[op.Path] = true
+				paths = append(paths, op.Path)
+			}
+		}
+	}
+	if len(paths) < threshold {
+		return evt, false
+	}
+
+	suspicious := 0
+	var example string
+	for _, path := range paths {
+		if sm.looksEncrypted(path, deleted) {
+			suspicious++
+			if example == "" {
+				example = path
+			}
+		}
+	}
+	if suspicious < threshold {
+		return evt, false
+	}
+
+	return agent.SecurityEvent{
+		Category:    agent.SecCatRansomware,
+		Severity:    agent.SecSevCritical,
+		Description: fmt.Sprintf("Possible ransomware: %d files rewritten with encrypted-looking content", suspicious),
+		Detail:      fmt.Sprintf("%d of %d files written, e.g. %s", suspicious, len(paths), example),
+		Rule:        fmt.Sprintf("ransomware:threshold=%d", threshold),
+	}, true
+}
+
+// looksEncrypted reads a sample of path; it only uses sm.config, which is
+// fixed at construction, so it is safe without sm.mu.
+func (sm *SecurityMonitor) looksEncrypted(path string, deleted map[string]bool) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range sm.config.RansomwareExtensions {
+		if ext == strings.ToLower(e) {
+			return true
+		}
+	}
+	// file.txt replaced by file.txt.xyz
+	if ext != "" && deleted[strings.TrimSuffix(path, filepath.Ext(path))] {
+		return true
+	}
+
+	if sm.config.RewriteEntropyBits <= 0 || compressedExts[ext] {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	buf := make([]byte, entropySampleBytes)
+	n, _ := io.ReadFull(f, buf)
+	if n < minEntropySample {
+		return false
+	}
+	return shannonEntropy(buf[:n]) >= sm.config.RewriteEntropyBits
+}
+
+// shannonEntropy returns the Shannon entropy of data in bits per byte (0-8).
+func shannonEntropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range data {
+		counts[b]++
+	}
+	var h float64
+	n := float64(len(data))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// Content secret scanning: tokens are runs of credential characters of
+// secretTokenMin..secretTokenMax length; maxScannedFiles bounds the memory
+// of which file versions were already read.
+const (
+	defaultSecretScanBytes = 64 * 1024
+	defaultSecretEntropy   = 4.3
+	secretTokenMin         = 20
+	secretTokenMax         = 256
+	maxScannedFiles        = 4096
+	secretSnippetVisible   = 4
+	secretSnippetMaxMasked = 12
+)
+
+// knownSecretFormats are credential formats recognised regardless of
+// entropy, checked in order.
+var knownSecretFormats = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"aws_access_key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"github_token", regexp.MustCompile(`\bgh[pousr]_[0-9A-Za-z]{36}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[0-9A-Za-z-]{10,}`)},
+}
+
+// secretToken matches candidate tokens for the entropy check.
+var secretToken = regexp.MustCompile(`[A-Za-z0-9+/=_-]{20,}`)
+
+// lockFiles hold integrity hashes that are high-entropy by design.
+var lockFiles = map[string]bool{
+	"package-lock.json": true, "npm-shrinkwrap.json": true, "yarn.lock": true,
+	"pnpm-lock.yaml": true, "go.sum": true, "cargo.lock": true, "poetry.lock": true,
+	"gemfile.lock": true, "composer.lock": true, "bun.lockb": true,
+}
+
+// scanSecrets scans the small text files the agent wrote under its WorkDir
+// for credentials, when ScanFileContents is enabled, and returns an event
+// per file with a finding. Each version of a file (by size and modification
+// time) is read once. The stat and read calls run without sm.mu, which is
+// taken only to check and record the scanned versions.
+func (sm *SecurityMonitor) scanSecrets(a *agent.Instance) map[string]agent.SecurityEvent {
+	if !sm.config.ScanFileContents || a.WorkDir == "" {
+		return nil
+	}
+	type candidate struct{ path, version string }
+	var candidates []candidate
+	checked := make(map[string]bool)
+	for _, op := range a.FileOps {
+		if !writesFile(op) || checked[op.Path] {
+			continue
+		}
+		checked[op.Path] = true
+		if version, ok := sm.secretScanVersion(a, op.Path); ok {
+			candidates = append(candidates, candidate{op.Path, version})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sm.mu.Lock()
+	fresh := candidates[:0]
+	for _, c := range candidates {
+		if sm.scanned[c.path] == c.version {
+			continue
+		}
+		if sm.scanned == nil || len(sm.scanned) >= maxScannedFiles {
+			sm.scanned = make(map[string]string)
+		}
+		sm.scanned[c.path] = c.version
+		fresh = append(fresh, c)
+	}
+	sm.mu.Unlock()
+
+	found := make(map[string]agent.SecurityEvent)
+	for _, c := range fresh {
+		if evt, ok := sm.secretInFile(c.path); ok {
+			found[c.path] = evt
+		}
+	}
+	return found
+}
+
+// secretScanVersion reports whether path is eligible for a content scan
+// and, if so, the size/mtime version it has now.
+func (sm *SecurityMonitor) secretScanVersion(a *agent.Instance, path string) (string, bool) {
+	if !pathWithin(a.WorkDir, path) {
+		return "", false
+	}
+	if lockFiles[strings.ToLower(filepath.Base(path))] || compressedExts[strings.ToLower(filepath.Ext(path))] {
+		return "", false
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > int64(sm.secretScanLimit()) {
+		return "", false
+	}
+	return fmt.Sprintf("%d/%d", info.Size(), info.ModTime().UnixNano()), true
+}
+
+// secretInFile reads path and returns an event for the first credential in
+// it.
+func (sm *SecurityMonitor) secretInFile(path string) (agent.SecurityEvent, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) > sm.secretScanLimit() || bytes.IndexByte(data, 0) >= 0 {
+		return agent.SecurityEvent{}, false // vanished, grew, or binary
+	}
+	kind, secret, line := findSecret(data, sm.secretEntropyBits())
+	if kind == "" {
+		return agent.SecurityEvent{}, false
+	}
+	return agent.SecurityEvent{
+		Category:    agent.SecCatSecretsExposure,
+		Severity:    agent.SecSevHigh,
+		Description: "Possible secret written to file",
+		Detail:      fmt.Sprintf("%s:%d: %s", path, line, redactSecret(secret)),
+		Rule:        "secrets_content:" + kind,
+	}, true
+}
+
+func (sm *SecurityMonitor) secretScanLimit() int {
+	if sm.config.SecretScanMaxBytes > 0 {
+		return sm.config.SecretScanMaxBytes
+	}
+	return defaultSecretScanBytes
+}
+
+func (sm *SecurityMonitor) secretEntropyBits() float64 {
+	if sm.config.SecretEntropyBits > 0 {
+		return sm.config.SecretEntropyBits
+	}
+	return defaultSecretEntropy
+}
+
+// findSecret returns the kind, text and 1-based line of the first credential
+// found in data: a known format, or else a token of mixed-case letters and
+// digits whose entropy reaches minBits per character. kind is "" if there
+// is none.
+func findSecret(data []byte, minBits float64) (kind, secret string, line int) {
+	for i, text := range strings.Split(string(data), "\n") {
+		for _, f := range knownSecretFormats {
+			if m := f.re.FindString(text); m != "" {
+				return f.name, m, i + 1
+			}
+		}
+		for _, tok := range secretToken.FindAllString(text, -1) {
+			if len(tok) > secretTokenMax || isHashDigest(tok) || !mixedAlnum(tok) {
+				continue
+			}
+			if shannonEntropy([]byte(tok)) >= minBits {
+				return "entropy", tok, i + 1
+			}
+		}
+	}
+	return "", "", 0
+}
+
+// isHashDigest reports whether tok is an integrity hash such as
+// "sha512-...", which is public by design.
+func isHashDigest(tok string) bool {
+	lower := strings.ToLower(tok)
+	return strings.HasPrefix(lower, "sha1-") || strings.HasPrefix(lower, "sha256-") ||
+		strings.HasPrefix(lower, "sha384-") || strings.HasPrefix(lower, "sha512-")
+}
+
+// mixedAlnum reports whether s has upper- and lower-case letters and digits,
+// as generated keys do and identifiers and paths mostly do not.
+func mixedAlnum(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
 		}
 	}
+	return upper && lower && digit
+}
+
+// redactSecret keeps the first few characters of secret and masks the rest,
+// e.g. "AKIA************".
+func redactSecret(secret string) string {
+	if len(secret) <= secretSnippetVisible {
+		return strings.Repeat("*", len(secret))
+	}
+	masked := min(len(secret)-secretSnippetVisible, secretSnippetMaxMasked)
+	return secret[:secretSnippetVisible] + strings.Repeat("*", masked)
+}
+
+// pathWithin reports whether path is dir or inside it.
+func pathWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
 }
 
 func (sm *SecurityMonitor) checkSecretsInFilename(a *agent.Instance, path string) {
@@ -283,39 +804,190 @@ func (sm *SecurityMonitor) checkSecretsInFilename(a *agent.Instance, path string
 func (sm *SecurityMonitor) checkNetwork(a *agent.Instance) {
 	for _, conn := range a.NetConns {
 		remoteLower := strings.ToLower(conn.RemoteAddr)
+		hostLower := strings.ToLower(conn.RemoteHost)
 
 		for _, host := range sm.config.SuspiciousHosts {
-			if strings.Contains(remoteLower, strings.ToLower(host)) {
+			pattern := strings.ToLower(host)
+			if strings.Contains(remoteLower, pattern) || (hostLower != "" && strings.Contains(hostLower, pattern)) {
+				remote := conn.RemoteAddr
+				if conn.RemoteHost != "" {
+					remote += " (" + conn.RemoteHost + ")"
+				}
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatSuspiciousNet,
 					Severity:    agent.SecSevHigh,
 					Description: fmt.Sprintf("Connection to suspicious host: %s", host),
-					Detail:      fmt.Sprintf("%s -> %s [%s]", conn.LocalAddr, conn.RemoteAddr, conn.Protocol),
+					Detail:      fmt.Sprintf("%s -> %s [%s]", conn.LocalAddr, remote, conn.Protocol),
 					Rule:        fmt.Sprintf("suspicious_host:%s", host),
 				})
 				break
 			}
 		}
 
-		if conn.State == "ESTABLISHED" && isUnusualPort(conn.RemoteAddr) {
-			sm.addEvent(a, agent.SecurityEvent{
+		// Loopback and link-local peers are usually local model servers or
+		// dev tooling, so they are only matched against SuspiciousHosts.
+		if conn.State == "ESTABLISHED" && !isLocalAddr(conn.RemoteAddr) && isUnusualPort(conn.RemoteAddr) {
+			// Unusual ports inside the LAN are mostly dev services; on the
+			// public internet they are a common exfiltration channel.
+			evt := agent.SecurityEvent{
 				Category:    agent.SecCatNetworkExfil,
 				Severity:    agent.SecSevLow,
 				Description: "Connection on unusual port",
 				Detail:      fmt.Sprintf("%s -> %s [%s]", conn.LocalAddr, conn.RemoteAddr, conn.Protocol),
 				Rule:        "unusual_port",
-			})
+			}
+			if isPublicAddr(conn.RemoteAddr) {
+				evt.Severity = agent.SecSevHigh
+				evt.Description = "Connection on unusual port to public IP"
+				evt.Rule = "unusual_port:public"
+			}
+			sm.addEvent(a, evt)
+		}
+	}
+}
+
+func (sm *SecurityMonitor) checkBackgroundDaemons(a *agent.Instance) {
+	minAge := sm.config.DaemonMinAge.Duration()
+	if minAge <= 0 {
+		return
+	}
+	for _, child := range a.Children {
+		if !child.Detached || child.Elapsed < minAge {
+			continue
+		}
+		name := commandBase(child.Command)
+		sm.addEvent(a, agent.SecurityEvent{
+			Category:    agent.SecCatBackgroundDaemon,
+			Severity:    agent.SecSevMedium,
+			Description: fmt.Sprintf("Detached background process running for %s", child.Elapsed.Round(time.Second)),
+			Detail:      fmt.Sprintf("pid %d: %s", child.PID, child.Command),
+			Rule:        fmt.Sprintf("background_daemon:%s", name),
+		})
+	}
+}
+
+// checkEscalationPersistence raises a critical event when a persistence
+// action (a PersistenceCommands command or a write to a shell persistence
+// file) follows a privilege escalation command within EscalationWindow. The
+// action must come after the escalation and be a different command, so a
+// single "sudo crontab -l" is not a pair. The latest escalation is
+// remembered so the pair is caught even when the escalation has scrolled
+// out of RecentCommands.
+func (sm *SecurityMonitor) checkEscalationPersistence(a *agent.Instance) {
+	window := sm.config.EscalationWindow.Duration()
+	if window <= 0 {
+		return
+	}
+	if sm.escalated == nil {
+		sm.escalated = make(map[string]agent.TerminalCommand)
+	}
+
+	var escalations []agent.TerminalCommand
+	if prev, ok := sm.escalated[a.Info.ID]; ok {
+		escalations = append(escalations, prev)
+	}
+	for _, cmd := range a.Terminal.RecentCommands {
+		cmdLower := strings.ToLower(cmd.Command)
+		if !sm.commandAllowed(cmdLower) && sm.matchPattern(cmdLower, sm.config.EscalationCommands) != "" {
+			escalations = append(escalations, cmd)
 		}
 	}
+	if len(escalations) == 0 {
+		return
+	}
+	latest := escalations[0]
+	for _, e := range escalations[1:] {
+		if !e.Timestamp.Before(latest.Timestamp) {
+			latest = e
+		}
+	}
+	sm.escalated[a.Info.ID] = latest
+
+	correlate := func(at time.Time, action string) {
+		for _, e := range escalations {
+			if action == e.Command {
+				continue
+			}
+			if d := at.Sub(e.Timestamp); d > 0 && d <= window {
+				sm.addEvent(a, agent.SecurityEvent{
+					Category:    agent.SecCatPermEscalation,
+					Severity:    agent.SecSevCritical,
+					Description: "Privilege escalation followed by persistence",
+					Detail:      fmt.Sprintf("%s -> %s", e.Command, action),
+					Rule:        "escalation_persistence",
+				})
+				return
+			}
+		}
+	}
+	for _, cmd := range a.Terminal.RecentCommands {
+		cmdLower := strings.ToLower(cmd.Command)
+		if !sm.commandAllowed(cmdLower) && sm.matchPattern(cmdLower, sm.config.PersistenceCommands) != "" {
+			correlate(cmd.Timestamp, cmd.Command)
+		}
+	}
+	for _, op := range a.FileOps {
+		if !writesFile(op) {
+			continue
+		}
+		if sm.matchPattern(strings.ToLower(op.Path), sm.config.ShellPersistenceFiles) != "" {
+			correlate(op.Timestamp, op.Op+" "+op.Path)
+		}
+	}
+}
+
+// writesFile reports whether op leaves content at op.Path: a create,
+// modify, or rename onto it.
+func writesFile(op agent.FileOperation) bool {
+	return op.Op == "CREATE" || op.Op == "MODIFY" || op.Op == "RENAME"
+}
+
+// matchPattern returns the first of patterns that matches sLower, or "" if
+// none does.
+func (sm *SecurityMonitor) matchPattern(sLower string, patterns []string) string {
+	for _, p := range patterns {
+		if sm.patternMatches(sLower, p) {
+			return p
+		}
+	}
+	return ""
+}
+
+// isRegexPattern reports whether a rule pattern is meant as a regular
+// expression. Literal rules are plain substrings that often contain regexp
+// metacharacters ("eval(", "| sh"), so only a ".*" or ".+" wildcard marks a
+// pattern as a regexp.
+func isRegexPattern(pattern string) bool {
+	return strings.Contains(pattern, ".*") || strings.Contains(pattern, ".+")
+}
+
+// patternMatches reports whether pattern matches sLower, case-insensitively.
+// Regexp patterns are compiled once and cached; one that fails to compile
+// is matched as a substring instead. Callers hold sm.mu.
+func (sm *SecurityMonitor) patternMatches(sLower, pattern string) bool {
+	if isRegexPattern(pattern) {
+		re, ok := sm.patterns[pattern]
+		if !ok {
+			re, _ = regexp.Compile("(?i)" + pattern)
+			if sm.patterns == nil {
+				sm.patterns = make(map[string]*regexp.Regexp)
+			}
+			sm.patterns[pattern] = re
+		}
+		if re != nil {
+			return re.MatchString(sLower)
+		}
+	}
+	return strings.Contains(sLower, strings.ToLower(pattern))
 }
 
 func (sm *SecurityMonitor) checkFileSecurity(a *agent.Instance) {
 	for _, op := range a.FileOps {
 		pathLower := strings.ToLower(op.Path)
 
-		if op.Op == "MODIFY" || op.Op == "CREATE" {
+		if writesFile(op) {
 			for _, pattern := range sm.config.ShellPersistenceFiles {
-				if strings.Contains(pathLower, strings.ToLower(pattern)) {
+				if sm.patternMatches(pathLower, pattern) {
 					sm.addEvent(a, agent.SecurityEvent{
 						Category:    agent.SecCatShellPersistence,
 						Severity:    agent.SecSevMedium,
@@ -328,8 +1000,9 @@ func (sm *SecurityMonitor) checkFileSecurity(a *agent.Instance) {
 			}
 		}
 
-		for _, pattern := range sm.config.CredentialAccessPatterns {
-			if strings.Contains(pathLower, strings.ToLower(pattern)) {
+		// Browser profile files are reported once, by checkBrowserData.
+		for _, pattern := range sm.credentialPatterns(strings.ToLower(filepath.ToSlash(op.Path))) {
+			if sm.patternMatches(pathLower, pattern) {
 				sm.addEvent(a, agent.SecurityEvent{
 					Category:    agent.SecCatCredentialAccess,
 					Severity:    agent.SecSevCritical,
@@ -343,28 +1016,133 @@ func (sm *SecurityMonitor) checkFileSecurity(a *agent.Instance) {
 	}
 }
 
+// browserSecretFiles are per-profile files holding cookies, saved passwords
+// or the keys protecting them.
+var browserSecretFiles = []string{
+	"login data", "cookies", "web data", "local state",
+	"cookies.sqlite", "logins.json", "key4.db", "key3.db",
+}
+
+func (sm *SecurityMonitor) checkBrowserData(a *agent.Instance) {
+	for _, cmd := range a.Terminal.RecentCommands {
+		cmdLower := strings.ToLower(cmd.Command)
+		if sm.commandAllowed(cmdLower) {
+			continue
+		}
+		if pattern := sm.matchBrowserProfile(cmdLower); pattern != "" {
+			sm.addEvent(a, agent.SecurityEvent{
+				Category:    agent.SecCatCredentialAccess,
+				Severity:    agent.SecSevCritical,
+				Description: "Browser profile data accessed by command",
+				Detail:      cmd.Command,
+				Rule:        fmt.Sprintf("browser_profile:%s", pattern),
+			})
+		}
+	}
+
+	for _, op := range a.FileOps {
+		pathLower := strings.ToLower(filepath.ToSlash(op.Path))
+		pattern := sm.matchBrowserProfile(pathLower)
+		if pattern == "" {
+			continue
+		}
+		desc := fmt.Sprintf("Browser profile data %s", strings.ToLower(op.Op))
+		if isBrowserSecretFile(pathLower) {
+			desc = fmt.Sprintf("Browser credentials/cookies %s", strings.ToLower(op.Op))
+		}
+		sm.addEvent(a, agent.SecurityEvent{
+			Category:    agent.SecCatCredentialAccess,
+			Severity:    agent.SecSevCritical,
+			Description: desc,
+			Detail:      op.Path,
+			Rule:        fmt.Sprintf("browser_profile:%s", pattern),
+		})
+	}
+}
+
+// credentialPatterns returns the CredentialAccessPatterns to check sLower
+// against: none if it is in a browser profile, which checkBrowserData
+// reports, so one access does not raise two critical events.
+func (sm *SecurityMonitor) credentialPatterns(sLower string) []string {
+	if sm.matchBrowserProfile(sLower) != "" {
+		return nil
+	}
+	return sm.config.CredentialAccessPatterns
+}
+
+func (sm *SecurityMonitor) matchBrowserProfile(sLower string) string {
+	for _, pattern := range sm.config.BrowserProfilePaths {
+		p := strings.ToLower(filepath.ToSlash(pattern))
+		if strings.Contains(sLower, p) || strings.Contains(sLower, strings.ReplaceAll(p, "/", `\`)) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+func isBrowserSecretFile(pathLower string) bool {
+	base := pathLower
+	if i := strings.LastIndexAny(base, `/\`); i >= 0 {
+		base = base[i+1:]
+	}
+	for _, name := range browserSecretFiles {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (sm *SecurityMonitor) addEvent(a *agent.Instance, evt agent.SecurityEvent) {
+	now := sm.now()
 	key := fmt.Sprintf("%s:%s:%s", a.Info.ID, evt.Rule, evt.Detail)
-	if last, ok := sm.seen[key]; ok {
-		if time.Since(last) < 5*time.Minute {
+	if window := sm.config.DedupWindow.Duration(); window > 0 {
+		if last, ok := sm.seen[key]; ok && now.Sub(last) < window {
 			return
 		}
 	}
 
-	evt.Timestamp = time.Now()
+	if sev, ok := sm.overrides[evt.Rule]; ok {
+		evt.Severity = sev
+	} else if sev, ok := sm.overrides[string(evt.Category)]; ok {
+		evt.Severity = sev
+	}
+	evt.Timestamp = now
 	evt.AgentID = a.Info.ID
 	evt.AgentName = a.Info.Name
+	evt.Metadata = buildMetadata(sm.metadata, sm.injector, a)
 	evt.Blocked = sm.config.BlockDangerousCommands &&
 		(evt.Severity == agent.SecSevCritical || evt.Severity == agent.SecSevHigh)
 
 	sm.events = append(sm.events, evt)
-	sm.seen[key] = time.Now()
+	sm.seen[key] = now
+	sm.subs.publish(evt)
+	if len(sm.handlers) > 0 {
+		sm.pending = append(sm.pending, evt)
+	}
 
 	if len(sm.events) > sm.maxEvents {
 		sm.events = sm.events[len(sm.events)-sm.maxEvents:]
 	}
 }
 
+// severityRank orders severities from 1 (low) to 4 (critical); unknown or
+// empty severities rank 0.
+func severityRank(s agent.SecuritySeverity) int {
+	switch s {
+	case agent.SecSevLow:
+		return 1
+	case agent.SecSevMedium:
+		return 2
+	case agent.SecSevHigh:
+		return 3
+	case agent.SecSevCritical:
+		return 4
+	default:
+		return 0
+	}
+}
+
 // GetEvents returns all security events.
 func (sm *SecurityMonitor) GetEvents() []agent.SecurityEvent {
 	sm.mu.Lock()
@@ -389,6 +1167,72 @@ func (sm *SecurityMonitor) GetRecentEvents(minutes int) []agent.SecurityEvent {
 	return result
 }
 
+// SetRiskWindow sets how far back RiskScore and FleetRiskScores look. A
+// non-positive window counts every retained event.
+func (sm *SecurityMonitor) SetRiskWindow(d time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.riskWin = d
+}
+
+// RiskScore sums the weighted severities of agentID's events within the risk
+// window: 10 per CRITICAL, 5 per HIGH, 2 per MEDIUM and 1 per LOW event.
+func (sm *SecurityMonitor) RiskScore(agentID string) int {
+	return sm.FleetRiskScores()[agentID]
+}
+
+// FleetRiskScores returns the RiskScore of every agent with events in the
+// risk window.
+func (sm *SecurityMonitor) FleetRiskScores() map[string]int {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	var cutoff time.Time
+	if sm.riskWin > 0 {
+		cutoff = sm.now().Add(-sm.riskWin)
+	}
+	scores := make(map[string]int)
+	for _, e := range sm.events {
+		if e.Timestamp.Before(cutoff) {
+			continue
+		}
+		scores[e.AgentID] += riskWeights[e.Severity]
+	}
+	return scores
+}
+
+// Clear discards every recorded event and all dedup and escalation state,
+// keeping the monitor's configuration, rules and handlers.
+func (sm *SecurityMonitor) Clear() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.events = make([]agent.SecurityEvent, 0)
+	sm.seen = make(map[string]time.Time)
+	sm.escalated = make(map[string]agent.TerminalCommand)
+}
+
+// ResetAgent discards agentID's events and its dedup and escalation state,
+// for example when its session ends, so a new session reports afresh.
+func (sm *SecurityMonitor) ResetAgent(agentID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	kept := sm.events[:0]
+	for _, e := range sm.events {
+		if e.AgentID != agentID {
+			kept = append(kept, e)
+		}
+	}
+	clear(sm.events[len(kept):])
+	sm.events = kept
+	prefix := agentID + ":"
+	for key := range sm.seen {
+		if strings.HasPrefix(key, prefix) {
+			delete(sm.seen, key)
+		}
+	}
+	delete(sm.escalated, agentID)
+}
+
 func (sm *SecurityMonitor) getEventsForAgent(agentID string) []agent.SecurityEvent {
 	var result []agent.SecurityEvent
 	for _, e := range sm.events {
@@ -447,6 +1291,45 @@ func (sm *SecurityMonitor) isAllowedRegistry(cmdLower string) bool {
 	return false
 }
 
+// isLocalAddr reports whether addr ("host:port") points at a loopback or
+// link-local address, including the "localhost" name lsof may print.
+func isLocalAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if i := strings.IndexByte(host, '%'); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast()
+}
+
+// cgnatNet is the RFC 6598 shared address space, which is not routable on
+// the public internet either.
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicAddr reports whether addr ("host:port") is a literal IP outside
+// private (RFC 1918, RFC 4193, CGNAT), loopback, link-local and multicast
+// ranges. Host names are not resolved and report false.
+func isPublicAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !cgnatNet.Contains(ip)
+}
+
 func isUnusualPort(addr string) bool {
 	commonPorts := map[string]bool{
 		"80": true, "443": true, "8080": true, "8443": true,
@@ -0,0 +1,68 @@
+//go:build unix
+
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// holdFIFO creates a FIFO at path and waits until CheckAgent has opened it
+// for reading. The returned writer keeps the reader blocked until closed.
+func holdFIFO(t *testing.T, path string, check func()) (writer *os.File, done <-chan struct{}) {
+	t.Helper()
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	ch := make(chan struct{})
+	go func() {
+		check()
+		close(ch)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// A non-blocking open for writing fails until a reader has the FIFO open.
+		f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err == nil {
+			return f, ch
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("FIFO was never opened for reading: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// assertNotLocked fails if GetEvents blocks, i.e. sm.mu is held.
+func assertNotLocked(t *testing.T, sm *SecurityMonitor) {
+	t.Helper()
+	got := make(chan struct{})
+	go func() {
+		sm.GetEvents()
+		close(got)
+	}()
+	select {
+	case <-got:
+	case <-time.After(2 * time.Second):
+		t.Error("GetEvents blocked while CheckAgent was reading a file")
+	}
+}
+
+func TestCheckAgent_MassRewriteReadsWithoutLock(t *testing.T) {
+	cfg := newTestSecurityConfig()
+	cfg.MassRewriteThreshold = 1
+	sm := NewSecurityMonitor(cfg)
+	inst := newTestInstance("test")
+	path := filepath.Join(t.TempDir(), "doc.txt")
+	inst.FileOps = []agent.FileOperation{{Timestamp: time.Now(), Path: path, Op: "MODIFY"}}
+
+	w, done := holdFIFO(t, path, func() { sm.CheckAgent(inst) })
+	assertNotLocked(t, sm)
+	w.Close()
+	<-done
+}
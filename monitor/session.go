@@ -11,6 +11,12 @@ import (
 type SessionMonitor struct {
 	mu       sync.Mutex
 	sessions map[string]*sessionState // agentID -> state
+
+	// CPU% above which an agent is considered active
+	cpuThreshold float64
+	// Count recent token, terminal and file activity as active
+	activitySignals bool
+	now             func() time.Time
 }
 
 type sessionState struct {
@@ -22,22 +28,56 @@ type sessionState struct {
 	lastCheck    time.Time
 }
 
-const cpuActiveThreshold = 0.5 // CPU% above which agent is considered "active"
+const cpuActiveThreshold = 0.5 // default CPU% above which agent is considered "active"
 
 // NewSessionMonitor creates a new session monitor.
 func NewSessionMonitor() *SessionMonitor {
+	return NewSessionMonitorWithThreshold(cpuActiveThreshold)
+}
+
+// NewSessionMonitorWithThreshold creates a session monitor that counts an
+// agent as active while its CPU% is above cpu. A negative cpu selects the
+// default of 0.5.
+func NewSessionMonitorWithThreshold(cpu float64) *SessionMonitor {
+	if cpu < 0 {
+		cpu = cpuActiveThreshold
+	}
 	return &SessionMonitor{
-		sessions: make(map[string]*sessionState),
+		sessions:     make(map[string]*sessionState),
+		cpuThreshold: cpu,
+		now:          time.Now,
 	}
 }
 
+// SetCPUThreshold sets the CPU% above which an agent is counted as active.
+// A negative value restores the default.
+func (sm *SessionMonitor) SetCPUThreshold(cpu float64) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if cpu < 0 {
+		cpu = cpuActiveThreshold
+	}
+	sm.cpuThreshold = cpu
+}
+
+// SetActivitySignals makes Collect also count an agent as active when it
+// made a model request, ran a terminal command or touched a file within the
+// last two minutes, whatever its CPU. This keeps agents that wait on I/O
+// from being booked as idle. Run the token, terminal and filesystem
+// monitors before Collect so the signals are current. Off by default.
+func (sm *SessionMonitor) SetActivitySignals(enabled bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.activitySignals = enabled
+}
+
 // Collect updates session metrics for an agent.
 func (sm *SessionMonitor) Collect(a *agent.Instance) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
 	id := a.Info.ID
-	now := time.Now()
+	now := sm.clock()
 
 	s, exists := sm.sessions[id]
 	if !exists {
@@ -55,8 +95,14 @@ func (sm *SessionMonitor) Collect(a *agent.Instance) {
 		delta = 2 * time.Second // Cap at refresh interval if gap is too large
 	}
 
-	// Update active/idle time based on CPU usage
-	if a.CPU > cpuActiveThreshold {
+	// Update active/idle time based on CPU usage, and optionally on recent
+	// progress
+	active := a.CPU > sm.cpuThreshold
+	if !active && sm.activitySignals {
+		last := lastProgressAt(*a)
+		active = !last.IsZero() && now.Sub(last) <= activityWindow
+	}
+	if active {
 		s.activeTime += delta
 		s.lastActiveAt = now
 	} else {
@@ -73,6 +119,32 @@ func (sm *SessionMonitor) Collect(a *agent.Instance) {
 	a.Session.LastActiveAt = s.lastActiveAt
 }
 
+// GetSession returns a snapshot of the session tracked for agentID, with
+// Uptime measured to now, and whether one exists. Unlike Collect it does not
+// advance the active and idle counters.
+func (sm *SessionMonitor) GetSession(agentID string) (agent.SessionMetrics, bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	s, ok := sm.sessions[agentID]
+	if !ok {
+		return agent.SessionMetrics{}, false
+	}
+	return agent.SessionMetrics{
+		StartedAt:    s.startedAt,
+		Uptime:       sm.clock().Sub(s.startedAt),
+		ActiveTime:   s.activeTime,
+		IdleTime:     s.idleTime,
+		LastActiveAt: s.lastActiveAt,
+	}, true
+}
+
+func (sm *SessionMonitor) clock() time.Time {
+	if sm.now != nil {
+		return sm.now()
+	}
+	return time.Now()
+}
+
 // Reset clears session data for an agent that has stopped.
 func (sm *SessionMonitor) Reset(agentID string) {
 	sm.mu.Lock()
@@ -80,6 +152,70 @@ func (sm *SessionMonitor) Reset(agentID string) {
 	delete(sm.sessions, agentID)
 }
 
+// activityWindow is how recent a token request, terminal command or file
+// operation must be to count as progress.
+const activityWindow = 2 * time.Minute
+
+// ClassifyActivity derives what a running agent is doing at now from its CPU,
+// token rate and the recency of model requests, terminal commands and file
+// operations. Any recent progress means working. Without it, an agent using
+// CPU above the monitor's threshold is stalled if it has shown progress
+// before and working if it never has (nothing is observable for it);
+// otherwise it is idle.
+func (sm *SessionMonitor) ClassifyActivity(a agent.Instance, now time.Time) agent.ActivityState {
+	sm.mu.Lock()
+	cpuThreshold := sm.cpuThreshold
+	sm.mu.Unlock()
+	return classifyActivity(a, now, cpuThreshold)
+}
+
+func classifyActivity(a agent.Instance, now time.Time, cpuThreshold float64) agent.ActivityState {
+	last := lastProgressAt(a)
+	if a.Tokens.TokensPerSec > 0 || (!last.IsZero() && now.Sub(last) <= activityWindow) {
+		return agent.ActivityWorking
+	}
+	if a.CPU > cpuThreshold {
+		if last.IsZero() {
+			return agent.ActivityWorking
+		}
+		return agent.ActivityStalled
+	}
+	return agent.ActivityIdle
+}
+
+// lastProgressAt returns the time of a's most recent model request,
+// terminal command or file operation, or zero if none is known.
+func lastProgressAt(a agent.Instance) time.Time {
+	last := a.Tokens.LastRequestAt
+	for _, c := range a.Terminal.RecentCommands {
+		if c.Timestamp.After(last) {
+			last = c.Timestamp
+		}
+	}
+	for _, op := range a.FileOps {
+		if op.Timestamp.After(last) {
+			last = op.Timestamp
+		}
+	}
+	return last
+}
+
+// ApplyActivity sets a.Activity from [SessionMonitor.ClassifyActivity] and
+// moves a running agent to StatusIdle when it is idle, or back to
+// StatusRunning otherwise. Call it after the other monitors have collected.
+// Stopped agents are left untouched.
+func (sm *SessionMonitor) ApplyActivity(a *agent.Instance, now time.Time) {
+	if a.Status == agent.StatusStopped {
+		return
+	}
+	a.Activity = sm.ClassifyActivity(*a, now)
+	if a.Activity == agent.ActivityIdle {
+		a.Status = agent.StatusIdle
+	} else {
+		a.Status = agent.StatusRunning
+	}
+}
+
 // FormatDuration formats a duration for human-readable display.
 // Returns "—" for zero/negative, "Xs" for seconds-only,
 // "Xm Xs" for minutes, or "Xh Xm" for hours.
@@ -95,6 +95,117 @@ func TestSessionMonitor_MultipleAgents(t *testing.T) {
 	sm.mu.Unlock()
 }
 
+func TestSessionMonitor_CPUThreshold(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	sm := NewSessionMonitorWithThreshold(10)
+	sm.now = func() time.Time { return clock }
+	inst := &agent.Instance{Info: agent.Info{ID: "test"}, CPU: 5}
+	sm.Collect(inst)
+	clock = clock.Add(2 * time.Second)
+	sm.Collect(inst)
+	if inst.Session.IdleTime != 2*time.Second || inst.Session.ActiveTime != 0 {
+		t.Errorf("5%% CPU under a 10%% threshold: active %v idle %v, want idle 2s",
+			inst.Session.ActiveTime, inst.Session.IdleTime)
+	}
+
+	sm.SetCPUThreshold(1)
+	clock = clock.Add(2 * time.Second)
+	sm.Collect(inst)
+	if inst.Session.ActiveTime != 2*time.Second {
+		t.Errorf("ActiveTime = %v after lowering threshold, want 2s", inst.Session.ActiveTime)
+	}
+
+	if got := NewSessionMonitorWithThreshold(-1).cpuThreshold; got != cpuActiveThreshold {
+		t.Errorf("negative threshold = %v, want default %v", got, cpuActiveThreshold)
+	}
+}
+
+func TestSessionMonitor_ActivitySignals(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	sm := NewSessionMonitor()
+	sm.SetActivitySignals(true)
+	sm.now = func() time.Time { return clock }
+
+	// Low CPU, but waiting on a test run it started a few seconds ago.
+	inst := &agent.Instance{
+		Info: agent.Info{ID: "test"},
+		CPU:  0.1,
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{
+			{Command: "go test ./...", Timestamp: clock.Add(-5 * time.Second)},
+		}},
+	}
+	sm.Collect(inst)
+	clock = clock.Add(2 * time.Second)
+	sm.Collect(inst)
+	if inst.Session.ActiveTime != 2*time.Second || inst.Session.IdleTime != 0 {
+		t.Errorf("active %v idle %v, want active 2s", inst.Session.ActiveTime, inst.Session.IdleTime)
+	}
+	if !inst.Session.LastActiveAt.Equal(clock) {
+		t.Errorf("LastActiveAt = %v, want %v", inst.Session.LastActiveAt, clock)
+	}
+
+	// Once the activity is older than the window the agent goes idle.
+	clock = clock.Add(activityWindow)
+	sm.Collect(inst)
+	clock = clock.Add(2 * time.Second)
+	sm.Collect(inst)
+	if inst.Session.IdleTime != 4*time.Second {
+		t.Errorf("IdleTime = %v, want 4s", inst.Session.IdleTime)
+	}
+
+	// Without the option, the same agent is idle on CPU alone.
+	plain := NewSessionMonitor()
+	plain.now = sm.now
+	fresh := *inst
+	fresh.Info.ID = "other"
+	fresh.FileOps = []agent.FileOperation{{Op: "MODIFY", Path: "main.go", Timestamp: clock}}
+	plain.Collect(&fresh)
+	clock = clock.Add(2 * time.Second)
+	plain.Collect(&fresh)
+	if fresh.Session.ActiveTime != 0 {
+		t.Errorf("ActiveTime = %v without activity signals, want 0", fresh.Session.ActiveTime)
+	}
+}
+
+func TestSessionMonitor_GetSession(t *testing.T) {
+	clock := time.Unix(1000, 0)
+	sm := NewSessionMonitor()
+	sm.now = func() time.Time { return clock }
+
+	if _, ok := sm.GetSession("missing"); ok {
+		t.Error("GetSession reported a session for an unknown agent")
+	}
+
+	inst := &agent.Instance{Info: agent.Info{ID: "test"}, CPU: 5}
+	sm.Collect(inst)
+	clock = clock.Add(2 * time.Second)
+	sm.Collect(inst)
+
+	clock = clock.Add(10 * time.Second)
+	got, ok := sm.GetSession("test")
+	if !ok {
+		t.Fatal("GetSession did not find a collected agent")
+	}
+	if !got.StartedAt.Equal(time.Unix(1000, 0)) || got.Uptime != 12*time.Second {
+		t.Errorf("StartedAt %v Uptime %v, want 1000 / 12s", got.StartedAt, got.Uptime)
+	}
+	if got.ActiveTime != 2*time.Second || got.IdleTime != 0 {
+		t.Errorf("active %v idle %v, want 2s / 0", got.ActiveTime, got.IdleTime)
+	}
+	if !got.LastActiveAt.Equal(time.Unix(1002, 0)) {
+		t.Errorf("LastActiveAt = %v, want 1002", got.LastActiveAt)
+	}
+	// Reading is side-effect free.
+	if again, _ := sm.GetSession("test"); again != got {
+		t.Errorf("second GetSession = %+v, want %+v", again, got)
+	}
+
+	sm.Reset("test")
+	if _, ok := sm.GetSession("test"); ok {
+		t.Error("GetSession found a session after Reset")
+	}
+}
+
 func TestFormatDuration(t *testing.T) {
 	tests := []struct {
 		d    time.Duration
@@ -140,3 +251,80 @@ func TestIntToStr(t *testing.T) {
 		}
 	}
 }
+
+func TestClassifyActivity(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	recent, old := now.Add(-30*time.Second), now.Add(-10*time.Minute)
+
+	tests := []struct {
+		name string
+		a    agent.Instance
+		want agent.ActivityState
+	}{
+		{"nothing", agent.Instance{}, agent.ActivityIdle},
+		{"cpu only, nothing observable", agent.Instance{CPU: 40}, agent.ActivityWorking},
+		{"streaming tokens", agent.Instance{Tokens: agent.TokenMetrics{TokensPerSec: 12}}, agent.ActivityWorking},
+		{"recent request", agent.Instance{Tokens: agent.TokenMetrics{LastRequestAt: recent}}, agent.ActivityWorking},
+		{"recent command", agent.Instance{Terminal: agent.TerminalActivity{
+			RecentCommands: []agent.TerminalCommand{{Command: "go test", Timestamp: recent}},
+		}}, agent.ActivityWorking},
+		{"recent file op", agent.Instance{FileOps: []agent.FileOperation{{Op: "MODIFY", Timestamp: recent}}}, agent.ActivityWorking},
+		{"old activity, quiet cpu", agent.Instance{CPU: 0.1, Tokens: agent.TokenMetrics{LastRequestAt: old}}, agent.ActivityIdle},
+		{"old activity, busy cpu", agent.Instance{CPU: 85, FileOps: []agent.FileOperation{{Op: "MODIFY", Timestamp: old}}}, agent.ActivityStalled},
+		{"old and recent mixed", agent.Instance{CPU: 85,
+			Tokens:  agent.TokenMetrics{LastRequestAt: old},
+			FileOps: []agent.FileOperation{{Op: "CREATE", Timestamp: recent}},
+		}, agent.ActivityWorking},
+	}
+	sm := NewSessionMonitor()
+	for _, tt := range tests {
+		if got := sm.ClassifyActivity(tt.a, now); got != tt.want {
+			t.Errorf("%s: ClassifyActivity = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyActivity_UsesMonitorThreshold(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	a := agent.Instance{CPU: 3}
+
+	sm := NewSessionMonitorWithThreshold(5)
+	if got := sm.ClassifyActivity(a, now); got != agent.ActivityIdle {
+		t.Errorf("CPU 3 with threshold 5: ClassifyActivity = %s, want idle", got)
+	}
+	sm.SetCPUThreshold(1)
+	if got := sm.ClassifyActivity(a, now); got != agent.ActivityWorking {
+		t.Errorf("CPU 3 with threshold 1: ClassifyActivity = %s, want working", got)
+	}
+
+	// Collect and ApplyActivity agree on what counts as active.
+	sm = NewSessionMonitorWithThreshold(5)
+	inst := &agent.Instance{Info: agent.Info{ID: "a"}, Status: agent.StatusRunning, CPU: 3}
+	sm.Collect(inst)
+	sm.ApplyActivity(inst, now)
+	if inst.Status != agent.StatusIdle {
+		t.Errorf("Status = %s, want idle below the monitor's threshold", inst.Status)
+	}
+}
+
+func TestApplyActivity(t *testing.T) {
+	now := time.Now()
+	sm := NewSessionMonitor()
+	a := &agent.Instance{Status: agent.StatusRunning}
+	sm.ApplyActivity(a, now)
+	if a.Status != agent.StatusIdle || a.Activity != agent.ActivityIdle {
+		t.Fatalf("quiet agent: Status=%s Activity=%s", a.Status, a.Activity)
+	}
+
+	a.Tokens.TokensPerSec = 5
+	sm.ApplyActivity(a, now)
+	if a.Status != agent.StatusRunning || a.Activity != agent.ActivityWorking {
+		t.Fatalf("busy agent: Status=%s Activity=%s", a.Status, a.Activity)
+	}
+
+	stopped := &agent.Instance{Status: agent.StatusStopped}
+	sm.ApplyActivity(stopped, now)
+	if stopped.Status != agent.StatusStopped || stopped.Activity != "" {
+		t.Errorf("stopped agent changed: %+v", stopped)
+	}
+}
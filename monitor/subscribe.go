@@ -0,0 +1,210 @@
+package monitor
+
+import (
+	"sync"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// DefaultSubscriptionBuffer is the channel capacity used when
+// SubscribeOptions.Buffer is not positive.
+const DefaultSubscriptionBuffer = 64
+
+// DropPolicy decides what a subscription discards when its buffer is full.
+type DropPolicy int
+
+const (
+	// DropOldest discards the oldest buffered item to make room, so the
+	// consumer always sees the most recent activity.
+	DropOldest DropPolicy = iota
+	// DropNewest discards the item being published and keeps the backlog.
+	DropNewest
+)
+
+// SubscribeOptions configures a subscription channel.
+type SubscribeOptions struct {
+	Buffer int
+	Drop   DropPolicy
+}
+
+// BackpressureState describes how far behind a subscriber is. Delivered
+// counts items accepted into the buffer; under DropOldest some of them may
+// later be discarded and are then also counted in Dropped.
+type BackpressureState struct {
+	Buffered  int    `json:"buffered"`
+	Capacity  int    `json:"capacity"`
+	Dropped   uint64 `json:"dropped"`
+	Delivered uint64 `json:"delivered"`
+}
+
+// Full reports whether the next publish will drop an item.
+func (b BackpressureState) Full() bool {
+	return b.Buffered >= b.Capacity
+}
+
+// Subscription delivers items from a monitor on a buffered channel.
+// Publishing never blocks: when the buffer is full an item is dropped
+// according to the subscription's DropPolicy and counted in Dropped.
+type Subscription[T any] struct {
+	mu        sync.Mutex
+	ch        chan T
+	policy    DropPolicy
+	dropped   uint64
+	delivered uint64
+	closed    bool
+	cancel    func()
+}
+
+func newSubscription[T any](opts SubscribeOptions) *Subscription[T] {
+	size := opts.Buffer
+	if size <= 0 {
+		size = DefaultSubscriptionBuffer
+	}
+	return &Subscription[T]{ch: make(chan T, size), policy: opts.Drop}
+}
+
+// C returns the channel items are delivered on. It is closed by Close.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Dropped returns how many items were discarded because the buffer was full.
+func (s *Subscription[T]) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Backpressure returns the subscription's current buffer usage and counters.
+func (s *Subscription[T]) Backpressure() BackpressureState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return BackpressureState{
+		Buffered:  len(s.ch),
+		Capacity:  cap(s.ch),
+		Dropped:   s.dropped,
+		Delivered: s.delivered,
+	}
+}
+
+// Close detaches the subscription from its monitor and closes C. It is safe
+// to call more than once.
+func (s *Subscription[T]) Close() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+}
+
+func (s *Subscription[T]) publish(v T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.ch <- v:
+		s.delivered++
+		return
+	default:
+	}
+	s.dropped++
+	if s.policy == DropNewest {
+		return
+	}
+	// Make room by discarding the oldest item. The consumer may have
+	// drained one in the meantime, in which case nothing is discarded
+	// here, but the count above still records the pressure.
+	select {
+	case <-s.ch:
+	default:
+	}
+	select {
+	case s.ch <- v:
+		s.delivered++
+	default:
+	}
+}
+
+// subscribers is the set of subscriptions a monitor publishes to. It is
+// guarded by the owning monitor's mutex.
+type subscribers[T any] struct {
+	subs []*Subscription[T]
+}
+
+func (ss *subscribers[T]) add(s *Subscription[T]) {
+	ss.subs = append(ss.subs, s)
+}
+
+func (ss *subscribers[T]) remove(s *Subscription[T]) {
+	for i, sub := range ss.subs {
+		if sub == s {
+			ss.subs = append(ss.subs[:i], ss.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (ss *subscribers[T]) publish(v T) {
+	for _, s := range ss.subs {
+		s.publish(v)
+	}
+}
+
+func (ss *subscribers[T]) backpressure() []BackpressureState {
+	out := make([]BackpressureState, len(ss.subs))
+	for i, s := range ss.subs {
+		out[i] = s.Backpressure()
+	}
+	return out
+}
+
+// Subscribe returns a subscription that receives every alert added from now
+// on. Call Close on it when done.
+func (am *AlertMonitor) Subscribe(opts SubscribeOptions) *Subscription[agent.Alert] {
+	s := newSubscription[agent.Alert](opts)
+	s.cancel = func() {
+		am.mu.Lock()
+		defer am.mu.Unlock()
+		am.subs.remove(s)
+	}
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.subs.add(s)
+	return s
+}
+
+// SubscriberBackpressure returns the state of every alert subscription.
+func (am *AlertMonitor) SubscriberBackpressure() []BackpressureState {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	return am.subs.backpressure()
+}
+
+// Subscribe returns a subscription that receives every security event
+// recorded from now on. Call Close on it when done.
+func (sm *SecurityMonitor) Subscribe(opts SubscribeOptions) *Subscription[agent.SecurityEvent] {
+	s := newSubscription[agent.SecurityEvent](opts)
+	s.cancel = func() {
+		sm.mu.Lock()
+		defer sm.mu.Unlock()
+		sm.subs.remove(s)
+	}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.subs.add(s)
+	return s
+}
+
+// SubscriberBackpressure returns the state of every security event
+// subscription.
+func (sm *SecurityMonitor) SubscriberBackpressure() []BackpressureState {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.subs.backpressure()
+}
@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+func TestSubscription_DropOldest(t *testing.T) {
+	s := newSubscription[int](SubscribeOptions{Buffer: 3, Drop: DropOldest})
+	for i := 1; i <= 5; i++ {
+		s.publish(i)
+	}
+	if got := s.Dropped(); got != 2 {
+		t.Fatalf("Dropped = %d, want 2", got)
+	}
+	bp := s.Backpressure()
+	if bp.Buffered != 3 || bp.Capacity != 3 || !bp.Full() {
+		t.Errorf("Backpressure = %+v", bp)
+	}
+	s.Close()
+	var got []int
+	for v := range s.C() {
+		got = append(got, v)
+	}
+	if fmt.Sprint(got) != "[3 4 5]" {
+		t.Errorf("received %v, want the newest [3 4 5]", got)
+	}
+}
+
+func TestSubscription_DropNewest(t *testing.T) {
+	s := newSubscription[int](SubscribeOptions{Buffer: 3, Drop: DropNewest})
+	for i := 1; i <= 5; i++ {
+		s.publish(i)
+	}
+	if got := s.Dropped(); got != 2 {
+		t.Fatalf("Dropped = %d, want 2", got)
+	}
+	s.Close()
+	var got []int
+	for v := range s.C() {
+		got = append(got, v)
+	}
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("received %v, want the oldest [1 2 3]", got)
+	}
+}
+
+func TestSubscription_DefaultBufferAndClose(t *testing.T) {
+	s := newSubscription[int](SubscribeOptions{})
+	if cap(s.C()) != DefaultSubscriptionBuffer {
+		t.Errorf("capacity = %d, want %d", cap(s.C()), DefaultSubscriptionBuffer)
+	}
+	s.Close()
+	s.Close()
+	s.publish(1) // must not panic on a closed channel
+	if _, ok := <-s.C(); ok {
+		t.Error("channel should be closed")
+	}
+}
+
+func TestAlertMonitor_SubscribeSlowConsumer(t *testing.T) {
+	am := NewAlertMonitor(DefaultThresholds())
+	sub := am.Subscribe(SubscribeOptions{Buffer: 2, Drop: DropOldest})
+	defer sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			am.Check(&agent.Instance{Info: agent.Info{ID: fmt.Sprintf("a%d", i)}, CPU: 99})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Check blocked on a subscriber that is not reading")
+	}
+
+	bp := am.SubscriberBackpressure()
+	if len(bp) != 1 || bp[0].Dropped != 8 || bp[0].Buffered != 2 {
+		t.Fatalf("SubscriberBackpressure = %+v", bp)
+	}
+	if al := <-sub.C(); al.AgentID != "a8" {
+		t.Errorf("oldest buffered alert from %s, want a8", al.AgentID)
+	}
+
+	sub.Close()
+	if len(am.SubscriberBackpressure()) != 0 {
+		t.Error("Close should detach the subscription")
+	}
+	am.Check(&agent.Instance{Info: agent.Info{ID: "late"}, CPU: 99})
+}
+
+func TestSecurityMonitor_Subscribe(t *testing.T) {
+	sm := NewSecurityMonitor(newTestSecurityConfig())
+	sub := sm.Subscribe(SubscribeOptions{Buffer: 8})
+	defer sub.Close()
+
+	inst := newTestInstance("sub")
+	inst.Terminal.RecentCommands = []agent.TerminalCommand{{Command: "rm -rf /", Timestamp: time.Now()}}
+	sm.CheckAgent(inst)
+
+	select {
+	case e := <-sub.C():
+		if e.AgentID != "sub" || e.Category != agent.SecCatDangerousCommand {
+			t.Errorf("event = %+v", e)
+		}
+	default:
+		t.Fatal("expected an event on the subscription")
+	}
+	if sub.Dropped() != 0 {
+		t.Errorf("Dropped = %d, want 0", sub.Dropped())
+	}
+}
@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const supervisorErrCollect = "collect"
+
+// Supervisor defaults, used when the SupervisorOptions field is not positive.
+const (
+	defaultSupervisorInterval   = 2 * time.Second
+	defaultSupervisorMinBackoff = time.Second
+	defaultSupervisorMaxBackoff = time.Minute
+)
+
+// SupervisorOptions configures a Supervisor. Every field is optional.
+//
+// Files, History, Push and Closers are the background components the
+// supervisor shuts down with the collection loop; the caller starts them.
+// Closers is typically the monitors' subscriptions.
+type SupervisorOptions struct {
+	Interval   time.Duration // between successful collection cycles
+	MinBackoff time.Duration // first retry delay after a failed cycle
+	MaxBackoff time.Duration // cap for the doubling retry delay
+
+	Files   *FileWatcher
+	History *HistoryStore
+	Push    *PushExporter
+	Closers []interface{ Close() }
+}
+
+// Supervisor runs a collection loop and owns the shutdown of the monitor's
+// background components, so one Stop leaves nothing running.
+//
+// Each cycle calls the collect function given to NewSupervisor. A cycle
+// that returns an error or panics is restarted after a backoff that starts
+// at MinBackoff and doubles up to MaxBackoff; a successful cycle resets the
+// backoff and the next one runs after Interval. Failures are recorded in
+// GetErrorStats under "collect".
+type Supervisor struct {
+	mu         sync.Mutex
+	collect    func(ctx context.Context) error
+	opts       SupervisorOptions
+	errorStats map[string]MonitorErrorStats
+	restarts   int
+	started    bool
+	cancel     context.CancelFunc
+	loopDone   chan struct{}
+	stopOnce   sync.Once
+	stopped    chan struct{} // closed when Stop's shutdown has finished
+}
+
+// NewSupervisor creates a supervisor that runs collect every cycle.
+func NewSupervisor(collect func(ctx context.Context) error, opts SupervisorOptions) *Supervisor {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultSupervisorInterval
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultSupervisorMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(defaultSupervisorMaxBackoff, opts.MinBackoff)
+	}
+	return &Supervisor{
+		collect:    collect,
+		opts:       opts,
+		errorStats: make(map[string]MonitorErrorStats),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Start runs the first cycle in the background and keeps cycling until
+// Stop. Only the first call has an effect; a stopped supervisor cannot be
+// restarted.
+func (s *Supervisor) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.loopDone = make(chan struct{})
+	go s.run(ctx, s.loopDone)
+}
+
+func (s *Supervisor) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	var backoff time.Duration
+	for {
+		err := s.cycle(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		wait := s.opts.Interval
+		if err != nil {
+			backoff = min(max(2*backoff, s.opts.MinBackoff), s.opts.MaxBackoff)
+			wait = backoff
+			s.mu.Lock()
+			s.restarts++
+			s.recordError(supervisorErrCollect, err)
+			s.mu.Unlock()
+		} else {
+			backoff = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// cycle runs collect once, turning a panic into an error.
+func (s *Supervisor) cycle(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("collect panicked: %v", r)
+		}
+	}()
+	return s.collect(ctx)
+}
+
+// Stop cancels the cycle in flight and waits for the loop to exit, then
+// stops the file watcher and push exporter, stops history auto-save (which
+// saves once more) and closes the Closers, in that order.
+//
+// Stop returns ctx.Err() if ctx is done first; the shutdown then carries
+// on in the background. Stop is idempotent: later calls wait for the same
+// shutdown and return nil once it has finished.
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		s.mu.Lock()
+		s.started = true // no Start after Stop
+		cancel, loopDone := s.cancel, s.loopDone
+		s.mu.Unlock()
+		go s.shutdown(cancel, loopDone)
+	})
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Supervisor) shutdown(cancel context.CancelFunc, loopDone chan struct{}) {
+	defer close(s.stopped)
+	if cancel != nil {
+		cancel()
+		<-loopDone
+	}
+	if s.opts.Files != nil {
+		s.opts.Files.Stop()
+	}
+	if s.opts.Push != nil {
+		s.opts.Push.Stop()
+	}
+	if s.opts.History != nil {
+		s.opts.History.StopAutoSave()
+	}
+	for _, c := range s.opts.Closers {
+		if c != nil {
+			c.Close()
+		}
+	}
+}
+
+// Restarts returns how many cycles failed and were retried after a backoff.
+func (s *Supervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+func (s *Supervisor) recordError(source string, err error) {
+	if err == nil {
+		return
+	}
+	stat := s.errorStats[source]
+	stat.Count++
+	stat.LastError = err.Error()
+	stat.LastAt = time.Now()
+	s.errorStats[source] = stat
+}
+
+// GetErrorStats returns a snapshot of operational errors per source.
+func (s *Supervisor) GetErrorStats() map[string]MonitorErrorStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]MonitorErrorStats, len(s.errorStats))
+	for k, v := range s.errorStats {
+		stats[k] = v
+	}
+	return stats
+}
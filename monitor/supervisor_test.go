@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+func TestSupervisor_RestartsWithBackoff(t *testing.T) {
+	var calls atomic.Int32
+	ok := make(chan struct{})
+	s := NewSupervisor(func(ctx context.Context) error {
+		switch n := calls.Add(1); {
+		case n == 1:
+			return errors.New("ps failed")
+		case n == 2:
+			panic("nil map")
+		case n == 3:
+			close(ok)
+		}
+		return nil
+	}, SupervisorOptions{Interval: time.Hour, MinBackoff: time.Millisecond, MaxBackoff: 4 * time.Millisecond})
+	s.Start()
+	defer s.Stop(context.Background())
+
+	select {
+	case <-ok:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("collect ran %d times, want a third run after two failures", calls.Load())
+	}
+	if got := s.Restarts(); got != 2 {
+		t.Errorf("Restarts = %d, want 2", got)
+	}
+	stat := s.GetErrorStats()["collect"]
+	if stat.Count != 2 || stat.LastError != "collect panicked: nil map" {
+		t.Errorf("collect error stats = %+v", stat)
+	}
+}
+
+func TestSupervisor_BackoffDoublesToMax(t *testing.T) {
+	var times []time.Time
+	done := make(chan struct{})
+	s := NewSupervisor(func(ctx context.Context) error {
+		times = append(times, time.Now())
+		if len(times) == 5 {
+			close(done)
+		}
+		if len(times) >= 5 {
+			<-ctx.Done()
+		}
+		return errors.New("down")
+	}, SupervisorOptions{MinBackoff: 10 * time.Millisecond, MaxBackoff: 40 * time.Millisecond})
+	s.Start()
+	<-done
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delays: 10ms, 20ms, 40ms, 40ms.
+	for i, want := range []time.Duration{10, 20, 40, 40} {
+		got := times[i+1].Sub(times[i])
+		if got < want*time.Millisecond {
+			t.Errorf("delay %d = %v, want at least %v", i+1, got, want*time.Millisecond)
+		}
+	}
+}
+
+func TestSupervisor_StopUnderLoadNoLeak(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 100; i++ {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.txt", i)), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := runtime.NumGoroutine()
+
+	fw := NewFileWatcher(1000)
+	fw.AddDir(dir)
+	fw.Start(time.Millisecond)
+	hs := NewHistoryStore(t.TempDir(), 100)
+	hs.StartAutoSave(time.Hour)
+	pe := NewPushExporter(config.PushConfig{URL: "http://127.0.0.1:1", Interval: config.Duration(time.Millisecond)})
+	pe.Start(func() agent.Snapshot { return agent.Snapshot{} })
+	sub := NewAlertMonitor(DefaultThresholds()).Subscribe(SubscribeOptions{})
+
+	inFlight := make(chan struct{}, 1)
+	s := NewSupervisor(func(ctx context.Context) error {
+		hs.Record([]agent.Instance{{Info: agent.Info{ID: "a"}}})
+		select {
+		case inFlight <- struct{}{}:
+		default:
+		}
+		<-ctx.Done() // a long collection, abandoned by Stop
+		return ctx.Err()
+	}, SupervisorOptions{Files: fw, History: hs, Push: pe, Closers: []interface{ Close() }{sub}})
+	s.Start()
+	s.Start() // no-op
+	<-inFlight
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatalf("Stop = %v", err)
+	}
+	if err := s.Stop(ctx); err != nil {
+		t.Errorf("second Stop = %v, want nil", err)
+	}
+
+	if _, open := <-sub.C(); open {
+		t.Error("subscription was not closed")
+	}
+	if _, err := os.Stat(filepath.Join(hs.dataDir, AutoSaveFile)); err != nil {
+		t.Errorf("history was not flushed: %v", err)
+	}
+	if n := waitGoroutines(before, 2*time.Second); n > before {
+		t.Errorf("goroutines = %d after Stop, want <= %d", n, before)
+	}
+}
+
+func TestSupervisor_StopDeadline(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s := NewSupervisor(func(ctx context.Context) error {
+		close(started)
+		<-release // ignores cancellation
+		return nil
+	}, SupervisorOptions{})
+	s.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop = %v, want deadline exceeded while collect is stuck", err)
+	}
+
+	close(release)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Errorf("Stop after collect returned = %v", err)
+	}
+}
+
+func TestSupervisor_StopNeverStarted(t *testing.T) {
+	s := NewSupervisor(func(context.Context) error { return nil }, SupervisorOptions{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Errorf("Stop = %v", err)
+	}
+	s.Start() // a stopped supervisor stays stopped
+	if err := s.Stop(ctx); err != nil {
+		t.Errorf("second Stop = %v", err)
+	}
+}
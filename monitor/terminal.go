@@ -2,6 +2,7 @@ package monitor
 
 import (
 	"os/exec"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +17,11 @@ type TerminalMonitor struct {
 	history    map[string][]agent.TerminalCommand // agentID -> commands
 	seenPIDs   map[int]bool                       // PIDs we've already seen
 	maxHistory int
+	dedup      bool
+
+	// Root of the proc filesystem read for child processes; empty means
+	// spawn pgrep and ps instead.
+	procRoot string
 }
 
 // NewTerminalMonitor creates a new terminal monitor.
@@ -23,11 +29,24 @@ func NewTerminalMonitor(maxHistory int) *TerminalMonitor {
 	if maxHistory <= 0 {
 		maxHistory = 50
 	}
-	return &TerminalMonitor{
+	tm := &TerminalMonitor{
 		history:    make(map[string][]agent.TerminalCommand),
 		seenPIDs:   make(map[int]bool),
 		maxHistory: maxHistory,
 	}
+	if runtime.GOOS == "linux" {
+		tm.procRoot = "/proc"
+	}
+	return tm
+}
+
+// SetDedup enables or disables folding a command that is identical to the
+// agent's previous one into that entry, incrementing its Count instead of
+// appending. It is off by default.
+func (tm *TerminalMonitor) SetDedup(enabled bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.dedup = enabled
 }
 
 // Collect detects terminal commands spawned by an agent process.
@@ -40,20 +59,34 @@ func (tm *TerminalMonitor) Collect(a *agent.Instance) {
 	}
 
 	// Find child processes that look like terminal commands
-	children := getChildProcesses(a.PID)
+	children := tm.childProcesses(a.PID)
 	for _, child := range children {
 		if tm.seenPIDs[child.pid] {
 			continue
 		}
 		tm.seenPIDs[child.pid] = true
 
+		started := child.started
+		if started.IsZero() {
+			started = time.Now()
+		}
 		cmd := agent.TerminalCommand{
 			Command:   child.cmd,
-			Timestamp: time.Now(),
+			Timestamp: started,
 			Category:  categorizeCommand(child.cmd),
+			Count:     1,
 		}
 
-		tm.history[a.Info.ID] = append(tm.history[a.Info.ID], cmd)
+		hist := tm.history[a.Info.ID]
+		if tm.dedup && len(hist) > 0 && hist[len(hist)-1].Command == cmd.Command {
+			last := &hist[len(hist)-1]
+			last.Count++
+			if cmd.Timestamp.After(last.Timestamp) {
+				last.Timestamp = cmd.Timestamp
+			}
+			continue
+		}
+		tm.history[a.Info.ID] = append(hist, cmd)
 
 		// Trim history
 		if len(tm.history[a.Info.ID]) > tm.maxHistory {
@@ -61,18 +94,31 @@ func (tm *TerminalMonitor) Collect(a *agent.Instance) {
 		}
 	}
 
-	// Populate the agent's terminal activity
+	// Populate the agent's terminal activity. Copy, since dedup updates
+	// entries in place.
 	cmds := tm.history[a.Info.ID]
-	a.Terminal.RecentCommands = cmds
+	a.Terminal.RecentCommands = append([]agent.TerminalCommand(nil), cmds...)
 	a.Terminal.TotalCommands = len(cmds)
 }
 
+// childProcesses lists the descendants of pid from /proc when available,
+// falling back to pgrep and ps.
+func (tm *TerminalMonitor) childProcesses(pid int) []childProcess {
+	if tm.procRoot != "" {
+		if children, err := procChildProcesses(tm.procRoot, pid); err == nil {
+			return children
+		}
+	}
+	return getChildProcesses(pid)
+}
+
 type childProcess struct {
-	pid int
-	cmd string
+	pid     int
+	cmd     string
+	started time.Time // zero if unknown
 }
 
-// getChildProcesses finds child processes of a given PID.
+// getChildProcesses finds child processes of a given PID using pgrep and ps.
 func getChildProcesses(parentPID int) []childProcess {
 	cmd := exec.Command("pgrep", "-P", strconv.Itoa(parentPID))
 	out, err := cmd.Output()
@@ -90,18 +136,18 @@ func getChildProcesses(parentPID int) []childProcess {
 			continue
 		}
 
-		cmdExec := exec.Command("ps", "-p", strconv.Itoa(childPID), "-o", "command=")
+		cmdExec := exec.Command("ps", "-p", strconv.Itoa(childPID), "-o", "lstart=", "-o", "command=")
 		cmdOut, err := cmdExec.Output()
 		if err != nil {
 			continue
 		}
 
-		cmdLine := strings.TrimSpace(string(cmdOut))
+		started, cmdLine := parsePSStartAndCommand(string(cmdOut))
 		if cmdLine == "" || isIgnoredProcess(cmdLine) {
 			continue
 		}
 
-		children = append(children, childProcess{pid: childPID, cmd: cmdLine})
+		children = append(children, childProcess{pid: childPID, cmd: cmdLine, started: started})
 
 		// Recursively find grandchildren
 		grandchildren := getChildProcesses(childPID)
@@ -111,6 +157,32 @@ func getChildProcesses(parentPID int) []childProcess {
 	return children
 }
 
+// psLstartLayout is the layout of ps's lstart column once runs of spaces
+// are collapsed, e.g. "Fri Oct 16 09:12:03 2026".
+const psLstartLayout = "Mon Jan 2 15:04:05 2006"
+
+// parsePSStartAndCommand splits a line of `ps -o lstart= -o command=` into
+// the process start time, in local time, and its command line. The start
+// time is zero if it cannot be parsed.
+func parsePSStartAndCommand(line string) (time.Time, string) {
+	line = strings.TrimSpace(line)
+	fields := strings.Fields(line)
+	if len(fields) < 5 {
+		return time.Time{}, line
+	}
+	started, err := time.ParseInLocation(psLstartLayout, strings.Join(fields[:5], " "), time.Local)
+	if err != nil {
+		return time.Time{}, line
+	}
+	// Drop the five date fields, keeping the command's own spacing.
+	rest := line
+	for i := 0; i < 5; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		rest = rest[strings.IndexAny(rest+" ", " \t"):]
+	}
+	return started, strings.TrimSpace(rest)
+}
+
 // CategorizeCommand returns the category of a terminal command.
 // Possible categories: "build", "test", "install", "git", "run",
 // "lint", "file", or "other".
@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/internal/procfs"
+)
+
+// procChildProcesses finds the descendants of parentPID by reading the
+// /proc tree under root, without spawning any processes. Children are
+// returned in the same order as getChildProcesses: each child followed by
+// its own descendants.
+func procChildProcesses(root string, parentPID int) ([]childProcess, error) {
+	pids, err := procfs.PIDs(root)
+	if err != nil {
+		return nil, err
+	}
+	kids := make(map[int][]int)
+	stats := make(map[int]procfs.Stat)
+	for _, pid := range pids {
+		st, err := procfs.ReadStat(root, pid)
+		if err != nil {
+			continue // exited while scanning
+		}
+		stats[pid] = st
+		kids[st.PPID] = append(kids[st.PPID], pid)
+	}
+	for _, pids := range kids {
+		sort.Ints(pids)
+	}
+
+	bootTime, _ := procfs.BootTime(root)
+
+	var children []childProcess
+	var walk func(pid int)
+	walk = func(pid int) {
+		for _, child := range kids[pid] {
+			cmdLine, err := procfs.ReadCmdline(root, child)
+			if err != nil || cmdLine == "" || isIgnoredProcess(cmdLine) {
+				continue
+			}
+			var started time.Time
+			if !bootTime.IsZero() {
+				ticks := stats[child].StartTicks
+				started = bootTime.Add(time.Duration(ticks) * time.Second / procfs.ClockTicks)
+			}
+			children = append(children, childProcess{pid: child, cmd: cmdLine, started: started})
+			walk(child)
+		}
+	}
+	walk(parentPID)
+	return children, nil
+}
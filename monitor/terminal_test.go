@@ -1,6 +1,15 @@
 package monitor
 
-import "testing"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
 
 func TestCategorizeCommand(t *testing.T) {
 	tests := []struct {
@@ -157,3 +166,176 @@ func TestCategorizeCommand_CaseInsensitive(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePSStartAndCommand(t *testing.T) {
+	started, cmd := parsePSStartAndCommand("Fri Oct  2 09:12:03 2026     go test  -run 'A B' ./...\n")
+	want := time.Date(2026, 10, 2, 9, 12, 3, 0, time.Local)
+	if !started.Equal(want) {
+		t.Errorf("started = %v, want %v", started, want)
+	}
+	if cmd != "go test  -run 'A B' ./..." {
+		t.Errorf("cmd = %q", cmd)
+	}
+
+	started, cmd = parsePSStartAndCommand("npm run build")
+	if !started.IsZero() || cmd != "npm run build" {
+		t.Errorf("unparseable start: got %v / %q, want zero / whole line", started, cmd)
+	}
+}
+
+func TestTerminalMonitor_CommandStartTime(t *testing.T) {
+	installFakeCommand(t, "pgrep", `[ "$2" = 100 ] && echo 200
+exit 0
+`)
+	installFakeCommand(t, "ps", `echo "Fri Oct 16 09:12:03 2026 cargo test --workspace"`)
+
+	tm := NewTerminalMonitor(10)
+	tm.procRoot = ""
+	a := &agent.Instance{Info: agent.Info{ID: "aider"}, PID: 100}
+	tm.Collect(a)
+	if len(a.Terminal.RecentCommands) != 1 {
+		t.Fatalf("RecentCommands = %+v, want 1", a.Terminal.RecentCommands)
+	}
+	got := a.Terminal.RecentCommands[0]
+	if got.Command != "cargo test --workspace" || got.Category != "test" {
+		t.Errorf("command = %q (%s), want cargo test --workspace (test)", got.Command, got.Category)
+	}
+	if want := time.Date(2026, 10, 16, 9, 12, 3, 0, time.Local); !got.Timestamp.Equal(want) {
+		t.Errorf("Timestamp = %v, want process start %v", got.Timestamp, want)
+	}
+}
+
+// writeProcFixture lays out a fake /proc with btime 1000000000 and one entry
+// per process. Start times are in clock ticks after boot.
+func writeProcFixture(t *testing.T, procs []struct {
+	pid, ppid int
+	start     int64
+	comm, cmd string
+}) string {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "stat"), []byte("cpu  1 2 3 4\nbtime 1000000000\nprocesses 42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range procs {
+		dir := filepath.Join(root, strconv.Itoa(p.pid))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		stat := fmt.Sprintf("%d (%s) S %d %d 0 0 -1 4194304 0 0 0 0 0 0 0 0 20 0 1 0 %d 0 0\n",
+			p.pid, p.comm, p.ppid, p.pid, p.start)
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(p.cmd), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestProcChildProcesses(t *testing.T) {
+	root := writeProcFixture(t, []struct {
+		pid, ppid int
+		start     int64
+		comm, cmd string
+	}{
+		{100, 1, 50, "node", "node\x00claude\x00"},
+		{210, 100, 1000, "go", "go\x00test\x00./...\x00"},
+		{212, 210, 1050, "go-build (vet)", "/usr/lib/go/pkg/tool/vet\x00-json\x00"},
+		{205, 100, 900, "bash", "/bin/bash\x00-c\x00npm run lint\x00"},
+		{300, 205, 950, "npm run (lint)", "npm\x00run\x00lint\x00"},
+		{211, 210, 1100, "kworker", ""},
+		{400, 1, 10, "sshd", "sshd\x00"},
+	})
+
+	got, err := procChildProcesses(root, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shells are ignored along with their descendants, as with pgrep/ps;
+	// kernel threads and unrelated processes never show up.
+	want := []childProcess{
+		{pid: 210, cmd: "go test ./...", started: time.Unix(1000000010, 0)},
+		{pid: 212, cmd: "/usr/lib/go/pkg/tool/vet -json", started: time.Unix(1000000010, 500000000)},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("children = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].pid != want[i].pid || got[i].cmd != want[i].cmd || !got[i].started.Equal(want[i].started) {
+			t.Errorf("children[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTerminalMonitor_CollectFromProc(t *testing.T) {
+	root := writeProcFixture(t, []struct {
+		pid, ppid int
+		start     int64
+		comm, cmd string
+	}{
+		{100, 1, 50, "node", "node\x00claude\x00"},
+		{210, 100, 1000, "cargo", "cargo\x00build\x00"},
+	})
+	tm := NewTerminalMonitor(10)
+	tm.procRoot = root
+	a := &agent.Instance{Info: agent.Info{ID: "claude-code"}, PID: 100}
+	tm.Collect(a)
+	if a.Terminal.TotalCommands != 1 {
+		t.Fatalf("TotalCommands = %d, want 1", a.Terminal.TotalCommands)
+	}
+	got := a.Terminal.RecentCommands[0]
+	if got.Command != "cargo build" || got.Category != "build" || !got.Timestamp.Equal(time.Unix(1000000010, 0)) {
+		t.Errorf("command = %+v", got)
+	}
+}
+
+func TestTerminalMonitor_Dedup(t *testing.T) {
+	procs := []struct {
+		pid, ppid int
+		start     int64
+		comm, cmd string
+	}{
+		{100, 1, 50, "node", "node\x00claude\x00"},
+		{210, 100, 1000, "go", "go\x00test\x00./...\x00"},
+	}
+	a := &agent.Instance{Info: agent.Info{ID: "claude-code"}, PID: 100}
+
+	tm := NewTerminalMonitor(10)
+	tm.SetDedup(true)
+	tm.procRoot = writeProcFixture(t, procs)
+	tm.Collect(a)
+	first := a.Terminal.RecentCommands
+
+	// Same command again, from a new process.
+	procs[1].pid, procs[1].start = 220, 2000
+	tm.procRoot = writeProcFixture(t, procs)
+	tm.Collect(a)
+
+	if a.Terminal.TotalCommands != 1 {
+		t.Fatalf("RecentCommands = %+v, want one entry", a.Terminal.RecentCommands)
+	}
+	got := a.Terminal.RecentCommands[0]
+	if got.Count != 2 {
+		t.Errorf("Count = %d, want 2", got.Count)
+	}
+	if !got.Timestamp.Equal(time.Unix(1000000020, 0)) {
+		t.Errorf("Timestamp = %v, want latest run", got.Timestamp)
+	}
+	if first[0].Count != 1 {
+		t.Errorf("earlier result mutated: Count = %d", first[0].Count)
+	}
+
+	// Without dedup each run is its own entry.
+	plain := NewTerminalMonitor(10)
+	b := &agent.Instance{Info: agent.Info{ID: "claude-code"}, PID: 100}
+	for _, pid := range []int{230, 231} {
+		procs[1].pid = pid
+		plain.procRoot = writeProcFixture(t, procs)
+		plain.Collect(b)
+	}
+	if b.Terminal.TotalCommands != 2 {
+		t.Errorf("without dedup TotalCommands = %d, want 2", b.Terminal.TotalCommands)
+	}
+}
@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// TimelineKind identifies the source of a TimelineEntry.
+type TimelineKind string
+
+const (
+	TimelineCommand  TimelineKind = "command"
+	TimelineFileOp   TimelineKind = "file"
+	TimelineCommit   TimelineKind = "commit"
+	TimelineTokens   TimelineKind = "tokens"
+	TimelineAlert    TimelineKind = "alert"
+	TimelineSecurity TimelineKind = "security"
+)
+
+// TimelineEntry is one item in an agent's activity timeline. Level holds the
+// alert level or security severity and is empty for other kinds.
+type TimelineEntry struct {
+	Timestamp time.Time    `json:"timestamp"`
+	Kind      TimelineKind `json:"kind"`
+	Summary   string       `json:"summary"`
+	Detail    string       `json:"detail,omitempty"`
+	Level     string       `json:"level,omitempty"`
+}
+
+// TimelineSources lists where Timeline reads activity from. Every field is
+// optional. Agent data comes from Snapshot; token activity is limited to the
+// most recent request, since per-request history is not kept.
+type TimelineSources struct {
+	Snapshot *agent.Snapshot
+	Alerts   *AlertMonitor
+	Security *SecurityMonitor
+}
+
+// Timeline merges terminal commands, file operations, git commits, token
+// requests, alerts and security events for agentID into one list sorted by
+// time. Entries outside [from, to] are dropped; a zero from or to leaves
+// that end open.
+func (s TimelineSources) Timeline(agentID string, from, to time.Time) []TimelineEntry {
+	var entries []TimelineEntry
+	add := func(e TimelineEntry) {
+		if e.Timestamp.IsZero() ||
+			(!from.IsZero() && e.Timestamp.Before(from)) ||
+			(!to.IsZero() && e.Timestamp.After(to)) {
+			return
+		}
+		entries = append(entries, e)
+	}
+
+	if s.Snapshot != nil {
+		for i := range s.Snapshot.Agents {
+			a := &s.Snapshot.Agents[i]
+			if a.Info.ID != agentID {
+				continue
+			}
+			for _, c := range a.Terminal.RecentCommands {
+				add(TimelineEntry{Timestamp: c.Timestamp, Kind: TimelineCommand, Summary: c.Command, Detail: c.Category})
+			}
+			for _, op := range a.FileOps {
+				add(TimelineEntry{Timestamp: op.Timestamp, Kind: TimelineFileOp, Summary: op.Op + " " + op.Path})
+			}
+			for _, c := range a.Git.RecentCommits {
+				add(TimelineEntry{Timestamp: c.Time, Kind: TimelineCommit, Summary: c.Message, Detail: c.Hash})
+			}
+			if t := a.Tokens; !t.LastRequestAt.IsZero() {
+				add(TimelineEntry{
+					Timestamp: t.LastRequestAt,
+					Kind:      TimelineTokens,
+					Summary:   fmt.Sprintf("Request #%d (%s tokens total)", t.RequestCount, FormatTokenCount(t.TotalTokens)),
+					Detail:    t.LastModel,
+				})
+			}
+		}
+	}
+	if s.Alerts != nil {
+		for _, al := range s.Alerts.GetAlerts() {
+			if al.AgentID == agentID {
+				add(TimelineEntry{Timestamp: al.Timestamp, Kind: TimelineAlert, Summary: al.Message, Level: string(al.Level)})
+			}
+		}
+	}
+	if s.Security != nil {
+		for _, e := range s.Security.GetEvents() {
+			if e.AgentID == agentID {
+				add(TimelineEntry{
+					Timestamp: e.Timestamp,
+					Kind:      TimelineSecurity,
+					Summary:   e.Description,
+					Detail:    e.Detail,
+					Level:     string(e.Severity),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	return entries
+}
@@ -0,0 +1,107 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+	"github.com/Rafiki81/libagentmetrics/config"
+)
+
+func TestTimeline_MergesSourcesInOrder(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	at := func(min int) time.Time { return base.Add(time.Duration(min) * time.Minute) }
+
+	a := agent.Instance{
+		Info: agent.Info{ID: "claude-code", Name: "Claude Code"},
+		CPU:  99,
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{
+			{Command: "go test ./...", Timestamp: at(1), Category: "test"},
+			{Command: "git commit -m fix", Timestamp: at(6), Category: "git"},
+		}},
+		FileOps: []agent.FileOperation{{Path: "main.go", Op: "MODIFY", Timestamp: at(3)}},
+		Git: agent.GitActivity{RecentCommits: []agent.GitCommit{
+			{Hash: "abc1234", Message: "fix", Time: at(7)},
+		}},
+		Tokens: agent.TokenMetrics{LastRequestAt: at(2), RequestCount: 4, TotalTokens: 1500, LastModel: "claude-sonnet-4"},
+	}
+	other := agent.Instance{
+		Info:     agent.Info{ID: "cursor"},
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{{Command: "ls", Timestamp: at(1)}}},
+	}
+	snap := &agent.Snapshot{Timestamp: at(10), Agents: []agent.Instance{other, a}}
+
+	am := NewAlertMonitor(DefaultThresholds())
+	am.now = func() time.Time { return at(4) }
+	am.Check(&a)
+	am.Check(&other)
+
+	sm := NewSecurityMonitor(config.DefaultConfig().Security)
+	sm.now = func() time.Time { return at(5) }
+	sm.CheckAgent(&agent.Instance{
+		Info:     agent.Info{ID: "claude-code"},
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{{Command: "rm -rf /"}}},
+	})
+
+	src := TimelineSources{Snapshot: snap, Alerts: am, Security: sm}
+	entries := src.Timeline("claude-code", time.Time{}, time.Time{})
+
+	wantKinds := []TimelineKind{
+		TimelineCommand, TimelineTokens, TimelineFileOp, TimelineAlert,
+		TimelineSecurity, TimelineCommand, TimelineCommit,
+	}
+	if len(entries) < len(wantKinds) {
+		t.Fatalf("got %d entries, want at least %d: %+v", len(entries), len(wantKinds), entries)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].Timestamp.Before(entries[i-1].Timestamp) {
+			t.Fatalf("entries out of order at %d: %+v", i, entries)
+		}
+	}
+	// Security rules may raise more than one event for the same command;
+	// compare the distinct sequence of kinds.
+	var kinds []TimelineKind
+	for _, e := range entries {
+		if n := len(kinds); n == 0 || kinds[n-1] != e.Kind {
+			kinds = append(kinds, e.Kind)
+		}
+	}
+	if len(kinds) != len(wantKinds) {
+		t.Fatalf("kinds = %v, want %v", kinds, wantKinds)
+	}
+	for i := range kinds {
+		if kinds[i] != wantKinds[i] {
+			t.Fatalf("kinds = %v, want %v", kinds, wantKinds)
+		}
+	}
+	if e := entries[3]; e.Level != string(agent.AlertCritical) || e.Summary != "Critical CPU: 99.0%" {
+		t.Errorf("alert entry = %+v", e)
+	}
+	if e := entries[1]; e.Detail != "claude-sonnet-4" {
+		t.Errorf("tokens entry = %+v", e)
+	}
+}
+
+func TestTimeline_Range(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	var cmds []agent.TerminalCommand
+	for i := 0; i < 5; i++ {
+		cmds = append(cmds, agent.TerminalCommand{Command: "make", Timestamp: base.Add(time.Duration(i) * time.Minute)})
+	}
+	snap := &agent.Snapshot{Agents: []agent.Instance{{
+		Info:     agent.Info{ID: "a1"},
+		Terminal: agent.TerminalActivity{RecentCommands: cmds},
+	}}}
+	src := TimelineSources{Snapshot: snap}
+
+	got := src.Timeline("a1", base.Add(time.Minute), base.Add(3*time.Minute))
+	if len(got) != 3 || !got[0].Timestamp.Equal(base.Add(time.Minute)) {
+		t.Errorf("bounded timeline = %+v, want minutes 1-3", got)
+	}
+	if got := src.Timeline("a1", base.Add(4*time.Minute), time.Time{}); len(got) != 1 {
+		t.Errorf("open-ended timeline has %d entries, want 1", len(got))
+	}
+	if got := src.Timeline("missing", time.Time{}, time.Time{}); len(got) != 0 {
+		t.Errorf("unknown agent timeline = %+v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"regexp"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model would see for a piece of text.
+//
+// The library ships an approximation ([HeuristicTokenizer]) so it keeps no
+// external dependencies. For exact counts, wrap a BPE implementation such as
+// tiktoken-go in a [TokenizerFunc] and install it with
+// TokenMonitor.SetTokenizer:
+//
+//	tm.SetTokenizer(monitor.TokenizerFunc(func(model, text string) int {
+//		enc, err := tiktoken.EncodingForModel(model)
+//		if err != nil {
+//			return monitor.HeuristicTokenizer{}.CountTokens(model, text)
+//		}
+//		return len(enc.Encode(text, nil, nil))
+//	}))
+type Tokenizer interface {
+	CountTokens(model, text string) int
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface.
+type TokenizerFunc func(model, text string) int
+
+// CountTokens calls f(model, text).
+func (f TokenizerFunc) CountTokens(model, text string) int {
+	return f(model, text)
+}
+
+// cl100kPieces splits text the way the cl100k_base pre-tokenizer does, minus
+// the whitespace lookahead RE2 cannot express.
+var cl100kPieces = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// HeuristicTokenizer approximates BPE tokenizers of the GPT-4 / Claude
+// generation without a vocabulary. Text is split with the cl100k_base
+// pre-tokenizer pattern; common words count as one token, long words and
+// camelCase identifiers as several, and symbol runs as one per three
+// characters. For English prose and shell commands this lands much closer
+// to the real count than bytes/4.
+type HeuristicTokenizer struct{}
+
+// CountTokens implements Tokenizer. The model is ignored.
+func (HeuristicTokenizer) CountTokens(_ string, text string) int {
+	n := 0
+	for _, piece := range cl100kPieces.FindAllString(text, -1) {
+		n += pieceTokens(piece)
+	}
+	return n
+}
+
+func pieceTokens(piece string) int {
+	letters, humps, other := 0, 0, 0
+	prevLower := false
+	for _, r := range piece {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+			if unicode.IsUpper(r) && prevLower {
+				humps++
+			}
+			prevLower = unicode.IsLower(r)
+			if r >= utf8.RuneSelf {
+				// Non-ASCII letters rarely merge; count bytes instead.
+				other += utf8.RuneLen(r) - 1
+			}
+		case unicode.IsSpace(r):
+		default:
+			other++
+		}
+	}
+	switch {
+	case letters > 0:
+		return 1 + (letters-1)/8 + humps + other/3
+	case other > 0:
+		return (other + 2) / 3
+	default:
+		return 1 // whitespace run
+	}
+}
+
+var defaultTokenizer Tokenizer = HeuristicTokenizer{}
+
+// CountTextTokens counts tokens in text with the built-in heuristic.
+func CountTextTokens(model, text string) int {
+	return defaultTokenizer.CountTokens(model, text)
+}
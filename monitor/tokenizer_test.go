@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rafiki81/libagentmetrics/agent"
+)
+
+// Reference counts are from tiktoken's cl100k_base encoding.
+func TestHeuristicTokenizer_KnownCounts(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello world", 2},
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"git status", 2},
+		{"1234567", 3},
+	}
+	var tok HeuristicTokenizer
+	for _, tt := range tests {
+		if got := tok.CountTokens("gpt-4o", tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHeuristicTokenizer_Identifiers(t *testing.T) {
+	var tok HeuristicTokenizer
+	if a, b := tok.CountTokens("", "username"), tok.CountTokens("", "getUserName"); b <= a {
+		t.Errorf("camelCase identifier counted %d, plain word %d; want more for camelCase", b, a)
+	}
+	long := strings.Repeat("a", 40)
+	if got := tok.CountTokens("", long); got < 4 {
+		t.Errorf("40-letter word = %d tokens, want >= 4", got)
+	}
+}
+
+func TestTokenMonitor_CountsCommandTokens(t *testing.T) {
+	tm := NewTokenMonitor()
+	var models []string
+	tm.SetTokenizer(TokenizerFunc(func(model, text string) int {
+		models = append(models, model)
+		return len(strings.Fields(text))
+	}))
+
+	t0 := time.Now()
+	a := agent.Instance{
+		Info: agent.Info{ID: "custom-agent"},
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{
+			{Command: "go test ./...", Timestamp: t0},
+			{Command: "git diff --stat", Timestamp: t0},
+		}},
+	}
+	agents := []agent.Instance{a}
+	tm.Collect(agents)
+	if got := agents[0].Tokens.InputTokens; got != 6 {
+		t.Fatalf("InputTokens = %d, want 6", got)
+	}
+	if agents[0].Tokens.Source != agent.TokenSourceEstimated {
+		t.Errorf("Source = %q, want estimated", agents[0].Tokens.Source)
+	}
+
+	// Already counted commands are not counted again; new ones are.
+	a.Terminal.RecentCommands = append(a.Terminal.RecentCommands,
+		agent.TerminalCommand{Command: "make lint", Timestamp: t0.Add(time.Second)})
+	agents = []agent.Instance{a}
+	tm.Collect(agents)
+	if got := agents[0].Tokens.InputTokens; got != 8 {
+		t.Errorf("InputTokens after second collect = %d, want 8", got)
+	}
+	if len(models) != 3 {
+		t.Errorf("tokenizer called %d times, want 3", len(models))
+	}
+
+	tm.SetTokenizer(nil)
+	if got := tm.CountTokens("", "hello world"); got != 2 {
+		t.Errorf("CountTokens with default tokenizer = %d, want 2", got)
+	}
+}
+
+func TestTokenMonitor_NetworkSourceOverridesCommandTokens(t *testing.T) {
+	var total int64
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(t.TempDir())
+	tm.networkBytes = func(pid int) (int64, error) {
+		total += 40_000
+		return total, nil
+	}
+	agents := []agent.Instance{{
+		Info: agent.Info{ID: "custom-agent"},
+		PID:  4242,
+		Terminal: agent.TerminalActivity{RecentCommands: []agent.TerminalCommand{
+			{Command: "go test ./...", Timestamp: time.Now()},
+		}},
+	}}
+
+	// Only command tokens so far: the first sample sets the byte baseline.
+	tm.Collect(agents)
+	if got := agents[0].Tokens.Source; got != agent.TokenSourceEstimated {
+		t.Fatalf("Source = %q, want estimated", got)
+	}
+	tm.Collect(agents)
+	if got := agents[0].Tokens.Source; got != agent.TokenSourceNetwork {
+		t.Errorf("Source = %q, want network once traffic is counted", got)
+	}
+}
@@ -5,10 +5,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -30,6 +32,8 @@ const (
 	tokenErrClaudeJSONL = "claude_jsonl"
 	tokenErrCursorDB    = "cursor_db"
 	tokenErrAiderLog    = "aider_log"
+	tokenErrGeminiLog   = "gemini_log"
+	tokenErrCodexLog    = "codex_log"
 	tokenErrNetwork     = "network"
 )
 
@@ -57,12 +61,45 @@ type TokenMonitor struct {
 	copilotLogSeen map[string]time.Time
 	claudeLogSeen  map[string]time.Time
 	aiderLogSeen   map[string]time.Time
+	// Gemini: usage totals already counted per session file
+	geminiFiles    map[string]fileUsage
+	geminiFileSeen map[string]time.Time
+	// Codex: read offsets and last model per session file
+	codexLogOffsets map[string]int64
+	codexLogModel   map[string]string
+	codexLogSeen    map[string]time.Time
 	// Last seen timestamps for PID-based network state
 	prevBytesSeen map[int]time.Time
 	// Last state pruning time
 	lastPruneAt time.Time
+	// How long idle per-PID/per-path state is kept, and how often it is
+	// checked; zero means tokenStateTTL / tokenPruneCheckInterval
+	stateTTL      time.Duration
+	pruneInterval time.Duration
 	// Error observability state per source
 	errorStats map[string]MonitorErrorStats
+	// Optional history used to derive per-agent spend since midnight
+	history *HistoryStore
+	// Home directory to read agent logs from; empty means os.UserHomeDir
+	homeDir string
+	// Platform whose log layout is used; empty means runtime.GOOS
+	goos string
+	// Reads cumulative network bytes for a PID; nil means getNetworkBytesForPID
+	networkBytes func(pid int) (int64, error)
+	// Counts tokens in raw text; nil means HeuristicTokenizer
+	tokenizer Tokenizer
+	// Prices consulted before ModelPrices when estimating cost
+	prices map[string]ModelPricing
+	// Newest terminal command already counted per agent ID
+	termSeen map[string]time.Time
+	// Last PID seen per agent ID, to find its network state on Reset
+	agentPIDs map[string]int
+	// Per-model usage per agent ID, for collectors that see each request
+	models map[string]map[string]*agent.TokenMetrics
+	// Running token totals per agent ID within tokenRateWindow
+	rateSamples map[string][]tokenSample
+	// Clock used by Collect; nil means time.Now
+	now func() time.Time
 }
 
 func (tm *TokenMonitor) ensureInit() {
@@ -90,12 +127,52 @@ func (tm *TokenMonitor) ensureInit() {
 	if tm.aiderLogSeen == nil {
 		tm.aiderLogSeen = make(map[string]time.Time)
 	}
+	if tm.geminiFiles == nil {
+		tm.geminiFiles = make(map[string]fileUsage)
+	}
+	if tm.geminiFileSeen == nil {
+		tm.geminiFileSeen = make(map[string]time.Time)
+	}
+	if tm.codexLogOffsets == nil {
+		tm.codexLogOffsets = make(map[string]int64)
+	}
+	if tm.codexLogModel == nil {
+		tm.codexLogModel = make(map[string]string)
+	}
+	if tm.codexLogSeen == nil {
+		tm.codexLogSeen = make(map[string]time.Time)
+	}
 	if tm.prevBytesSeen == nil {
 		tm.prevBytesSeen = make(map[int]time.Time)
 	}
 	if tm.errorStats == nil {
 		tm.errorStats = make(map[string]MonitorErrorStats)
 	}
+	if tm.termSeen == nil {
+		tm.termSeen = make(map[string]time.Time)
+	}
+	if tm.agentPIDs == nil {
+		tm.agentPIDs = make(map[string]int)
+	}
+	if tm.models == nil {
+		tm.models = make(map[string]map[string]*agent.TokenMetrics)
+	}
+	if tm.rateSamples == nil {
+		tm.rateSamples = make(map[string][]tokenSample)
+	}
+	if tm.now == nil {
+		tm.now = time.Now
+	}
+}
+
+// NewTokenMonitorWithTTL creates a token monitor that forgets network byte
+// baselines, log offsets and counted commands after ttl without activity,
+// checking every pruneInterval. Zero values use the defaults (24h, 5m).
+func NewTokenMonitorWithTTL(ttl, pruneInterval time.Duration) *TokenMonitor {
+	tm := NewTokenMonitor()
+	tm.stateTTL = ttl
+	tm.pruneInterval = pruneInterval
+	return tm
 }
 
 // NewTokenMonitor creates a new token monitor.
@@ -109,9 +186,131 @@ func NewTokenMonitor() *TokenMonitor {
 		copilotLogSeen:    make(map[string]time.Time),
 		claudeLogSeen:     make(map[string]time.Time),
 		aiderLogSeen:      make(map[string]time.Time),
+		geminiFiles:       make(map[string]fileUsage),
+		geminiFileSeen:    make(map[string]time.Time),
+		codexLogOffsets:   make(map[string]int64),
+		codexLogModel:     make(map[string]string),
+		codexLogSeen:      make(map[string]time.Time),
 		prevBytesSeen:     make(map[int]time.Time),
 		errorStats:        make(map[string]MonitorErrorStats),
+		termSeen:          make(map[string]time.Time),
+		agentPIDs:         make(map[string]int),
+		rateSamples:       make(map[string][]tokenSample),
+		now:               time.Now,
+		models:            make(map[string]map[string]*agent.TokenMetrics),
+	}
+}
+
+// SetHistoryStore wires a HistoryStore so that Collect populates
+// TokenMetrics.CostToday from recorded history. Pass nil to disable.
+func (tm *TokenMonitor) SetHistoryStore(hs *HistoryStore) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.history = hs
+}
+
+// SetHomeDir sets the home directory that agent logs and databases are read
+// from, e.g. to monitor another user's agents or to point tests at a fixture.
+// An empty dir restores the default of os.UserHomeDir.
+func (tm *TokenMonitor) SetHomeDir(dir string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.homeDir = dir
+}
+
+// SetTokenizer sets the tokenizer used to count input tokens from raw text
+// for agents without usage logs. Pass nil to restore the built-in
+// HeuristicTokenizer.
+func (tm *TokenMonitor) SetTokenizer(t Tokenizer) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.tokenizer = t
+}
+
+// SetPricing sets model prices that take precedence over the built-in
+// ModelPrices when Collect estimates cost, e.g. from PricingFromConfig.
+// Pass nil to use the built-ins only.
+func (tm *TokenMonitor) SetPricing(prices map[string]ModelPricing) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.prices = prices
+}
+
+// CountTokens counts tokens in text for model with the configured tokenizer.
+func (tm *TokenMonitor) CountTokens(model, text string) int {
+	tm.mu.Lock()
+	t := tm.tokenizer
+	tm.mu.Unlock()
+	if t == nil {
+		t = defaultTokenizer
+	}
+	return t.CountTokens(model, text)
+}
+
+func (tm *TokenMonitor) userHome() (string, error) {
+	if tm.homeDir != "" {
+		return tm.homeDir, nil
+	}
+	return os.UserHomeDir()
+}
+
+// logDirs resolves where the editor and agent logs live on this platform.
+// With an explicit home (SetHomeDir) environment overrides such as
+// XDG_CONFIG_HOME and APPDATA are ignored, so the layout stays under it.
+func (tm *TokenMonitor) logDirs(home string) logPaths {
+	goos := tm.goos
+	if goos == "" {
+		goos = runtime.GOOS
 	}
+	getenv := os.Getenv
+	if tm.homeDir != "" {
+		getenv = func(string) string { return "" }
+	}
+	return resolveLogPaths(home, goos, getenv)
+}
+
+// logPaths are the per-platform base directories token collectors read.
+type logPaths struct {
+	CodeLogs   string   // VS Code logs (Copilot Chat)
+	CursorData string   // Cursor user data (User/, logs/)
+	ClaudeDirs []string // Claude Code data directories, in lookup order
+}
+
+func resolveLogPaths(home, goos string, getenv func(string) string) logPaths {
+	p := logPaths{
+		CodeLogs:   filepath.Join(appDataDir(home, goos, getenv), "Code", "logs"),
+		CursorData: filepath.Join(appDataDir(home, goos, getenv), "Cursor"),
+		ClaudeDirs: []string{filepath.Join(home, ".claude")},
+	}
+	if goos == "linux" {
+		p.ClaudeDirs = append(p.ClaudeDirs, filepath.Join(appDataDir(home, goos, getenv), "claude"))
+	}
+	return p
+}
+
+// appDataDir is the per-user application data directory editors use:
+// ~/Library/Application Support on macOS, %APPDATA% on Windows and
+// $XDG_CONFIG_HOME (default ~/.config) elsewhere.
+func appDataDir(home, goos string, getenv func(string) string) string {
+	switch goos {
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support")
+	case "windows":
+		if dir := getenv("APPDATA"); dir != "" {
+			return dir
+		}
+		return filepath.Join(home, "AppData", "Roaming")
+	default:
+		if dir := getenv("XDG_CONFIG_HOME"); dir != "" {
+			return dir
+		}
+		return filepath.Join(home, ".config")
+	}
+}
+
+// codeLogsBase returns the VS Code logs directory for this platform.
+func (tm *TokenMonitor) codeLogsBase(home string) string {
+	return tm.logDirs(home).CodeLogs
 }
 
 // Collect gathers token metrics for all detected agents. It dispatches to
@@ -122,8 +321,12 @@ func (tm *TokenMonitor) Collect(agents []agent.Instance) {
 	defer tm.mu.Unlock()
 	tm.ensureInit()
 
-	now := time.Now()
-	if tm.lastPruneAt.IsZero() || now.Sub(tm.lastPruneAt) >= tokenPruneCheckInterval {
+	now := tm.now()
+	pruneInterval := tm.pruneInterval
+	if pruneInterval <= 0 {
+		pruneInterval = tokenPruneCheckInterval
+	}
+	if tm.lastPruneAt.IsZero() || now.Sub(tm.lastPruneAt) >= pruneInterval {
 		tm.pruneState(agents, now)
 		tm.lastPruneAt = now
 	}
@@ -136,6 +339,9 @@ func (tm *TokenMonitor) Collect(agents []agent.Instance) {
 		if _, ok := tm.data[id]; !ok {
 			tm.data[id] = &agent.TokenMetrics{}
 		}
+		if a.PID > 0 {
+			tm.agentPIDs[id] = a.PID
+		}
 
 		switch id {
 		case "copilot":
@@ -146,20 +352,107 @@ func (tm *TokenMonitor) Collect(agents []agent.Instance) {
 			tm.collectCursor(a)
 		case "aider":
 			tm.collectAider(a)
+		case "gemini-cli":
+			tm.collectGemini(a)
+		case "codex-cli":
+			tm.collectCodex(a)
 		default:
 			tm.collectFromNetwork(a)
 		}
 
 		// Calculate cost based on model and tokens
 		m := tm.data[id]
-		m.EstCost = EstimateCost(m.LastModel, m.InputTokens, m.OutputTokens)
+		m.EstCost = pricedCost(FindPricingWith(tm.prices, m.LastModel), m.InputTokens, m.OutputTokens, m.CacheCreateTokens, m.CacheReadTokens)
 		m.Confidence = tokenConfidence(m.Source)
+		m.TokensPerSec = tm.tokenRate(id, m.TotalTokens, now)
+		if tm.history != nil {
+			m.CostToday = tm.history.costTodayWith(id, m.EstCost, now)
+		}
+
+		for _, bm := range tm.models[id] {
+			bm.EstCost = pricedCost(FindPricingWith(tm.prices, bm.LastModel), bm.InputTokens, bm.OutputTokens, bm.CacheCreateTokens, bm.CacheReadTokens)
+			bm.Source = m.Source
+			bm.Confidence = m.Confidence
+		}
 
 		// Copy metrics to agent instance
 		a.Tokens = *m
 	}
 }
 
+// Reset discards the accumulated metrics for agentID, along with its
+// network byte baseline and counted terminal commands, so the next Collect
+// starts from zero. Use it when an agent restarts under the same ID. Log
+// read offsets are shared by path rather than owned by one agent and are
+// kept, so lines already read are not counted again.
+func (tm *TokenMonitor) Reset(agentID string) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.ensureInit()
+
+	delete(tm.data, agentID)
+	delete(tm.termSeen, agentID)
+	delete(tm.models, agentID)
+	delete(tm.rateSamples, agentID)
+	if pid, ok := tm.agentPIDs[agentID]; ok {
+		delete(tm.prevBytes, pid)
+		delete(tm.prevBytesSeen, pid)
+		delete(tm.agentPIDs, agentID)
+	}
+}
+
+// ResetAll is Reset for every agent.
+func (tm *TokenMonitor) ResetAll() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.data = make(map[string]*agent.TokenMetrics)
+	tm.termSeen = make(map[string]time.Time)
+	tm.prevBytes = make(map[int]int64)
+	tm.prevBytesSeen = make(map[int]time.Time)
+	tm.agentPIDs = make(map[string]int)
+	tm.models = make(map[string]map[string]*agent.TokenMetrics)
+	tm.rateSamples = make(map[string][]tokenSample)
+}
+
+// GetModelBreakdown returns agentID's usage split by model, as seen by the
+// Claude Code and Copilot/Cursor log collectors. Each entry has its own
+// counts and EstCost priced for that model. Agents whose collector cannot
+// attribute requests to a model return an empty map.
+func (tm *TokenMonitor) GetModelBreakdown(agentID string) map[string]agent.TokenMetrics {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	out := make(map[string]agent.TokenMetrics, len(tm.models[agentID]))
+	for model, m := range tm.models[agentID] {
+		out[model] = *m
+	}
+	return out
+}
+
+func (tm *TokenMonitor) modelsFor(agentID string) map[string]*agent.TokenMetrics {
+	models := tm.models[agentID]
+	if models == nil {
+		models = make(map[string]*agent.TokenMetrics)
+		tm.models[agentID] = models
+	}
+	return models
+}
+
+// usageTargets returns the metrics one request is added to: the agent's
+// totals and, if models is non-nil and model is known, that model's bucket.
+func usageTargets(m *agent.TokenMetrics, models map[string]*agent.TokenMetrics, model string) []*agent.TokenMetrics {
+	if models == nil || model == "" {
+		return []*agent.TokenMetrics{m}
+	}
+	b := models[model]
+	if b == nil {
+		b = &agent.TokenMetrics{}
+		models[model] = b
+	}
+	return []*agent.TokenMetrics{m, b}
+}
+
 func tokenConfidence(source agent.TokenSource) float64 {
 	switch source {
 	case agent.TokenSourceLog, agent.TokenSourceDB, agent.TokenSourceLocalAPI:
@@ -184,6 +477,20 @@ func (tm *TokenMonitor) GetMetrics(agentID string) agent.TokenMetrics {
 	return agent.TokenMetrics{}
 }
 
+// Probe reports the source token data for agentID was last collected from.
+// It returns an error if Collect has not produced any token data for the
+// agent. It matches the signature of agent.Detector.TokenProbe.
+func (tm *TokenMonitor) Probe(agentID string) (agent.TokenSource, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.ensureInit()
+	m, ok := tm.data[agentID]
+	if !ok || m.Source == agent.TokenSourceNone {
+		return agent.TokenSourceNone, fmt.Errorf("no token data collected for %s", agentID)
+	}
+	return m.Source, nil
+}
+
 // GetErrorStats returns a snapshot of operational errors per data source.
 func (tm *TokenMonitor) GetErrorStats() map[string]MonitorErrorStats {
 	tm.mu.Lock()
@@ -217,7 +524,7 @@ var copilotReqRe = regexp.MustCompile(
 )
 
 func (tm *TokenMonitor) collectCopilot(a *agent.Instance) {
-	home, err := os.UserHomeDir()
+	home, err := tm.userHome()
 	if err != nil {
 		tm.recordError(tokenErrHomeDir, err)
 		tm.collectFromNetwork(a)
@@ -225,7 +532,7 @@ func (tm *TokenMonitor) collectCopilot(a *agent.Instance) {
 	}
 	m := tm.data[a.Info.ID]
 
-	logsBase := filepath.Join(home, "Library", "Application Support", "Code", "logs")
+	logsBase := tm.codeLogsBase(home)
 	logDirs, _ := filepath.Glob(filepath.Join(logsBase, "*"))
 	if len(logDirs) == 0 {
 		tm.collectFromNetwork(a)
@@ -244,7 +551,7 @@ func (tm *TokenMonitor) collectCopilot(a *agent.Instance) {
 
 	foundRequests := false
 	for _, logPath := range chatLogs {
-		count := tm.parseCopilotLog(logPath, m)
+		count := tm.parseCopilotLog(logPath, m, tm.modelsFor(a.Info.ID))
 		if count > 0 {
 			foundRequests = true
 		}
@@ -257,7 +564,9 @@ func (tm *TokenMonitor) collectCopilot(a *agent.Instance) {
 	}
 }
 
-func (tm *TokenMonitor) parseCopilotLog(logPath string, m *agent.TokenMetrics) int {
+// parseCopilotLog counts new requests in a Copilot Chat log into m and,
+// when models is non-nil, into per-model buckets.
+func (tm *TokenMonitor) parseCopilotLog(logPath string, m *agent.TokenMetrics, models map[string]*agent.TokenMetrics) int {
 	f, err := os.Open(logPath)
 	if err != nil {
 		tm.recordError(tokenErrCopilotLog, err)
@@ -266,9 +575,8 @@ func (tm *TokenMonitor) parseCopilotLog(logPath string, m *agent.TokenMetrics) i
 	defer f.Close()
 	tm.copilotLogSeen[logPath] = time.Now()
 
-	offset, exists := tm.copilotLogOffsets[logPath]
-	if exists {
-		if _, err := f.Seek(offset, 0); err != nil {
+	if offset, exists := tm.copilotLogOffsets[logPath]; exists {
+		if err := resumeAt(f, offset); err != nil {
 			tm.recordError(tokenErrCopilotLog, err)
 		}
 	}
@@ -289,19 +597,6 @@ func (tm *TokenMonitor) parseCopilotLog(logPath string, m *agent.TokenMetrics) i
 		latencyStr := match[4]
 		latency, _ := strconv.Atoi(latencyStr)
 
-		m.RequestCount++
-		m.LastModel = model
-		m.LastRequestAt = time.Now()
-		newRequests++
-
-		if latency > 0 {
-			if m.AvgLatencyMs == 0 {
-				m.AvgLatencyMs = int64(latency)
-			} else {
-				m.AvgLatencyMs = (m.AvgLatencyMs*int64(m.RequestCount-1) + int64(latency)) / int64(m.RequestCount)
-			}
-		}
-
 		estimatedInput := int64(300)
 		estimatedOutput := int64(200)
 		if strings.Contains(model, "gpt-4") || strings.Contains(model, "claude") {
@@ -309,9 +604,29 @@ func (tm *TokenMonitor) parseCopilotLog(logPath string, m *agent.TokenMetrics) i
 			estimatedOutput = 400
 		}
 
-		m.InputTokens += estimatedInput
-		m.OutputTokens += estimatedOutput
-		m.TotalTokens = m.InputTokens + m.OutputTokens
+		for _, t := range usageTargets(m, models, model) {
+			t.RequestCount++
+			if match[1] == "error" {
+				t.ErrorCount++
+			} else {
+				t.SuccessCount++
+			}
+			t.LastModel = model
+			t.LastRequestAt = time.Now()
+
+			if latency > 0 {
+				if t.AvgLatencyMs == 0 {
+					t.AvgLatencyMs = int64(latency)
+				} else {
+					t.AvgLatencyMs = (t.AvgLatencyMs*int64(t.RequestCount-1) + int64(latency)) / int64(t.RequestCount)
+				}
+			}
+
+			t.InputTokens += estimatedInput
+			t.OutputTokens += estimatedOutput
+			t.TotalTokens = t.InputTokens + t.OutputTokens
+		}
+		newRequests++
 	}
 
 	pos, err := f.Seek(0, 1)
@@ -325,22 +640,13 @@ func (tm *TokenMonitor) parseCopilotLog(logPath string, m *agent.TokenMetrics) i
 		tm.recordError(tokenErrCopilotLog, err)
 	}
 
-	if m.RequestCount > 0 && !m.LastRequestAt.IsZero() {
-		elapsed := time.Since(m.LastRequestAt).Seconds()
-		if elapsed < 60 && elapsed > 0 {
-			m.TokensPerSec = float64(m.OutputTokens) / float64(m.RequestCount) / (elapsed + 0.5)
-		} else {
-			m.TokensPerSec = 0
-		}
-	}
-
 	return newRequests
 }
 
 // ---------- Claude Code: parse conversation JSONL files ----------
 
 func (tm *TokenMonitor) collectClaude(a *agent.Instance) {
-	home, err := os.UserHomeDir()
+	home, err := tm.userHome()
 	if err != nil {
 		tm.recordError(tokenErrHomeDir, err)
 		tm.collectFromNetwork(a)
@@ -348,17 +654,7 @@ func (tm *TokenMonitor) collectClaude(a *agent.Instance) {
 	}
 	m := tm.data[a.Info.ID]
 
-	claudeDir := filepath.Join(home, ".claude")
-	if _, err := os.Stat(claudeDir); os.IsNotExist(err) {
-		tm.collectFromNetwork(a)
-		return
-	}
-
-	files, _ := filepath.Glob(filepath.Join(claudeDir, "projects", "*", "conversations", "*.jsonl"))
-	if len(files) == 0 {
-		files, _ = filepath.Glob(filepath.Join(claudeDir, "conversations", "*.jsonl"))
-	}
-
+	files := claudeLogFiles(tm.logDirs(home).ClaudeDirs)
 	if len(files) == 0 {
 		tm.collectFromNetwork(a)
 		return
@@ -366,7 +662,7 @@ func (tm *TokenMonitor) collectClaude(a *agent.Instance) {
 
 	foundTokens := false
 	for _, f := range files {
-		count := tm.parseClaudeJSONL(f, m)
+		count := tm.parseClaudeJSONL(f, m, tm.modelsFor(a.Info.ID))
 		if count > 0 {
 			foundTokens = true
 		}
@@ -379,18 +675,48 @@ func (tm *TokenMonitor) collectClaude(a *agent.Instance) {
 	}
 }
 
+// claudeLogFiles lists conversation logs under the given Claude data
+// directories. Current releases write projects/<project>/<session>.jsonl;
+// older ones used a conversations/ subdirectory, per project or top level.
+func claudeLogFiles(dirs []string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		for _, pattern := range []string{
+			filepath.Join(dir, "projects", "*", "*.jsonl"),
+			filepath.Join(dir, "projects", "*", "conversations", "*.jsonl"),
+			filepath.Join(dir, "conversations", "*.jsonl"),
+		} {
+			matches, _ := filepath.Glob(pattern)
+			for _, f := range matches {
+				if !seen[f] {
+					seen[f] = true
+					files = append(files, f)
+				}
+			}
+		}
+	}
+	return files
+}
+
 type claudeMessage struct {
-	Type    string `json:"type"`
-	Message struct {
+	Type       string `json:"type"`
+	IsAPIError bool   `json:"isApiErrorMessage"`
+	Message    struct {
 		Usage struct {
-			InputTokens  int64 `json:"input_tokens"`
-			OutputTokens int64 `json:"output_tokens"`
+			InputTokens              int64 `json:"input_tokens"`
+			OutputTokens             int64 `json:"output_tokens"`
+			CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+			CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
 		} `json:"usage"`
 		Model string `json:"model"`
 	} `json:"message"`
 }
 
-func (tm *TokenMonitor) parseClaudeJSONL(path string, m *agent.TokenMetrics) int {
+// parseClaudeJSONL counts new assistant messages in a Claude Code
+// conversation log into m and, when models is non-nil, into per-model
+// buckets.
+func (tm *TokenMonitor) parseClaudeJSONL(path string, m *agent.TokenMetrics, models map[string]*agent.TokenMetrics) int {
 	f, err := os.Open(path)
 	if err != nil {
 		tm.recordError(tokenErrClaudeJSONL, err)
@@ -399,9 +725,8 @@ func (tm *TokenMonitor) parseClaudeJSONL(path string, m *agent.TokenMetrics) int
 	defer f.Close()
 	tm.claudeLogSeen[path] = time.Now()
 
-	offset, exists := tm.claudeLogOffsets[path]
-	if exists {
-		if _, err := f.Seek(offset, 0); err != nil {
+	if offset, exists := tm.claudeLogOffsets[path]; exists {
+		if err := resumeAt(f, offset); err != nil {
 			tm.recordError(tokenErrClaudeJSONL, err)
 		}
 	}
@@ -421,14 +746,28 @@ func (tm *TokenMonitor) parseClaudeJSONL(path string, m *agent.TokenMetrics) int
 			continue
 		}
 
-		if msg.Type == "assistant" && msg.Message.Usage.InputTokens > 0 {
-			m.InputTokens += msg.Message.Usage.InputTokens
-			m.OutputTokens += msg.Message.Usage.OutputTokens
-			m.TotalTokens = m.InputTokens + m.OutputTokens
+		if msg.Type == "assistant" && msg.IsAPIError {
 			m.RequestCount++
+			m.ErrorCount++
 			m.LastRequestAt = time.Now()
-			if msg.Message.Model != "" {
-				m.LastModel = msg.Message.Model
+			count++
+			continue
+		}
+
+		usage := msg.Message.Usage
+		if msg.Type == "assistant" && usage.InputTokens+usage.CacheCreationInputTokens+usage.CacheReadInputTokens > 0 {
+			for _, t := range usageTargets(m, models, msg.Message.Model) {
+				t.InputTokens += usage.InputTokens
+				t.OutputTokens += usage.OutputTokens
+				t.CacheCreateTokens += usage.CacheCreationInputTokens
+				t.CacheReadTokens += usage.CacheReadInputTokens
+				t.TotalTokens = t.InputTokens + t.OutputTokens
+				t.RequestCount++
+				t.SuccessCount++
+				t.LastRequestAt = time.Now()
+				if msg.Message.Model != "" {
+					t.LastModel = msg.Message.Model
+				}
 			}
 			count++
 		}
@@ -445,22 +784,13 @@ func (tm *TokenMonitor) parseClaudeJSONL(path string, m *agent.TokenMetrics) int
 		tm.recordError(tokenErrClaudeJSONL, err)
 	}
 
-	if m.RequestCount > 0 && !m.LastRequestAt.IsZero() {
-		elapsed := time.Since(m.LastRequestAt).Seconds()
-		if elapsed < 60 && elapsed > 0 {
-			m.TokensPerSec = float64(m.OutputTokens) / float64(m.RequestCount) / (elapsed + 0.5)
-		} else {
-			m.TokensPerSec = 0
-		}
-	}
-
 	return count
 }
 
 // ---------- Cursor: parse SQLite DB ----------
 
 func (tm *TokenMonitor) collectCursor(a *agent.Instance) {
-	home, err := os.UserHomeDir()
+	home, err := tm.userHome()
 	if err != nil {
 		tm.recordError(tokenErrHomeDir, err)
 		tm.collectFromNetwork(a)
@@ -468,7 +798,8 @@ func (tm *TokenMonitor) collectCursor(a *agent.Instance) {
 	}
 	m := tm.data[a.Info.ID]
 
-	dbPath := filepath.Join(home, "Library", "Application Support", "Cursor", "User", "globalStorage", "state.vscdb")
+	cursorData := tm.logDirs(home).CursorData
+	dbPath := filepath.Join(cursorData, "User", "globalStorage", "state.vscdb")
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
 		tm.collectFromNetwork(a)
 		return
@@ -479,14 +810,14 @@ func (tm *TokenMonitor) collectCursor(a *agent.Instance) {
 		return
 	}
 
-	logsBase := filepath.Join(home, "Library", "Application Support", "Cursor", "logs")
+	logsBase := filepath.Join(cursorData, "logs")
 	logDirs, _ := filepath.Glob(filepath.Join(logsBase, "*"))
 	if len(logDirs) > 0 {
 		sort.Strings(logDirs)
 		latestDir := logDirs[len(logDirs)-1]
 		chatLogs, _ := filepath.Glob(filepath.Join(latestDir, "window*", "exthost", "*", "*.log"))
 		for _, logPath := range chatLogs {
-			tm.parseCopilotLog(logPath, m)
+			tm.parseCopilotLog(logPath, m, tm.modelsFor(a.Info.ID))
 		}
 	}
 
@@ -607,7 +938,7 @@ func (tm *TokenMonitor) collectAider(a *agent.Instance) {
 		)
 	}
 
-	home, err := os.UserHomeDir()
+	home, err := tm.userHome()
 	if err != nil {
 		tm.recordError(tokenErrHomeDir, err)
 		tm.collectFromNetwork(a)
@@ -639,9 +970,8 @@ func (tm *TokenMonitor) parseAiderHistory(path string, m *agent.TokenMetrics) bo
 	defer f.Close()
 	tm.aiderLogSeen[path] = time.Now()
 
-	offset, exists := tm.aiderLogOffsets[path]
-	if exists {
-		if _, err := f.Seek(offset, 0); err != nil {
+	if offset, exists := tm.aiderLogOffsets[path]; exists {
+		if err := resumeAt(f, offset); err != nil {
 			tm.recordError(tokenErrAiderLog, err)
 		}
 	}
@@ -664,6 +994,7 @@ func (tm *TokenMonitor) parseAiderHistory(path string, m *agent.TokenMetrics) bo
 		m.OutputTokens += recv
 		m.TotalTokens = m.InputTokens + m.OutputTokens
 		m.RequestCount++
+		m.SuccessCount++
 		m.LastRequestAt = time.Now()
 		m.LastModel = "aider"
 		found = true
@@ -700,12 +1031,322 @@ func parseTokenCount(s string) int64 {
 	return int64(f * float64(multiplier))
 }
 
+// ---------- Gemini CLI: parse session JSON usage metadata ----------
+
+// usageTotals accumulates request counts and tokens for one model.
+type usageTotals struct {
+	Requests int64
+	Input    int64
+	Output   int64
+	Cached   int64
+}
+
+// fileUsage is what has been counted from one log file that is rewritten
+// in place rather than appended to, so it cannot be offset-tracked.
+type fileUsage struct {
+	Size    int64
+	ModTime time.Time
+	ByModel map[string]usageTotals
+}
+
+func (tm *TokenMonitor) collectGemini(a *agent.Instance) {
+	home, err := tm.userHome()
+	if err != nil {
+		tm.recordError(tokenErrHomeDir, err)
+		tm.collectFromNetwork(a)
+		return
+	}
+	m := tm.data[a.Info.ID]
+
+	geminiDir := filepath.Join(home, ".gemini")
+	var files []string
+	_ = filepath.WalkDir(filepath.Join(geminiDir, "tmp"), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() && (strings.HasSuffix(path, ".json") || strings.HasSuffix(path, ".jsonl")) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if _, err := os.Stat(filepath.Join(geminiDir, "telemetry.log")); err == nil {
+		files = append(files, filepath.Join(geminiDir, "telemetry.log"))
+	}
+	if len(files) == 0 {
+		tm.collectFromNetwork(a)
+		return
+	}
+
+	found := false
+	for _, path := range files {
+		if tm.parseGeminiFile(path, m, tm.modelsFor(a.Info.ID)) > 0 {
+			found = true
+		}
+	}
+	if found {
+		m.Source = agent.TokenSourceLog
+	} else if m.Source == "" {
+		tm.collectFromNetwork(a)
+	}
+}
+
+// parseGeminiFile adds the requests in path not counted yet to m and the
+// per-model buckets and returns how many there were. Gemini CLI rewrites
+// its session files whole, so the file is re-read when its size or
+// modification time changes and only the growth in its totals is added.
+func (tm *TokenMonitor) parseGeminiFile(path string, m *agent.TokenMetrics, models map[string]*agent.TokenMetrics) int {
+	info, err := os.Stat(path)
+	if err != nil {
+		tm.recordError(tokenErrGeminiLog, err)
+		return 0
+	}
+	tm.geminiFileSeen[path] = time.Now()
+	prev, seen := tm.geminiFiles[path]
+	if seen && prev.Size == info.Size() && prev.ModTime.Equal(info.ModTime()) {
+		return 0
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		tm.recordError(tokenErrGeminiLog, err)
+		return 0
+	}
+	defer f.Close()
+
+	byModel := make(map[string]usageTotals)
+	dec := json.NewDecoder(f)
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			// Most likely a write in progress; try again next time.
+			return 0
+		}
+		walkGeminiUsage(v, "", byModel)
+	}
+	tm.geminiFiles[path] = fileUsage{Size: info.Size(), ModTime: info.ModTime(), ByModel: byModel}
+
+	count := 0
+	for model, cur := range byModel {
+		old := prev.ByModel[model]
+		if cur.Requests < old.Requests {
+			// The file was replaced by a new session.
+			old = usageTotals{}
+		}
+		if cur.Requests == old.Requests {
+			continue
+		}
+		for _, t := range usageTargets(m, models, model) {
+			t.RequestCount += int(cur.Requests - old.Requests)
+			t.SuccessCount += int(cur.Requests - old.Requests)
+			t.InputTokens += cur.Input - old.Input
+			t.OutputTokens += cur.Output - old.Output
+			t.CacheReadTokens += cur.Cached - old.Cached
+			t.TotalTokens = t.InputTokens + t.OutputTokens
+			t.LastRequestAt = time.Now()
+			if model != "" {
+				t.LastModel = model
+			}
+		}
+		count += int(cur.Requests - old.Requests)
+	}
+	return count
+}
+
+// walkGeminiUsage finds every usageMetadata object (as returned by the
+// Gemini API) nested in v and totals it under the closest enclosing
+// modelVersion or model name.
+func walkGeminiUsage(v interface{}, model string, out map[string]usageTotals) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{"modelVersion", "model"} {
+			if name, ok := x[key].(string); ok && name != "" {
+				model = name
+				break
+			}
+		}
+		if um, ok := x["usageMetadata"].(map[string]interface{}); ok {
+			prompt, _ := um["promptTokenCount"].(float64)
+			candidates, _ := um["candidatesTokenCount"].(float64)
+			cached, _ := um["cachedContentTokenCount"].(float64)
+			if prompt > 0 || candidates > 0 {
+				t := out[model]
+				t.Requests++
+				t.Input += int64(prompt - cached)
+				t.Output += int64(candidates)
+				t.Cached += int64(cached)
+				out[model] = t
+			}
+		}
+		for key, child := range x {
+			if key != "usageMetadata" {
+				walkGeminiUsage(child, model, out)
+			}
+		}
+	case []interface{}:
+		for _, child := range x {
+			walkGeminiUsage(child, model, out)
+		}
+	}
+}
+
+// ---------- Codex CLI: parse rollout JSONL token_count events ----------
+
+func (tm *TokenMonitor) collectCodex(a *agent.Instance) {
+	home, err := tm.userHome()
+	if err != nil {
+		tm.recordError(tokenErrHomeDir, err)
+		tm.collectFromNetwork(a)
+		return
+	}
+	m := tm.data[a.Info.ID]
+
+	path := newestCodexSession(filepath.Join(home, ".codex", "sessions"))
+	if path == "" {
+		tm.collectFromNetwork(a)
+		return
+	}
+
+	if tm.parseCodexJSONL(path, m, tm.modelsFor(a.Info.ID)) > 0 {
+		m.Source = agent.TokenSourceLog
+	} else if m.Source == "" {
+		tm.collectFromNetwork(a)
+	}
+}
+
+// newestCodexSession returns the most recently modified session file under
+// dir, which Codex CLI lays out as YYYY/MM/DD/rollout-<time>-<id>.jsonl.
+func newestCodexSession(dir string) string {
+	var newest string
+	var newestMod time.Time
+	_ = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".jsonl") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if newest == "" || info.ModTime().After(newestMod) {
+			newest, newestMod = path, info.ModTime()
+		}
+		return nil
+	})
+	return newest
+}
+
+type codexTokenUsage struct {
+	InputTokens       int64 `json:"input_tokens"`
+	CachedInputTokens int64 `json:"cached_input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+}
+
+type codexRolloutLine struct {
+	Type    string `json:"type"`
+	Payload struct {
+		Type  string `json:"type"`
+		Model string `json:"model"`
+		Info  *struct {
+			LastTokenUsage *codexTokenUsage `json:"last_token_usage"`
+		} `json:"info"`
+	} `json:"payload"`
+}
+
+// parseCodexJSONL counts new token_count events in a Codex CLI rollout file
+// into m and, when models is non-nil, into per-model buckets. Each event
+// carries the usage of the turn that just finished; the model comes from
+// the turn_context line that precedes it.
+func (tm *TokenMonitor) parseCodexJSONL(path string, m *agent.TokenMetrics, models map[string]*agent.TokenMetrics) int {
+	f, err := os.Open(path)
+	if err != nil {
+		tm.recordError(tokenErrCodexLog, err)
+		return 0
+	}
+	defer f.Close()
+	tm.codexLogSeen[path] = time.Now()
+
+	if offset, exists := tm.codexLogOffsets[path]; exists {
+		if err := resumeAt(f, offset); err != nil {
+			tm.recordError(tokenErrCodexLog, err)
+		}
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+	model := tm.codexLogModel[path]
+	count := 0
+
+	for scanner.Scan() {
+		var line codexRolloutLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		switch {
+		case line.Type == "turn_context" && line.Payload.Model != "":
+			model = line.Payload.Model
+		case line.Type == "event_msg" && line.Payload.Type == "token_count":
+			if line.Payload.Info == nil || line.Payload.Info.LastTokenUsage == nil {
+				continue
+			}
+			usage := line.Payload.Info.LastTokenUsage
+			for _, t := range usageTargets(m, models, model) {
+				// input_tokens includes the cached part of the prompt.
+				t.InputTokens += usage.InputTokens - usage.CachedInputTokens
+				t.CacheReadTokens += usage.CachedInputTokens
+				t.OutputTokens += usage.OutputTokens
+				t.TotalTokens = t.InputTokens + t.OutputTokens
+				t.RequestCount++
+				t.SuccessCount++
+				t.LastRequestAt = time.Now()
+				if model != "" {
+					t.LastModel = model
+				}
+			}
+			count++
+		}
+	}
+	tm.codexLogModel[path] = model
+
+	pos, err := f.Seek(0, 1)
+	if err != nil {
+		tm.recordError(tokenErrCodexLog, err)
+	} else {
+		tm.codexLogOffsets[path] = pos
+	}
+
+	if err := scanner.Err(); err != nil {
+		tm.recordError(tokenErrCodexLog, err)
+	}
+	return count
+}
+
+// resumeAt seeks f to offset, where the previous scan stopped. If the file
+// is now shorter than offset it was truncated or replaced by log rotation,
+// so f is left at the start and the new content is read in full.
+func resumeAt(f *os.File, offset int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < offset {
+		return nil
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	return err
+}
+
 // ---------- Network-based estimation ----------
 
 func (tm *TokenMonitor) collectFromNetwork(a *agent.Instance) {
 	m := tm.data[a.Info.ID]
+	tm.countCommandTokens(a, m)
 
-	bytes, err := getNetworkBytesForPID(a.PID)
+	readBytes := tm.networkBytes
+	if readBytes == nil {
+		readBytes = getNetworkBytesForPID
+	}
+	bytes, err := readBytes(a.PID)
 	if err != nil {
 		tm.recordError(tokenErrNetwork, err)
 	}
@@ -729,14 +1370,77 @@ func (tm *TokenMonitor) collectFromNetwork(a *agent.Instance) {
 	m.TotalTokens = m.InputTokens + m.OutputTokens
 	m.LastRequestAt = time.Now()
 
-	if m.Source == "" {
+	// Command tokens alone are marked estimated; once network traffic
+	// dominates the count, report the less precise source.
+	if m.Source == "" || m.Source == agent.TokenSourceEstimated {
 		m.Source = agent.TokenSourceNetwork
 	}
+}
 
-	m.TokensPerSec = float64(estimatedTokens) / 2.0
+// countCommandTokens adds the tokens of terminal commands not counted yet to
+// the input side. Commands run by the agent are fed back to the model, and
+// unlike network traffic their text is available to tokenize.
+func (tm *TokenMonitor) countCommandTokens(a *agent.Instance, m *agent.TokenMetrics) {
+	t := tm.tokenizer
+	if t == nil {
+		t = defaultTokenizer
+	}
+	seen := tm.termSeen[a.Info.ID]
+	newest := seen
+	var tokens int64
+	for _, cmd := range a.Terminal.RecentCommands {
+		if !cmd.Timestamp.After(seen) {
+			continue
+		}
+		tokens += int64(t.CountTokens(m.LastModel, cmd.Command))
+		if cmd.Timestamp.After(newest) {
+			newest = cmd.Timestamp
+		}
+	}
+	tm.termSeen[a.Info.ID] = newest
+	if tokens == 0 {
+		return
+	}
+	m.InputTokens += tokens
+	m.TotalTokens = m.InputTokens + m.OutputTokens
+	if m.Source == "" {
+		m.Source = agent.TokenSourceEstimated
+	}
 }
 
+// bytesPerConnection is the traffic assumed per established connection
+// when only the number of connections is known.
+const bytesPerConnection = 500
+
+// getNetworkBytesForPID returns a byte count for pid that grows with its
+// network traffic. It samples nettop where available, falling back to an
+// estimate from the PID's established connections listed by lsof. On Linux
+// the same estimate, bytesPerConnection per established connection, is
+// made from the PID's sockets in /proc without spawning anything; it is
+// not a real byte count, since /proc has no per-process network counters
+// and the process I/O counters also count file and pipe I/O.
 func getNetworkBytesForPID(pid int) (int64, error) {
+	if runtime.GOOS == "linux" {
+		if conns, err := procConnections("/proc", pid); err == nil {
+			return establishedBytes(conns), nil
+		}
+	}
+	return nettopBytesForPID(pid)
+}
+
+// establishedBytes estimates traffic from the established TCP connections
+// in conns, as estimateFromLsof does from lsof output.
+func establishedBytes(conns []agent.NetConnection) int64 {
+	established := 0
+	for _, c := range conns {
+		if c.Protocol == "tcp" && c.State == "ESTABLISHED" {
+			established++
+		}
+	}
+	return int64(established * bytesPerConnection)
+}
+
+func nettopBytesForPID(pid int) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), tokenCommandTimeout)
 	defer cancel()
 
@@ -786,10 +1490,14 @@ func estimateFromLsof(pid int) (int64, error) {
 		}
 	}
 
-	return int64(established * 500), nil
+	return int64(established * bytesPerConnection), nil
 }
 
 func (tm *TokenMonitor) pruneState(agents []agent.Instance, now time.Time) {
+	ttl := tm.stateTTL
+	if ttl <= 0 {
+		ttl = tokenStateTTL
+	}
 	activePIDs := make(map[int]struct{}, len(agents))
 	for _, a := range agents {
 		if a.PID > 0 {
@@ -801,20 +1509,68 @@ func (tm *TokenMonitor) pruneState(agents []agent.Instance, now time.Time) {
 		if _, active := activePIDs[pid]; active {
 			continue
 		}
-		if now.Sub(lastSeen) > tokenStateTTL {
+		if now.Sub(lastSeen) > ttl {
 			delete(tm.prevBytesSeen, pid)
 			delete(tm.prevBytes, pid)
 		}
 	}
 
-	prunePathOffsetMap(tm.copilotLogOffsets, tm.copilotLogSeen, now)
-	prunePathOffsetMap(tm.claudeLogOffsets, tm.claudeLogSeen, now)
-	prunePathOffsetMap(tm.aiderLogOffsets, tm.aiderLogSeen, now)
+	activeIDs := make(map[string]struct{}, len(agents))
+	for _, a := range agents {
+		activeIDs[a.Info.ID] = struct{}{}
+	}
+	for id, last := range tm.termSeen {
+		if _, active := activeIDs[id]; !active && now.Sub(last) > ttl {
+			delete(tm.termSeen, id)
+		}
+	}
+	for id := range tm.rateSamples {
+		if _, active := activeIDs[id]; !active {
+			delete(tm.rateSamples, id)
+		}
+	}
+
+	prunePathOffsetMap(tm.copilotLogOffsets, tm.copilotLogSeen, now, ttl)
+	prunePathOffsetMap(tm.claudeLogOffsets, tm.claudeLogSeen, now, ttl)
+	prunePathOffsetMap(tm.aiderLogOffsets, tm.aiderLogSeen, now, ttl)
+	prunePathOffsetMap(tm.geminiFiles, tm.geminiFileSeen, now, ttl)
+	prunePathOffsetMap(tm.codexLogOffsets, tm.codexLogSeen, now, ttl)
+	prunePathOffsetMap(tm.codexLogModel, tm.codexLogSeen, now, ttl)
+}
+
+// tokenRateWindow is the span TokensPerSec is measured over.
+const tokenRateWindow = 60 * time.Second
+
+type tokenSample struct {
+	at     time.Time
+	tokens int64
+}
+
+// tokenRate records agentID's running token total at now and returns the
+// tokens per second across the samples taken in the last tokenRateWindow.
+// It is zero until two samples fall in the window, so history read on the
+// first Collect does not count as throughput.
+func (tm *TokenMonitor) tokenRate(agentID string, total int64, now time.Time) float64 {
+	samples := append(tm.rateSamples[agentID], tokenSample{at: now, tokens: total})
+	cutoff := now.Add(-tokenRateWindow)
+	i := 0
+	for i < len(samples)-1 && samples[i].at.Before(cutoff) {
+		i++
+	}
+	samples = samples[i:]
+	tm.rateSamples[agentID] = samples
+
+	first, last := samples[0], samples[len(samples)-1]
+	elapsed := last.at.Sub(first.at).Seconds()
+	if elapsed <= 0 || last.tokens <= first.tokens {
+		return 0
+	}
+	return float64(last.tokens-first.tokens) / elapsed
 }
 
-func prunePathOffsetMap(offsets map[string]int64, seen map[string]time.Time, now time.Time) {
+func prunePathOffsetMap[V any](offsets map[string]V, seen map[string]time.Time, now time.Time, ttl time.Duration) {
 	for path, lastSeen := range seen {
-		if now.Sub(lastSeen) > tokenStateTTL {
+		if now.Sub(lastSeen) > ttl {
 			delete(seen, path)
 			delete(offsets, path)
 		}
@@ -2,7 +2,11 @@ package monitor
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"testing"
 	"time"
 
@@ -222,3 +226,619 @@ func TestTokenConfidence(t *testing.T) {
 		}
 	}
 }
+
+func writeLogFixture(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseCopilotLog_SuccessErrorSplit(t *testing.T) {
+	log := `2026-03-10 10:00:00.000 [info] ccreq:abc123.copilotmd | success | gpt-4o -> gpt-4o-2024-11-20 | 812ms | [panel/editAgent]
+2026-03-10 10:00:05.000 [info] ccreq:abc124.copilotmd | error | gpt-4o -> gpt-4o-2024-11-20 | 95ms | [panel/editAgent]
+2026-03-10 10:00:09.000 [info] unrelated line
+2026-03-10 10:00:12.000 [info] ccreq:abc125.copilotmd | success | claude-sonnet-4 -> claude-sonnet-4 | 1500ms | [panel/editAgent]
+2026-03-10 10:00:20.000 [info] ccreq:abc126.copilotmd | error | claude-sonnet-4 -> claude-sonnet-4 | 40ms | [panel/editAgent]
+2026-03-10 10:00:25.000 [info] ccreq:abc127.copilotmd | success | gpt-4o -> gpt-4o-2024-11-20 | 700ms | [panel/editAgent]
+`
+	path := writeLogFixture(t, "GitHub Copilot Chat.log", log)
+	tm := NewTokenMonitor()
+	m := &agent.TokenMetrics{}
+
+	if n := tm.parseCopilotLog(path, m, nil); n != 5 {
+		t.Fatalf("parseCopilotLog = %d, want 5", n)
+	}
+	if m.RequestCount != 5 || m.SuccessCount != 3 || m.ErrorCount != 2 {
+		t.Errorf("requests=%d success=%d error=%d, want 5/3/2", m.RequestCount, m.SuccessCount, m.ErrorCount)
+	}
+	if got := m.ErrorRate(); got != 0.4 {
+		t.Errorf("ErrorRate = %v, want 0.4", got)
+	}
+
+	// Only new lines are counted on the next pass.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("2026-03-10 10:01:00.000 [info] ccreq:abc128.copilotmd | error | gpt-4o -> gpt-4o | 10ms |\n")
+	f.Close()
+	tm.parseCopilotLog(path, m, nil)
+	if m.SuccessCount != 3 || m.ErrorCount != 3 {
+		t.Errorf("after append success=%d error=%d, want 3/3", m.SuccessCount, m.ErrorCount)
+	}
+}
+
+func TestParseClaudeJSONL_SuccessErrorSplit(t *testing.T) {
+	log := `{"type":"user","message":{"role":"user","content":"hi"}}
+{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":100,"output_tokens":50}}}
+{"type":"assistant","isApiErrorMessage":true,"message":{"model":"<synthetic>","usage":{"input_tokens":0,"output_tokens":0}}}
+{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":200,"output_tokens":80}}}
+`
+	path := writeLogFixture(t, "session.jsonl", log)
+	tm := NewTokenMonitor()
+	m := &agent.TokenMetrics{}
+
+	tm.parseClaudeJSONL(path, m, nil)
+	if m.RequestCount != 3 || m.SuccessCount != 2 || m.ErrorCount != 1 {
+		t.Errorf("requests=%d success=%d error=%d, want 3/2/1", m.RequestCount, m.SuccessCount, m.ErrorCount)
+	}
+	if m.InputTokens != 300 || m.OutputTokens != 130 {
+		t.Errorf("tokens in=%d out=%d, want 300/130", m.InputTokens, m.OutputTokens)
+	}
+	if m.LastModel != "claude-sonnet-4" {
+		t.Errorf("LastModel = %q, error message must not override it", m.LastModel)
+	}
+}
+
+func TestTokenMonitor_SetHomeDir(t *testing.T) {
+	home := t.TempDir()
+	convDir := filepath.Join(home, ".claude", "projects", "demo", "conversations")
+	if err := os.MkdirAll(convDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	claudeLog := `{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":1000,"output_tokens":400}}}
+{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":500,"output_tokens":100}}}
+`
+	if err := os.WriteFile(filepath.Join(convDir, "s1.jsonl"), []byte(claudeLog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	aiderLog := "#### fix the bug\n> Tokens: 1200 sent, 300 received. Cost: $0.01 message\n"
+	if err := os.WriteFile(filepath.Join(home, ".aider.chat.history.md"), []byte(aiderLog), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(home)
+	agents := []agent.Instance{
+		{Info: agent.Info{ID: "claude-code"}},
+		{Info: agent.Info{ID: "aider"}},
+	}
+	tm.Collect(agents)
+
+	claude := agents[0].Tokens
+	if claude.InputTokens != 1500 || claude.OutputTokens != 500 || claude.RequestCount != 2 {
+		t.Errorf("claude tokens = %+v, want 1500 in / 500 out / 2 requests", claude)
+	}
+	if claude.Source != agent.TokenSourceLog || claude.LastModel != "claude-sonnet-4" {
+		t.Errorf("claude source=%q model=%q", claude.Source, claude.LastModel)
+	}
+
+	aider := agents[1].Tokens
+	if aider.InputTokens != 1200 || aider.OutputTokens != 300 || aider.Source != agent.TokenSourceLog {
+		t.Errorf("aider tokens = %+v, want 1200 in / 300 out from log", aider)
+	}
+
+	tm.SetHomeDir("")
+	if got, _ := tm.userHome(); got == home {
+		t.Error("SetHomeDir(\"\") should restore the default home")
+	}
+}
+
+func TestTokenMonitor_Probe(t *testing.T) {
+	tm := NewTokenMonitor()
+	if _, err := tm.Probe("claude-code"); err == nil {
+		t.Error("Probe before Collect should fail")
+	}
+	tm.data["claude-code"] = &agent.TokenMetrics{Source: agent.TokenSourceLog}
+	src, err := tm.Probe("claude-code")
+	if err != nil || src != agent.TokenSourceLog {
+		t.Errorf("Probe = %q, %v; want log, nil", src, err)
+	}
+}
+
+func TestResolveLogPaths(t *testing.T) {
+	noEnv := func(string) string { return "" }
+	home := filepath.FromSlash("/home/dev")
+
+	tests := []struct {
+		goos   string
+		getenv func(string) string
+		code   string
+		cursor string
+		claude []string
+	}{
+		{"darwin", noEnv,
+			"/home/dev/Library/Application Support/Code/logs",
+			"/home/dev/Library/Application Support/Cursor",
+			[]string{"/home/dev/.claude"}},
+		{"linux", noEnv,
+			"/home/dev/.config/Code/logs",
+			"/home/dev/.config/Cursor",
+			[]string{"/home/dev/.claude", "/home/dev/.config/claude"}},
+		{"linux", func(k string) string {
+			if k == "XDG_CONFIG_HOME" {
+				return filepath.FromSlash("/xdg")
+			}
+			return ""
+		},
+			"/xdg/Code/logs",
+			"/xdg/Cursor",
+			[]string{"/home/dev/.claude", "/xdg/claude"}},
+		{"windows", noEnv,
+			"/home/dev/AppData/Roaming/Code/logs",
+			"/home/dev/AppData/Roaming/Cursor",
+			[]string{"/home/dev/.claude"}},
+	}
+	for _, tt := range tests {
+		p := resolveLogPaths(home, tt.goos, tt.getenv)
+		if p.CodeLogs != filepath.FromSlash(tt.code) || p.CursorData != filepath.FromSlash(tt.cursor) {
+			t.Errorf("%s: code=%q cursor=%q", tt.goos, p.CodeLogs, p.CursorData)
+		}
+		var want []string
+		for _, d := range tt.claude {
+			want = append(want, filepath.FromSlash(d))
+		}
+		if !reflect.DeepEqual(p.ClaudeDirs, want) {
+			t.Errorf("%s: claude dirs = %q, want %q", tt.goos, p.ClaudeDirs, want)
+		}
+	}
+}
+
+func TestTokenMonitor_CopilotLogsPerPlatform(t *testing.T) {
+	log := "2026-03-10 10:00:00.000 [info] ccreq:abc.copilotmd | success | gpt-4o -> gpt-4o | 800ms |\n"
+	for goos, base := range map[string]string{
+		"linux":   filepath.Join(".config", "Code", "logs"),
+		"darwin":  filepath.Join("Library", "Application Support", "Code", "logs"),
+		"windows": filepath.Join("AppData", "Roaming", "Code", "logs"),
+	} {
+		home := t.TempDir()
+		dir := filepath.Join(home, base, "20260310T100000", "window1", "exthost", "GitHub.copilot-chat")
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "GitHub Copilot Chat.log"), []byte(log), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		tm := NewTokenMonitor()
+		tm.SetHomeDir(home)
+		tm.goos = goos
+		agents := []agent.Instance{{Info: agent.Info{ID: "copilot"}}}
+		tm.Collect(agents)
+		if got := agents[0].Tokens; got.RequestCount != 1 || got.Source != agent.TokenSourceLog {
+			t.Errorf("%s: tokens = %+v, want 1 request from log", goos, got)
+		}
+	}
+}
+
+func TestTokenMonitor_ClaudeLinuxLayout(t *testing.T) {
+	home := t.TempDir()
+	dir := filepath.Join(home, ".config", "claude", "projects", "-home-dev-app")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	line := `{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":700,"output_tokens":50}}}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "session.jsonl"), []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(home)
+	tm.goos = "linux"
+	agents := []agent.Instance{{Info: agent.Info{ID: "claude-code"}}}
+	tm.Collect(agents)
+	if got := agents[0].Tokens; got.InputTokens != 700 || got.Source != agent.TokenSourceLog {
+		t.Errorf("tokens = %+v, want 700 input from log", got)
+	}
+}
+
+func TestParseClaudeJSONL_CacheTokens(t *testing.T) {
+	log := `{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":12,"output_tokens":300,"cache_creation_input_tokens":20000,"cache_read_input_tokens":0}}}
+{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":8,"output_tokens":200,"cache_creation_input_tokens":500,"cache_read_input_tokens":20000}}}
+{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":0,"output_tokens":50,"cache_creation_input_tokens":0,"cache_read_input_tokens":20500}}}
+`
+	path := writeLogFixture(t, "cache.jsonl", log)
+	tm := NewTokenMonitor()
+	m := &agent.TokenMetrics{}
+
+	if n := tm.parseClaudeJSONL(path, m, nil); n != 3 {
+		t.Fatalf("parseClaudeJSONL = %d, want 3 (fully cached prompts still count)", n)
+	}
+	if m.InputTokens != 20 || m.OutputTokens != 550 {
+		t.Errorf("input/output = %d/%d, want 20/550", m.InputTokens, m.OutputTokens)
+	}
+	if m.CacheCreateTokens != 20500 || m.CacheReadTokens != 40500 {
+		t.Errorf("cache create/read = %d/%d, want 20500/40500", m.CacheCreateTokens, m.CacheReadTokens)
+	}
+	if m.TotalTokens != 570 {
+		t.Errorf("TotalTokens = %d, want 570 (cache tokens excluded)", m.TotalTokens)
+	}
+}
+
+func TestCollect_NetworkSourceSetsConfidence(t *testing.T) {
+	var total int64
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(t.TempDir())
+	tm.networkBytes = func(pid int) (int64, error) {
+		total += 40_000
+		return total, nil
+	}
+	agents := []agent.Instance{{Info: agent.Info{ID: "some-unknown-agent"}, PID: 4242}}
+
+	// The first sample only sets the byte baseline.
+	tm.Collect(agents)
+	tm.Collect(agents)
+
+	got := agents[0].Tokens
+	if got.Source != agent.TokenSourceNetwork {
+		t.Fatalf("Source = %q, want network", got.Source)
+	}
+	if got.Confidence != 0.60 {
+		t.Errorf("Confidence = %.2f, want 0.60", got.Confidence)
+	}
+	if got.OutputTokens != 10_000 {
+		t.Errorf("OutputTokens = %d, want 10000 (40KB / 4)", got.OutputTokens)
+	}
+}
+
+func TestParseLogs_TruncatedOrRotated(t *testing.T) {
+	claudeLine := func(in int) string {
+		return fmt.Sprintf(`{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":%d,"output_tokens":1}}}`+"\n", in)
+	}
+	copilotLine := "2026-03-10 10:00:00.000 [info] ccreq:a.copilotmd | success | gpt-4o -> gpt-4o | 10ms |\n"
+	aiderLine := "> Tokens: 100 sent, 10 received.\n"
+
+	tests := []struct {
+		name  string
+		first string
+		after string
+		parse func(tm *TokenMonitor, path string, m *agent.TokenMetrics)
+	}{
+		{
+			name:  "claude",
+			first: claudeLine(1000) + claudeLine(1000) + claudeLine(1000),
+			after: claudeLine(7),
+			parse: func(tm *TokenMonitor, path string, m *agent.TokenMetrics) { tm.parseClaudeJSONL(path, m, nil) },
+		},
+		{
+			name:  "copilot",
+			first: copilotLine + copilotLine + copilotLine,
+			after: copilotLine,
+			parse: func(tm *TokenMonitor, path string, m *agent.TokenMetrics) { tm.parseCopilotLog(path, m, nil) },
+		},
+		{
+			name:  "aider",
+			first: aiderLine + aiderLine + aiderLine,
+			after: aiderLine,
+			parse: func(tm *TokenMonitor, path string, m *agent.TokenMetrics) { tm.parseAiderHistory(path, m) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLogFixture(t, "log", tt.first)
+			tm := NewTokenMonitor()
+			m := &agent.TokenMetrics{}
+			tt.parse(tm, path, m)
+			if got := m.RequestCount; got != 3 {
+				t.Fatalf("first pass counted %d requests, want 3", got)
+			}
+
+			// Rotation: a new, shorter file appears at the same path.
+			if err := os.WriteFile(path, []byte(tt.after), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			tt.parse(tm, path, m)
+			if got := m.RequestCount; got != 4 {
+				t.Errorf("after rotation counted %d requests, want 4", got)
+			}
+		})
+	}
+}
+
+func TestTokenMonitor_Reset(t *testing.T) {
+	var total int64
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(t.TempDir())
+	tm.networkBytes = func(pid int) (int64, error) {
+		total += 4000
+		return total, nil
+	}
+	agents := []agent.Instance{
+		{Info: agent.Info{ID: "one"}, PID: 10},
+		{Info: agent.Info{ID: "two"}, PID: 20},
+	}
+	tm.Collect(agents)
+	tm.Collect(agents)
+	if tm.GetMetrics("one").TotalTokens == 0 || tm.GetMetrics("two").TotalTokens == 0 {
+		t.Fatal("expected tokens before Reset")
+	}
+
+	tm.Reset("one")
+	if got := tm.GetMetrics("one"); got.TotalTokens != 0 || got.Source != "" {
+		t.Errorf("after Reset GetMetrics(one) = %+v, want zero", got)
+	}
+	if _, ok := tm.prevBytes[10]; ok {
+		t.Error("Reset should drop the agent's network byte baseline")
+	}
+	if tm.GetMetrics("two").TotalTokens == 0 {
+		t.Error("Reset(one) must not touch other agents")
+	}
+
+	// The restarted agent starts a new baseline instead of inheriting the old one.
+	tm.Collect(agents[:1])
+	if got := tm.GetMetrics("one").TotalTokens; got != 0 {
+		t.Errorf("first Collect after Reset = %d tokens, want 0 (new baseline)", got)
+	}
+
+	if len(tm.rateSamples) == 0 {
+		t.Fatal("Collect recorded no rate samples")
+	}
+	tm.ResetAll()
+	if tm.GetMetrics("two").TotalTokens != 0 || len(tm.prevBytes) != 0 {
+		t.Error("ResetAll should clear every agent")
+	}
+	if len(tm.rateSamples) != 0 {
+		t.Errorf("ResetAll left rate samples for %d agents", len(tm.rateSamples))
+	}
+}
+
+func TestTokenMonitor_ResetZeroValue(t *testing.T) {
+	var tm TokenMonitor
+	tm.Reset("none")
+	tm.ResetAll()
+	if got := tm.GetMetrics("none"); got.TotalTokens != 0 {
+		t.Errorf("GetMetrics = %+v", got)
+	}
+}
+
+func TestTokenMonitor_GetModelBreakdown(t *testing.T) {
+	home := t.TempDir()
+	dir := filepath.Join(home, ".claude", "projects", "demo")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	log := `{"type":"assistant","message":{"model":"claude-opus-4","usage":{"input_tokens":1000,"output_tokens":200}}}
+{"type":"assistant","message":{"model":"claude-3-haiku","usage":{"input_tokens":4000,"output_tokens":100}}}
+{"type":"assistant","message":{"model":"claude-opus-4","usage":{"input_tokens":500,"output_tokens":300}}}
+{"type":"assistant","isApiErrorMessage":true,"message":{"model":"<synthetic>"}}
+`
+	if err := os.WriteFile(filepath.Join(dir, "s.jsonl"), []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(home)
+	agents := []agent.Instance{{Info: agent.Info{ID: "claude-code"}}}
+	tm.Collect(agents)
+
+	got := tm.GetModelBreakdown("claude-code")
+	if len(got) != 2 {
+		t.Fatalf("breakdown has %d models, want 2: %+v", len(got), got)
+	}
+	opus, haiku := got["claude-opus-4"], got["claude-3-haiku"]
+	if opus.InputTokens != 1500 || opus.OutputTokens != 500 || opus.RequestCount != 2 {
+		t.Errorf("opus = %+v, want 1500 in / 500 out / 2 requests", opus)
+	}
+	if haiku.InputTokens != 4000 || haiku.OutputTokens != 100 || haiku.RequestCount != 1 {
+		t.Errorf("haiku = %+v, want 4000 in / 100 out / 1 request", haiku)
+	}
+	if want := EstimateCost("claude-opus-4", 1500, 500); opus.EstCost != want {
+		t.Errorf("opus EstCost = %f, want %f", opus.EstCost, want)
+	}
+	if total := agents[0].Tokens; total.InputTokens != 5500 || total.RequestCount != 4 {
+		t.Errorf("agent totals = %+v, want 5500 in / 4 requests", total)
+	}
+
+	if len(tm.GetModelBreakdown("unknown")) != 0 {
+		t.Error("unknown agent should have an empty breakdown")
+	}
+	tm.Reset("claude-code")
+	if len(tm.GetModelBreakdown("claude-code")) != 0 {
+		t.Error("Reset should clear the breakdown")
+	}
+}
+
+func TestNewTokenMonitorWithTTL(t *testing.T) {
+	tm := NewTokenMonitorWithTTL(time.Second, time.Millisecond)
+	tm.SetHomeDir(t.TempDir())
+	tm.networkBytes = func(int) (int64, error) { return 0, nil }
+
+	tm.prevBytes[111] = 1000
+	tm.prevBytesSeen[111] = time.Now().Add(-2 * time.Second)
+	tm.prevBytes[222] = 2000
+	tm.prevBytesSeen[222] = time.Now()
+
+	tm.Collect(nil)
+	if _, ok := tm.prevBytes[111]; ok {
+		t.Error("PID 111 idle for 2s should be pruned with a 1s TTL")
+	}
+	if _, ok := tm.prevBytes[222]; !ok {
+		t.Error("recently seen PID 222 should be kept")
+	}
+
+	def := NewTokenMonitorWithTTL(0, 0)
+	def.prevBytes[333] = 1
+	def.prevBytesSeen[333] = time.Now().Add(-2 * time.Hour)
+	def.Collect(nil)
+	if _, ok := def.prevBytes[333]; !ok {
+		t.Error("zero TTL should fall back to the 24h default")
+	}
+}
+
+func TestEstablishedBytes(t *testing.T) {
+	conns := []agent.NetConnection{
+		{LocalAddr: "10.0.0.2:54321", RemoteAddr: "142.250.80.46:443", State: "ESTABLISHED", Protocol: "tcp"},
+		{LocalAddr: "10.0.0.2:54322", RemoteAddr: "142.250.80.46:443", State: "ESTABLISHED", Protocol: "tcp"},
+		{LocalAddr: "127.0.0.1:8080", State: "LISTEN", Protocol: "tcp"},
+		{LocalAddr: "10.0.0.2:54323", RemoteAddr: "1.1.1.1:443", State: "TIME_WAIT", Protocol: "tcp"},
+		{LocalAddr: "[::1]:5353", Protocol: "udp"},
+	}
+	if got := establishedBytes(conns); got != 2*bytesPerConnection {
+		t.Errorf("establishedBytes = %d, want %d", got, 2*bytesPerConnection)
+	}
+	if got := establishedBytes(nil); got != 0 {
+		t.Errorf("establishedBytes(nil) = %d, want 0", got)
+	}
+}
+
+func TestGetNetworkBytesForPID_IgnoresFileIO(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("/proc sockets are Linux-only")
+	}
+	pid := os.Getpid()
+	before, err := getNetworkBytesForPID(pid)
+	if err != nil {
+		t.Skipf("network bytes unavailable: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(path, make([]byte, 1<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := getNetworkBytesForPID(pid); after != before {
+		t.Errorf("network bytes went from %d to %d after file I/O only", before, after)
+	}
+}
+
+func TestTokenMonitor_GeminiSessionLog(t *testing.T) {
+	home := t.TempDir()
+	dir := filepath.Join(home, ".gemini", "tmp", "3f9a1c")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "session.json")
+	turn1 := `{"modelVersion":"gemini-2.5-pro","usageMetadata":{"promptTokenCount":1200,"candidatesTokenCount":300,"cachedContentTokenCount":200}}`
+	turn2 := `{"modelVersion":"gemini-2.5-pro","usageMetadata":{"promptTokenCount":1500,"candidatesTokenCount":100}}`
+	if err := os.WriteFile(path, []byte(`{"history":[`+turn1+`]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(home)
+	agents := []agent.Instance{{Info: agent.Info{ID: "gemini-cli"}}}
+	tm.Collect(agents)
+	got := agents[0].Tokens
+	if got.InputTokens != 1000 || got.OutputTokens != 300 || got.CacheReadTokens != 200 {
+		t.Errorf("tokens = %+v, want 1000 in / 300 out / 200 cached", got)
+	}
+	if got.Source != agent.TokenSourceLog || got.LastModel != "gemini-2.5-pro" {
+		t.Errorf("source = %q, model = %q, want log / gemini-2.5-pro", got.Source, got.LastModel)
+	}
+
+	// The CLI rewrites the whole file; only the new turn should be added.
+	if err := os.WriteFile(path, []byte(`{"history":[`+turn1+`,`+turn2+`]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tm.Collect(agents)
+	if got := agents[0].Tokens; got.RequestCount != 2 || got.InputTokens != 2500 || got.OutputTokens != 400 {
+		t.Errorf("after rewrite tokens = %+v, want 2 requests, 2500 in / 400 out", got)
+	}
+	tm.Collect(agents)
+	if got := agents[0].Tokens; got.RequestCount != 2 {
+		t.Errorf("unchanged file recounted: %d requests", got.RequestCount)
+	}
+}
+
+func TestTokenMonitor_CodexSessionLog(t *testing.T) {
+	home := t.TempDir()
+	dir := filepath.Join(home, ".codex", "sessions", "2026", "10", "16")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "rollout-2026-10-16T09-12-03-5f0c.jsonl")
+	session := `{"timestamp":"2026-10-16T09:12:03Z","type":"session_meta","payload":{"id":"5f0c","cwd":"/home/dev/app"}}
+{"timestamp":"2026-10-16T09:12:04Z","type":"turn_context","payload":{"cwd":"/home/dev/app","model":"gpt-5-codex"}}
+{"timestamp":"2026-10-16T09:12:09Z","type":"event_msg","payload":{"type":"token_count","info":null}}
+{"timestamp":"2026-10-16T09:12:10Z","type":"event_msg","payload":{"type":"token_count","info":{"total_token_usage":{"input_tokens":5000,"cached_input_tokens":3000,"output_tokens":400},"last_token_usage":{"input_tokens":5000,"cached_input_tokens":3000,"output_tokens":400}}}}
+`
+	if err := os.WriteFile(path, []byte(session), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(home)
+	agents := []agent.Instance{{Info: agent.Info{ID: "codex-cli"}}}
+	tm.Collect(agents)
+	got := agents[0].Tokens
+	if got.InputTokens != 2000 || got.CacheReadTokens != 3000 || got.OutputTokens != 400 || got.RequestCount != 1 {
+		t.Errorf("tokens = %+v, want 1 request, 2000 in / 3000 cached / 400 out", got)
+	}
+	if got.Source != agent.TokenSourceLog || got.LastModel != "gpt-5-codex" {
+		t.Errorf("source = %q, model = %q, want log / gpt-5-codex", got.Source, got.LastModel)
+	}
+
+	// Appending a turn counts only that turn, still under the earlier model.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"timestamp":"2026-10-16T09:13:00Z","type":"event_msg","payload":{"type":"token_count","info":{"total_token_usage":{"input_tokens":11000,"cached_input_tokens":8000,"output_tokens":600},"last_token_usage":{"input_tokens":6000,"cached_input_tokens":5000,"output_tokens":200}}}}` + "\n")
+	f.Close()
+	tm.Collect(agents)
+	if got := agents[0].Tokens; got.RequestCount != 2 || got.InputTokens != 3000 || got.OutputTokens != 600 {
+		t.Errorf("after append tokens = %+v, want 2 requests, 3000 in / 600 out", got)
+	}
+	if b := tm.GetModelBreakdown("codex-cli"); b["gpt-5-codex"].RequestCount != 2 {
+		t.Errorf("model breakdown = %+v, want 2 gpt-5-codex requests", b)
+	}
+}
+
+func TestTokenMonitor_TokensPerSecWindow(t *testing.T) {
+	home := t.TempDir()
+	dir := filepath.Join(home, ".claude", "projects", "-home-dev-app")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "session.jsonl")
+	line := `{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":400,"output_tokens":100}}}` + "\n"
+	if err := os.WriteFile(path, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	clock := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	tm := NewTokenMonitor()
+	tm.SetHomeDir(home)
+	tm.goos = "darwin"
+	tm.now = func() time.Time { return clock }
+	agents := []agent.Instance{{Info: agent.Info{ID: "claude-code"}}}
+
+	tm.Collect(agents)
+	if got := agents[0].Tokens.TokensPerSec; got != 0 {
+		t.Errorf("first batch rate = %v, want 0 (no earlier sample)", got)
+	}
+
+	// A second batch of 1000 tokens 10s later is 100 tokens/sec.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"type":"assistant","message":{"model":"claude-sonnet-4","usage":{"input_tokens":800,"output_tokens":200}}}` + "\n")
+	f.Close()
+	clock = clock.Add(10 * time.Second)
+	tm.Collect(agents)
+	if got := agents[0].Tokens.TokensPerSec; got != 100 {
+		t.Errorf("rate after second batch = %v, want 100", got)
+	}
+
+	// Once both batches are older than the window the rate drops to zero.
+	clock = clock.Add(2 * tokenRateWindow)
+	tm.Collect(agents)
+	if got := agents[0].Tokens.TokensPerSec; got != 0 {
+		t.Errorf("idle rate = %v, want 0", got)
+	}
+}